@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log"
+
+	"panopticon-scanner/internal/config"
+	"panopticon-scanner/internal/database"
+	"panopticon-scanner/internal/nvd"
+	"panopticon-scanner/internal/scanner"
+)
+
+// runCommand runs a one-off command given on the command line
+func runCommand(cfg *config.Config, db *database.DB, args []string) error {
+	switch args[0] {
+	case "import":
+		return runImport(cfg, db, args[1:])
+	case "import-nvd":
+		return runImportNVD(db, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// runImport imports scan result files, which may be gzipped. Every file is
+// attempted; an error is returned if any of them failed.
+func runImport(cfg *config.Config, db *database.DB, files []string) error {
+	if len(files) == 0 {
+		return errors.New("usage: panopticond import <file>...")
+	}
+
+	scanService := scanner.New(cfg, db)
+
+	failed := 0
+	for _, path := range files {
+		if err := importFile(scanService, path); err != nil {
+			log.Error().Err(err).Str("file", path).Msg("Import failed")
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed to import", failed, len(files))
+	}
+	return nil
+}
+
+// importFile imports a single result file and reports the scan it was stored as
+func importFile(scanService *scanner.ScanService, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scan, err := scanService.ImportScan(file, path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: imported as scan %d (%s, %d devices, %d ports)\n",
+		path, scan.ID, scan.Timestamp.Format("2006-01-02 15:04:05"), scan.DevicesFound, scan.PortsFound)
+	return nil
+}
+
+// runImportNVD imports NVD JSON feeds, which may be gzipped, and matches
+// every device against them. Feeds that cannot be read are skipped; an error
+// is returned if any of them failed.
+func runImportNVD(db *database.DB, files []string) error {
+	if len(files) == 0 {
+		return errors.New("usage: panopticond import-nvd <file>...")
+	}
+
+	var cves []*nvd.CVE
+	failed := 0
+	for _, path := range files {
+		feed, err := nvd.Load(path)
+		if err != nil {
+			log.Error().Err(err).Str("file", path).Msg("Import failed")
+			failed++
+			continue
+		}
+		cves = append(cves, feed...)
+	}
+
+	if len(cves) > 0 {
+		imported, findings, err := db.ImportVulnerabilities(cves)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("imported %d CVEs from %d files (%d unresolved findings)\n", imported, len(files)-failed, findings)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed to import", failed, len(files))
+	}
+	return nil
+}
@@ -21,6 +21,8 @@ import (
 	"panopticon-scanner/internal/api"
 	"panopticon-scanner/internal/config"
 	"panopticon-scanner/internal/database"
+	"panopticon-scanner/internal/events"
+	"panopticon-scanner/internal/maintenance"
 	"panopticon-scanner/internal/scanner"
 )
 
@@ -31,6 +33,14 @@ var logLevelFlag string
 func parseFlags() string {
 	configPath := flag.String("config", "configs/config.yaml", "Path to configuration file")
 	flag.StringVar(&logLevelFlag, "log-level", "info", "Log level (debug, info, warn, error)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Without a command the scanner service is started. Commands:")
+		fmt.Fprintln(flag.CommandLine.Output(), "  import <file>...      Import nmap, masscan, ZMap or Nessus results from scans run elsewhere")
+		fmt.Fprintln(flag.CommandLine.Output(), "  import-nvd <file>...  Import NVD JSON vulnerability feeds and match devices against them")
+		fmt.Fprintln(flag.CommandLine.Output(), "\nFlags:")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 	return *configPath
 }
@@ -66,14 +76,34 @@ func main() {
 	}
 	defer db.Close()
 
+	// Run a one-off command instead of the service if one was given
+	if args := flag.Args(); len(args) > 0 {
+		if err := runCommand(cfg, db, args); err != nil {
+			db.Close()
+			log.Fatal().Err(err).Str("command", args[0]).Msg("Command failed")
+		}
+		return
+	}
+
+	// Initialize event bus for real-time updates
+	eventBus := events.NewBus()
+	db.SetEventBus(eventBus)
+
 	// Initialize scan service
 	log.Info().Msg("Initializing scan service")
 	scanService := scanner.New(cfg, db)
+	scanService.SetEventBus(eventBus)
 
 	if err := scanService.Start(); err != nil {
 		log.Fatal().Err(err).Msg("Failed to start scan service")
 	}
 
+	// Start scheduled backups, optimization and retention cleanup
+	maintenanceService := maintenance.New(cfg, db, scanService)
+	if err := maintenanceService.Start(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to start maintenance service")
+	}
+
 	// Initialize router and API handlers
 	router := mux.NewRouter()
 
@@ -81,11 +111,23 @@ func main() {
 	scanHandler := api.NewScanHandler(scanService)
 	deviceHandler := api.NewDeviceHandler(db)
 	statusHandler := api.NewStatusHandler(db, scanService, cfg)
+	eventHandler := api.NewEventHandler(eventBus, cfg)
+	exclusionHandler := api.NewExclusionHandler(scanService)
+	scheduleHandler := api.NewScheduleHandler(scanService)
+	importHandler := api.NewImportHandler(scanService)
+	vulnerabilityHandler := api.NewVulnerabilityHandler(db)
+	certificateHandler := api.NewCertificateHandler(db)
 
 	// Register API routes
 	scanHandler.RegisterRoutes(router)
 	deviceHandler.RegisterRoutes(router)
 	statusHandler.RegisterRoutes(router)
+	eventHandler.RegisterRoutes(router)
+	exclusionHandler.RegisterRoutes(router)
+	scheduleHandler.RegisterRoutes(router)
+	importHandler.RegisterRoutes(router)
+	vulnerabilityHandler.RegisterRoutes(router)
+	certificateHandler.RegisterRoutes(router)
 
 	// Register static file server for the Electron UI
 	router.PathPrefix("/").Handler(http.FileServer(http.Dir("./ui/build")))
@@ -132,12 +174,19 @@ func main() {
 	)
 	defer shutdownCancel()
 
+	// Close event streams so open connections don't hold up the shutdown
+	eventBus.Close()
+
 	// Shutdown HTTP server
 	log.Info().Msg("Shutting down HTTP server")
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Error().Err(err).Msg("HTTP server shutdown failed")
 	}
 
+	// Stop maintenance, letting a running task finish
+	log.Info().Msg("Stopping maintenance service")
+	maintenanceService.Stop()
+
 	// Stop scan service
 	log.Info().Msg("Stopping scan service")
 	if err := scanService.Stop(); err != nil {
@@ -10,6 +10,9 @@ import (
 	"path/filepath"
 	"testing"
 	"time"
+
+	"panopticon-scanner/internal/config"
+	"panopticon-scanner/internal/database"
 )
 
 // TestMainStartup tests that the main program starts up correctly
@@ -200,3 +203,95 @@ func TestCommandLineArgs(t *testing.T) {
 	_ = parseFlags()
 	// This should log a warning but continue with default level
 }
+
+// TestRunImport tests the import command
+func TestRunImport(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "panopticon-import-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	cfg := config.GetConfig()
+	oldOutputDir := cfg.Scanner.OutputDir
+	cfg.Scanner.OutputDir = filepath.Join(tempDir, "scans")
+	defer func() { cfg.Scanner.OutputDir = oldOutputDir }()
+
+	db, err := database.New(filepath.Join(tempDir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	path := filepath.Join(tempDir, "scan.xml")
+	output := `<?xml version="1.0"?>
+<nmaprun scanner="nmap" start="1677664800">
+<host><status state="up"/><address addr="10.1.0.5" addrtype="ipv4"/></host>
+<runstats><finished time="1677664895" exit="success"/></runstats>
+</nmaprun>`
+	if err := os.WriteFile(path, []byte(output), 0644); err != nil {
+		t.Fatalf("Failed to write scan output: %v", err)
+	}
+
+	if err := runCommand(cfg, db, []string{"import", path}); err != nil {
+		t.Fatalf("Failed to import scan: %v", err)
+	}
+
+	if _, err := db.GetDeviceByIP("10.1.0.5"); err != nil {
+		t.Errorf("Imported device was not stored: %v", err)
+	}
+
+	// A second import of the same file and a missing file both fail
+	if err := runCommand(cfg, db, []string{"import", path, filepath.Join(tempDir, "missing.xml")}); err == nil {
+		t.Errorf("Expected error importing duplicate and missing files, got nil")
+	}
+
+	if err := runCommand(cfg, db, []string{"import"}); err == nil {
+		t.Errorf("Expected error for import without files, got nil")
+	}
+
+	if err := runCommand(cfg, db, []string{"export"}); err == nil {
+		t.Errorf("Expected error for unknown command, got nil")
+	}
+}
+
+// TestRunImportNVD tests the import-nvd command
+func TestRunImportNVD(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "panopticon-import-nvd-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	db, err := database.New(filepath.Join(tempDir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	path := filepath.Join(tempDir, "nvdcve.json")
+	feed := `{"vulnerabilities": [{"cve": {"id": "CVE-2023-38408", "configurations": [{"nodes": [{"cpeMatch": [
+		{"vulnerable": true, "criteria": "cpe:2.3:a:openbsd:openssh:*:*:*:*:*:*:*:*", "versionEndExcluding": "9.3"}]}]}]}}]}`
+	if err := os.WriteFile(path, []byte(feed), 0644); err != nil {
+		t.Fatalf("Failed to write feed: %v", err)
+	}
+
+	cfg := config.GetConfig()
+	if err := runCommand(cfg, db, []string{"import-nvd", path}); err != nil {
+		t.Fatalf("Failed to import feed: %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM vulnerabilities`).Scan(&count); err != nil || count != 1 {
+		t.Errorf("Expected 1 imported CVE, got %d: %v", count, err)
+	}
+
+	// A missing feed fails after the others are imported
+	if err := runCommand(cfg, db, []string{"import-nvd", path, filepath.Join(tempDir, "missing.json")}); err == nil {
+		t.Errorf("Expected error importing a missing feed, got nil")
+	}
+
+	if err := runCommand(cfg, db, []string{"import-nvd"}); err == nil {
+		t.Errorf("Expected error for import-nvd without files, got nil")
+	}
+}
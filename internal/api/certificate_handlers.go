@@ -0,0 +1,109 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+
+	"panopticon-scanner/internal/database"
+)
+
+// CertificateHandler handles the TLS certificate inventory
+type CertificateHandler struct {
+	db *database.DB
+}
+
+// NewCertificateHandler creates a new certificate handler
+func NewCertificateHandler(db *database.DB) *CertificateHandler {
+	return &CertificateHandler{
+		db: db,
+	}
+}
+
+// RegisterRoutes registers the certificate routes
+func (h *CertificateHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/api/certificates", h.getCertificates).Methods("GET")
+}
+
+// getCertificates returns the certificates ports currently present, soonest
+// to expire first. They can be filtered by device, port, text in the subject,
+// SANs or issuer, and by expiry; history includes certificates that have
+// been replaced.
+func (h *CertificateHandler) getCertificates(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "getCertificates").Logger()
+	query := r.URL.Query()
+
+	filter := database.CertificateFilter{
+		Query:           query.Get("q"),
+		IncludeReplaced: query.Get("history") == "true",
+		Limit:           100, // Default limit
+	}
+
+	if device := query.Get("device"); device != "" {
+		id, err := strconv.ParseInt(device, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid device ID", http.StatusBadRequest)
+			return
+		}
+		filter.DeviceID = id
+	}
+
+	if port := query.Get("port"); port != "" {
+		number, err := strconv.Atoi(port)
+		if err != nil || number < 1 || number > 65535 {
+			http.Error(w, "Invalid port", http.StatusBadRequest)
+			return
+		}
+		filter.PortNumber = number
+	}
+
+	if expiresWithin := query.Get("expiresWithin"); expiresWithin != "" {
+		within, err := parseExpiresWithin(expiresWithin)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.ExpiresBefore = time.Now().Add(within)
+	}
+
+	if limitParam := query.Get("limit"); limitParam != "" {
+		parsedLimit, err := strconv.Atoi(limitParam)
+		if err == nil && parsedLimit > 0 {
+			filter.Limit = parsedLimit
+		}
+	}
+
+	certs, err := h.db.GetCertificates(filter)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to retrieve certificates")
+		http.Error(w, "Failed to retrieve certificates", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, certs)
+}
+
+// parseExpiresWithin parses a period such as 30d, in days, or 12h, in any
+// unit time.ParseDuration accepts
+func parseExpiresWithin(value string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid expiresWithin %q: expected days such as 30d or a duration such as 12h", value)
+
+	if days := strings.TrimSuffix(value, "d"); days != value {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, invalid
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	within, err := time.ParseDuration(value)
+	if err != nil || within < 0 {
+		return 0, invalid
+	}
+	return within, nil
+}
@@ -0,0 +1,85 @@
+// internal/api/certificate_handlers_test.go
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"panopticon-scanner/internal/database"
+	"panopticon-scanner/internal/models"
+)
+
+// TestGetCertificates tests listing certificates with the expiresWithin filter
+func TestGetCertificates(t *testing.T) {
+	tempDir, _, db, _, _ := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	deviceID, err := db.SaveDevice(&models.Device{IPAddress: "10.1.0.7"})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	for port, expiresIn := range map[int]time.Duration{443: 10 * 24 * time.Hour, 8443: 200 * 24 * time.Hour} {
+		err := db.IngestCertificate(database.ScanContext{}, &models.Certificate{
+			DeviceID: deviceID, PortNumber: port, Protocol: "tcp", Subject: "CN=intranet.example.com",
+			NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(expiresIn), SHA256Fingerprint: "fp" + expiresIn.String(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to ingest certificate: %v", err)
+		}
+	}
+
+	router := mux.NewRouter()
+	NewCertificateHandler(db).RegisterRoutes(router)
+
+	tests := []struct {
+		query string
+		want  int
+		ports []int
+	}{
+		{"", http.StatusOK, []int{443, 8443}},
+		{"?expiresWithin=30d", http.StatusOK, []int{443}},
+		{"?expiresWithin=720h&port=8443", http.StatusOK, nil},
+		{"?q=intranet&port=8443", http.StatusOK, []int{8443}},
+		{"?expiresWithin=soon", http.StatusBadRequest, nil},
+		{"?expiresWithin=-5d", http.StatusBadRequest, nil},
+		{"?port=70000", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/certificates"+tt.query, nil))
+		if rr.Code != tt.want {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tt.query, rr.Code, tt.want)
+			continue
+		}
+		if tt.want != http.StatusOK {
+			continue
+		}
+
+		var certs []*models.Certificate
+		if err := json.Unmarshal(rr.Body.Bytes(), &certs); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		var ports []int
+		for _, cert := range certs {
+			ports = append(ports, cert.PortNumber)
+		}
+		if len(ports) != len(tt.ports) {
+			t.Errorf("%s: expected ports %v, got %v", tt.query, tt.ports, ports)
+			continue
+		}
+		for i := range ports {
+			if ports[i] != tt.ports[i] {
+				t.Errorf("%s: expected ports %v, got %v", tt.query, tt.ports, ports)
+				break
+			}
+		}
+	}
+}
@@ -2,13 +2,16 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"panopticon-scanner/internal/database"
@@ -30,17 +33,30 @@ func NewDeviceHandler(db *database.DB) *DeviceHandler {
 // RegisterRoutes registers the device routes
 func (h *DeviceHandler) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/api/devices", h.getDevices).Methods("GET")
-	r.HandleFunc("/api/devices/{id}", h.getDeviceDetail).Methods("GET")
+	r.HandleFunc("/api/devices/{id:[0-9]+}", h.getDeviceDetail).Methods("GET")
+	r.HandleFunc("/api/devices/{id:[0-9]+}/history", h.getDeviceHistory).Methods("GET")
+	r.HandleFunc("/api/devices/{id:[0-9]+}/addresses", h.getDeviceAddresses).Methods("GET")
+	r.HandleFunc("/api/devices/{id:[0-9]+}/merge", h.mergeDevices).Methods("POST")
+	r.HandleFunc("/api/devices/{id:[0-9]+}/split", h.splitDevice).Methods("POST")
+	r.HandleFunc("/api/devices/history", h.getInventoryHistory).Methods("GET")
 	r.HandleFunc("/api/devices/search", h.SearchDevices).Methods("GET")
 	r.HandleFunc("/api/devices/stats", h.GetDeviceStats).Methods("GET")
+	r.HandleFunc("/api/devices/scripts", h.searchScriptResults).Methods("GET")
 }
 
-// getDevices returns a list of all devices
+// getDevices returns a list of all devices, or of those whose vendor contains
+// the vendor query parameter
 func (h *DeviceHandler) getDevices(w http.ResponseWriter, r *http.Request) {
 	logger := log.With().Str("handler", "getDevices").Logger()
 
 	// Get all devices from database
-	devices, err := h.db.GetAllDevices()
+	var devices []*models.Device
+	var err error
+	if vendor := r.URL.Query().Get("vendor"); vendor != "" {
+		devices, err = h.db.GetDevicesByVendor(vendor)
+	} else {
+		devices, err = h.db.GetAllDevices()
+	}
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to retrieve devices")
 		http.Error(w, "Failed to retrieve devices", http.StatusInternalServerError)
@@ -88,6 +104,244 @@ func (h *DeviceHandler) getDeviceDetail(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// getDeviceHistory returns what scans found on a device over time, or with
+// "at" what the inventory held for it at that time
+func (h *DeviceHandler) getDeviceHistory(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "getDeviceHistory").Logger()
+
+	idStr := mux.Vars(r)["id"]
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		logger.Error().Err(err).Str("id", idStr).Msg("Invalid device ID")
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.db.GetDevice(id); err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("at") != "" {
+		at, err := parseTimeParam(query.Get("at"), true)
+		if err != nil {
+			http.Error(w, "Invalid at time: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		observation, err := h.db.GetDeviceObservationAt(id, at)
+		if err != nil {
+			logger.Error().Err(err).Int64("id", id).Msg("Failed to retrieve device history")
+			http.Error(w, "Failed to retrieve device history", http.StatusInternalServerError)
+			return
+		}
+		if observation == nil {
+			http.Error(w, "Device had not been observed by then", http.StatusNotFound)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, observation)
+		return
+	}
+
+	var from, to time.Time
+	if value := query.Get("from"); value != "" {
+		if from, err = parseTimeParam(value, false); err != nil {
+			http.Error(w, "Invalid from time: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if to, err = parseTimeParam(value, true); err != nil {
+			http.Error(w, "Invalid to time: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := 100 // Default limit
+	if limitParam := query.Get("limit"); limitParam != "" {
+		parsedLimit, err := strconv.Atoi(limitParam)
+		if err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	observations, err := h.db.GetDeviceHistory(id, from, to, limit)
+	if err != nil {
+		logger.Error().Err(err).Int64("id", id).Msg("Failed to retrieve device history")
+		http.Error(w, "Failed to retrieve device history", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, observations)
+}
+
+// getDeviceAddresses returns every address a device has been seen at
+func (h *DeviceHandler) getDeviceAddresses(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "getDeviceAddresses").Logger()
+
+	idStr := mux.Vars(r)["id"]
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		logger.Error().Err(err).Str("id", idStr).Msg("Invalid device ID")
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.db.GetDevice(id); err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	addresses, err := h.db.GetDeviceAddressHistory(id)
+	if err != nil {
+		logger.Error().Err(err).Int64("id", id).Msg("Failed to retrieve device addresses")
+		http.Error(w, "Failed to retrieve device addresses", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, addresses)
+}
+
+// mergeDevicesRequest lists the devices to merge into another
+type mergeDevicesRequest struct {
+	DeviceIDs []int64 `json:"deviceIds"`
+}
+
+// mergeDevices merges devices that are the same host into the device
+func (h *DeviceHandler) mergeDevices(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "mergeDevices").Logger()
+
+	idStr := mux.Vars(r)["id"]
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		logger.Error().Err(err).Str("id", idStr).Msg("Invalid device ID")
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+
+	var req mergeDevicesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.MergeDevices(id, req.DeviceIDs); err != nil {
+		h.writeIdentityError(w, logger, err, "Failed to merge devices")
+		return
+	}
+
+	logger.Info().Int64("id", id).Ints64("merged", req.DeviceIDs).Msg("Merged devices")
+
+	h.writeDeviceDetails(w, logger, http.StatusOK, id)
+}
+
+// splitDeviceRequest describes the device to split from another
+type splitDeviceRequest struct {
+	Addresses  []string `json:"addresses"`
+	MACAddress string   `json:"macAddress"`
+	Hostname   string   `json:"hostname"`
+}
+
+// splitDevice moves addresses wrongly attributed to the device to a new device
+func (h *DeviceHandler) splitDevice(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "splitDevice").Logger()
+
+	idStr := mux.Vars(r)["id"]
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		logger.Error().Err(err).Str("id", idStr).Msg("Invalid device ID")
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+
+	var req splitDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	newID, err := h.db.SplitDevice(id, req.Addresses, req.MACAddress, req.Hostname)
+	if err != nil {
+		h.writeIdentityError(w, logger, err, "Failed to split device")
+		return
+	}
+
+	logger.Info().Int64("id", id).Int64("newId", newID).Strs("addresses", req.Addresses).Msg("Split device")
+
+	h.writeDeviceDetails(w, logger, http.StatusCreated, newID)
+}
+
+// writeIdentityError responds to a failed merge or split
+func (h *DeviceHandler) writeIdentityError(w http.ResponseWriter, logger zerolog.Logger, err error, message string) {
+	switch {
+	case errors.Is(err, database.ErrInvalidIdentityChange):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Device not found", http.StatusNotFound)
+	default:
+		logger.Error().Err(err).Msg(message)
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+// writeDeviceDetails responds with a device and its ports
+func (h *DeviceHandler) writeDeviceDetails(w http.ResponseWriter, logger zerolog.Logger, status int, id int64) {
+	details, err := h.db.GetDeviceDetails(id)
+	if err != nil {
+		logger.Error().Err(err).Int64("id", id).Msg("Failed to retrieve device details")
+		http.Error(w, "Failed to retrieve device details", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, logger, status, details)
+}
+
+// getInventoryHistory returns the inventory as it stood at a point in time
+func (h *DeviceHandler) getInventoryHistory(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "getInventoryHistory").Logger()
+
+	value := r.URL.Query().Get("at")
+	if value == "" {
+		http.Error(w, "Missing at parameter", http.StatusBadRequest)
+		return
+	}
+
+	at, err := parseTimeParam(value, true)
+	if err != nil {
+		http.Error(w, "Invalid at time: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	inventory, err := h.db.GetInventoryAt(at)
+	if err != nil {
+		logger.Error().Err(err).Time("at", at).Msg("Failed to reconstruct inventory")
+		http.Error(w, "Failed to reconstruct inventory", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, inventory)
+}
+
+// parseTimeParam parses a time given as RFC 3339 or as a date. A date stands
+// for the start of the day, or for its end if endOfDay is set, so that
+// "at=2024-03-03" includes every scan made that day.
+func parseTimeParam(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not an RFC 3339 time or YYYY-MM-DD date", value)
+	}
+	if endOfDay {
+		return day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+	return day, nil
+}
+
 // SearchDevices searches for devices based on query parameters
 func (h *DeviceHandler) SearchDevices(w http.ResponseWriter, r *http.Request) {
 	logger := log.With().Str("handler", "searchDevices").Logger()
@@ -117,9 +371,41 @@ func (h *DeviceHandler) SearchDevices(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// GetDeviceStats returns statistics about devices in the network
+// searchScriptResults searches NSE script output across all devices
+func (h *DeviceHandler) searchScriptResults(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "searchScriptResults").Logger()
+
+	query := r.URL.Query().Get("q")
+	scriptID := r.URL.Query().Get("script")
+	if query == "" && scriptID == "" {
+		http.Error(w, "Missing q or script parameter", http.StatusBadRequest)
+		return
+	}
+
+	limit := 100 // Default limit
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsedLimit, err := strconv.Atoi(limitParam)
+		if err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	results, err := h.db.SearchScriptResults(query, scriptID, limit)
+	if err != nil {
+		logger.Error().Err(err).Str("query", query).Msg("Failed to search script results")
+		http.Error(w, "Failed to search script results", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, results)
+}
+
+// GetDeviceStats returns statistics about devices in the network. The vendor
+// query parameter restricts the OS, port and service breakdowns to devices
+// whose vendor contains it.
 func (h *DeviceHandler) GetDeviceStats(w http.ResponseWriter, r *http.Request) {
 	logger := log.With().Str("handler", "getDeviceStats").Logger()
+	vendor := r.URL.Query().Get("vendor")
 
 	// Get database stats
 	dbStats, err := h.db.GetDatabaseStats()
@@ -131,17 +417,28 @@ func (h *DeviceHandler) GetDeviceStats(w http.ResponseWriter, r *http.Request) {
 
 	// Build response with network statistics
 	stats := models.NetworkStats{
-		TotalDevices: dbStats["deviceCount"].(int),
-		TotalPorts:   dbStats["portCount"].(int),
+		TotalDevices:   dbStats["deviceCount"].(int),
+		TotalPorts:     dbStats["portCount"].(int),
+		ClosedPorts:    dbStats["closedPorts"].(int),
+		OfflineDevices: dbStats["offlineDevices"].(int),
+		RandomizedMACs: dbStats["randomizedMacs"].(int),
+		ActiveVulnerabilities: dbStats["activeVulnerabilities"].(int),
 	}
 
 	// Include OS distribution if available
-	if osDistribution, ok := dbStats["osDistribution"].(map[string]int); ok {
+	if vendor != "" {
+		osDistribution, err := h.db.GetOSDistribution(vendor)
+		if err != nil {
+			logger.Warn().Err(err).Msg("Failed to get OS distribution")
+		} else {
+			stats.OSDistribution = osDistribution
+		}
+	} else if osDistribution, ok := dbStats["osDistribution"].(map[string]int); ok {
 		stats.OSDistribution = osDistribution
 	}
 
 	// Calculate port distribution
-	portDistribution, err := h.getPortDistribution()
+	portDistribution, err := h.getPortDistribution(vendor)
 	if err != nil {
 		logger.Warn().Err(err).Msg("Failed to get port distribution")
 	} else {
@@ -149,13 +446,21 @@ func (h *DeviceHandler) GetDeviceStats(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Calculate service distribution
-	serviceDistribution, err := h.getServiceDistribution()
+	serviceDistribution, err := h.getServiceDistribution(vendor)
 	if err != nil {
 		logger.Warn().Err(err).Msg("Failed to get service distribution")
 	} else {
 		stats.ServiceDistribution = serviceDistribution
 	}
 
+	// Calculate vendor distribution
+	vendorDistribution, err := h.getVendorDistribution()
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to get vendor distribution")
+	} else {
+		stats.VendorDistribution = vendorDistribution
+	}
+
 	// Get new devices in the last 24 hours
 	newDevices, err := h.getNewDevicesCount(24 * time.Hour)
 	if err != nil {
@@ -179,8 +484,13 @@ func (h *DeviceHandler) GetDeviceStats(w http.ResponseWriter, r *http.Request) {
 		"osDistribution":     stats.OSDistribution,
 		"portDistribution":   stats.PortDistribution,
 		"serviceDistribution": stats.ServiceDistribution,
+		"vendorDistribution": stats.VendorDistribution,
 		"newDevices":         stats.NewDevices,
 		"changedDevices":     stats.ChangedDevices,
+		"closedPorts":        stats.ClosedPorts,
+		"offlineDevices":     stats.OfflineDevices,
+		"randomizedMacs":     stats.RandomizedMACs,
+		"activeVulnerabilities": stats.ActiveVulnerabilities,
 		"lastScanTime":       dbStats["lastScanTime"],
 		"generatedAt":        time.Now(),
 	}
@@ -196,17 +506,29 @@ func (h *DeviceHandler) GetDeviceStats(w http.ResponseWriter, r *http.Request) {
 
 // Helper methods for statistics
 
+// vendorFilter returns a condition on device_id, and its arguments, that
+// selects the devices whose vendor contains the given text, or selects every
+// device if it is empty
+func vendorFilter(vendor string) (string, []interface{}) {
+	if vendor == "" {
+		return "1 = 1", nil
+	}
+	return "device_id IN (SELECT id FROM devices WHERE vendor LIKE ?)", []interface{}{"%" + vendor + "%"}
+}
+
 // getPortDistribution returns the distribution of ports across devices
-func (h *DeviceHandler) getPortDistribution() (map[int]int, error) {
+func (h *DeviceHandler) getPortDistribution(vendor string) (map[int]int, error) {
 	portDistribution := make(map[int]int)
 	
+	filter, args := vendorFilter(vendor)
 	rows, err := h.db.Query(`
 		SELECT port_number, COUNT(*) as count
 		FROM ports
+		WHERE state <> 'closed' AND `+filter+`
 		GROUP BY port_number
 		ORDER BY count DESC
 		LIMIT 10
-	`)
+	`, args...)
 	
 	if err != nil {
 		return nil, fmt.Errorf("failed to query port distribution: %w", err)
@@ -229,17 +551,18 @@ func (h *DeviceHandler) getPortDistribution() (map[int]int, error) {
 }
 
 // getServiceDistribution returns the distribution of services across devices
-func (h *DeviceHandler) getServiceDistribution() (map[string]int, error) {
+func (h *DeviceHandler) getServiceDistribution(vendor string) (map[string]int, error) {
 	serviceDistribution := make(map[string]int)
 	
+	filter, args := vendorFilter(vendor)
 	rows, err := h.db.Query(`
 		SELECT service_name, COUNT(*) as count
 		FROM ports
-		WHERE service_name <> ''
+		WHERE service_name <> '' AND state <> 'closed' AND `+filter+`
 		GROUP BY service_name
 		ORDER BY count DESC
 		LIMIT 10
-	`)
+	`, args...)
 	
 	if err != nil {
 		return nil, fmt.Errorf("failed to query service distribution: %w", err)
@@ -265,6 +588,40 @@ func (h *DeviceHandler) getServiceDistribution() (map[string]int, error) {
 	return serviceDistribution, nil
 }
 
+// getVendorDistribution returns the distribution of vendors across devices
+func (h *DeviceHandler) getVendorDistribution() (map[string]int, error) {
+	vendorDistribution := make(map[string]int)
+
+	rows, err := h.db.Query(`
+		SELECT vendor, COUNT(*) as count
+		FROM devices
+		WHERE vendor <> ''
+		GROUP BY vendor
+		ORDER BY count DESC
+		LIMIT 10
+	`)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vendor distribution: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var vendor string
+		var count int
+		if err := rows.Scan(&vendor, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan vendor distribution row: %w", err)
+		}
+		vendorDistribution[vendor] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating vendor distribution rows: %w", err)
+	}
+
+	return vendorDistribution, nil
+}
+
 // getNewDevicesCount returns the count of new devices discovered within the given duration
 func (h *DeviceHandler) getNewDevicesCount(duration time.Duration) (int, error) {
 	var count int
@@ -291,7 +648,7 @@ func (h *DeviceHandler) getChangedDevicesCount(duration time.Duration) (int, err
 	err := h.db.QueryRow(`
 		SELECT COUNT(DISTINCT device_id) 
 		FROM changes 
-		WHERE timestamp > ? AND change_type IN ('device_change', 'port_change')
+		WHERE timestamp > ? AND change_type IN ('device_change', 'port_change', 'port_state_change', 'port_closed')
 	`, cutoff).Scan(&count)
 	
 	if err != nil {
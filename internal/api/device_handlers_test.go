@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -398,6 +399,236 @@ func TestSearchDevices(t *testing.T) {
 	}
 }
 
+// TestSearchDevicesIPv6 tests finding dual-stack devices by IPv6 address through the router
+func TestSearchDevicesIPv6(t *testing.T) {
+	tempDir, _, db, _, _ := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	deviceID, err := db.SaveDevice(&models.Device{IPAddress: "192.168.1.100", MACAddress: "00:11:22:33:44:55", Hostname: "webserver"})
+	if err != nil {
+		t.Fatalf("Failed to create test device: %v", err)
+	}
+	if _, err := db.SaveDevice(&models.Device{IPAddress: "2001:db8::100", MACAddress: "00:11:22:33:44:55"}); err != nil {
+		t.Fatalf("Failed to add IPv6 address: %v", err)
+	}
+
+	router := mux.NewRouter()
+	NewDeviceHandler(db).RegisterRoutes(router)
+
+	req := httptest.NewRequest("GET", "/api/devices/search?q=2001:0db8:0000:0000:0000:0000:0000:0100", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Search returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var results []models.Device
+	if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+		t.Fatalf("Failed to parse search response: %v", err)
+	}
+
+	if len(results) != 1 || results[0].ID != deviceID {
+		t.Fatalf("Expected the dual-stack device, got %+v", results)
+	}
+
+	req = httptest.NewRequest("GET", fmt.Sprintf("/api/devices/%d", deviceID), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var details models.DeviceDetails
+	if err := json.Unmarshal(rr.Body.Bytes(), &details); err != nil {
+		t.Fatalf("Failed to parse device response: %v", err)
+	}
+
+	if len(details.Addresses) != 2 || details.Addresses[0] != "192.168.1.100" || details.Addresses[1] != "2001:db8::100" {
+		t.Errorf("Expected both addresses in device details, got %v", details.Addresses)
+	}
+}
+
+// TestSearchScriptResults tests searching NSE script output
+func TestSearchScriptResults(t *testing.T) {
+	tempDir, _, db, _, _ := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	deviceID, err := db.SaveDevice(&models.Device{IPAddress: "192.168.1.30", MACAddress: "00:11:22:33:44:30"})
+	if err != nil {
+		t.Fatalf("Failed to create test device: %v", err)
+	}
+	if err := db.SaveScriptResult(&models.ScriptResult{DeviceID: deviceID, ScriptID: "smb-os-discovery", Output: "OS: Windows Server 2019"}); err != nil {
+		t.Fatalf("Failed to save script result: %v", err)
+	}
+
+	router := mux.NewRouter()
+	NewDeviceHandler(db).RegisterRoutes(router)
+
+	req := httptest.NewRequest("GET", "/api/devices/scripts?q=Windows&script=smb-os-discovery", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Script search returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var results []models.ScriptResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if len(results) != 1 || results[0].DeviceID != deviceID || results[0].IPAddress != "192.168.1.30" {
+		t.Errorf("Unexpected script search results: %+v", results)
+	}
+
+	req = httptest.NewRequest("GET", "/api/devices/scripts", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Script search without parameters returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// TestDeviceHistory tests reading a device's history and past inventory
+func TestDeviceHistory(t *testing.T) {
+	tempDir, _, db, _, _ := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	deviceID, err := db.SaveDevice(&models.Device{IPAddress: "10.0.0.5"})
+	if err != nil {
+		t.Fatalf("Failed to create test device: %v", err)
+	}
+
+	for i, ports := range [][]*models.PortObservation{
+		{{PortNumber: 22, Protocol: "tcp", State: "open"}, {PortNumber: 80, Protocol: "tcp", State: "open"}},
+		{{PortNumber: 22, Protocol: "tcp", State: "open"}},
+	} {
+		scanID, err := db.CreateScan("default")
+		if err != nil {
+			t.Fatalf("Failed to create scan: %v", err)
+		}
+		err = db.SaveHostObservation(&models.HostObservation{
+			ScanID: scanID, DeviceID: deviceID, IPAddress: "10.0.0.5", Ports: ports,
+			ObservedAt: time.Date(2024, 3, 2+2*i, 12, 0, 0, 0, time.Local),
+		})
+		if err != nil {
+			t.Fatalf("Failed to save observation: %v", err)
+		}
+	}
+
+	router := mux.NewRouter()
+	NewDeviceHandler(db).RegisterRoutes(router)
+
+	get := func(url string, wantStatus int, v interface{}) {
+		t.Helper()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", url, nil))
+		if rr.Code != wantStatus {
+			t.Fatalf("GET %s returned wrong status code: got %v want %v", url, rr.Code, wantStatus)
+		}
+		if v != nil {
+			if err := json.Unmarshal(rr.Body.Bytes(), v); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+		}
+	}
+
+	var history []models.HostObservation
+	get(fmt.Sprintf("/api/devices/%d/history", deviceID), http.StatusOK, &history)
+	if len(history) != 2 || len(history[0].Ports) != 1 || len(history[1].Ports) != 2 {
+		t.Errorf("Expected 2 observations newest first, got %+v", history)
+	}
+
+	get(fmt.Sprintf("/api/devices/%d/history?from=2024-03-03", deviceID), http.StatusOK, &history)
+	if len(history) != 1 {
+		t.Errorf("Expected 1 observation from March 3rd, got %d", len(history))
+	}
+
+	// What was open on March 3rd
+	var observation models.HostObservation
+	get(fmt.Sprintf("/api/devices/%d/history?at=2024-03-03", deviceID), http.StatusOK, &observation)
+	if len(observation.Ports) != 2 {
+		t.Errorf("Expected 2 ports open on March 3rd, got %+v", observation.Ports)
+	}
+
+	get(fmt.Sprintf("/api/devices/%d/history?at=2024-03-01", deviceID), http.StatusNotFound, nil)
+	get(fmt.Sprintf("/api/devices/%d/history?at=yesterday", deviceID), http.StatusBadRequest, nil)
+	get("/api/devices/9999/history", http.StatusNotFound, nil)
+
+	var inventory []models.HostObservation
+	get("/api/devices/history?at=2024-03-04", http.StatusOK, &inventory)
+	if len(inventory) != 1 || len(inventory[0].Ports) != 1 {
+		t.Errorf("Expected the latest observation in the inventory, got %+v", inventory)
+	}
+
+	get("/api/devices/history", http.StatusBadRequest, nil)
+}
+
+// TestDeviceIdentityHandlers tests address history and merging and splitting
+// devices
+func TestDeviceIdentityHandlers(t *testing.T) {
+	tempDir, _, db, _, _ := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	laptop, err := db.SaveDevice(&models.Device{IPAddress: "10.0.0.5", MACAddress: "00:11:22:33:44:05"})
+	if err != nil {
+		t.Fatalf("Failed to create test device: %v", err)
+	}
+	if _, err := db.SaveDevice(&models.Device{IPAddress: "10.0.0.6", MACAddress: "00:11:22:33:44:05"}); err != nil {
+		t.Fatalf("Failed to move test device: %v", err)
+	}
+	duplicate, err := db.SaveDevice(&models.Device{IPAddress: "10.0.0.7", Hostname: "laptop"})
+	if err != nil {
+		t.Fatalf("Failed to create test device: %v", err)
+	}
+
+	router := mux.NewRouter()
+	NewDeviceHandler(db).RegisterRoutes(router)
+
+	request := func(method, url, body string, wantStatus int, v interface{}) {
+		t.Helper()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, url, strings.NewReader(body)))
+		if rr.Code != wantStatus {
+			t.Fatalf("%s %s returned wrong status code: got %v want %v (%s)", method, url, rr.Code, wantStatus, rr.Body.String())
+		}
+		if v != nil {
+			if err := json.Unmarshal(rr.Body.Bytes(), v); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+		}
+	}
+
+	var addresses []models.DeviceAddress
+	request("GET", fmt.Sprintf("/api/devices/%d/addresses", laptop), "", http.StatusOK, &addresses)
+	if len(addresses) != 2 {
+		t.Errorf("Expected the laptop's 2 addresses, got %+v", addresses)
+	}
+	request("GET", "/api/devices/9999/addresses", "", http.StatusNotFound, nil)
+
+	var merged models.DeviceDetails
+	request("POST", fmt.Sprintf("/api/devices/%d/merge", laptop), fmt.Sprintf(`{"deviceIds": [%d]}`, duplicate), http.StatusOK, &merged)
+	if merged.ID != laptop || merged.Hostname != "laptop" || len(merged.Addresses) != 3 {
+		t.Errorf("Expected the duplicate merged into the laptop, got %+v", merged.Device)
+	}
+	request("POST", fmt.Sprintf("/api/devices/%d/merge", laptop), fmt.Sprintf(`{"deviceIds": [%d]}`, laptop), http.StatusBadRequest, nil)
+	request("POST", fmt.Sprintf("/api/devices/%d/merge", laptop), `{"deviceIds": [9999]}`, http.StatusNotFound, nil)
+	request("POST", fmt.Sprintf("/api/devices/%d/merge", laptop), `not json`, http.StatusBadRequest, nil)
+
+	var split models.DeviceDetails
+	request("POST", fmt.Sprintf("/api/devices/%d/split", laptop), `{"addresses": ["10.0.0.7"], "hostname": "desktop"}`, http.StatusCreated, &split)
+	if split.ID == laptop || split.IPAddress != "10.0.0.7" || split.Hostname != "desktop" {
+		t.Errorf("Unexpected split device: %+v", split.Device)
+	}
+	request("POST", fmt.Sprintf("/api/devices/%d/split", laptop), `{"addresses": ["10.0.0.99"]}`, http.StatusBadRequest, nil)
+	request("POST", "/api/devices/9999/split", `{"addresses": ["10.0.0.5"]}`, http.StatusNotFound, nil)
+}
+
 // TestGetDeviceStats tests the getDeviceStats handler
 func TestGetDeviceStats(t *testing.T) {
 	tempDir, _, db, _, _ := setupTestEnvironment(t)
@@ -472,3 +703,71 @@ func TestGetDeviceStats(t *testing.T) {
 		}
 	}
 }
+
+// TestDeviceVendorFilters tests filtering devices and the statistics
+// breakdowns by vendor
+func TestDeviceVendorFilters(t *testing.T) {
+	tempDir, _, db, _, _ := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	for _, device := range []*models.Device{
+		{IPAddress: "10.0.0.1", MACAddress: "00:00:0C:00:00:01", Vendor: "Cisco Systems, Inc", OSFingerprint: "IOS"},
+		{IPAddress: "10.0.0.2", MACAddress: "00:00:0C:00:00:02", Vendor: "Cisco Systems, Inc", OSFingerprint: "IOS"},
+		{IPAddress: "10.0.0.3", MACAddress: "3C:5A:B4:00:00:03", Vendor: "Google, Inc.", OSFingerprint: "Android"},
+		{IPAddress: "10.0.0.4", MACAddress: "DA:A1:19:0B:2C:3D"},
+	} {
+		deviceID, err := db.SaveDevice(device)
+		if err != nil {
+			t.Fatalf("Failed to create test device: %v", err)
+		}
+		if err := db.SavePort(&models.Port{DeviceID: deviceID, PortNumber: 22, Protocol: "tcp", ServiceName: "ssh"}); err != nil {
+			t.Fatalf("Failed to create test port: %v", err)
+		}
+	}
+
+	router := mux.NewRouter()
+	NewDeviceHandler(db).RegisterRoutes(router)
+
+	get := func(url string, v interface{}) {
+		t.Helper()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", url, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s returned wrong status code: got %v want %v", url, rr.Code, http.StatusOK)
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), v); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+	}
+
+	var devices []models.Device
+	get("/api/devices?vendor=cisco", &devices)
+	if len(devices) != 2 || devices[0].Vendor != "Cisco Systems, Inc" {
+		t.Errorf("Expected the 2 Cisco devices, got %+v", devices)
+	}
+
+	get("/api/devices", &devices)
+	randomized := 0
+	for _, device := range devices {
+		if device.RandomizedMAC {
+			randomized++
+		}
+	}
+	if len(devices) != 4 || randomized != 1 {
+		t.Errorf("Expected 4 devices, 1 with a randomized MAC address, got %+v", devices)
+	}
+
+	var stats models.NetworkStats
+	get("/api/devices/stats", &stats)
+	if stats.VendorDistribution["Cisco Systems, Inc"] != 2 || stats.VendorDistribution["Google, Inc."] != 1 || stats.RandomizedMACs != 1 {
+		t.Errorf("Unexpected vendor statistics: %+v and %d randomized", stats.VendorDistribution, stats.RandomizedMACs)
+	}
+
+	var google models.NetworkStats
+	get("/api/devices/stats?vendor=google", &google)
+	if len(google.OSDistribution) != 1 || google.OSDistribution["Android"] != 1 || google.ServiceDistribution["ssh"] != 1 || google.PortDistribution[22] != 1 {
+		t.Errorf("Expected breakdowns of the Google device only, got %+v", google)
+	}
+}
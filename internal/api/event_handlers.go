@@ -0,0 +1,331 @@
+// internal/api/event_handlers.go
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+
+	"panopticon-scanner/internal/config"
+	"panopticon-scanner/internal/events"
+)
+
+const (
+	// eventBufferSize is the number of events held per client before events are dropped
+	eventBufferSize = 64
+
+	// eventHeartbeatInterval is how often idle streams are kept alive
+	eventHeartbeatInterval = 15 * time.Second
+
+	// eventWriteTimeout disconnects WebSocket clients that stop reading
+	eventWriteTimeout = 10 * time.Second
+
+	// sseRetryMillis tells EventSource clients how soon to reconnect
+	sseRetryMillis = 3000
+)
+
+// EventHandler streams bus events to clients over Server-Sent Events and WebSocket
+type EventHandler struct {
+	bus            *events.Bus
+	allowedOrigins []string
+	streamTimeout  time.Duration
+	upgrader       websocket.Upgrader
+}
+
+// NewEventHandler creates a new event handler
+func NewEventHandler(bus *events.Bus, cfg *config.Config) *EventHandler {
+	h := &EventHandler{
+		bus:            bus,
+		allowedOrigins: cfg.Server.AllowedOrigins,
+	}
+
+	// SSE responses are subject to the server write timeout, so streams end
+	// shortly before it and clients reconnect with Last-Event-ID
+	if cfg.Server.WriteTimeout > 0 {
+		h.streamTimeout = time.Duration(cfg.Server.WriteTimeout)*time.Second - time.Second
+	}
+
+	h.upgrader = websocket.Upgrader{
+		HandshakeTimeout: eventWriteTimeout,
+		CheckOrigin:      h.checkOrigin,
+	}
+
+	return h
+}
+
+// RegisterRoutes registers the event stream routes
+func (h *EventHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/api/events", h.streamEvents).Methods("GET")
+	r.HandleFunc("/api/ws", h.serveWebSocket).Methods("GET")
+}
+
+// streamEvents streams events as Server-Sent Events
+func (h *EventHandler) streamEvents(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "streamEvents").Logger()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	types, err := parseEventTypes(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lastID := parseLastEventID(r, r.Header.Get("Last-Event-ID"))
+
+	sub := h.bus.Subscribe(types, eventBufferSize)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetryMillis)
+	flusher.Flush()
+
+	logger.Debug().Strs("types", types).Msg("Event stream opened")
+
+	stream := &eventStream{sub: sub, lastID: lastID, write: func(event events.Event) error {
+		return writeSSE(w, flusher, event)
+	}}
+
+	// Replay events missed since the client's last connection
+	if err := stream.replay(h.bus); err != nil {
+		return
+	}
+
+	var timeout <-chan time.Time
+	if h.streamTimeout > 0 {
+		timer := time.NewTimer(h.streamTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-timeout:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			if err := stream.send(event); err != nil {
+				logger.Debug().Err(err).Msg("Event stream closed")
+				return
+			}
+		}
+	}
+}
+
+// serveWebSocket streams events over a WebSocket connection
+func (h *EventHandler) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "serveWebSocket").Logger()
+
+	types, err := parseEventTypes(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lastID := parseLastEventID(r, "")
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already written an error response
+		logger.Warn().Err(err).Msg("WebSocket upgrade failed")
+		return
+	}
+	defer conn.Close()
+
+	sub := h.bus.Subscribe(types, eventBufferSize)
+	defer sub.Close()
+
+	// Read and discard client messages so control frames are processed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(4096)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	stream := &eventStream{sub: sub, lastID: lastID, write: func(event events.Event) error {
+		conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		return conn.WriteJSON(event)
+	}}
+
+	if err := stream.replay(h.bus); err != nil {
+		return
+	}
+
+	ping := time.NewTicker(eventHeartbeatInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout)); err != nil {
+				return
+			}
+		case event, ok := <-sub.Events():
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+					time.Now().Add(eventWriteTimeout))
+				return
+			}
+			if err := stream.send(event); err != nil {
+				logger.Debug().Err(err).Msg("WebSocket client disconnected")
+				return
+			}
+		}
+	}
+}
+
+// checkOrigin allows WebSocket connections from the configured origins
+func (h *EventHandler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	for _, allowed := range h.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// eventStream writes events to one client, skipping duplicates and
+// reporting events dropped because the client fell behind
+type eventStream struct {
+	sub      *events.Subscription
+	lastID   uint64
+	reported uint64
+	write    func(events.Event) error
+}
+
+// replay sends retained events published after the client's last event.
+// Clients connecting for the first time only receive new events.
+func (s *eventStream) replay(bus *events.Bus) error {
+	if s.lastID == 0 {
+		return nil
+	}
+
+	for _, event := range bus.Since(s.lastID, s.sub) {
+		if err := s.send(event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// send writes an event unless it was already sent during replay
+func (s *eventStream) send(event events.Event) error {
+	if event.ID <= s.lastID {
+		return nil
+	}
+
+	if dropped := s.sub.Dropped(); dropped > s.reported {
+		notice := events.Event{
+			Type:      events.TypeEventsDropped,
+			Timestamp: time.Now(),
+			Data:      map[string]uint64{"dropped": dropped - s.reported},
+		}
+		if err := s.write(notice); err != nil {
+			return err
+		}
+		s.reported = dropped
+	}
+
+	if err := s.write(event); err != nil {
+		return err
+	}
+	s.lastID = event.ID
+
+	return nil
+}
+
+// writeSSE writes a single event in text/event-stream format
+func writeSSE(w http.ResponseWriter, flusher http.Flusher, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if event.ID > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+		return err
+	}
+	flusher.Flush()
+
+	return nil
+}
+
+// parseEventTypes reads the comma-separated "types" filter from the query string
+func parseEventTypes(r *http.Request) ([]string, error) {
+	var types []string
+	for _, value := range r.URL.Query()["types"] {
+		for _, t := range strings.Split(value, ",") {
+			t = strings.TrimSpace(t)
+			if t == "" {
+				continue
+			}
+			if !events.IsKnownType(t) {
+				return nil, fmt.Errorf("unknown event type: %s", t)
+			}
+			types = append(types, t)
+		}
+	}
+
+	return types, nil
+}
+
+// parseLastEventID returns the ID of the last event the client received,
+// from the given header value or the "lastEventId" query parameter
+func parseLastEventID(r *http.Request, header string) uint64 {
+	value := header
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return id
+}
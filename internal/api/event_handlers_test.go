@@ -0,0 +1,150 @@
+// internal/api/event_handlers_test.go
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"panopticon-scanner/internal/config"
+	"panopticon-scanner/internal/events"
+)
+
+// setupEventServer starts a test server exposing the event routes
+func setupEventServer(t *testing.T) (*events.Bus, *httptest.Server) {
+	bus := events.NewBus()
+	handler := NewEventHandler(bus, config.GetConfig())
+
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	return bus, httptest.NewServer(router)
+}
+
+// waitForSubscribers waits until the bus has the given number of subscribers
+func waitForSubscribers(t *testing.T, bus *events.Bus, count int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for bus.SubscriberCount() != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d event subscribers", count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestStreamEvents tests the Server-Sent Events endpoint
+func TestStreamEvents(t *testing.T) {
+	bus, server := setupEventServer(t)
+	defer server.Close()
+	defer bus.Close()
+
+	resp, err := http.Get(server.URL + "/api/events?types=scan_status")
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %s", ct)
+	}
+
+	waitForSubscribers(t, bus, 1)
+
+	// Only the subscribed type is delivered
+	bus.Publish(events.TypeDeviceFound, map[string]interface{}{"deviceId": 1})
+	bus.Publish(events.TypeScanStatus, map[string]interface{}{"scanId": 7, "status": "running"})
+
+	reader := bufio.NewReader(resp.Body)
+	var eventType, data string
+	for data == "" {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event stream: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			eventType = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+
+	if eventType != events.TypeScanStatus {
+		t.Errorf("Expected scan_status event, got %s", eventType)
+	}
+
+	var event events.Event
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		t.Fatalf("Failed to parse event data: %v", err)
+	}
+
+	if status := event.Data.(map[string]interface{})["status"]; status != "running" {
+		t.Errorf("Expected status running, got %v", status)
+	}
+
+	// Unknown event types are rejected
+	resp2, err := http.Get(server.URL + "/api/events?types=bogus")
+	if err != nil {
+		t.Fatalf("Failed to request event stream: %v", err)
+	}
+	resp2.Body.Close()
+
+	if resp2.StatusCode != http.StatusBadRequest {
+		t.Errorf("Unknown event type returned wrong status code: got %v want %v", resp2.StatusCode, http.StatusBadRequest)
+	}
+}
+
+// TestServeWebSocket tests the WebSocket endpoint, including replay on reconnect
+func TestServeWebSocket(t *testing.T) {
+	bus, server := setupEventServer(t)
+	defer server.Close()
+	defer bus.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/ws"
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	waitForSubscribers(t, bus, 1)
+	bus.Publish(events.TypeScanProgress, map[string]interface{}{"scanId": 7})
+
+	var event events.Event
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("Failed to read event: %v", err)
+	}
+
+	if event.Type != events.TypeScanProgress {
+		t.Errorf("Expected scan_progress event, got %s", event.Type)
+	}
+	conn.Close()
+	waitForSubscribers(t, bus, 0)
+
+	// Events published while disconnected are replayed after lastEventId
+	bus.Publish(events.TypeScanStatus, map[string]interface{}{"status": "completed"})
+
+	conn, _, err = websocket.DefaultDialer.Dial(wsURL+"?lastEventId=1", nil)
+	if err != nil {
+		t.Fatalf("Failed to reconnect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("Failed to read replayed event: %v", err)
+	}
+
+	if event.Type != events.TypeScanStatus || event.ID != 2 {
+		t.Errorf("Expected replayed scan_status event 2, got %+v", event)
+	}
+}
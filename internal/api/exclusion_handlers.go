@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"panopticon-scanner/internal/models"
+	"panopticon-scanner/internal/scanner"
+)
+
+// ExclusionHandler handles the exclusion list API endpoints
+type ExclusionHandler struct {
+	scanService *scanner.ScanService
+}
+
+// NewExclusionHandler creates a new exclusion handler
+func NewExclusionHandler(scanService *scanner.ScanService) *ExclusionHandler {
+	return &ExclusionHandler{
+		scanService: scanService,
+	}
+}
+
+// RegisterRoutes registers the exclusion routes
+func (h *ExclusionHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/api/exclusions", h.getExclusions).Methods("GET")
+	r.HandleFunc("/api/exclusions", h.createExclusion).Methods("POST")
+	r.HandleFunc("/api/exclusions/{id:[0-9]+}", h.getExclusion).Methods("GET")
+	r.HandleFunc("/api/exclusions/{id:[0-9]+}", h.updateExclusion).Methods("PUT")
+	r.HandleFunc("/api/exclusions/{id:[0-9]+}", h.deleteExclusion).Methods("DELETE")
+}
+
+// getExclusions returns the exclusion list; ?all=true includes expired entries
+func (h *ExclusionHandler) getExclusions(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "getExclusions").Logger()
+
+	includeExpired := r.URL.Query().Get("all") == "true"
+
+	exclusions, err := h.scanService.GetExclusions(includeExpired)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to retrieve exclusions")
+		http.Error(w, "Failed to retrieve exclusions", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, exclusions)
+}
+
+// getExclusion returns a stored exclusion by ID
+func (h *ExclusionHandler) getExclusion(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "getExclusion").Logger()
+
+	id, ok := parseExclusionID(w, r, logger)
+	if !ok {
+		return
+	}
+
+	exclusion, err := h.scanService.GetExclusion(id)
+	if err != nil {
+		h.writeExclusionError(w, logger, err)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, exclusion)
+}
+
+// createExclusion validates and stores a new exclusion
+func (h *ExclusionHandler) createExclusion(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "createExclusion").Logger()
+
+	var exclusion models.Exclusion
+	if err := json.NewDecoder(r.Body).Decode(&exclusion); err != nil {
+		logger.Error().Err(err).Msg("Failed to parse exclusion")
+		http.Error(w, "Invalid exclusion", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.scanService.CreateExclusion(&exclusion)
+	if err != nil {
+		h.writeExclusionError(w, logger, err)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusCreated, created)
+}
+
+// updateExclusion validates and replaces a stored exclusion
+func (h *ExclusionHandler) updateExclusion(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "updateExclusion").Logger()
+
+	id, ok := parseExclusionID(w, r, logger)
+	if !ok {
+		return
+	}
+
+	var exclusion models.Exclusion
+	if err := json.NewDecoder(r.Body).Decode(&exclusion); err != nil {
+		logger.Error().Err(err).Msg("Failed to parse exclusion")
+		http.Error(w, "Invalid exclusion", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.scanService.UpdateExclusion(id, &exclusion)
+	if err != nil {
+		h.writeExclusionError(w, logger, err)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, updated)
+}
+
+// deleteExclusion removes a stored exclusion
+func (h *ExclusionHandler) deleteExclusion(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "deleteExclusion").Logger()
+
+	id, ok := parseExclusionID(w, r, logger)
+	if !ok {
+		return
+	}
+
+	if err := h.scanService.DeleteExclusion(id); err != nil {
+		h.writeExclusionError(w, logger, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseExclusionID reads the exclusion ID from the URL
+func parseExclusionID(w http.ResponseWriter, r *http.Request, logger zerolog.Logger) (int64, bool) {
+	idStr := mux.Vars(r)["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		logger.Error().Err(err).Str("id", idStr).Msg("Invalid exclusion ID")
+		http.Error(w, "Invalid exclusion ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return id, true
+}
+
+// writeExclusionError maps exclusion errors to HTTP responses
+func (h *ExclusionHandler) writeExclusionError(w http.ResponseWriter, logger zerolog.Logger, err error) {
+	switch {
+	case errors.Is(err, scanner.ErrInvalidTarget), errors.Is(err, scanner.ErrInvalidExclusion):
+		logger.Warn().Err(err).Msg("Rejected invalid exclusion")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, scanner.ErrExclusionNotFound):
+		http.Error(w, "Exclusion not found", http.StatusNotFound)
+	default:
+		logger.Error().Err(err).Msg("Failed to save exclusion")
+		http.Error(w, "Failed to save exclusion", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,104 @@
+// internal/api/exclusion_handlers_test.go
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestExclusionHandlers tests the exclusion list endpoints
+func TestExclusionHandlers(t *testing.T) {
+	tempDir, cfg, db, scanService, _ := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	cfg.Scanner.ExcludeHosts = []string{"192.168.1.254"}
+	defer func() { cfg.Scanner.ExcludeHosts = nil }()
+
+	router := mux.NewRouter()
+	NewExclusionHandler(scanService).RegisterRoutes(router)
+
+	// Create an exclusion
+	body := `{"target": "192.168.1.10-20", "reason": "Printers", "expiresAt": "2099-01-01T00:00:00Z"}`
+	req := httptest.NewRequest("POST", "/api/exclusions", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Create returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+
+	var created models.Exclusion
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if created.ID == 0 || created.Target != "192.168.1.10-192.168.1.20" || created.ExpiresAt == nil {
+		t.Errorf("Unexpected created exclusion: %+v", created)
+	}
+
+	// Invalid targets are rejected
+	for _, body := range []string{
+		`{"target": "example.com", "reason": "x"}`,
+		`{"target": "192.168.1.1", "reason": ""}`,
+		`not json`,
+	} {
+		req = httptest.NewRequest("POST", "/api/exclusions", strings.NewReader(body))
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Invalid exclusion %s returned wrong status code: got %v want %v", body, rr.Code, http.StatusBadRequest)
+		}
+	}
+
+	// List includes configured and stored exclusions
+	req = httptest.NewRequest("GET", "/api/exclusions", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var exclusions []models.Exclusion
+	if err := json.Unmarshal(rr.Body.Bytes(), &exclusions); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if len(exclusions) != 2 || exclusions[0].Source != "config" || exclusions[1].Source != "database" {
+		t.Errorf("Unexpected exclusion list: %+v", exclusions)
+	}
+
+	// Update the exclusion
+	path := fmt.Sprintf("/api/exclusions/%d", created.ID)
+	req = httptest.NewRequest("PUT", path, strings.NewReader(`{"target": "192.168.1.10", "reason": "Printer"}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Update returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Delete the exclusion
+	req = httptest.NewRequest("DELETE", path, nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Delete returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+
+	req = httptest.NewRequest("GET", path, nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Get of deleted exclusion returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+
+	"panopticon-scanner/internal/scanner"
+)
+
+// importMemory is how much of an upload is held in memory before spilling to disk
+const importMemory = 32 << 20
+
+// ImportHandler handles uploads of scan results produced elsewhere
+type ImportHandler struct {
+	scanService *scanner.ScanService
+}
+
+// NewImportHandler creates a new import handler
+func NewImportHandler(scanService *scanner.ScanService) *ImportHandler {
+	return &ImportHandler{
+		scanService: scanService,
+	}
+}
+
+// RegisterRoutes registers the import routes
+func (h *ImportHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/api/imports", h.importScan).Methods("POST")
+}
+
+// importScan imports a scan result file, optionally gzipped, uploaded as the
+// "file" field of a multipart form
+func (h *ImportHandler) importScan(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "importScan").Logger()
+
+	r.Body = http.MaxBytesReader(w, r.Body, scanner.MaxImportSize)
+	if err := r.ParseMultipartForm(importMemory); err != nil {
+		logger.Warn().Err(err).Msg("Failed to parse import upload")
+		http.Error(w, "Invalid upload: expected a multipart form with a file field", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Missing file field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	scan, err := h.scanService.ImportScan(file, header.Filename)
+	if err != nil {
+		switch {
+		case errors.Is(err, scanner.ErrInvalidImport):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, scanner.ErrDuplicateImport):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			logger.Error().Err(err).Str("file", header.Filename).Msg("Failed to import scan")
+			http.Error(w, "Failed to import scan", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, logger, http.StatusCreated, scan)
+}
@@ -0,0 +1,90 @@
+// internal/api/import_handlers_test.go
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"panopticon-scanner/internal/models"
+)
+
+// importTestOutput is complete nmap output with one host
+const importTestOutput = `<?xml version="1.0"?>
+<nmaprun scanner="nmap" start="1677664800">
+<host><status state="up"/>
+<address addr="10.1.0.5" addrtype="ipv4"/>
+<ports><port protocol="tcp" portid="22"><state state="open"/><service name="ssh"/></port></ports>
+</host>
+<runstats><finished time="1677664895" exit="success"/></runstats>
+</nmaprun>`
+
+// uploadRequest builds a multipart request uploading data as the given field
+func uploadRequest(t *testing.T, field, name, data string) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile(field, name)
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	part.Write([]byte(data))
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/api/imports", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+// TestImportScan tests the importScan handler
+func TestImportScan(t *testing.T) {
+	tempDir, _, db, scanService, _ := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	router := mux.NewRouter()
+	NewImportHandler(scanService).RegisterRoutes(router)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, uploadRequest(t, "file", "scan.xml", importTestOutput))
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Handler returned wrong status code: got %v want %v (%s)", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+
+	var scan models.Scan
+	if err := json.Unmarshal(rr.Body.Bytes(), &scan); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if scan.Source != "import" || scan.DevicesFound != 1 || scan.Timestamp.Unix() != 1677664800 {
+		t.Errorf("Unexpected imported scan: %+v", scan)
+	}
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"duplicate", uploadRequest(t, "file", "copy.xml", importTestOutput), http.StatusConflict},
+		{"malformed", uploadRequest(t, "file", "bad.xml", "<nmaprun"), http.StatusBadRequest},
+		{"missing file", uploadRequest(t, "upload", "scan.xml", importTestOutput), http.StatusBadRequest},
+		{"not multipart", httptest.NewRequest("POST", "/api/imports", bytes.NewBufferString(importTestOutput)), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, tt.req)
+
+			if rr.Code != tt.want {
+				t.Errorf("Handler returned wrong status code: got %v want %v (%s)", rr.Code, tt.want, rr.Body.String())
+			}
+		})
+	}
+}
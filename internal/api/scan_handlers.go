@@ -4,12 +4,16 @@
 package api
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"panopticon-scanner/internal/models"
@@ -31,10 +35,21 @@ func NewScanHandler(scanService *scanner.ScanService) *ScanHandler {
 // RegisterRoutes registers the scan routes
 func (h *ScanHandler) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/api/scans", h.getScans).Methods("GET")
-	r.HandleFunc("/api/scans/{id}", h.getScan).Methods("GET")
+	r.HandleFunc("/api/scans/{id:[0-9]+}", h.getScan).Methods("GET")
 	r.HandleFunc("/api/scans", h.startScan).Methods("POST")
+	r.HandleFunc("/api/scans/{id:[0-9]+}", h.cancelScan).Methods("DELETE")
+	r.HandleFunc("/api/scans/{id:[0-9]+}/cancel", h.cancelScan).Methods("POST")
+	r.HandleFunc("/api/scans/{id:[0-9]+}/hosts", h.getScanHosts).Methods("GET")
+	r.HandleFunc("/api/scans/{id:[0-9]+}/changes", h.getScanChanges).Methods("GET")
+	r.HandleFunc("/api/scans/diff", h.diffScans).Methods("GET")
 	r.HandleFunc("/api/scans/status", h.GetScanStatus).Methods("GET")
+	r.HandleFunc("/api/scans/queue", h.getScanQueue).Methods("GET")
+	r.HandleFunc("/api/scans/audit", h.getAuditLog).Methods("GET")
+	r.HandleFunc("/api/scans/queue/{id:[0-9]+}", h.cancelScanJob).Methods("DELETE")
 	r.HandleFunc("/api/scans/templates", h.GetScanTemplates).Methods("GET")
+	r.HandleFunc("/api/scans/templates", h.createScanTemplate).Methods("POST")
+	r.HandleFunc("/api/scans/templates/{name}", h.updateScanTemplate).Methods("PUT")
+	r.HandleFunc("/api/scans/templates/{name}", h.deleteScanTemplate).Methods("DELETE")
 }
 
 // getScans returns a list of recent scans
@@ -99,33 +114,253 @@ func (h *ScanHandler) getScan(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// startScan initiates a new network scan
-func (h *ScanHandler) startScan(w http.ResponseWriter, r *http.Request) {
-	logger := log.With().Str("handler", "startScan").Logger()
+// getScanHosts returns the hosts a scan found and the ports it found on each
+func (h *ScanHandler) getScanHosts(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "getScanHosts").Logger()
 
-	// Check if a scan is already running
-	status := h.scanService.GetStatus()
-	if status.Status == "running" {
-		logger.Warn().Msg("Scan already in progress")
-		http.Error(w, "A scan is already in progress", http.StatusConflict)
+	idStr := mux.Vars(r)["id"]
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		logger.Error().Err(err).Str("id", idStr).Msg("Invalid scan ID")
+		http.Error(w, "Invalid scan ID", http.StatusBadRequest)
+		return
+	}
+
+	hosts, err := h.scanService.GetScanHosts(id)
+	if err != nil {
+		if errors.Is(err, scanner.ErrScanNotFound) {
+			http.Error(w, "Scan not found", http.StatusNotFound)
+			return
+		}
+		logger.Error().Err(err).Int64("id", id).Msg("Failed to retrieve scan hosts")
+		http.Error(w, "Failed to retrieve scan hosts", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, hosts)
+}
+
+// getScanChanges returns the changes a scan made to the inventory
+func (h *ScanHandler) getScanChanges(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "getScanChanges").Logger()
+
+	idStr := mux.Vars(r)["id"]
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		logger.Error().Err(err).Str("id", idStr).Msg("Invalid scan ID")
+		http.Error(w, "Invalid scan ID", http.StatusBadRequest)
+		return
+	}
+
+	changes, err := h.scanService.GetScanChanges(id)
+	if err != nil {
+		if errors.Is(err, scanner.ErrScanNotFound) {
+			http.Error(w, "Scan not found", http.StatusNotFound)
+			return
+		}
+		logger.Error().Err(err).Int64("id", id).Msg("Failed to retrieve scan changes")
+		http.Error(w, "Failed to retrieve scan changes", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, changes)
+}
+
+// diffScans compares what two completed scans found, as JSON or, with
+// format=csv, as CSV
+func (h *ScanHandler) diffScans(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "diffScans").Logger()
+
+	var ids [2]int64
+	for i, param := range []string{"from", "to"} {
+		value := r.URL.Query().Get(param)
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid or missing "+param+" scan ID", http.StatusBadRequest)
+			return
+		}
+		ids[i] = id
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, "Invalid format, must be json or csv", http.StatusBadRequest)
 		return
 	}
 
+	diff, err := h.scanService.DiffScans(ids[0], ids[1])
+	if err != nil {
+		switch {
+		case errors.Is(err, scanner.ErrScanNotFound):
+			http.Error(w, "Scan not found", http.StatusNotFound)
+		case errors.Is(err, scanner.ErrScanNotCompleted):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			logger.Error().Err(err).Int64("from", ids[0]).Int64("to", ids[1]).Msg("Failed to compare scans")
+			http.Error(w, "Failed to compare scans", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if format != "csv" {
+		writeJSON(w, logger, http.StatusOK, diff)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="scan_diff_%d_%d.csv"`, ids[0], ids[1]))
+	w.WriteHeader(http.StatusOK)
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"type", "device_id", "ip_address", "port", "protocol", "before", "after"})
+	for _, change := range diff.Changes {
+		port := ""
+		if change.PortNumber != 0 {
+			port = strconv.Itoa(change.PortNumber)
+		}
+		out.Write([]string{
+			change.Type, strconv.FormatInt(change.DeviceID, 10), change.IPAddress,
+			port, change.Protocol, change.Before, change.After,
+		})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		logger.Error().Err(err).Msg("Failed to write CSV response")
+	}
+}
+
+// cancelScan stops a running scan
+func (h *ScanHandler) cancelScan(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "cancelScan").Logger()
+
+	// Parse scan ID from URL
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		logger.Error().Err(err).Str("id", idStr).Msg("Invalid scan ID")
+		http.Error(w, "Invalid scan ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.scanService.CancelScan(id); err != nil {
+		switch {
+		case errors.Is(err, scanner.ErrScanNotFound):
+			http.Error(w, "Scan not found", http.StatusNotFound)
+		case errors.Is(err, scanner.ErrScanNotRunning):
+			http.Error(w, "Scan is not running", http.StatusConflict)
+		default:
+			logger.Error().Err(err).Int64("id", id).Msg("Failed to cancel scan")
+			http.Error(w, "Failed to cancel scan", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	logger.Info().Int64("id", id).Msg("Scan cancellation requested")
+
+	writeJSON(w, logger, http.StatusAccepted, map[string]interface{}{
+		"message":   "Scan cancellation requested",
+		"scanId":    id,
+		"timestamp": time.Now(),
+	})
+}
+
+// getScanQueue returns the running and queued scan jobs
+func (h *ScanHandler) getScanQueue(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "getScanQueue").Logger()
+
+	jobs, err := h.scanService.GetScanQueue()
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to retrieve scan queue")
+		http.Error(w, "Failed to retrieve scan queue", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, jobs)
+}
+
+// getAuditLog returns recent scan authorization decisions
+func (h *ScanHandler) getAuditLog(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "getAuditLog").Logger()
+
+	limit := 100 // Default limit
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsedLimit, err := strconv.Atoi(limitParam)
+		if err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	entries, err := h.scanService.GetAuditLog(limit)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to retrieve audit log")
+		http.Error(w, "Failed to retrieve audit log", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, entries)
+}
+
+// cancelScanJob removes a scan job from the queue before it starts
+func (h *ScanHandler) cancelScanJob(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "cancelScanJob").Logger()
+
+	// Parse job ID from URL
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		logger.Error().Err(err).Str("id", idStr).Msg("Invalid job ID")
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.scanService.CancelScanJob(id); err != nil {
+		switch {
+		case errors.Is(err, scanner.ErrJobNotFound):
+			http.Error(w, "Scan job not found", http.StatusNotFound)
+		case errors.Is(err, scanner.ErrJobNotQueued):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			logger.Error().Err(err).Int64("id", id).Msg("Failed to cancel scan job")
+			http.Error(w, "Failed to cancel scan job", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// startScan queues a new network scan
+func (h *ScanHandler) startScan(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "startScan").Logger()
+
 	// Parse scan parameters from request body
-	var params models.ScanParameters
+	var request models.ScanRequest
 	if r.ContentLength > 0 {
-		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 			logger.Error().Err(err).Msg("Failed to parse scan parameters")
 			http.Error(w, "Invalid scan parameters", http.StatusBadRequest)
 			return
 		}
 	}
 
+	params := request.ScanParameters
+
 	// Use default template if none specified
 	if params.Template == "" {
 		params.Template = "default"
 	}
 
+	// Reject unknown templates before starting the scan
+	if _, err := h.scanService.GetScanTemplate(params.Template); err != nil {
+		logger.Warn().Err(err).Str("template", params.Template).Msg("Unknown scan template requested")
+		http.Error(w, "Unknown scan template: "+params.Template, http.StatusBadRequest)
+		return
+	}
+
 	// Validate parameters
 	if params.RateLimit < 0 {
 		logger.Warn().Int("rateLimit", params.RateLimit).Msg("Invalid rate limit provided")
@@ -140,26 +375,56 @@ func (h *ScanHandler) startScan(w http.ResponseWriter, r *http.Request) {
 		Int("rateLimit", params.RateLimit).
 		Bool("scanAllPorts", params.ScanAllPorts).
 		Bool("disablePing", params.DisablePing).
+		Strs("protocols", params.Protocols).
 		Msg("Scan requested")
 
-	// Start the scan in a goroutine
-	go func() {
-		_, err := h.scanService.RunManualScan(r.Context(), params)
-		if err != nil {
-			logger.Error().Err(err).Msg("Scan failed")
+	priority := scanner.ScanPriorityManual
+	if request.Priority != nil {
+		priority = *request.Priority
+	}
+	if priority < scanner.ScanPriorityScheduled || priority > scanner.ScanPriorityManual {
+		logger.Warn().Int("priority", priority).Msg("Invalid priority provided")
+		http.Error(w, fmt.Sprintf("Invalid priority: must be between %d and %d",
+			scanner.ScanPriorityScheduled, scanner.ScanPriorityManual), http.StatusBadRequest)
+		return
+	}
+
+	// The requester is taken from the connection, never from the request
+	// body, so scans and rejections cannot be attributed to someone else
+	requestedBy := r.RemoteAddr
+
+	// Queue the scan; the scan service worker runs it when its turn comes
+	job, err := h.scanService.EnqueueScan(params, priority, requestedBy, request.Label)
+	if err != nil {
+		switch {
+		case errors.Is(err, scanner.ErrTargetOutOfScope):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, scanner.ErrInvalidTarget), errors.Is(err, scanner.ErrTargetTooLarge), errors.Is(err, scanner.ErrUnknownSite),
+			errors.Is(err, scanner.ErrInvalidProtocol):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			logger.Error().Err(err).Msg("Failed to queue scan")
+			http.Error(w, "Failed to queue scan", http.StatusInternalServerError)
 		}
-	}()
+		return
+	}
 
 	// Return success response
 	response := map[string]interface{}{
-		"message": "Scan started",
+		"message": "Scan queued",
+		"jobId": job.ID,
+		"position": job.Position,
+		"priority": job.Priority,
 		"template": params.Template,
 		"timestamp": time.Now(),
 	}
 
 	// Include additional parameters in response if they were provided
-	if params.TargetNetwork != "" {
-		response["targetNetwork"] = params.TargetNetwork
+	if job.Parameters.TargetNetwork != "" {
+		response["targetNetwork"] = job.Parameters.TargetNetwork
+	}
+	if params.Site != "" {
+		response["site"] = params.Site
 	}
 	if params.RateLimit > 0 {
 		response["rateLimit"] = params.RateLimit
@@ -170,6 +435,9 @@ func (h *ScanHandler) startScan(w http.ResponseWriter, r *http.Request) {
 	if params.DisablePing {
 		response["disablePing"] = true
 	}
+	if len(job.Parameters.Protocols) > 0 {
+		response["protocols"] = job.Parameters.Protocols
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted) // 202 Accepted
@@ -206,6 +474,11 @@ func (h *ScanHandler) GetScanStatus(w http.ResponseWriter, r *http.Request) {
 		response["error"] = status.Error.Error()
 	}
 
+	// Include the latest progress reported by nmap
+	if !status.Progress.UpdatedAt.IsZero() {
+		response["progress"] = status.Progress
+	}
+
 	// Return JSON response
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -234,4 +507,83 @@ func (h *ScanHandler) GetScanTemplates(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
 	}
-}
\ No newline at end of file
+}
+
+// createScanTemplate validates and stores a new user-defined scan template
+func (h *ScanHandler) createScanTemplate(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "createScanTemplate").Logger()
+
+	var template models.ScanTemplate
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		logger.Error().Err(err).Msg("Failed to parse scan template")
+		http.Error(w, "Invalid scan template", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.scanService.CreateScanTemplate(&template)
+	if err != nil {
+		h.writeTemplateError(w, logger, err)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusCreated, created)
+}
+
+// updateScanTemplate validates and replaces a user-defined scan template
+func (h *ScanHandler) updateScanTemplate(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "updateScanTemplate").Logger()
+	name := mux.Vars(r)["name"]
+
+	var template models.ScanTemplate
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		logger.Error().Err(err).Msg("Failed to parse scan template")
+		http.Error(w, "Invalid scan template", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.scanService.UpdateScanTemplate(name, &template)
+	if err != nil {
+		h.writeTemplateError(w, logger, err)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, updated)
+}
+
+// deleteScanTemplate removes a user-defined scan template
+func (h *ScanHandler) deleteScanTemplate(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "deleteScanTemplate").Logger()
+	name := mux.Vars(r)["name"]
+
+	if err := h.scanService.DeleteScanTemplate(name); err != nil {
+		h.writeTemplateError(w, logger, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeTemplateError maps scan template errors to HTTP responses
+func (h *ScanHandler) writeTemplateError(w http.ResponseWriter, logger zerolog.Logger, err error) {
+	var validationErr *scanner.TemplateValidationError
+
+	switch {
+	case errors.As(err, &validationErr):
+		logger.Warn().Err(err).Msg("Rejected invalid scan template")
+		writeJSON(w, logger, http.StatusBadRequest, map[string]interface{}{
+			"error":      "Invalid scan template",
+			"template":   validationErr.Template,
+			"problems":   validationErr.Problems,
+			"violations": validationErr.Violations,
+		})
+	case errors.Is(err, scanner.ErrTemplateNotFound):
+		http.Error(w, "Scan template not found", http.StatusNotFound)
+	case errors.Is(err, scanner.ErrTemplateExists):
+		http.Error(w, "Scan template already exists", http.StatusConflict)
+	case errors.Is(err, scanner.ErrTemplateReadOnly):
+		http.Error(w, "Built-in and configured scan templates cannot be modified", http.StatusForbidden)
+	default:
+		logger.Error().Err(err).Msg("Failed to save scan template")
+		http.Error(w, "Failed to save scan template", http.StatusInternalServerError)
+	}
+}
@@ -2,12 +2,14 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -234,6 +236,182 @@ func TestGetScan(t *testing.T) {
 	}
 }
 
+// TestGetScanHosts tests listing the hosts a scan found
+func TestGetScanHosts(t *testing.T) {
+	tempDir, _, db, _, scanHandler := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	scanID := createTestScans(t, db, 1)[0]
+	deviceID, err := db.SaveDevice(&models.Device{IPAddress: "10.0.0.5"})
+	if err != nil {
+		t.Fatalf("Failed to create test device: %v", err)
+	}
+	err = db.SaveHostObservation(&models.HostObservation{
+		ScanID: scanID, DeviceID: deviceID, IPAddress: "10.0.0.5", ObservedAt: time.Now(),
+		Ports: []*models.PortObservation{{PortNumber: 443, Protocol: "tcp", State: "open", ServiceName: "https"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to save observation: %v", err)
+	}
+
+	router := mux.NewRouter()
+	scanHandler.RegisterRoutes(router)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/api/scans/%d/hosts", scanID), nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var hosts []models.HostObservation
+	if err := json.Unmarshal(rr.Body.Bytes(), &hosts); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(hosts) != 1 || hosts[0].IPAddress != "10.0.0.5" || len(hosts[0].Ports) != 1 || hosts[0].Ports[0].ServiceName != "https" {
+		t.Errorf("Unexpected scan hosts: %+v", hosts)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/scans/9999/hosts", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Handler with non-existent ID returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+// TestGetScanChanges tests listing the changes a scan made to the inventory
+func TestGetScanChanges(t *testing.T) {
+	tempDir, _, db, _, scanHandler := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	scanIDs := createTestScans(t, db, 2)
+	sc := database.ScanContext{ScanID: scanIDs[0]}
+	deviceID, err := db.IngestDevice(sc, &models.Device{IPAddress: "10.0.0.7"})
+	if err != nil {
+		t.Fatalf("Failed to ingest device: %v", err)
+	}
+	if err := db.IngestPort(sc, &models.Port{DeviceID: deviceID, PortNumber: 80, Protocol: "tcp"}); err != nil {
+		t.Fatalf("Failed to ingest port: %v", err)
+	}
+
+	router := mux.NewRouter()
+	scanHandler.RegisterRoutes(router)
+
+	tests := []struct {
+		scanID int64
+		want   int
+	}{
+		{scanIDs[0], 2},
+		{scanIDs[1], 0},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/api/scans/%d/changes", tt.scanID), nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+
+		var changes []models.Change
+		if err := json.Unmarshal(rr.Body.Bytes(), &changes); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if len(changes) != tt.want {
+			t.Errorf("Expected %d changes in scan %d, got %+v", tt.want, tt.scanID, changes)
+		}
+		for _, change := range changes {
+			if change.ScanID != tt.scanID || change.DeviceID != deviceID {
+				t.Errorf("Unexpected change in scan %d: %+v", tt.scanID, change)
+			}
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/scans/9999/changes", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Handler with non-existent ID returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+// TestDiffScans tests comparing two scans as JSON and CSV
+func TestDiffScans(t *testing.T) {
+	tempDir, _, db, _, scanHandler := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	scanIDs := createTestScans(t, db, 2)
+	deviceID, err := db.SaveDevice(&models.Device{IPAddress: "10.0.0.5"})
+	if err != nil {
+		t.Fatalf("Failed to create test device: %v", err)
+	}
+	for i, service := range []string{"http", "http-proxy"} {
+		err := db.SaveHostObservation(&models.HostObservation{
+			ScanID: scanIDs[i], DeviceID: deviceID, IPAddress: "10.0.0.5", ObservedAt: time.Now(),
+			Ports: []*models.PortObservation{{PortNumber: 8080, Protocol: "tcp", State: "open", ServiceName: service}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to save observation: %v", err)
+		}
+	}
+
+	router := mux.NewRouter()
+	scanHandler.RegisterRoutes(router)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/api/scans/diff?from=%d&to=%d", scanIDs[0], scanIDs[1]), nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var diff models.ScanDiff
+	if err := json.Unmarshal(rr.Body.Bytes(), &diff); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(diff.Changes) != 1 || diff.Summary[scanner.DiffServiceChanged] != 1 {
+		t.Fatalf("Expected one service change, got %+v", diff)
+	}
+	if change := diff.Changes[0]; change.PortNumber != 8080 || change.Before != "http" || change.After != "http-proxy" {
+		t.Errorf("Unexpected change: %+v", change)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/api/scans/diff?from=%d&to=%d&format=csv", scanIDs[0], scanIDs[1]), nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "text/csv" {
+		t.Errorf("Expected text/csv, got %s", contentType)
+	}
+	want := "type,device_id,ip_address,port,protocol,before,after\n" +
+		fmt.Sprintf("service_changed,%d,10.0.0.5,8080,tcp,http,http-proxy\n", deviceID)
+	if rr.Body.String() != want {
+		t.Errorf("Unexpected CSV:\n%s", rr.Body.String())
+	}
+
+	running, err := db.CreateScan("default")
+	if err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"missing to", fmt.Sprintf("from=%d", scanIDs[0]), http.StatusBadRequest},
+		{"invalid format", fmt.Sprintf("from=%d&to=%d&format=xml", scanIDs[0], scanIDs[1]), http.StatusBadRequest},
+		{"unknown scan", fmt.Sprintf("from=%d&to=9999", scanIDs[0]), http.StatusNotFound},
+		{"running scan", fmt.Sprintf("from=%d&to=%d", scanIDs[0], running), http.StatusConflict},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/scans/diff?"+tt.query, nil))
+		if rr.Code != tt.status {
+			t.Errorf("%s: got status %v want %v", tt.name, rr.Code, tt.status)
+		}
+	}
+}
+
 // TestStartScan tests the startScan handler
 func TestStartScan(t *testing.T) {
 	tempDir, _, db, scanService, scanHandler := setupTestEnvironment(t)
@@ -268,37 +446,248 @@ func TestStartScan(t *testing.T) {
 	}
 
 	// Check the response fields
-	if msg, ok := response["message"]; !ok || msg != "Scan started" {
-		t.Errorf("Expected message 'Scan started', got %v", msg)
+	if msg, ok := response["message"]; !ok || msg != "Scan queued" {
+		t.Errorf("Expected message 'Scan queued', got %v", msg)
 	}
 
 	if template, ok := response["template"]; !ok || template != "default" {
 		t.Errorf("Expected template 'default', got %v", template)
 	}
 
-	// Reset any leftover scan status
-	scanService.SetStatusForTesting("idle")
+	if _, ok := response["jobId"]; !ok {
+		t.Errorf("Expected jobId in response")
+	}
 
-	// Test conflict case - mock a scan in progress
+	// Scans requested while another is running are queued rather than rejected
 	scanService.SetStatusForTesting("running")
 
-	req, err = http.NewRequest("POST", "/api/scans", nil)
+	req, err = http.NewRequest("POST", "/api/scans", strings.NewReader(`{"template": "quick", "priority": 5, "label": "ticket-42", "requestedBy": "someone-else"}`))
 	if err != nil {
-		t.Fatalf("Failed to create request for conflict test: %v", err)
+		t.Fatalf("Failed to create request for queued scan: %v", err)
 	}
+	req.RemoteAddr = "10.0.0.5:51234"
 
 	rr = httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
 
-	// Should return 409 Conflict when scan is already in progress
-	if status := rr.Code; status != http.StatusConflict {
-		t.Errorf("Handler with scan in progress returned wrong status code: got %v want %v", status, http.StatusConflict)
+	if status := rr.Code; status != http.StatusAccepted {
+		t.Errorf("Handler with scan in progress returned wrong status code: got %v want %v", status, http.StatusAccepted)
+	}
+
+	response = nil
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Errorf("Failed to parse response: %v", err)
+	}
+
+	if priority, ok := response["priority"]; !ok || priority != float64(5) {
+		t.Errorf("Expected priority 5, got %v", priority)
+	}
+
+	if position, ok := response["position"].(float64); !ok || position < 0 {
+		t.Errorf("Expected queue position, got %v", response["position"])
+	}
+
+	// The requester is the client's address; the body only labels the job
+	if jobID, ok := response["jobId"].(float64); ok {
+		job, err := db.GetScanJob(int64(jobID))
+		if err != nil {
+			t.Fatalf("Failed to get scan job: %v", err)
+		}
+		if job.RequestedBy != "10.0.0.5:51234" || job.Label != "ticket-42" {
+			t.Errorf("Expected the job to be requested by the client's address with its label, got %+v", job)
+		}
+	}
+	audit, err := db.GetAuditEntries(1)
+	if err != nil {
+		t.Fatalf("Failed to get audit log: %v", err)
+	}
+	if len(audit) != 1 || audit[0].Actor != "10.0.0.5:51234" {
+		t.Errorf("Expected the client's address as the audit actor, got %+v", audit)
+	}
+
+	// Clients cannot jump ahead of operators' scans or below scheduled ones
+	for _, priority := range []string{"2147483647", "11", "-1"} {
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/scans", strings.NewReader(`{"priority": `+priority+`}`)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected priority %s to be rejected, got status %v", priority, rr.Code)
+		}
 	}
 
 	// Reset the scan status for other tests
 	scanService.SetStatusForTesting(originalStatus.Status)
 }
 
+// TestStartScanScope tests that scan targets are checked against the authorized scopes
+func TestStartScanScope(t *testing.T) {
+	tempDir, cfg, db, scanService, scanHandler := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	// Stop the worker so queued jobs stay queued
+	scanService.Stop()
+
+	cfg.Scanner.AuthorizedScopes = []config.ScopeConfig{
+		{Site: "office", Networks: []string{"192.168.1.0/24"}},
+		{Site: "lab", Networks: []string{"10.20.0.0/16"}},
+	}
+	defer func() { cfg.Scanner.AuthorizedScopes = nil }()
+
+	router := mux.NewRouter()
+	scanHandler.RegisterRoutes(router)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"in scope", `{"targetNetwork": "192.168.1.10-20"}`, http.StatusAccepted},
+		{"in site scope", `{"targetNetwork": "10.20.5.0/24", "site": "lab"}`, http.StatusAccepted},
+		{"other site", `{"targetNetwork": "10.20.5.0/24", "site": "office"}`, http.StatusForbidden},
+		{"out of scope", `{"targetNetwork": "8.8.8.0/24"}`, http.StatusForbidden},
+		{"partly out of scope", `{"targetNetwork": "192.168.1.0/23"}`, http.StatusForbidden},
+		{"too large", `{"targetNetwork": "10.0.0.0/8"}`, http.StatusBadRequest},
+		{"invalid", `{"targetNetwork": "example.com"}`, http.StatusBadRequest},
+		{"unknown site", `{"targetNetwork": "192.168.1.1", "site": "hq"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/scans", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("Handler returned wrong status code: got %v want %v (%s)", rr.Code, tt.want, rr.Body.String())
+			}
+		})
+	}
+
+	// Every decision is written to the audit log
+	req := httptest.NewRequest("GET", "/api/scans/audit", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var entries []models.AuditEntry
+	if err := json.Unmarshal(rr.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("Failed to parse audit log: %v", err)
+	}
+
+	if len(entries) != len(tests) {
+		t.Fatalf("Expected %d audit entries, got %d", len(tests), len(entries))
+	}
+
+	rejected := 0
+	for _, entry := range entries {
+		if entry.Action == scanner.AuditScanRejected {
+			rejected++
+		}
+	}
+
+	if rejected != 6 {
+		t.Errorf("Expected 6 rejected requests in audit log, got %d", rejected)
+	}
+}
+
+// TestStartScanProtocols tests queueing scans of chosen protocols
+func TestStartScanProtocols(t *testing.T) {
+	tempDir, _, db, scanService, scanHandler := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	// Stop the worker so queued jobs stay queued
+	scanService.Stop()
+
+	router := mux.NewRouter()
+	scanHandler.RegisterRoutes(router)
+
+	req := httptest.NewRequest("POST", "/api/scans", strings.NewReader(`{"template": "udp", "protocols": ["UDP", "tcp"]}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Handler returned wrong status code: got %v want %v (%s)", rr.Code, http.StatusAccepted, rr.Body.String())
+	}
+
+	var response struct {
+		Protocols []string `json:"protocols"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if fmt.Sprint(response.Protocols) != "[tcp udp]" {
+		t.Errorf("Expected protocols [tcp udp], got %v", response.Protocols)
+	}
+
+	req = httptest.NewRequest("POST", "/api/scans", strings.NewReader(`{"protocols": ["icmp"]}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Handler returned wrong status code for unknown protocol: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// TestGetScanQueue tests the getScanQueue and cancelScanJob handlers
+func TestGetScanQueue(t *testing.T) {
+	tempDir, _, db, scanService, scanHandler := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	// Stop the worker so queued jobs stay queued
+	scanService.Stop()
+
+	router := mux.NewRouter()
+	scanHandler.RegisterRoutes(router)
+
+	job, err := scanService.EnqueueScan(models.ScanParameters{Template: "default"}, scanner.ScanPriorityManual, "tester", "")
+	if err != nil {
+		t.Fatalf("Failed to queue scan: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/scans/queue", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var jobs []models.ScanJob
+	if err := json.Unmarshal(rr.Body.Bytes(), &jobs); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if len(jobs) != 1 || jobs[0].ID != job.ID || jobs[0].Position != 1 || jobs[0].RequestedBy != "tester" {
+		t.Errorf("Unexpected queue: %+v", jobs)
+	}
+
+	// Remove the job from the queue
+	req = httptest.NewRequest("DELETE", fmt.Sprintf("/api/scans/queue/%d", job.ID), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Delete returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+
+	// It can only be removed once
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("DELETE", fmt.Sprintf("/api/scans/queue/%d", job.ID), nil))
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Second delete returned wrong status code: got %v want %v", rr.Code, http.StatusConflict)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/api/scans/queue/9999", nil))
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Delete of unknown job returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
 // TestGetScanStatus tests the getScanStatus handler
 func TestGetScanStatus(t *testing.T) {
 	tempDir, _, db, scanService, scanHandler := setupTestEnvironment(t)
@@ -336,6 +725,12 @@ func TestGetScanStatus(t *testing.T) {
 	startTime := time.Now().Add(-30 * time.Second)
 	scanService.SetStartTimeForTesting(startTime)
 	scanService.SetScanIDForTesting(123)
+	scanService.SetProgressForTesting(models.ScanProgress{
+		Percent:        42.5,
+		Phase:          "SYN Stealth Scan",
+		HostsCompleted: 3,
+		UpdatedAt:      time.Now(),
+	})
 
 	req, err = http.NewRequest("GET", "/api/scans/status", nil)
 	if err != nil {
@@ -361,6 +756,15 @@ func TestGetScanStatus(t *testing.T) {
 		t.Errorf("Expected scanID 123, got %v", scanID)
 	}
 
+	progress, ok := response["progress"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected progress in running status, got %v", response["progress"])
+	}
+
+	if progress["percent"] != 42.5 || progress["phase"] != "SYN Stealth Scan" || progress["hostsCompleted"] != float64(3) {
+		t.Errorf("Unexpected progress: %v", progress)
+	}
+
 	// Test with completed status
 	scanService.SetStatusForTesting("completed")
 	scanService.SetDevicesFoundForTesting(10)
@@ -442,4 +846,175 @@ func TestGetScanTemplates(t *testing.T) {
 	}
 }
 
+// TestScanTemplateHandlers tests creating, updating and deleting scan templates via the API
+func TestScanTemplateHandlers(t *testing.T) {
+	tempDir, _, db, _, scanHandler := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	router := mux.NewRouter()
+	scanHandler.RegisterRoutes(router)
+
+	// Create a template
+	body := `{"name": "iot-safe", "description": "Gentle scan", "nmapArgs": ["-sT", "-T2"], "rateLimit": 50}`
+	req := httptest.NewRequest("POST", "/api/scans/templates", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Create returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+
+	var created models.ScanTemplate
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if created.ID != "iot-safe" || created.Source != "database" {
+		t.Errorf("Unexpected created template: %+v", created)
+	}
+
+	// Invalid templates are rejected with an explanation
+	body = `{"name": "bad", "nmapArgs": ["-iL", "/etc/shadow"]}`
+	req = httptest.NewRequest("POST", "/api/scans/templates", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Invalid template returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	var validation map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &validation); err != nil {
+		t.Fatalf("Failed to parse validation response: %v", err)
+	}
+
+	if problems, ok := validation["problems"].([]interface{}); !ok || len(problems) == 0 {
+		t.Errorf("Expected validation problems, got %v", validation["problems"])
+	}
+
+	violations, ok := validation["violations"].([]interface{})
+	if !ok || len(violations) == 0 {
+		t.Fatalf("Expected argument violations, got %v", validation["violations"])
+	}
+
+	if violation := violations[0].(map[string]interface{}); violation["arg"] != "-iL" || violation["reason"] == "" {
+		t.Errorf("Unexpected argument violation: %v", violation)
+	}
+
+	// Update the template
+	body = `{"description": "Updated", "nmapArgs": ["-sT"], "rateLimit": 25}`
+	req = httptest.NewRequest("PUT", "/api/scans/templates/iot-safe", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Update returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Built-in templates cannot be modified
+	req = httptest.NewRequest("DELETE", "/api/scans/templates/default", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Delete of built-in returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	// Delete the template
+	req = httptest.NewRequest("DELETE", "/api/scans/templates/iot-safe", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Delete returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+
+	// Unknown templates are rejected when starting a scan
+	req = httptest.NewRequest("POST", "/api/scans", strings.NewReader(`{"template": "iot-safe"}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Scan with unknown template returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// TestCancelScan tests the cancelScan handler
+func TestCancelScan(t *testing.T) {
+	tempDir, _, db, scanService, scanHandler := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	// Use a mock nmap that runs until it is killed
+	script := "#!/bin/sh\nsleep 30\n"
+	if err := os.WriteFile(filepath.Join(tempDir, "nmap"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write mock nmap script: %v", err)
+	}
+	os.Setenv("PATH", tempDir+":"+os.Getenv("PATH"))
+
+	router := mux.NewRouter()
+	scanHandler.RegisterRoutes(router)
+
+	// Completed scans cannot be cancelled
+	scanIDs := createTestScans(t, db, 1)
+	req := httptest.NewRequest("POST", fmt.Sprintf("/api/scans/%d/cancel", scanIDs[0]), nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Cancel of completed scan returned wrong status code: got %v want %v", rr.Code, http.StatusConflict)
+	}
+
+	// Unknown scans are not found
+	req = httptest.NewRequest("DELETE", "/api/scans/9999", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Cancel of unknown scan returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	// Start a scan and wait for it to be running
+	done := make(chan struct{})
+	go func() {
+		scanService.RunScan(context.Background(), "default")
+		close(done)
+	}()
+
+	var scanID int64
+	deadline := time.Now().Add(5 * time.Second)
+	for scanID == 0 && time.Now().Before(deadline) {
+		if status := scanService.GetStatus(); status.Status == "running" {
+			scanID = status.ScanID
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if scanID == 0 {
+		t.Fatalf("Timed out waiting for scan to start")
+	}
+
+	req = httptest.NewRequest("DELETE", fmt.Sprintf("/api/scans/%d", scanID), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("Cancel of running scan returned wrong status code: got %v want %v", rr.Code, http.StatusAccepted)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Scan did not stop after cancellation")
+	}
+
+	scan, err := db.GetScan(scanID)
+	if err != nil {
+		t.Fatalf("Failed to get scan: %v", err)
+	}
+	if scan.Status != "cancelled" {
+		t.Errorf("Expected scan status 'cancelled', got '%s'", scan.Status)
+	}
+}
+
 // Note: All testing helper methods have been moved to the scanner package
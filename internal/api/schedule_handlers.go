@@ -0,0 +1,162 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"panopticon-scanner/internal/models"
+	"panopticon-scanner/internal/scanner"
+)
+
+// ScheduleHandler handles the scan schedule API endpoints
+type ScheduleHandler struct {
+	scanService *scanner.ScanService
+}
+
+// NewScheduleHandler creates a new schedule handler
+func NewScheduleHandler(scanService *scanner.ScanService) *ScheduleHandler {
+	return &ScheduleHandler{
+		scanService: scanService,
+	}
+}
+
+// RegisterRoutes registers the schedule routes
+func (h *ScheduleHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/api/schedules", h.getSchedules).Methods("GET")
+	r.HandleFunc("/api/schedules", h.createSchedule).Methods("POST")
+	r.HandleFunc("/api/schedules/{name}", h.getSchedule).Methods("GET")
+	r.HandleFunc("/api/schedules/{name}", h.updateSchedule).Methods("PUT")
+	r.HandleFunc("/api/schedules/{name}", h.deleteSchedule).Methods("DELETE")
+	r.HandleFunc("/api/schedules/{name}/runs", h.getScheduleRuns).Methods("GET")
+}
+
+// getSchedules returns all schedules with their next and last runs
+func (h *ScheduleHandler) getSchedules(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "getSchedules").Logger()
+
+	schedules, err := h.scanService.GetSchedules()
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to retrieve schedules")
+		http.Error(w, "Failed to retrieve schedules", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, schedules)
+}
+
+// getSchedule returns a single schedule
+func (h *ScheduleHandler) getSchedule(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "getSchedule").Logger()
+
+	schedule, err := h.scanService.GetSchedule(mux.Vars(r)["name"])
+	if err != nil {
+		h.writeScheduleError(w, logger, err)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, schedule)
+}
+
+// getScheduleRuns returns the run history of a schedule
+func (h *ScheduleHandler) getScheduleRuns(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "getScheduleRuns").Logger()
+
+	limit := 50 // Default limit
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsedLimit, err := strconv.Atoi(limitParam)
+		if err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	runs, err := h.scanService.GetScheduleRuns(mux.Vars(r)["name"], limit)
+	if err != nil {
+		h.writeScheduleError(w, logger, err)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, runs)
+}
+
+// createSchedule validates and stores a new schedule
+func (h *ScheduleHandler) createSchedule(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "createSchedule").Logger()
+
+	// Schedules are enabled unless the request says otherwise
+	schedule := models.Schedule{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		logger.Error().Err(err).Msg("Failed to parse schedule")
+		http.Error(w, "Invalid schedule", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.scanService.CreateSchedule(&schedule)
+	if err != nil {
+		h.writeScheduleError(w, logger, err)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusCreated, created)
+}
+
+// updateSchedule validates and replaces a schedule
+func (h *ScheduleHandler) updateSchedule(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "updateSchedule").Logger()
+
+	schedule := models.Schedule{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		logger.Error().Err(err).Msg("Failed to parse schedule")
+		http.Error(w, "Invalid schedule", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.scanService.UpdateSchedule(mux.Vars(r)["name"], &schedule)
+	if err != nil {
+		h.writeScheduleError(w, logger, err)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, updated)
+}
+
+// deleteSchedule removes a schedule
+func (h *ScheduleHandler) deleteSchedule(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "deleteSchedule").Logger()
+
+	if err := h.scanService.DeleteSchedule(mux.Vars(r)["name"]); err != nil {
+		h.writeScheduleError(w, logger, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeScheduleError maps schedule errors to HTTP responses
+func (h *ScheduleHandler) writeScheduleError(w http.ResponseWriter, logger zerolog.Logger, err error) {
+	var validationErr *scanner.ScheduleValidationError
+
+	switch {
+	case errors.As(err, &validationErr):
+		logger.Warn().Err(err).Msg("Rejected invalid schedule")
+		writeJSON(w, logger, http.StatusBadRequest, map[string]interface{}{
+			"error":    "Invalid schedule",
+			"schedule": validationErr.Schedule,
+			"problems": validationErr.Problems,
+		})
+	case errors.Is(err, scanner.ErrScheduleNotFound):
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+	case errors.Is(err, scanner.ErrScheduleExists):
+		http.Error(w, "Schedule already exists", http.StatusConflict)
+	case errors.Is(err, scanner.ErrScheduleReadOnly):
+		http.Error(w, "Configured schedules cannot be modified", http.StatusForbidden)
+	default:
+		logger.Error().Err(err).Msg("Failed to save schedule")
+		http.Error(w, "Failed to save schedule", http.StatusInternalServerError)
+	}
+}
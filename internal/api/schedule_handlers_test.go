@@ -0,0 +1,110 @@
+// internal/api/schedule_handlers_test.go
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestScheduleHandlers tests the schedule endpoints
+func TestScheduleHandlers(t *testing.T) {
+	tempDir, _, db, scanService, _ := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	router := mux.NewRouter()
+	NewScheduleHandler(scanService).RegisterRoutes(router)
+
+	// Create a schedule; it is enabled unless the request says otherwise
+	body := `{"name": "nightly", "cron": "0 2 * * *", "template": "thorough", "blackouts": [{"start": "01:00", "end": "03:00"}]}`
+	req := httptest.NewRequest("POST", "/api/schedules", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Create returned wrong status code: got %v want %v (%s)", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+
+	var created models.Schedule
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if !created.Enabled || created.Source != "database" {
+		t.Errorf("Unexpected created schedule: %+v", created)
+	}
+
+	// Invalid schedules are rejected with an explanation
+	req = httptest.NewRequest("POST", "/api/schedules", strings.NewReader(`{"name": "bad", "cron": "61 * * * *", "template": "default"}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Invalid schedule returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	// List includes the default schedule built from the scan frequency
+	req = httptest.NewRequest("GET", "/api/schedules", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var schedules []models.Schedule
+	if err := json.Unmarshal(rr.Body.Bytes(), &schedules); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if len(schedules) != 2 || schedules[0].Name != "default" || schedules[1].Name != "nightly" {
+		t.Errorf("Unexpected schedule list: %+v", schedules)
+	}
+
+	// Update the schedule
+	req = httptest.NewRequest("PUT", "/api/schedules/nightly", strings.NewReader(`{"cron": "0 3 * * *", "template": "default", "enabled": false}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Update returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Run history
+	req = httptest.NewRequest("GET", "/api/schedules/nightly/runs", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Errorf("Unexpected run history response: %v %s", rr.Code, rr.Body.String())
+	}
+
+	// Configured schedules cannot be modified
+	req = httptest.NewRequest("DELETE", "/api/schedules/default", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Delete of configured schedule returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	req = httptest.NewRequest("DELETE", "/api/schedules/nightly", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Delete returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+
+	req = httptest.NewRequest("GET", "/api/schedules/nightly", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Get of deleted schedule returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"runtime"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -12,6 +13,7 @@ import (
 
 	"panopticon-scanner/internal/config"
 	"panopticon-scanner/internal/database"
+	"panopticon-scanner/internal/maintenance"
 	"panopticon-scanner/internal/scanner"
 )
 
@@ -38,6 +40,7 @@ func (h *StatusHandler) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/api/status", h.getSystemStatus).Methods("GET")
 	r.HandleFunc("/api/status/health", h.getHealthCheck).Methods("GET")
 	r.HandleFunc("/api/status/database", h.getDatabaseStatus).Methods("GET")
+	r.HandleFunc("/api/status/maintenance", h.getMaintenanceRuns).Methods("GET")
 }
 
 // getSystemStatus returns the overall system status
@@ -53,6 +56,15 @@ func (h *StatusHandler) getSystemStatus(w http.ResponseWriter, r *http.Request)
 	// Get current scan status
 	scanStatus := h.scanService.GetStatus()
 
+	// Get the time of the last successful backup
+	var lastBackup interface{} = "N/A"
+	backup, err := h.db.GetLastCompletedMaintenanceRun(maintenance.TaskBackup)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to retrieve last backup")
+	} else if backup != nil {
+		lastBackup = backup.FinishedAt
+	}
+
 	// Build memory stats
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
@@ -101,7 +113,7 @@ func (h *StatusHandler) getSystemStatus(w http.ResponseWriter, r *http.Request)
 			"deviceCount":   dbStats["deviceCount"],
 			"portCount":     dbStats["portCount"],
 			"path":          h.cfg.Database.Path,
-			"lastBackup":    "N/A", // Would need to track this separately
+			"lastBackup":    lastBackup,
 		},
 		"timestamp": time.Now(),
 	}
@@ -189,4 +201,26 @@ func (h *StatusHandler) getDatabaseStatus(w http.ResponseWriter, r *http.Request
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
 	}
-}
\ No newline at end of file
+}
+
+// getMaintenanceRuns returns the most recent maintenance task runs
+func (h *StatusHandler) getMaintenanceRuns(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "getMaintenanceRuns").Logger()
+
+	limit := 50 // Default limit
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsedLimit, err := strconv.Atoi(limitParam)
+		if err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	runs, err := h.db.GetMaintenanceRuns(limit)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to retrieve maintenance runs")
+		http.Error(w, "Failed to retrieve maintenance runs", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, runs)
+}
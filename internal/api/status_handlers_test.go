@@ -0,0 +1,72 @@
+// internal/api/status_handlers_test.go
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestMaintenanceStatus tests that maintenance runs are reported in the status endpoints
+func TestMaintenanceStatus(t *testing.T) {
+	tempDir, cfg, db, scanService, _ := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	router := mux.NewRouter()
+	NewStatusHandler(db, scanService, cfg).RegisterRoutes(router)
+
+	finished := time.Date(2024, 3, 4, 2, 5, 0, 0, time.UTC)
+	_, err := db.AddMaintenanceRun(&models.MaintenanceRun{
+		Task:        "backup",
+		ScheduledAt: finished.Add(-5 * time.Minute),
+		StartedAt:   finished.Add(-time.Minute),
+		FinishedAt:  finished,
+		Status:      "completed",
+		Details:     "/backups/test.db",
+	})
+	if err != nil {
+		t.Fatalf("Failed to add maintenance run: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var status struct {
+		Database struct {
+			LastBackup time.Time `json:"lastBackup"`
+		} `json:"database"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if !status.Database.LastBackup.Equal(finished) {
+		t.Errorf("Expected last backup %v, got %v", finished, status.Database.LastBackup)
+	}
+
+	req = httptest.NewRequest("GET", "/api/status/maintenance?limit=10", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Maintenance runs returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var runs []models.MaintenanceRun
+	if err := json.Unmarshal(rr.Body.Bytes(), &runs); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if len(runs) != 1 || runs[0].Task != "backup" || runs[0].Details != "/backups/test.db" {
+		t.Errorf("Unexpected maintenance runs: %+v", runs)
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+
+	"panopticon-scanner/internal/database"
+	"panopticon-scanner/internal/nvd"
+)
+
+// maxFeedSize is the largest NVD feed that can be uploaded
+const maxFeedSize = 1 << 30
+
+// VulnerabilityHandler handles vulnerability findings and NVD feed imports
+type VulnerabilityHandler struct {
+	db *database.DB
+}
+
+// NewVulnerabilityHandler creates a new vulnerability handler
+func NewVulnerabilityHandler(db *database.DB) *VulnerabilityHandler {
+	return &VulnerabilityHandler{
+		db: db,
+	}
+}
+
+// RegisterRoutes registers the vulnerability routes
+func (h *VulnerabilityHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/api/vulnerabilities", h.getVulnerabilities).Methods("GET")
+	r.HandleFunc("/api/vulnerabilities/import", h.importFeed).Methods("POST")
+}
+
+// getVulnerabilities returns unresolved findings, highest CVSS score first,
+// optionally filtered by device, CVE, severity and minimum CVSS score
+func (h *VulnerabilityHandler) getVulnerabilities(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "getVulnerabilities").Logger()
+	query := r.URL.Query()
+
+	filter := database.VulnerabilityFilter{
+		CVEID:           query.Get("cve"),
+		Severity:        query.Get("severity"),
+		IncludeResolved: query.Get("resolved") == "true",
+		Limit:           100, // Default limit
+	}
+
+	if device := query.Get("device"); device != "" {
+		id, err := strconv.ParseInt(device, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid device ID", http.StatusBadRequest)
+			return
+		}
+		filter.DeviceID = id
+	}
+
+	if minCVSS := query.Get("minCvss"); minCVSS != "" {
+		score, err := strconv.ParseFloat(minCVSS, 64)
+		if err != nil || score < 0 || score > 10 {
+			http.Error(w, "Invalid minCvss: expected a score from 0 to 10", http.StatusBadRequest)
+			return
+		}
+		filter.MinCVSS = score
+	}
+
+	if limitParam := query.Get("limit"); limitParam != "" {
+		parsedLimit, err := strconv.Atoi(limitParam)
+		if err == nil && parsedLimit > 0 {
+			filter.Limit = parsedLimit
+		}
+	}
+
+	vulnerabilities, err := h.db.GetVulnerabilities(filter)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to retrieve vulnerabilities")
+		http.Error(w, "Failed to retrieve vulnerabilities", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, vulnerabilities)
+}
+
+// importFeed imports an NVD JSON feed, optionally gzipped, uploaded as the
+// "file" field of a multipart form, and matches every device against it
+func (h *VulnerabilityHandler) importFeed(w http.ResponseWriter, r *http.Request) {
+	logger := log.With().Str("handler", "importFeed").Logger()
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxFeedSize)
+	if err := r.ParseMultipartForm(importMemory); err != nil {
+		logger.Warn().Err(err).Msg("Failed to parse feed upload")
+		http.Error(w, "Invalid upload: expected a multipart form with a file field", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Missing file field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	cves, err := nvd.Parse(file)
+	if err != nil {
+		if errors.Is(err, nvd.ErrInvalidFeed) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.Error().Err(err).Str("file", header.Filename).Msg("Failed to read NVD feed")
+		http.Error(w, "Failed to read NVD feed", http.StatusInternalServerError)
+		return
+	}
+
+	imported, findings, err := h.db.ImportVulnerabilities(cves)
+	if err != nil {
+		logger.Error().Err(err).Str("file", header.Filename).Msg("Failed to import NVD feed")
+		http.Error(w, "Failed to import NVD feed", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, map[string]int{
+		"imported": imported,
+		"findings": findings,
+	})
+}
@@ -0,0 +1,133 @@
+// internal/api/vulnerability_handlers_test.go
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"panopticon-scanner/internal/models"
+)
+
+// vulnerabilityTestFeed is an NVD 2.0 feed with one OpenSSH CVE
+const vulnerabilityTestFeed = `{
+  "vulnerabilities": [{
+    "cve": {
+      "id": "CVE-2023-38408",
+      "published": "2023-07-20T03:15:10.170",
+      "descriptions": [{"lang": "en", "value": "The PKCS#11 feature in ssh-agent in OpenSSH before 9.3p2 has an insufficiently trustworthy search path."}],
+      "metrics": {"cvssMetricV31": [{"type": "Primary", "cvssData": {"baseScore": 9.8, "baseSeverity": "CRITICAL"}}]},
+      "configurations": [{"nodes": [{"cpeMatch": [
+        {"vulnerable": true, "criteria": "cpe:2.3:a:openbsd:openssh:*:*:*:*:*:*:*:*", "versionEndExcluding": "9.3"}
+      ]}]}]
+    }
+  }]
+}`
+
+// TestVulnerabilityHandlers tests importing a feed and listing the findings
+// it produces
+func TestVulnerabilityHandlers(t *testing.T) {
+	tempDir, _, db, _, _ := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	deviceID, err := db.SaveDevice(&models.Device{IPAddress: "10.1.0.9"})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	err = db.SavePort(&models.Port{
+		DeviceID: deviceID, PortNumber: 22, Protocol: "tcp", ServiceName: "ssh",
+		CPEs: []string{"cpe:/a:openbsd:openssh:8.9p1"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to save port: %v", err)
+	}
+
+	router := mux.NewRouter()
+	NewVulnerabilityHandler(db).RegisterRoutes(router)
+	NewDeviceHandler(db).RegisterRoutes(router)
+
+	req := uploadRequest(t, "file", "nvdcve-2.0-2023.json", vulnerabilityTestFeed)
+	req.URL.Path = "/api/vulnerabilities/import"
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v (%s)", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var result map[string]int
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if result["imported"] != 1 || result["findings"] != 1 {
+		t.Errorf("Expected 1 CVE and 1 finding, got %v", result)
+	}
+
+	req = uploadRequest(t, "file", "bad.json", `{"results": []}`)
+	req.URL.Path = "/api/vulnerabilities/import"
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected %d for an invalid feed, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	list := func(query string) []*models.Vulnerability {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/vulnerabilities"+query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Handler returned wrong status code: got %v want %v (%s)", rr.Code, http.StatusOK, rr.Body.String())
+		}
+		var vulnerabilities []*models.Vulnerability
+		if err := json.Unmarshal(rr.Body.Bytes(), &vulnerabilities); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		return vulnerabilities
+	}
+
+	vulnerabilities := list("")
+	if len(vulnerabilities) != 1 {
+		t.Fatalf("Expected 1 vulnerability, got %d", len(vulnerabilities))
+	}
+	if v := vulnerabilities[0]; v.CVEID != "CVE-2023-38408" || v.IPAddress != "10.1.0.9" || v.PortNumber != 22 || v.CVSS != 9.8 {
+		t.Errorf("Unexpected vulnerability: %+v", v)
+	}
+	if n := len(list("?device=" + strconv.FormatInt(deviceID, 10) + "&severity=critical")); n != 1 {
+		t.Errorf("Expected 1 critical vulnerability on the device, got %d", n)
+	}
+	if n := len(list("?minCvss=10")); n != 0 {
+		t.Errorf("Expected no vulnerabilities scoring 10, got %d", n)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/vulnerabilities?minCvss=high", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected %d for an invalid minCvss, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	// Device details and stats include the finding
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/devices/"+strconv.FormatInt(deviceID, 10), nil))
+	var details models.DeviceDetails
+	if err := json.Unmarshal(rr.Body.Bytes(), &details); err != nil {
+		t.Fatalf("Failed to parse device details: %v", err)
+	}
+	if len(details.Vulnerabilities) != 1 || len(details.Ports) != 1 || len(details.Ports[0].CPEs) != 1 {
+		t.Errorf("Expected the device's CPE and vulnerability, got %+v", details)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/devices/stats", nil))
+	var stats models.NetworkStats
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to parse stats: %v", err)
+	}
+	if stats.ActiveVulnerabilities != 1 {
+		t.Errorf("Expected 1 active vulnerability, got %d", stats.ActiveVulnerabilities)
+	}
+}
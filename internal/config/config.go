@@ -39,10 +39,17 @@ type Config struct {
 		CompressOutput       bool     `yaml:"compressOutput"`
 		EnableScheduler      bool     `yaml:"enableScheduler"`
 		DefaultTemplate      string   `yaml:"defaultTemplate"`
-		Templates            []string `yaml:"templates"`
+		Templates            []ScanTemplateConfig `yaml:"templates"`
 		ExcludeHosts         []string `yaml:"excludeHosts"`
 		EnableOSDetection    bool     `yaml:"enableOSDetection"`
 		EnableVersionDetection bool   `yaml:"enableVersionDetection"`
+		StatsInterval        string   `yaml:"statsInterval"`
+		Schedules            []ScheduleConfig `yaml:"schedules"`
+		AuthorizedScopes     []ScopeConfig `yaml:"authorizedScopes"`
+		TargetSizeLimit      int      `yaml:"targetSizeLimit"`
+		Reconciliation       ReconciliationConfig `yaml:"reconciliation"`
+		OUIDatabase          string   `yaml:"ouiDatabase"`
+		OSChangeMinAccuracy  int      `yaml:"osChangeMinAccuracy"`
 	} `yaml:"scanner"`
 
 	Database struct {
@@ -103,6 +110,52 @@ type Config struct {
 	mu   sync.RWMutex
 }
 
+// ScanTemplateConfig defines a user-provided scan template. Templates listed in
+// the configuration are merged with the built-in templates by the scanner.
+type ScanTemplateConfig struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	NmapArgs    []string `yaml:"nmapArgs"`
+	RateLimit   int      `yaml:"rateLimit"`
+}
+
+// ScheduleConfig defines a recurring scan. Schedules listed in the
+// configuration replace the single schedule built from Frequency.
+type ScheduleConfig struct {
+	Name          string           `yaml:"name"`
+	Cron          string           `yaml:"cron"`
+	Template      string           `yaml:"template"`
+	TargetNetwork string           `yaml:"targetNetwork"`
+	Site          string           `yaml:"site"`
+	Jitter        string           `yaml:"jitter"`
+	Blackouts     []BlackoutConfig `yaml:"blackouts"`
+}
+
+// BlackoutConfig defines a daily window, in HH:MM form, during which a
+// schedule does not run
+type BlackoutConfig struct {
+	Start string   `yaml:"start"`
+	End   string   `yaml:"end"`
+	Days  []string `yaml:"days"`
+}
+
+// ScopeConfig defines networks the scanner is authorized to scan. Scopes may
+// be grouped by site so that a scan request for a site is limited to its networks.
+type ScopeConfig struct {
+	Site     string   `yaml:"site"`
+	Networks []string `yaml:"networks"`
+}
+
+// ReconciliationConfig controls how a completed scan is compared against the
+// inventory. A port or device is only reported closed or offline once it has
+// been missed by the given number of consecutive scans that covered it, so
+// that a single dropped probe does not raise a change.
+type ReconciliationConfig struct {
+	Enabled           bool `yaml:"enabled"`
+	PortMissedScans   int  `yaml:"portMissedScans"`
+	DeviceMissedScans int  `yaml:"deviceMissedScans"`
+}
+
 var (
 	instance *Config
 	once     sync.Once
@@ -210,6 +263,68 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid rate limit: %d", c.Scanner.RateLimit)
 	}
 
+	if c.Scanner.StatsInterval != "" {
+		interval, err := time.ParseDuration(c.Scanner.StatsInterval)
+		if err != nil || interval < time.Second {
+			return fmt.Errorf("invalid stats interval: %s", c.Scanner.StatsInterval)
+		}
+	}
+
+	if c.Scanner.TargetSizeLimit < 0 || c.Scanner.TargetSizeLimit > 32 {
+		return fmt.Errorf("invalid target size limit: /%d", c.Scanner.TargetSizeLimit)
+	}
+
+	if c.Scanner.OSChangeMinAccuracy < 0 || c.Scanner.OSChangeMinAccuracy > 100 {
+		return fmt.Errorf("invalid OS change minimum accuracy: %d%%", c.Scanner.OSChangeMinAccuracy)
+	}
+
+	if c.Scanner.Reconciliation.PortMissedScans < 1 {
+		return fmt.Errorf("invalid reconciliation port missed scans: %d", c.Scanner.Reconciliation.PortMissedScans)
+	}
+
+	if c.Scanner.Reconciliation.DeviceMissedScans < 1 {
+		return fmt.Errorf("invalid reconciliation device missed scans: %d", c.Scanner.Reconciliation.DeviceMissedScans)
+	}
+
+	scheduleNames := make(map[string]bool)
+	for i, schedule := range c.Scanner.Schedules {
+		if schedule.Name == "" {
+			return fmt.Errorf("schedule #%d has no name", i+1)
+		}
+		if scheduleNames[schedule.Name] {
+			return fmt.Errorf("duplicate schedule: %s", schedule.Name)
+		}
+		if schedule.Cron == "" {
+			return fmt.Errorf("schedule %s has no cron expression", schedule.Name)
+		}
+		if schedule.Jitter != "" {
+			if _, err := time.ParseDuration(schedule.Jitter); err != nil {
+				return fmt.Errorf("invalid jitter for schedule %s: %s", schedule.Name, schedule.Jitter)
+			}
+		}
+		scheduleNames[schedule.Name] = true
+	}
+
+	for i, scope := range c.Scanner.AuthorizedScopes {
+		if len(scope.Networks) == 0 {
+			return fmt.Errorf("authorized scope #%d has no networks", i+1)
+		}
+	}
+
+	templateNames := make(map[string]bool)
+	for i, template := range c.Scanner.Templates {
+		if template.Name == "" {
+			return fmt.Errorf("scan template #%d has no name", i+1)
+		}
+		if templateNames[template.Name] {
+			return fmt.Errorf("duplicate scan template: %s", template.Name)
+		}
+		if template.RateLimit < 0 {
+			return fmt.Errorf("invalid rate limit for scan template %s: %d", template.Name, template.RateLimit)
+		}
+		templateNames[template.Name] = true
+	}
+
 	// Database validation
 	if c.Database.Path == "" {
 		return errors.New("database path is required")
@@ -238,6 +353,14 @@ func (c *Config) GetScanFrequency() (time.Duration, error) {
 	return time.ParseDuration(c.Scanner.Frequency)
 }
 
+// GetStatsInterval returns how often nmap reports scan progress
+func (c *Config) GetStatsInterval() (time.Duration, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return time.ParseDuration(c.Scanner.StatsInterval)
+}
+
 // GetBackupFrequency returns the backup frequency as a parsed duration
 func (c *Config) GetBackupFrequency() (time.Duration, error) {
 	c.mu.RLock()
@@ -277,6 +400,12 @@ func setDefaults(c *Config) {
 	c.Scanner.DefaultTemplate = "default"
 	c.Scanner.EnableOSDetection = true
 	c.Scanner.EnableVersionDetection = true
+	c.Scanner.StatsInterval = "10s"
+	c.Scanner.TargetSizeLimit = 16
+	c.Scanner.OSChangeMinAccuracy = 90
+	c.Scanner.Reconciliation.Enabled = true
+	c.Scanner.Reconciliation.PortMissedScans = 2
+	c.Scanner.Reconciliation.DeviceMissedScans = 3
 
 	// Database defaults
 	c.Database.Path = "./data/panopticon.db"
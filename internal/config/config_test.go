@@ -191,6 +191,79 @@ func TestValidate(t *testing.T) {
 	}
 	cfg.Scanner.RateLimit = 1000 // Reset
 
+	// Test stats interval below nmap's one second resolution
+	cfg.Scanner.StatsInterval = "500ms"
+	err = cfg.Validate()
+	if err == nil {
+		t.Errorf("Expected error for invalid stats interval, got nil")
+	}
+	cfg.Scanner.StatsInterval = "10s" // Reset
+
+	// Test target size limit outside the IPv4 prefix lengths
+	cfg.Scanner.TargetSizeLimit = 33
+	err = cfg.Validate()
+	if err == nil {
+		t.Errorf("Expected error for invalid target size limit, got nil")
+	}
+	cfg.Scanner.TargetSizeLimit = 16 // Reset
+
+	// Test an OS accuracy that is not a percentage
+	cfg.Scanner.OSChangeMinAccuracy = 101
+	err = cfg.Validate()
+	if err == nil {
+		t.Errorf("Expected error for invalid OS change minimum accuracy, got nil")
+	}
+	cfg.Scanner.OSChangeMinAccuracy = 90 // Reset
+
+	// Test reconciliation that would report a port closed without missing it
+	cfg.Scanner.Reconciliation.PortMissedScans = 0
+	err = cfg.Validate()
+	if err == nil {
+		t.Errorf("Expected error for invalid port missed scans, got nil")
+	}
+	cfg.Scanner.Reconciliation.PortMissedScans = 2 // Reset
+
+	cfg.Scanner.Reconciliation.DeviceMissedScans = 0
+	err = cfg.Validate()
+	if err == nil {
+		t.Errorf("Expected error for invalid device missed scans, got nil")
+	}
+	cfg.Scanner.Reconciliation.DeviceMissedScans = 3 // Reset
+
+	// Test authorized scope without networks
+	cfg.Scanner.AuthorizedScopes = []ScopeConfig{{Site: "office"}}
+	err = cfg.Validate()
+	if err == nil {
+		t.Errorf("Expected error for empty authorized scope, got nil")
+	}
+	cfg.Scanner.AuthorizedScopes = nil // Reset
+
+	// Test duplicate scan template names
+	cfg.Scanner.Templates = []ScanTemplateConfig{
+		{Name: "iot-safe", NmapArgs: []string{"-sT", "-T2"}},
+		{Name: "iot-safe", NmapArgs: []string{"-sS"}},
+	}
+	err = cfg.Validate()
+	if err == nil {
+		t.Errorf("Expected error for duplicate scan template, got nil")
+	}
+
+	// Test unnamed scan template
+	cfg.Scanner.Templates = []ScanTemplateConfig{{NmapArgs: []string{"-sS"}}}
+	err = cfg.Validate()
+	if err == nil {
+		t.Errorf("Expected error for unnamed scan template, got nil")
+	}
+	cfg.Scanner.Templates = nil // Reset
+
+	// Test schedule without a cron expression
+	cfg.Scanner.Schedules = []ScheduleConfig{{Name: "nightly"}}
+	err = cfg.Validate()
+	if err == nil {
+		t.Errorf("Expected error for schedule without cron expression, got nil")
+	}
+	cfg.Scanner.Schedules = nil // Reset
+
 	// Test missing database path
 	cfg.Database.Path = ""
 	err = cfg.Validate()
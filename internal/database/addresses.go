@@ -0,0 +1,178 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// NormalizeIP returns the canonical form of an IP address, so that
+// "2001:0db8:0000:0000:0000:0000:0000:0001" and "2001:db8::1" are stored and
+// matched alike. Values that are not IP addresses are returned unchanged.
+func NormalizeIP(address string) string {
+	ip := net.ParseIP(strings.TrimSpace(address))
+	if ip == nil {
+		return address
+	}
+	return ip.String()
+}
+
+// isIPv6 reports whether a normalized address is an IPv6 address
+func isIPv6(address string) bool {
+	return strings.Contains(address, ":")
+}
+
+// addressFamily returns the family of a normalized address
+func addressFamily(address string) string {
+	if isIPv6(address) {
+		return "ipv6"
+	}
+	return "ipv4"
+}
+
+// normalizeAddressQuery rewrites a search for an IP address in the form
+// addresses are stored in. Complete addresses are normalized; partial IPv6
+// addresses lose the leading zeros of each group, so "2001:0db8:00a" finds
+// 2001:db8:a::1.
+func normalizeAddressQuery(query string) string {
+	if ip := net.ParseIP(query); ip != nil {
+		return ip.String()
+	}
+
+	if !strings.Contains(query, ":") || strings.Trim(strings.ToLower(query), "0123456789abcdef:") != "" {
+		return query
+	}
+
+	groups := strings.Split(strings.ToLower(query), ":")
+	for i, group := range groups {
+		if trimmed := strings.TrimLeft(group, "0"); trimmed != "" {
+			groups[i] = trimmed
+		} else if group != "" {
+			groups[i] = "0"
+		}
+	}
+	return strings.Join(groups, ":")
+}
+
+// hasDeviceAddress reports whether a device has been seen at an address
+func hasDeviceAddress(tx *sql.Tx, deviceID int64, address string) (bool, error) {
+	var count int
+	err := tx.QueryRow(
+		`SELECT COUNT(*) FROM device_addresses WHERE device_id = ? AND address = ?`, deviceID, address,
+	).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check addresses of device %d: %w", deviceID, err)
+	}
+	return count > 0, nil
+}
+
+// saveDeviceAddress records that a device was seen at an address. Results
+// older than those already recorded only widen the period it was seen there.
+func saveDeviceAddress(tx *sql.Tx, deviceID int64, address string, seen time.Time) error {
+	_, err := tx.Exec(
+		`INSERT INTO device_addresses (device_id, address, family, first_seen, last_seen)
+		 VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(device_id, address) DO UPDATE SET
+		   first_seen = MIN(first_seen, excluded.first_seen), last_seen = MAX(last_seen, excluded.last_seen)`,
+		deviceID, address, addressFamily(address), seen, seen,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save address %s of device %d: %w", address, deviceID, err)
+	}
+	return nil
+}
+
+// SaveDeviceAddress records that the scan in sc also saw a device at address,
+// such as the IPv6 address of a host reported with both families
+func (db *DB) SaveDeviceAddress(sc ScanContext, deviceID int64, address string) error {
+	db.Lock()
+	defer db.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := saveDeviceAddress(tx, deviceID, NormalizeIP(address), sc.observedAt().Truncate(time.Hour)); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	tx = nil
+
+	return nil
+}
+
+// getDeviceAddresses returns every address a device has been seen at, IPv4
+// addresses first
+func (db *DB) getDeviceAddresses(deviceID int64) ([]string, error) {
+	rows, err := db.Query(
+		`SELECT address FROM device_addresses WHERE device_id = ? ORDER BY family, last_seen DESC, address`,
+		deviceID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query addresses of device %d: %w", deviceID, err)
+	}
+	defer rows.Close()
+
+	var addresses []string
+	for rows.Next() {
+		var address string
+		if err := rows.Scan(&address); err != nil {
+			return nil, fmt.Errorf("failed to scan device address: %w", err)
+		}
+		addresses = append(addresses, address)
+	}
+
+	return addresses, rows.Err()
+}
+
+// GetDeviceAddressHistory returns every address a device has been seen at
+// with when it was first and last seen there, most recent first
+func (db *DB) GetDeviceAddressHistory(deviceID int64) ([]*models.DeviceAddress, error) {
+	rows, err := db.Query(
+		`SELECT address, family, first_seen, last_seen FROM device_addresses
+		 WHERE device_id = ? ORDER BY last_seen DESC, address`, deviceID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query addresses of device %d: %w", deviceID, err)
+	}
+	defer rows.Close()
+
+	addresses := []*models.DeviceAddress{}
+	for rows.Next() {
+		var address models.DeviceAddress
+		if err := rows.Scan(&address.Address, &address.Family, &address.FirstSeen, &address.LastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan device address: %w", err)
+		}
+		addresses = append(addresses, &address)
+	}
+
+	return addresses, rows.Err()
+}
+
+// backfillDeviceAddresses records the primary address of devices saved before
+// addresses were tracked
+func (db *DB) backfillDeviceAddresses() error {
+	_, err := db.Exec(
+		`INSERT OR IGNORE INTO device_addresses (device_id, address, family, first_seen, last_seen)
+		 SELECT id, ip_address, CASE WHEN instr(ip_address, ':') > 0 THEN 'ipv6' ELSE 'ipv4' END, first_seen, last_seen
+		 FROM devices d
+		 WHERE NOT EXISTS (SELECT 1 FROM device_addresses a WHERE a.device_id = d.id)`,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to backfill device addresses: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"testing"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestNormalizeAddressQuery tests rewriting address searches into stored notation
+func TestNormalizeAddressQuery(t *testing.T) {
+	tests := map[string]string{
+		"2001:0DB8:0000:0000:0000:0000:0000:0001": "2001:db8::1",
+		"2001:0db8:00a": "2001:db8:a",
+		"fe80::0001":    "fe80::1",
+		"192.168.001":   "192.168.001",
+		"router":        "router",
+		"aa:bb":         "aa:bb",
+	}
+
+	for query, want := range tests {
+		if got := normalizeAddressQuery(query); got != want {
+			t.Errorf("normalizeAddressQuery(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+// TestDualStackDevices tests linking a host's IPv4 and IPv6 addresses by MAC
+func TestDualStackDevices(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// Changes are recorded against the latest scan
+	if _, err := db.CreateScan("default"); err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+
+	ipv4ID, err := db.SaveDevice(&models.Device{IPAddress: "192.168.1.20", MACAddress: "00:11:22:33:44:55", Hostname: "nas"})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+
+	// The IPv6 address arrives in expanded notation from another scan
+	ipv6ID, err := db.SaveDevice(&models.Device{IPAddress: "2001:0db8:0000:0000:0000:0000:0000:0020", MACAddress: "00:11:22:33:44:55"})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+
+	if ipv6ID != ipv4ID {
+		t.Fatalf("Expected the IPv6 address to be linked to device %d, got device %d", ipv4ID, ipv6ID)
+	}
+
+	// Seen again without a MAC, e.g. from beyond a router
+	againID, err := db.SaveDevice(&models.Device{IPAddress: "2001:db8::20"})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+
+	if againID != ipv4ID {
+		t.Errorf("Expected a known IPv6 address to find device %d, got device %d", ipv4ID, againID)
+	}
+
+	device, err := db.GetDevice(ipv4ID)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+
+	if device.IPAddress != "192.168.1.20" || len(device.Addresses) != 2 || device.Addresses[1] != "2001:db8::20" {
+		t.Errorf("Unexpected dual-stack device: %+v", device)
+	}
+
+	var count int
+	err = db.QueryRow(
+		`SELECT COUNT(*) FROM changes WHERE device_id = ? AND change_type = 'device_change' AND details = ?`,
+		ipv4ID, "Address added: 2001:db8::20; ",
+	).Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to count device changes: %v", err)
+	}
+
+	if count != 1 {
+		t.Errorf("Expected one change recording the new address, got %d", count)
+	}
+
+	// Lookups and searches accept either notation
+	for _, address := range []string{"2001:db8::20", "2001:0db8::0020", "2001:0DB8:0:0:0:0:0:20"} {
+		byIP, err := db.GetDeviceByIP(address)
+		if err != nil || byIP.ID != ipv4ID {
+			t.Errorf("GetDeviceByIP(%q) = %v, %v; want device %d", address, byIP, err, ipv4ID)
+		}
+
+		found, err := db.SearchDevices(address)
+		if err != nil || len(found) != 1 || found[0].ID != ipv4ID {
+			t.Errorf("SearchDevices(%q) = %v, %v; want device %d", address, found, err, ipv4ID)
+		}
+	}
+
+	// A different host on the same network stays separate
+	otherID, err := db.SaveDevice(&models.Device{IPAddress: "2001:db8::21", MACAddress: "00:11:22:33:44:66"})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+
+	if otherID == ipv4ID {
+		t.Errorf("Expected a host with another MAC address to be a new device")
+	}
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// AddAuditEntry records a decision in the audit log
+func (db *DB) AddAuditEntry(entry *models.AuditEntry) (int64, error) {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	res, err := db.Exec(
+		`INSERT INTO audit_log (timestamp, action, actor, target, site, reason) VALUES (?, ?, ?, ?, ?, ?)`,
+		entry.Timestamp, entry.Action, entry.Actor, entry.Target, entry.Site, entry.Reason,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add audit entry: %w", err)
+	}
+
+	return res.LastInsertId()
+}
+
+// GetAuditEntries returns the most recent audit log entries, newest first
+func (db *DB) GetAuditEntries(limit int) ([]*models.AuditEntry, error) {
+	rows, err := db.Query(
+		`SELECT id, timestamp, action, COALESCE(actor, ''), COALESCE(target, ''), COALESCE(site, ''), COALESCE(reason, '')
+		FROM audit_log ORDER BY timestamp DESC, id DESC LIMIT ?`, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		if err := rows.Scan(&entry.ID, &entry.Timestamp, &entry.Action, &entry.Actor, &entry.Target, &entry.Site, &entry.Reason); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
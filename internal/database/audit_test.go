@@ -0,0 +1,49 @@
+// internal/database/audit_test.go
+package database
+
+import (
+	"testing"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestAuditLog tests recording and listing audit entries
+func TestAuditLog(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	entries := []*models.AuditEntry{
+		{Timestamp: now.Add(-time.Minute), Action: "scan_authorized", Actor: "admin", Target: "192.168.1.0/24"},
+		{Timestamp: now, Action: "scan_rejected", Actor: "10.0.0.5:1234", Target: "8.8.8.0/24", Site: "office", Reason: "outside the authorized scope"},
+	}
+
+	for _, entry := range entries {
+		if _, err := db.AddAuditEntry(entry); err != nil {
+			t.Fatalf("Failed to add audit entry: %v", err)
+		}
+	}
+
+	stored, err := db.GetAuditEntries(10)
+	if err != nil {
+		t.Fatalf("Failed to get audit entries: %v", err)
+	}
+
+	if len(stored) != 2 {
+		t.Fatalf("Expected 2 audit entries, got %d", len(stored))
+	}
+
+	if stored[0].Action != "scan_rejected" || stored[0].Site != "office" || stored[0].Reason == "" {
+		t.Errorf("Expected newest entry first, got %+v", stored[0])
+	}
+
+	limited, err := db.GetAuditEntries(1)
+	if err != nil {
+		t.Fatalf("Failed to get audit entries: %v", err)
+	}
+
+	if len(limited) != 1 {
+		t.Errorf("Expected 1 audit entry with limit, got %d", len(limited))
+	}
+}
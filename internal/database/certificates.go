@@ -0,0 +1,201 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// CertificateFilter selects certificates. Zero fields select the current
+// certificate of every port.
+type CertificateFilter struct {
+	DeviceID        int64
+	PortNumber      int
+	Query           string    // in the subject, SANs or issuer
+	ExpiresBefore   time.Time // including certificates that have expired
+	IncludeReplaced bool      // include every certificate ports have presented
+	Limit           int
+}
+
+// certificateColumns lists the columns read by scanCertificateRow, for a
+// query joining certificates c with devices d
+const certificateColumns = `c.id, c.device_id, d.ip_address, c.port_number, c.protocol, COALESCE(c.subject, ''), COALESCE(c.sans, ''),
+	COALESCE(c.issuer, ''), c.not_before, c.not_after, COALESCE(c.key_type, ''), COALESCE(c.key_bits, 0),
+	COALESCE(c.signature_algorithm, ''), c.sha256_fingerprint, COALESCE(c.self_signed, 0),
+	c.first_seen, c.last_seen, COALESCE(c.first_scan_id, 0), COALESCE(c.last_scan_id, 0), c.replaced_at`
+
+// scanCertificateRow reads a certificate from a query result
+func scanCertificateRow(row rowScanner) (*models.Certificate, error) {
+	var cert models.Certificate
+	var sans string
+	var replacedAt sql.NullTime
+
+	err := row.Scan(
+		&cert.ID,
+		&cert.DeviceID,
+		&cert.IPAddress,
+		&cert.PortNumber,
+		&cert.Protocol,
+		&cert.Subject,
+		&sans,
+		&cert.Issuer,
+		&cert.NotBefore,
+		&cert.NotAfter,
+		&cert.KeyType,
+		&cert.KeyBits,
+		&cert.SignatureAlgorithm,
+		&cert.SHA256Fingerprint,
+		&cert.SelfSigned,
+		&cert.FirstSeen,
+		&cert.LastSeen,
+		&cert.FirstScanID,
+		&cert.LastScanID,
+		&replacedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	cert.SANs = strings.Fields(sans)
+	if replacedAt.Valid {
+		cert.ReplacedAt = &replacedAt.Time
+	}
+
+	return &cert, nil
+}
+
+// IngestCertificate records the certificate a port presented to the scan in
+// sc. A certificate already seen on the port is seen again; another one
+// replaces the port's current certificate, recording a change against the
+// scan. A certificate from results older than the current certificate goes
+// into the port's history without replacing it.
+func (db *DB) IngestCertificate(sc ScanContext, cert *models.Certificate) error {
+	db.Lock()
+	defer db.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var currentID int64
+	var currentFingerprint, currentSubject string
+	var currentNotAfter, currentFirstSeen, currentLastSeen time.Time
+	err = tx.QueryRow(
+		`SELECT id, sha256_fingerprint, COALESCE(subject, ''), not_after, first_seen, last_seen FROM certificates
+		 WHERE device_id = ? AND port_number = ? AND protocol = ? AND replaced_at IS NULL`,
+		cert.DeviceID, cert.PortNumber, cert.Protocol,
+	).Scan(&currentID, &currentFingerprint, &currentSubject, &currentNotAfter, &currentFirstSeen, &currentLastSeen)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get current certificate of port %d/%s: %w", cert.PortNumber, cert.Protocol, err)
+	}
+	seen := sc.observedAt()
+	stale := err == nil && seen.Before(currentLastSeen)
+	replaced := err == nil && currentFingerprint != cert.SHA256Fingerprint && !stale
+
+	// An older certificate was replaced once the current one was first seen
+	var replacedAt interface{}
+	if stale && currentFingerprint != cert.SHA256Fingerprint {
+		replacedAt = currentFirstSeen
+	}
+
+	scanID := sql.NullInt64{Int64: sc.ScanID, Valid: sc.ScanID != 0}
+
+	// A certificate the port presented before is current again, unless the
+	// results are older than the current certificate
+	_, err = tx.Exec(
+		`INSERT INTO certificates (device_id, port_number, protocol, sha256_fingerprint, subject, sans, issuer,
+		   not_before, not_after, key_type, key_bits, signature_algorithm, self_signed,
+		   first_seen, last_seen, first_scan_id, last_scan_id, replaced_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(device_id, port_number, protocol, sha256_fingerprint) DO UPDATE SET
+		   first_seen = MIN(first_seen, excluded.first_seen),
+		   last_seen = MAX(last_seen, excluded.last_seen),
+		   last_scan_id = CASE WHEN excluded.last_seen >= last_seen THEN COALESCE(excluded.last_scan_id, last_scan_id) ELSE last_scan_id END,
+		   replaced_at = CASE WHEN excluded.replaced_at IS NULL THEN NULL ELSE COALESCE(replaced_at, excluded.replaced_at) END`,
+		cert.DeviceID, cert.PortNumber, cert.Protocol, cert.SHA256Fingerprint, cert.Subject, strings.Join(cert.SANs, " "), cert.Issuer,
+		cert.NotBefore.UTC(), cert.NotAfter.UTC(), cert.KeyType, cert.KeyBits, cert.SignatureAlgorithm, cert.SelfSigned,
+		seen, seen, scanID, scanID, replacedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save certificate of port %d/%s: %w", cert.PortNumber, cert.Protocol, err)
+	}
+
+	var changes []*models.Change
+	if replaced {
+		if _, err := tx.Exec(`UPDATE certificates SET replaced_at = ? WHERE id = ?`, seen, currentID); err != nil {
+			return fmt.Errorf("failed to replace certificate %d: %w", currentID, err)
+		}
+
+		details := fmt.Sprintf("Certificate on port %d/%s changed: %s (expires %s) -> %s (expires %s)",
+			cert.PortNumber, cert.Protocol,
+			currentSubject, currentNotAfter.Format("2006-01-02"),
+			cert.Subject, cert.NotAfter.Format("2006-01-02"))
+		if change, err := db.insertChange(tx, sc.ScanID, cert.DeviceID, "certificate_change", details); err != nil {
+			db.logger.Warn().Err(err).Int64("deviceID", cert.DeviceID).Msg("Failed to record certificate change")
+		} else {
+			changes = append(changes, change)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	tx = nil
+
+	db.publishChanges(changes)
+
+	return nil
+}
+
+// GetCertificates returns the certificates selected by filter, soonest to
+// expire first
+func (db *DB) GetCertificates(filter CertificateFilter) ([]*models.Certificate, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = -1 // SQLite for no limit
+	}
+
+	var expiresBefore interface{}
+	if !filter.ExpiresBefore.IsZero() {
+		expiresBefore = filter.ExpiresBefore.UTC()
+	}
+
+	likeQuery := "%" + filter.Query + "%"
+
+	rows, err := db.Query(
+		`SELECT `+certificateColumns+`
+		FROM certificates c JOIN devices d ON d.id = c.device_id
+		WHERE (?1 = 0 OR c.device_id = ?1)
+		  AND (?2 = 0 OR c.port_number = ?2)
+		  AND (?3 = '' OR c.subject LIKE ?4 OR c.sans LIKE ?4 OR c.issuer LIKE ?4)
+		  AND (?5 IS NULL OR c.not_after < ?5)
+		  AND (?6 OR c.replaced_at IS NULL)
+		ORDER BY c.not_after, c.device_id, c.port_number, c.protocol, c.last_seen DESC
+		LIMIT ?7`,
+		filter.DeviceID, filter.PortNumber, filter.Query, likeQuery, expiresBefore, filter.IncludeReplaced, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query certificates: %w", err)
+	}
+	defer rows.Close()
+
+	certs := []*models.Certificate{}
+	for rows.Next() {
+		cert, err := scanCertificateRow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan certificate row: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, rows.Err()
+}
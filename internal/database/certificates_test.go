@@ -0,0 +1,123 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestIngestCertificate tests keeping every certificate a port presents and
+// filtering certificates by expiry
+func TestIngestCertificate(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	deviceID, err := db.SaveDevice(&models.Device{IPAddress: "10.0.0.5"})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	for _, port := range []int{443, 8443} {
+		if err := db.SavePort(&models.Port{DeviceID: deviceID, PortNumber: port, Protocol: "tcp"}); err != nil {
+			t.Fatalf("Failed to save port: %v", err)
+		}
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	cert := func(port int, fingerprint string, expiresIn time.Duration) *models.Certificate {
+		return &models.Certificate{
+			DeviceID: deviceID, PortNumber: port, Protocol: "tcp",
+			Subject: "CN=" + fingerprint, Issuer: "CN=Example CA", SANs: []string{"DNS:" + fingerprint, "IP:10.0.0.5"},
+			NotBefore: now.Add(-24 * time.Hour), NotAfter: now.Add(expiresIn),
+			KeyType: "rsa", KeyBits: 2048, SignatureAlgorithm: "SHA256-RSA", SHA256Fingerprint: fingerprint,
+		}
+	}
+	ingest := func(sc ScanContext, cert *models.Certificate) {
+		t.Helper()
+		if err := db.IngestCertificate(sc, cert); err != nil {
+			t.Fatalf("Failed to ingest certificate: %v", err)
+		}
+	}
+
+	ingest(ScanContext{}, cert(443, "old", 5*24*time.Hour))
+	ingest(ScanContext{}, cert(443, "old", 5*24*time.Hour))
+	ingest(ScanContext{}, cert(8443, "expired", -time.Hour))
+	if details := changeDetails(t, db, deviceID, "certificate_change"); len(details) != 0 {
+		t.Errorf("Expected no certificate changes yet, got %v", details)
+	}
+
+	// Renewal replaces the port's current certificate
+	ingest(ScanContext{}, cert(443, "new", 365*24*time.Hour))
+	details := changeDetails(t, db, deviceID, "certificate_change")
+	if len(details) != 1 {
+		t.Fatalf("Expected 1 certificate change, got %v", details)
+	}
+	want := "Certificate on port 443/tcp changed: CN=old (expires " + now.Add(5*24*time.Hour).Format("2006-01-02") +
+		") -> CN=new (expires " + now.Add(365*24*time.Hour).Format("2006-01-02") + ")"
+	if details[0] != want {
+		t.Errorf("Expected change %q, got %q", want, details[0])
+	}
+
+	current, err := db.GetCertificates(CertificateFilter{})
+	if err != nil {
+		t.Fatalf("Failed to get certificates: %v", err)
+	}
+	if len(current) != 2 || current[0].SHA256Fingerprint != "expired" || current[1].SHA256Fingerprint != "new" {
+		t.Fatalf("Expected the current certificates, soonest to expire first, got %+v", current)
+	}
+	if c := current[1]; c.IPAddress != "10.0.0.5" || len(c.SANs) != 2 || c.KeyBits != 2048 || !c.NotAfter.Equal(now.Add(365*24*time.Hour)) {
+		t.Errorf("Unexpected certificate: %+v", c)
+	}
+
+	expiring, err := db.GetCertificates(CertificateFilter{ExpiresBefore: time.Now().Add(30 * 24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("Failed to get certificates: %v", err)
+	}
+	if len(expiring) != 1 || expiring[0].SHA256Fingerprint != "expired" {
+		t.Errorf("Expected the expired certificate only, got %+v", expiring)
+	}
+
+	history, err := db.GetCertificates(CertificateFilter{PortNumber: 443, IncludeReplaced: true})
+	if err != nil {
+		t.Fatalf("Failed to get certificates: %v", err)
+	}
+	if len(history) != 2 || history[0].SHA256Fingerprint != "old" || history[0].ReplacedAt == nil {
+		t.Errorf("Expected the replaced certificate in the port's history, got %+v", history)
+	}
+
+	// A rollback to the old certificate makes it current again
+	ingest(ScanContext{}, cert(443, "old", 5*24*time.Hour))
+	found, err := db.GetCertificates(CertificateFilter{PortNumber: 443, Query: "old"})
+	if err != nil {
+		t.Fatalf("Failed to get certificates: %v", err)
+	}
+	if len(found) != 1 || found[0].ReplacedAt != nil || found[0].ID != history[0].ID {
+		t.Errorf("Expected the old certificate to be current again, got %+v", found)
+	}
+
+	// A certificate from older results joins the history without replacing
+	// the current one
+	ingest(ScanContext{ObservedAt: now.Add(-30 * 24 * time.Hour)}, cert(443, "older", 90*24*time.Hour))
+	if details := changeDetails(t, db, deviceID, "certificate_change"); len(details) != 2 {
+		t.Errorf("Expected no change from older results, got %v", details)
+	}
+	history, err = db.GetCertificates(CertificateFilter{PortNumber: 443, IncludeReplaced: true})
+	if err != nil {
+		t.Fatalf("Failed to get certificates: %v", err)
+	}
+	for _, c := range history {
+		if (c.ReplacedAt == nil) != (c.SHA256Fingerprint == "old") {
+			t.Errorf("Expected only the old certificate to be current, got %+v", c)
+		}
+	}
+
+	deviceDetails, err := db.GetDeviceDetails(deviceID)
+	if err != nil {
+		t.Fatalf("Failed to get device details: %v", err)
+	}
+	for _, port := range deviceDetails.Ports {
+		if port.Certificate == nil {
+			t.Errorf("Expected port %d to have its certificate", port.PortNumber)
+		}
+	}
+}
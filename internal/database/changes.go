@@ -0,0 +1,121 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"panopticon-scanner/internal/events"
+	"panopticon-scanner/internal/models"
+)
+
+// changeEventTypes maps change types to the events published for them
+var changeEventTypes = map[string]string{
+	"new_device":         events.TypeDeviceFound,
+	"device_change":      events.TypeDeviceChanged,
+	"device_offline":     events.TypeDeviceOffline,
+	"device_returned":    events.TypeDeviceReturned,
+	"ip_changed":         events.TypeDeviceChanged,
+	"device_merged":      events.TypeDeviceChanged,
+	"device_split":       events.TypeDeviceChanged,
+	"new_port":           events.TypePortFound,
+	"port_change":        events.TypePortChanged,
+	"port_state_change":  events.TypePortChanged,
+	"port_closed":        events.TypePortClosed,
+	"certificate_change": events.TypePortChanged,
+}
+
+// SetEventBus sets the bus on which committed changes are published
+func (db *DB) SetEventBus(bus *events.Bus) {
+	db.events = bus
+}
+
+// ScanContext identifies the scan whose results are being ingested, so that
+// the changes they make to the inventory are attributed to it. The zero
+// ScanContext stands for changes made outside a scan.
+type ScanContext struct {
+	ScanID int64
+
+	// MinOSAccuracy is the accuracy, in percent, below which an OS guess
+	// does not replace a device's known OS. Zero accepts every guess.
+	MinOSAccuracy int
+
+	// ObservedAt is when the scan saw what it reports, which for imported
+	// results may be long ago. Zero means now.
+	ObservedAt time.Time
+}
+
+// observedAt returns when the scan saw what it reports
+func (sc ScanContext) observedAt() time.Time {
+	if sc.ObservedAt.IsZero() {
+		return time.Now()
+	}
+	return sc.ObservedAt
+}
+
+// insertChange records a change within a transaction and returns it so it
+// can be published after the transaction commits. A scan ID of zero records
+// the change without a scan.
+func (db *DB) insertChange(tx *sql.Tx, scanID, deviceID int64, changeType, details string) (*models.Change, error) {
+	change := &models.Change{
+		ScanID:     scanID,
+		DeviceID:   deviceID,
+		ChangeType: changeType,
+		Details:    details,
+		Timestamp:  time.Now(),
+	}
+
+	res, err := tx.Exec(
+		`INSERT INTO changes (scan_id, device_id, change_type, details, timestamp)
+		 VALUES (?, ?, ?, ?, ?)`,
+		sql.NullInt64{Int64: change.ScanID, Valid: change.ScanID != 0}, change.DeviceID, change.ChangeType, change.Details, change.Timestamp,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert change: %w", err)
+	}
+
+	change.ID, err = res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inserted change ID: %w", err)
+	}
+
+	return change, nil
+}
+
+// GetScanChanges returns the changes a scan made to the inventory, oldest
+// first
+func (db *DB) GetScanChanges(scanID int64) ([]*models.Change, error) {
+	rows, err := db.Query(
+		`SELECT id, scan_id, device_id, change_type, details, timestamp
+		 FROM changes WHERE scan_id = ? ORDER BY id`, scanID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query changes of scan %d: %w", scanID, err)
+	}
+	defer rows.Close()
+
+	changes := []*models.Change{}
+	for rows.Next() {
+		var change models.Change
+		if err := rows.Scan(&change.ID, &change.ScanID, &change.DeviceID, &change.ChangeType, &change.Details, &change.Timestamp); err != nil {
+			return nil, fmt.Errorf("failed to scan change row: %w", err)
+		}
+		changes = append(changes, &change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating change rows: %w", err)
+	}
+
+	return changes, nil
+}
+
+// publishChanges publishes committed changes on the event bus
+func (db *DB) publishChanges(changes []*models.Change) {
+	for _, change := range changes {
+		eventType, ok := changeEventTypes[change.ChangeType]
+		if !ok {
+			eventType = events.TypeDeviceChanged
+		}
+		db.events.Publish(eventType, change)
+	}
+}
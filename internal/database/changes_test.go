@@ -0,0 +1,109 @@
+// internal/database/changes_test.go
+package database
+
+import (
+	"testing"
+	"time"
+
+	"panopticon-scanner/internal/events"
+	"panopticon-scanner/internal/models"
+)
+
+// TestChangeEvents tests that recorded changes are published on the event bus
+func TestChangeEvents(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	bus := events.NewBus()
+	defer bus.Close()
+	db.SetEventBus(bus)
+
+	if _, err := db.CreateScan("default"); err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+
+	sub := bus.Subscribe(nil, 10)
+
+	deviceID, err := db.SaveDevice(&models.Device{
+		IPAddress:  "192.168.1.50",
+		MACAddress: "00:11:22:33:44:66",
+		Hostname:   "printer",
+		LastSeen:   time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+
+	if err := db.SavePort(&models.Port{DeviceID: deviceID, PortNumber: 631, Protocol: "tcp", ServiceName: "ipp"}); err != nil {
+		t.Fatalf("Failed to save port: %v", err)
+	}
+
+	want := []string{events.TypeDeviceFound, events.TypePortFound}
+	for _, eventType := range want {
+		select {
+		case event := <-sub.Events():
+			if event.Type != eventType {
+				t.Errorf("Expected %s event, got %s", eventType, event.Type)
+			}
+			change, ok := event.Data.(*models.Change)
+			if !ok || change.ID == 0 || change.DeviceID != deviceID {
+				t.Errorf("Expected committed change for device %d, got %+v", deviceID, event.Data)
+			}
+		default:
+			t.Fatalf("Expected %s event to be published", eventType)
+		}
+	}
+}
+
+// TestIngestAttributesChanges tests that changes are recorded against the scan
+// whose results were ingested rather than the latest scan
+func TestIngestAttributesChanges(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// Without any scans, changes are recorded without one
+	deviceID, err := db.SaveDevice(&models.Device{IPAddress: "192.168.1.60"})
+	if err != nil {
+		t.Fatalf("Failed to save device on a fresh database: %v", err)
+	}
+
+	first, err := db.CreateScan("default")
+	if err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+	second, err := db.CreateScan("default")
+	if err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+
+	// Results of the earlier scan arrive after the later one started
+	sc := ScanContext{ScanID: first}
+	if _, err := db.IngestDevice(sc, &models.Device{IPAddress: "192.168.1.61"}); err != nil {
+		t.Fatalf("Failed to ingest device: %v", err)
+	}
+	if err := db.IngestPort(sc, &models.Port{DeviceID: deviceID, PortNumber: 22, Protocol: "tcp"}); err != nil {
+		t.Fatalf("Failed to ingest port: %v", err)
+	}
+
+	changes, err := db.GetScanChanges(first)
+	if err != nil {
+		t.Fatalf("Failed to get scan changes: %v", err)
+	}
+	if len(changes) != 2 || changes[0].ChangeType != "new_device" || changes[1].ChangeType != "new_port" {
+		t.Fatalf("Expected the new device and port in scan %d, got %+v", first, changes)
+	}
+	for _, change := range changes {
+		if change.ScanID != first {
+			t.Errorf("Expected change attributed to scan %d, got %d", first, change.ScanID)
+		}
+	}
+
+	if changes, err := db.GetScanChanges(second); err != nil || len(changes) != 0 {
+		t.Errorf("Expected no changes in scan %d, got %+v (%v)", second, changes, err)
+	}
+
+	var unattributed int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM changes WHERE scan_id IS NULL`).Scan(&unattributed); err != nil || unattributed != 1 {
+		t.Errorf("Expected 1 change without a scan, got %d (%v)", unattributed, err)
+	}
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// ScanCoverage is what a scan looked at: the targets it was run against and
+// the ports nmap probed on each protocol, as listed in its scaninfo. Either
+// is empty if the scan did not record it, as for imported results.
+type ScanCoverage struct {
+	Targets     string
+	Exclusions  []string
+	ProbedPorts map[string]string // protocol to nmap's port list, such as "1-1000"
+}
+
+// SetScanTargets records the targets a scan was run against
+func (db *DB) SetScanTargets(scanID int64, targets string) error {
+	if _, err := db.Exec(`UPDATE scans SET targets = ? WHERE id = ?`, targets, scanID); err != nil {
+		return fmt.Errorf("failed to record targets for scan #%d: %w", scanID, err)
+	}
+	return nil
+}
+
+// SetScanProbedPorts records the ports a scan probed on each protocol
+func (db *DB) SetScanProbedPorts(scanID int64, probed map[string]string) error {
+	encoded, err := json.Marshal(probed)
+	if err != nil {
+		return fmt.Errorf("failed to encode probed ports: %w", err)
+	}
+
+	if _, err := db.Exec(`UPDATE scans SET probed_ports = ? WHERE id = ?`, string(encoded), scanID); err != nil {
+		return fmt.Errorf("failed to record probed ports for scan #%d: %w", scanID, err)
+	}
+
+	return nil
+}
+
+// GetScanCoverage returns what a scan looked at
+func (db *DB) GetScanCoverage(scanID int64) (*ScanCoverage, error) {
+	var targets, exclusions, probed sql.NullString
+	err := db.QueryRow(
+		`SELECT targets, exclusions, probed_ports FROM scans WHERE id = ?`, scanID,
+	).Scan(&targets, &exclusions, &probed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get coverage of scan #%d: %w", scanID, err)
+	}
+
+	coverage := &ScanCoverage{
+		Targets:    targets.String,
+		Exclusions: decodeExclusionList(exclusions),
+	}
+	if probed.Valid && probed.String != "" {
+		if err := json.Unmarshal([]byte(probed.String), &coverage.ProbedPorts); err != nil {
+			return nil, fmt.Errorf("failed to decode probed ports of scan #%d: %w", scanID, err)
+		}
+	}
+
+	return coverage, nil
+}
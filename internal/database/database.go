@@ -16,7 +16,9 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"panopticon-scanner/internal/events"
 	"panopticon-scanner/internal/models"
+	"panopticon-scanner/internal/oui"
 )
 
 // DB represents the database connection
@@ -24,6 +26,7 @@ type DB struct {
 	*sql.DB
 	Path   string // Exported for integration tests
 	logger *zerolog.Logger
+	events *events.Bus
 	sync.Mutex
 }
 
@@ -84,7 +87,40 @@ func (db *DB) initializeDB() error {
 		os_fingerprint TEXT,
 		first_seen TIMESTAMP NOT NULL,
 		last_seen TIMESTAMP NOT NULL,
-		UNIQUE(ip_address, mac_address)
+		missed_scans INTEGER DEFAULT 0,
+		offline_since TIMESTAMP,
+		vendor TEXT,
+		netbios_name TEXT,
+		workgroup TEXT,
+		smb_os TEXT,
+		os_accuracy INTEGER,
+		os_family TEXT,
+		device_type TEXT,
+		os_cpes TEXT,
+		address_changed_at TIMESTAMP
+	);
+
+	-- Every OS guess from a device's latest OS fingerprint
+	CREATE TABLE IF NOT EXISTS device_os_matches (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_id INTEGER NOT NULL,
+		position INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		accuracy INTEGER NOT NULL,
+		classes TEXT,
+		FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE
+	);
+
+	-- Every address a device has been seen at, including its primary address
+	CREATE TABLE IF NOT EXISTS device_addresses (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_id INTEGER NOT NULL,
+		address TEXT NOT NULL,
+		family TEXT NOT NULL,
+		first_seen TIMESTAMP NOT NULL,
+		last_seen TIMESTAMP NOT NULL,
+		FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE,
+		UNIQUE(device_id, address)
 	);
 
 	-- Ports table
@@ -95,12 +131,99 @@ func (db *DB) initializeDB() error {
 		protocol TEXT NOT NULL,
 		service_name TEXT,
 		service_version TEXT,
+		state TEXT NOT NULL DEFAULT 'open',
+		reason TEXT,
+		missed_scans INTEGER DEFAULT 0,
+		cpes TEXT,
 		first_seen TIMESTAMP NOT NULL,
 		last_seen TIMESTAMP NOT NULL,
 		FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE,
 		UNIQUE(device_id, port_number, protocol)
 	);
 
+	-- CVEs imported from NVD feeds, and the CPEs each one affects
+	CREATE TABLE IF NOT EXISTS vulnerabilities (
+		cve_id TEXT PRIMARY KEY,
+		description TEXT,
+		cvss REAL,
+		severity TEXT,
+		published TIMESTAMP,
+		imported_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS vulnerability_cpes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		cve_id TEXT NOT NULL,
+		part TEXT NOT NULL,
+		vendor TEXT NOT NULL,
+		product TEXT NOT NULL,
+		criteria TEXT NOT NULL,
+		version_start_including TEXT,
+		version_start_excluding TEXT,
+		version_end_including TEXT,
+		version_end_excluding TEXT,
+		FOREIGN KEY (cve_id) REFERENCES vulnerabilities(cve_id) ON DELETE CASCADE
+	);
+
+	-- CVEs matched to the services on a device's ports, or to its OS on port 0
+	CREATE TABLE IF NOT EXISTS vulnerability_findings (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_id INTEGER NOT NULL,
+		port_number INTEGER NOT NULL DEFAULT 0,
+		protocol TEXT NOT NULL DEFAULT '',
+		cve_id TEXT NOT NULL,
+		cpe TEXT NOT NULL,
+		first_seen TIMESTAMP NOT NULL,
+		last_seen TIMESTAMP NOT NULL,
+		first_scan_id INTEGER,
+		last_scan_id INTEGER,
+		resolved_at TIMESTAMP,
+		FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE,
+		FOREIGN KEY (cve_id) REFERENCES vulnerabilities(cve_id) ON DELETE CASCADE,
+		UNIQUE(device_id, port_number, protocol, cve_id)
+	);
+
+	-- TLS certificates each port has presented, the current one without replaced_at
+	CREATE TABLE IF NOT EXISTS certificates (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_id INTEGER NOT NULL,
+		port_number INTEGER NOT NULL,
+		protocol TEXT NOT NULL,
+		sha256_fingerprint TEXT NOT NULL,
+		subject TEXT,
+		sans TEXT,
+		issuer TEXT,
+		not_before TIMESTAMP NOT NULL,
+		not_after TIMESTAMP NOT NULL,
+		key_type TEXT,
+		key_bits INTEGER,
+		signature_algorithm TEXT,
+		self_signed BOOLEAN DEFAULT 0,
+		first_seen TIMESTAMP NOT NULL,
+		last_seen TIMESTAMP NOT NULL,
+		first_scan_id INTEGER,
+		last_scan_id INTEGER,
+		replaced_at TIMESTAMP,
+		FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE,
+		UNIQUE(device_id, port_number, protocol, sha256_fingerprint)
+	);
+
+	-- Latest output of each NSE script per host and port
+	CREATE TABLE IF NOT EXISTS script_results (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_id INTEGER NOT NULL,
+		port_id INTEGER,
+		scan_id INTEGER,
+		script_id TEXT NOT NULL,
+		output TEXT,
+		data TEXT,
+		first_seen TIMESTAMP NOT NULL,
+		last_seen TIMESTAMP NOT NULL,
+		FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE,
+		FOREIGN KEY (port_id) REFERENCES ports(id) ON DELETE CASCADE,
+		FOREIGN KEY (scan_id) REFERENCES scans(id) ON DELETE SET NULL
+	);
+
 	-- Scans table
 	CREATE TABLE IF NOT EXISTS scans (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -110,13 +233,24 @@ func (db *DB) initializeDB() error {
 		devices_found INTEGER DEFAULT 0,
 		ports_found INTEGER DEFAULT 0,
 		status TEXT NOT NULL,
-		error_message TEXT
+		error_message TEXT,
+		progress_percent REAL DEFAULT 0,
+		progress_phase TEXT,
+		progress_eta TIMESTAMP,
+		hosts_completed INTEGER DEFAULT 0,
+		hosts_up INTEGER DEFAULT 0,
+		progress_updated_at TIMESTAMP,
+		exclusions TEXT,
+		source TEXT DEFAULT 'scan',
+		import_hash TEXT,
+		targets TEXT,
+		probed_ports TEXT
 	);
 
 	-- Changes table
 	CREATE TABLE IF NOT EXISTS changes (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		scan_id INTEGER NOT NULL,
+		scan_id INTEGER,
 		device_id INTEGER NOT NULL,
 		change_type TEXT NOT NULL,
 		details TEXT NOT NULL,
@@ -125,6 +259,37 @@ func (db *DB) initializeDB() error {
 		FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE
 	);
 
+	-- What each scan found on each host, so past inventory can be reconstructed
+	CREATE TABLE IF NOT EXISTS scan_host_observations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		scan_id INTEGER NOT NULL,
+		device_id INTEGER NOT NULL,
+		ip_address TEXT NOT NULL,
+		mac_address TEXT,
+		hostname TEXT,
+		os_fingerprint TEXT,
+		observed_at TIMESTAMP NOT NULL,
+		FOREIGN KEY (scan_id) REFERENCES scans(id) ON DELETE CASCADE,
+		FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE,
+		UNIQUE(scan_id, device_id)
+	);
+
+	-- The state of each port each scan found
+	CREATE TABLE IF NOT EXISTS scan_port_observations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		scan_id INTEGER NOT NULL,
+		device_id INTEGER NOT NULL,
+		port_number INTEGER NOT NULL,
+		protocol TEXT NOT NULL,
+		state TEXT NOT NULL,
+		reason TEXT,
+		service_name TEXT,
+		service_version TEXT,
+		FOREIGN KEY (scan_id) REFERENCES scans(id) ON DELETE CASCADE,
+		FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE,
+		UNIQUE(scan_id, device_id, port_number, protocol)
+	);
+
 	-- Configuration table
 	CREATE TABLE IF NOT EXISTS configuration (
 		key TEXT PRIMARY KEY,
@@ -142,16 +307,108 @@ func (db *DB) initializeDB() error {
 		timestamp TIMESTAMP NOT NULL
 	);
 
+	-- Scan templates table (user-defined templates; built-ins live in code)
+	CREATE TABLE IF NOT EXISTS scan_templates (
+		name TEXT PRIMARY KEY,
+		description TEXT,
+		nmap_args TEXT NOT NULL,
+		rate_limit INTEGER DEFAULT 0,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);
+
+	-- Scan jobs table (persistent scan queue)
+	CREATE TABLE IF NOT EXISTS scan_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		priority INTEGER NOT NULL DEFAULT 0,
+		params TEXT NOT NULL,
+		requested_by TEXT NOT NULL,
+		label TEXT,
+		status TEXT NOT NULL,
+		scan_id INTEGER,
+		error_message TEXT,
+		created_at TIMESTAMP NOT NULL,
+		started_at TIMESTAMP,
+		finished_at TIMESTAMP
+	);
+
+	-- Exclusions table (hosts and networks that must never be scanned)
+	CREATE TABLE IF NOT EXISTS exclusions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		target TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS schedules (
+		name TEXT PRIMARY KEY,
+		cron TEXT NOT NULL,
+		template TEXT NOT NULL,
+		target_network TEXT,
+		site TEXT,
+		jitter TEXT,
+		blackouts TEXT,
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS schedule_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		schedule TEXT NOT NULL,
+		scheduled_at TIMESTAMP NOT NULL,
+		run_at TIMESTAMP NOT NULL,
+		status TEXT NOT NULL,
+		job_id INTEGER,
+		message TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS maintenance_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task TEXT NOT NULL,
+		scheduled_at TIMESTAMP NOT NULL,
+		started_at TIMESTAMP NOT NULL,
+		finished_at TIMESTAMP NOT NULL,
+		status TEXT NOT NULL,
+		details TEXT,
+		error_message TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp TIMESTAMP NOT NULL,
+		action TEXT NOT NULL,
+		actor TEXT,
+		target TEXT,
+		site TEXT,
+		reason TEXT
+	);
+
 	-- Create indexes
 	CREATE INDEX IF NOT EXISTS idx_devices_ip ON devices(ip_address);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_timestamp ON audit_log(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_schedule_runs_schedule ON schedule_runs(schedule, run_at);
+	CREATE INDEX IF NOT EXISTS idx_maintenance_runs_task ON maintenance_runs(task, finished_at);
 	CREATE INDEX IF NOT EXISTS idx_devices_mac ON devices(mac_address);
+	CREATE INDEX IF NOT EXISTS idx_devices_hostname ON devices(hostname);
+	CREATE INDEX IF NOT EXISTS idx_device_addresses_address ON device_addresses(address);
+	CREATE INDEX IF NOT EXISTS idx_device_os_matches_device ON device_os_matches(device_id, position);
 	CREATE INDEX IF NOT EXISTS idx_ports_device_id ON ports(device_id);
+	CREATE INDEX IF NOT EXISTS idx_script_results_device ON script_results(device_id, port_id, script_id);
+	CREATE INDEX IF NOT EXISTS idx_script_results_script ON script_results(script_id);
 	CREATE INDEX IF NOT EXISTS idx_ports_port_protocol ON ports(port_number, protocol);
+	CREATE INDEX IF NOT EXISTS idx_vulnerability_cpes_product ON vulnerability_cpes(vendor, product);
+	CREATE INDEX IF NOT EXISTS idx_vulnerability_findings_cve ON vulnerability_findings(cve_id);
+	CREATE INDEX IF NOT EXISTS idx_certificates_not_after ON certificates(not_after);
 	CREATE INDEX IF NOT EXISTS idx_scans_timestamp ON scans(timestamp);
 	CREATE INDEX IF NOT EXISTS idx_changes_scan_id ON changes(scan_id);
 	CREATE INDEX IF NOT EXISTS idx_changes_device_id ON changes(device_id);
+	CREATE INDEX IF NOT EXISTS idx_host_observations_device ON scan_host_observations(device_id, observed_at);
+	CREATE INDEX IF NOT EXISTS idx_host_observations_observed_at ON scan_host_observations(observed_at);
 	CREATE INDEX IF NOT EXISTS idx_logs_level_component ON logs(level, component);
 	CREATE INDEX IF NOT EXISTS idx_logs_timestamp ON logs(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_scan_jobs_status_priority ON scan_jobs(status, priority);
 	`
 
 	_, err := db.Exec(schema)
@@ -159,6 +416,11 @@ func (db *DB) initializeDB() error {
 		return fmt.Errorf("failed to initialize database schema: %w", err)
 	}
 
+	// Bring tables created by older versions up to date
+	if err := db.migrateDB(); err != nil {
+		return fmt.Errorf("failed to migrate database schema: %w", err)
+	}
+
 	return nil
 }
 
@@ -235,8 +497,15 @@ func (db *DB) ExecuteWithRetry(maxRetries int, retryDelay time.Duration, operati
 	return fmt.Errorf("database operation failed after %d attempts: %w", maxRetries, err)
 }
 
-// SaveDevice saves or updates a device in the database
+// SaveDevice saves or updates a device that was not found by a scan, such as
+// one added by hand. Changes are recorded without a scan.
 func (db *DB) SaveDevice(device *models.Device) (int64, error) {
+	return db.IngestDevice(ScanContext{}, device)
+}
+
+// IngestDevice saves or updates a device found by the scan in sc, recording
+// changes to the inventory against the scan
+func (db *DB) IngestDevice(sc ScanContext, device *models.Device) (int64, error) {
 	db.Lock()
 	defer db.Unlock()
 
@@ -254,23 +523,25 @@ func (db *DB) SaveDevice(device *models.Device) (int64, error) {
 	}()
 
 	// Round timestamps to the nearest hour for deduplication
-	roundedTime := time.Now().Truncate(time.Hour)
+	roundedTime := sc.observedAt().Truncate(time.Hour)
 
-	// Check if device exists
-	var id int64
-	err = tx.QueryRow(
-		`SELECT id FROM devices WHERE ip_address = ? AND
-		 (mac_address = ? OR (mac_address IS NULL AND ? IS NULL))`,
-		device.IPAddress, device.MACAddress, device.MACAddress,
-	).Scan(&id)
+	// Changes are published once the transaction commits
+	var changes []*models.Change
+
+	// Store IPv6 addresses in one notation so they match however they were written
+	device.IPAddress = NormalizeIP(device.IPAddress)
+
+	// Check if device exists, by MAC address, hostname or IP address
+	id, err := resolveDevice(tx, device)
 
 	if err == sql.ErrNoRows {
 		// Insert new device
 		res, err := tx.Exec(
-			`INSERT INTO devices (ip_address, mac_address, hostname, os_fingerprint, first_seen, last_seen)
-			 VALUES (?, ?, ?, ?, ?, ?)`,
-			device.IPAddress, device.MACAddress, device.Hostname, device.OSFingerprint,
-			roundedTime, roundedTime,
+			`INSERT INTO devices (ip_address, mac_address, hostname, os_fingerprint, vendor, netbios_name, workgroup, smb_os,
+			   first_seen, last_seen)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			device.IPAddress, device.MACAddress, device.Hostname, device.OSFingerprint, device.Vendor,
+			device.NetBIOSName, device.Workgroup, device.SMBOS, roundedTime, roundedTime,
 		)
 		if err != nil {
 			return 0, fmt.Errorf("failed to insert device: %w", err)
@@ -288,39 +559,63 @@ func (db *DB) SaveDevice(device *models.Device) (int64, error) {
 			Int64("id", id).
 			Msg("New device discovered")
 
-		// Get latest scan ID for change record or create a dummy record if needed
-		var scanID int64
-		scanErr := tx.QueryRow("SELECT COALESCE(MAX(id), 1) FROM scans").Scan(&scanID)
-		if scanErr != nil {
-			scanID = 1 // Fallback to ID 1 if query fails
-			db.logger.Warn().Err(scanErr).Msg("Failed to get latest scan ID, using default")
+		if err := saveDeviceOS(tx, id, device); err != nil {
+			return 0, err
 		}
-		
+
 		// Insert change record
-		if _, err := tx.Exec(
-			`INSERT INTO changes (scan_id, device_id, change_type, details, timestamp)
-			 VALUES (?, ?, ?, ?, ?)`,
-			scanID, id, "new_device", fmt.Sprintf("New device discovered: %s", device.IPAddress),
-			time.Now(),
+		if change, err := db.insertChange(tx, sc.ScanID, id, "new_device",
+			fmt.Sprintf("New device discovered: %s", device.IPAddress),
 		); err != nil {
 			db.logger.Warn().Err(err).Int64("deviceID", id).Msg("Failed to record device change")
+		} else {
+			changes = append(changes, change)
 		}
 	} else if err != nil {
 		return 0, fmt.Errorf("failed to check if device exists: %w", err)
 	} else {
 		// Device exists, check if we need to update
-		var oldHostname, oldOsFingerprint string
+		var oldIPAddress, oldHostname, oldOsFingerprint, oldVendor string
+		var oldNetBIOSName, oldWorkgroup, oldSMBOS string
 		var oldMacAddress sql.NullString
+		var offlineSince sql.NullTime
+		var missedScans int
+		var oldLastSeen time.Time
 
 		err = tx.QueryRow(
-			`SELECT hostname, os_fingerprint, mac_address FROM devices WHERE id = ?`,
+			`SELECT ip_address, hostname, os_fingerprint, mac_address, COALESCE(vendor, ''),
+			   COALESCE(netbios_name, ''), COALESCE(workgroup, ''), COALESCE(smb_os, ''), offline_since, COALESCE(missed_scans, 0),
+			   last_seen
+			 FROM devices WHERE id = ?`,
 			id,
-		).Scan(&oldHostname, &oldOsFingerprint, &oldMacAddress)
+		).Scan(&oldIPAddress, &oldHostname, &oldOsFingerprint, &oldMacAddress, &oldVendor,
+			&oldNetBIOSName, &oldWorkgroup, &oldSMBOS, &offlineSince, &missedScans, &oldLastSeen)
 
 		if err != nil {
 			return 0, fmt.Errorf("failed to retrieve existing device data: %w", err)
 		}
 
+		// Results older than what the inventory already knows, such as an
+		// imported run from before the last scan, do not replace it. Only
+		// the address they saw the device at is kept.
+		if roundedTime.Before(oldLastSeen) {
+			if err := saveDeviceAddress(tx, id, device.IPAddress, roundedTime); err != nil {
+				return 0, err
+			}
+			if err = tx.Commit(); err != nil {
+				return 0, fmt.Errorf("failed to commit transaction: %w", err)
+			}
+			tx = nil
+
+			db.logger.Debug().
+				Int64("id", id).
+				Str("ip", device.IPAddress).
+				Time("observedAt", roundedTime).
+				Msg("Kept newer device data over older results")
+
+			return id, nil
+		}
+
 		// Check if anything changed
 		hasChanges := false
 		changeDetails := ""
@@ -342,18 +637,63 @@ func (db *DB) SaveDevice(device *models.Device) (int64, error) {
 			changeDetails += fmt.Sprintf("Hostname changed: %s -> %s; ", oldHostname, device.Hostname)
 		}
 
+		// An OS guess nmap is unsure of does not replace a known OS, so that
+		// devices do not flap between similar fingerprints
+		osKnown := device.OSFingerprint != "" &&
+			!(oldOsFingerprint != "" && device.OSAccuracy > 0 && device.OSAccuracy < sc.MinOSAccuracy)
+
 		// Compare OS fingerprint
-		if device.OSFingerprint != oldOsFingerprint && device.OSFingerprint != "" {
+		if device.OSFingerprint != oldOsFingerprint && osKnown {
 			hasChanges = true
 			changeDetails += fmt.Sprintf("OS changed: %s -> %s; ", oldOsFingerprint, device.OSFingerprint)
 		}
 
+		// Compare what the host reports about itself over NetBIOS and SMB
+		if device.NetBIOSName != oldNetBIOSName && device.NetBIOSName != "" {
+			hasChanges = true
+			changeDetails += fmt.Sprintf("NetBIOS name changed: %s -> %s; ", oldNetBIOSName, device.NetBIOSName)
+		}
+
+		if device.Workgroup != oldWorkgroup && device.Workgroup != "" {
+			hasChanges = true
+			changeDetails += fmt.Sprintf("Workgroup changed: %s -> %s; ", oldWorkgroup, device.Workgroup)
+		}
+
+		if device.SMBOS != oldSMBOS && device.SMBOS != "" {
+			hasChanges = true
+			changeDetails += fmt.Sprintf("SMB OS changed: %s -> %s; ", oldSMBOS, device.SMBOS)
+		}
+
+		// A host seen at a new address in the family of its primary address
+		// has had its address changed, by DHCP for instance, while a
+		// dual-stack host has gained an address in the other family
+		ipValue := oldIPAddress
+		ipChanged := false
+		if device.IPAddress != oldIPAddress {
+			if isIPv6(device.IPAddress) == isIPv6(oldIPAddress) {
+				ipValue = device.IPAddress
+				ipChanged = true
+			} else if known, err := hasDeviceAddress(tx, id, device.IPAddress); err != nil {
+				return 0, err
+			} else if !known {
+				hasChanges = true
+				changeDetails += fmt.Sprintf("Address added: %s; ", device.IPAddress)
+			}
+		}
+
+		// A device that was reported offline has answered again
+		returned := offlineSince.Valid
+
 		// Update device if anything changed
-		if hasChanges || device.LastSeen.After(time.Now().Add(-time.Hour)) {
+		if hasChanges || ipChanged || returned || missedScans > 0 || roundedTime.After(oldLastSeen) || device.LastSeen.After(time.Now().Add(-time.Hour)) {
 			// Only update non-empty fields
 			macValue := device.MACAddress
 			hostnameValue := device.Hostname
 			osValue := device.OSFingerprint
+			vendorValue := device.Vendor
+			netbiosValue := device.NetBIOSName
+			workgroupValue := device.Workgroup
+			smbOSValue := device.SMBOS
 
 			// If new values are empty, keep old values
 			if macValue == "" && oldMacAddress.Valid {
@@ -364,15 +704,34 @@ func (db *DB) SaveDevice(device *models.Device) (int64, error) {
 				hostnameValue = oldHostname
 			}
 
-			if osValue == "" {
+			if !osKnown {
 				osValue = oldOsFingerprint
 			}
 
+			if vendorValue == "" {
+				vendorValue = oldVendor
+			}
+
+			if netbiosValue == "" {
+				netbiosValue = oldNetBIOSName
+			}
+
+			if workgroupValue == "" {
+				workgroupValue = oldWorkgroup
+			}
+
+			if smbOSValue == "" {
+				smbOSValue = oldSMBOS
+			}
+
 			_, err = tx.Exec(
 				`UPDATE devices
-				 SET mac_address = ?, hostname = ?, os_fingerprint = ?, last_seen = ?
+				 SET ip_address = ?, mac_address = ?, hostname = ?, os_fingerprint = ?, vendor = ?,
+				     netbios_name = ?, workgroup = ?, smb_os = ?, last_seen = ?,
+				     missed_scans = 0, offline_since = NULL
 				 WHERE id = ?`,
-				macValue, hostnameValue, osValue, roundedTime, id,
+				ipValue, macValue, hostnameValue, osValue, vendorValue,
+				netbiosValue, workgroupValue, smbOSValue, roundedTime, id,
 			)
 
 			if err != nil {
@@ -381,20 +740,37 @@ func (db *DB) SaveDevice(device *models.Device) (int64, error) {
 
 			// Record change if anything significant changed
 			if hasChanges {
-				// Get latest scan ID for change record
-				var scanID int64
-				scanErr := tx.QueryRow("SELECT COALESCE(MAX(id), 1) FROM scans").Scan(&scanID)
-				if scanErr != nil {
-					scanID = 1 // Fallback to ID 1 if query fails
-					db.logger.Warn().Err(scanErr).Msg("Failed to get latest scan ID, using default")
+				if change, err := db.insertChange(tx, sc.ScanID, id, "device_change", changeDetails); err != nil {
+					db.logger.Warn().Err(err).Int64("deviceID", id).Msg("Failed to record device change")
+				} else {
+					changes = append(changes, change)
+				}
+			}
+
+			// Record the move to a new address. Addresses in the other
+			// family seen before the move are no longer current.
+			if ipChanged {
+				if _, err := tx.Exec(`UPDATE devices SET address_changed_at = ? WHERE id = ?`, roundedTime, id); err != nil {
+					return 0, fmt.Errorf("failed to record address change: %w", err)
 				}
-				
-				if _, err := tx.Exec(
-					`INSERT INTO changes (scan_id, device_id, change_type, details, timestamp)
-					 VALUES (?, ?, ?, ?, ?)`,
-					scanID, id, "device_change", changeDetails, time.Now(),
+				if change, err := db.insertChange(tx, sc.ScanID, id, "ip_changed",
+					fmt.Sprintf("IP address changed: %s -> %s", oldIPAddress, device.IPAddress),
 				); err != nil {
 					db.logger.Warn().Err(err).Int64("deviceID", id).Msg("Failed to record device change")
+				} else {
+					changes = append(changes, change)
+				}
+			}
+
+			// Record the return of a device that was offline
+			if returned {
+				if change, err := db.insertChange(tx, sc.ScanID, id, "device_returned",
+					fmt.Sprintf("Device returned: %s (offline since %s)",
+						device.IPAddress, offlineSince.Time.Format(time.RFC3339)),
+				); err != nil {
+					db.logger.Warn().Err(err).Int64("deviceID", id).Msg("Failed to record device change")
+				} else {
+					changes = append(changes, change)
 				}
 			}
 
@@ -404,6 +780,17 @@ func (db *DB) SaveDevice(device *models.Device) (int64, error) {
 				Bool("hasChanges", hasChanges).
 				Msg("Updated existing device")
 		}
+
+		// Keep the details of the OS fingerprint with it
+		if osKnown && (len(device.OSMatches) > 0 || device.OSFingerprint != oldOsFingerprint) {
+			if err := saveDeviceOS(tx, id, device); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if err := saveDeviceAddress(tx, id, device.IPAddress, roundedTime); err != nil {
+		return 0, err
 	}
 
 	// Commit the transaction
@@ -414,11 +801,20 @@ func (db *DB) SaveDevice(device *models.Device) (int64, error) {
 	// Set tx to nil to prevent rollback in deferred function
 	tx = nil
 
+	db.publishChanges(changes)
+
 	return id, nil
 }
 
-// SavePort saves or updates a port in the database
+// SavePort saves or updates a port that was not found by a scan. Changes are
+// recorded without a scan.
 func (db *DB) SavePort(port *models.Port) error {
+	return db.IngestPort(ScanContext{}, port)
+}
+
+// IngestPort saves or updates a port found by the scan in sc, recording
+// changes to the inventory against the scan
+func (db *DB) IngestPort(sc ScanContext, port *models.Port) error {
 	db.Lock()
 	defer db.Unlock()
 
@@ -436,26 +832,42 @@ func (db *DB) SavePort(port *models.Port) error {
 	}()
 
 	// Round timestamps to the nearest hour for deduplication
-	roundedTime := time.Now().Truncate(time.Hour)
+	roundedTime := sc.observedAt().Truncate(time.Hour)
+
+	// Ports saved without a state were found open
+	state := port.State
+	if state == "" {
+		state = "open"
+	}
+
+	// Changes are published once the transaction commits
+	var changes []*models.Change
 
 	// Check if port exists
 	var id int64
-	var oldServiceName, oldServiceVersion string
+	var oldServiceName, oldServiceVersion, oldState string
+	var oldReason sql.NullString
+	var oldCPEs string
+	var missedScans int
+	var oldLastSeen time.Time
+
+	// CPEs are stored space-separated
+	cpes := strings.Join(port.CPEs, " ")
 
 	err = tx.QueryRow(
-		`SELECT id, service_name, service_version
+		`SELECT id, service_name, service_version, state, reason, COALESCE(missed_scans, 0), COALESCE(cpes, ''), last_seen
 		 FROM ports
 		 WHERE device_id = ? AND port_number = ? AND protocol = ?`,
 		port.DeviceID, port.PortNumber, port.Protocol,
-	).Scan(&id, &oldServiceName, &oldServiceVersion)
+	).Scan(&id, &oldServiceName, &oldServiceVersion, &oldState, &oldReason, &missedScans, &oldCPEs, &oldLastSeen)
 
 	if err == sql.ErrNoRows {
 		// Insert new port
 		res, err := tx.Exec(
-			`INSERT INTO ports (device_id, port_number, protocol, service_name, service_version, first_seen, last_seen)
-			 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			`INSERT INTO ports (device_id, port_number, protocol, service_name, service_version, state, reason, cpes, first_seen, last_seen)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			port.DeviceID, port.PortNumber, port.Protocol, port.ServiceName, port.ServiceVersion,
-			roundedTime, roundedTime,
+			state, port.Reason, cpes, roundedTime, roundedTime,
 		)
 
 		if err != nil {
@@ -474,35 +886,45 @@ func (db *DB) SavePort(port *models.Port) error {
 			Str("protocol", port.Protocol).
 			Msg("New port discovered")
 
-		// Get latest scan ID for change record
-		var scanID int64
-		scanErr := tx.QueryRow("SELECT COALESCE(MAX(id), 1) FROM scans").Scan(&scanID)
-		if scanErr != nil {
-			scanID = 1 // Fallback to ID 1 if query fails
-			db.logger.Warn().Err(scanErr).Msg("Failed to get latest scan ID, using default")
+		// Insert change record for new port, noting ports that may not be open
+		details := fmt.Sprintf("New port discovered: %d/%s - %s",
+			port.PortNumber, port.Protocol, port.ServiceName)
+		if state != "open" {
+			details = fmt.Sprintf("New port discovered: %d/%s (%s) - %s",
+				port.PortNumber, port.Protocol, state, port.ServiceName)
 		}
-		
-		// Insert change record for new port
-		if _, err := tx.Exec(
-			`INSERT INTO changes (scan_id, device_id, change_type, details, timestamp)
-			 VALUES (?, ?, ?, ?, ?)`,
-			scanID, port.DeviceID, "new_port",
-			fmt.Sprintf("New port discovered: %d/%s - %s",
-				port.PortNumber, port.Protocol, port.ServiceName),
-			time.Now(),
-		); err != nil {
+		if change, err := db.insertChange(tx, sc.ScanID, port.DeviceID, "new_port", details); err != nil {
 			db.logger.Warn().Err(err).Int64("portID", id).Msg("Failed to record port change")
+		} else {
+			changes = append(changes, change)
 		}
 
 	} else if err != nil {
 		return fmt.Errorf("failed to check if port exists: %w", err)
+	} else if roundedTime.Before(oldLastSeen) {
+		// Results older than what the inventory already knows about the
+		// port do not replace it
+		db.logger.Debug().
+			Int64("id", id).
+			Int("port", port.PortNumber).
+			Time("observedAt", roundedTime).
+			Msg("Kept newer port data over older results")
 	} else {
 		// Port exists, check if service information changed
 		serviceChanged := (port.ServiceName != oldServiceName && port.ServiceName != "") ||
 						  (port.ServiceVersion != oldServiceVersion && port.ServiceVersion != "")
+		stateChanged := state != oldState
+		reasonChanged := port.Reason != oldReason.String
+
+		// CPEs are kept when a scan without version detection finds the port,
+		// but not once the service has changed since they no longer describe it
+		if cpes == "" && !serviceChanged {
+			cpes = oldCPEs
+		}
+		cpesChanged := cpes != oldCPEs
 
-		// Update port if service changed or last seen needs to be updated
-		if serviceChanged || port.LastSeen.After(time.Now().Add(-time.Hour)) {
+		// Update port if service or state changed, it had been missed or last seen needs to be updated
+		if serviceChanged || stateChanged || reasonChanged || cpesChanged || missedScans > 0 || roundedTime.After(oldLastSeen) || port.LastSeen.After(time.Now().Add(-time.Hour)) {
 			// Only update non-empty fields
 			serviceNameValue := port.ServiceName
 			serviceVersionValue := port.ServiceVersion
@@ -518,9 +940,9 @@ func (db *DB) SavePort(port *models.Port) error {
 
 			_, err = tx.Exec(
 				`UPDATE ports
-				 SET service_name = ?, service_version = ?, last_seen = ?
+				 SET service_name = ?, service_version = ?, state = ?, reason = ?, cpes = ?, last_seen = ?, missed_scans = 0
 				 WHERE id = ?`,
-				serviceNameValue, serviceVersionValue, roundedTime, id,
+				serviceNameValue, serviceVersionValue, state, port.Reason, cpes, roundedTime, id,
 			)
 
 			if err != nil {
@@ -529,25 +951,30 @@ func (db *DB) SavePort(port *models.Port) error {
 
 			// Record change if service information changed
 			if serviceChanged {
-				// Get latest scan ID for change record
-				var scanID int64
-				scanErr := tx.QueryRow("SELECT COALESCE(MAX(id), 1) FROM scans").Scan(&scanID)
-				if scanErr != nil {
-					scanID = 1 // Fallback to ID 1 if query fails
-					db.logger.Warn().Err(scanErr).Msg("Failed to get latest scan ID, using default")
-				}
-				
-				if _, err := tx.Exec(
-					`INSERT INTO changes (scan_id, device_id, change_type, details, timestamp)
-					 VALUES (?, ?, ?, ?, ?)`,
-					scanID, port.DeviceID, "port_change",
+				if change, err := db.insertChange(tx, sc.ScanID, port.DeviceID, "port_change",
 					fmt.Sprintf("Service on port %d/%s changed: %s %s -> %s %s",
 						port.PortNumber, port.Protocol,
 						oldServiceName, oldServiceVersion,
 						serviceNameValue, serviceVersionValue),
-					time.Now(),
 				); err != nil {
 					db.logger.Warn().Err(err).Int64("portID", id).Msg("Failed to record port change")
+				} else {
+					changes = append(changes, change)
+				}
+			}
+
+			// Record change if the port's state changed, e.g. open|filtered -> open
+			if stateChanged {
+				details := fmt.Sprintf("Port %d/%s state changed: %s -> %s",
+					port.PortNumber, port.Protocol, oldState, state)
+				if port.Reason != "" {
+					details += " (" + port.Reason + ")"
+				}
+
+				if change, err := db.insertChange(tx, sc.ScanID, port.DeviceID, "port_state_change", details); err != nil {
+					db.logger.Warn().Err(err).Int64("portID", id).Msg("Failed to record port change")
+				} else {
+					changes = append(changes, change)
 				}
 			}
 
@@ -555,6 +982,7 @@ func (db *DB) SavePort(port *models.Port) error {
 				Int64("id", id).
 				Int("port", port.PortNumber).
 				Bool("serviceChanged", serviceChanged).
+				Bool("stateChanged", stateChanged).
 				Msg("Updated existing port")
 		}
 	}
@@ -567,17 +995,24 @@ func (db *DB) SavePort(port *models.Port) error {
 	// Set tx to nil to prevent rollback in deferred function
 	tx = nil
 
+	db.publishChanges(changes)
+
 	return nil
 }
 
-// GetDevice retrieves a device by ID
-func (db *DB) GetDevice(id int64) (*models.Device, error) {
+// deviceColumns lists the columns of "devices d" read by scanDeviceRow
+const deviceColumns = `d.id, d.ip_address, d.mac_address, d.hostname, d.os_fingerprint, d.first_seen, d.last_seen, d.offline_since,
+	COALESCE(d.vendor, ''), COALESCE(d.netbios_name, ''), COALESCE(d.workgroup, ''), COALESCE(d.smb_os, ''),
+	COALESCE(d.os_accuracy, 0), COALESCE(d.os_family, ''), COALESCE(d.device_type, ''), COALESCE(d.os_cpes, '')`
+
+// scanDeviceRow reads a device from a query result, followed by any extra
+// columns selected after deviceColumns
+func scanDeviceRow(row rowScanner, extra ...interface{}) (*models.Device, error) {
 	var device models.Device
+	var offlineSince sql.NullTime
+	var cpes string
 
-	err := db.QueryRow(
-		`SELECT id, ip_address, mac_address, hostname, os_fingerprint, first_seen, last_seen
-		 FROM devices WHERE id = ?`, id,
-	).Scan(
+	dest := []interface{}{
 		&device.ID,
 		&device.IPAddress,
 		&device.MACAddress,
@@ -585,55 +1020,74 @@ func (db *DB) GetDevice(id int64) (*models.Device, error) {
 		&device.OSFingerprint,
 		&device.FirstSeen,
 		&device.LastSeen,
-	)
+		&offlineSince,
+		&device.Vendor,
+		&device.NetBIOSName,
+		&device.Workgroup,
+		&device.SMBOS,
+		&device.OSAccuracy,
+		&device.OSFamily,
+		&device.DeviceType,
+		&cpes,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to get device: %w", err)
+	if offlineSince.Valid {
+		device.OfflineSince = &offlineSince.Time
 	}
+	device.RandomizedMAC = oui.IsLocallyAdministered(device.MACAddress)
+	device.OSCPEs = strings.Fields(cpes)
 
-	// Get port count
-	err = db.QueryRow(
-		`SELECT COUNT(*) FROM ports WHERE device_id = ?`, id,
-	).Scan(&device.PortCount)
+	return &device, nil
+}
 
+// GetDevice retrieves a device by ID
+func (db *DB) GetDevice(id int64) (*models.Device, error) {
+	device, err := scanDeviceRow(db.QueryRow(
+		`SELECT `+deviceColumns+` FROM devices d WHERE d.id = ?`, id,
+	))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get port count: %w", err)
+		return nil, fmt.Errorf("failed to get device: %w", err)
 	}
 
-	return &device, nil
+	return db.loadDevice(device)
 }
 
-// GetDeviceByIP retrieves a device by IP address
+// GetDeviceByIP retrieves a device by any of its IP addresses
 func (db *DB) GetDeviceByIP(ipAddress string) (*models.Device, error) {
-	var device models.Device
-
-	err := db.QueryRow(
-		`SELECT id, ip_address, mac_address, hostname, os_fingerprint, first_seen, last_seen
-		 FROM devices WHERE ip_address = ?`, ipAddress,
-	).Scan(
-		&device.ID,
-		&device.IPAddress,
-		&device.MACAddress,
-		&device.Hostname,
-		&device.OSFingerprint,
-		&device.FirstSeen,
-		&device.LastSeen,
-	)
+	ipAddress = NormalizeIP(ipAddress)
 
+	device, err := scanDeviceRow(db.QueryRow(
+		`SELECT `+deviceColumns+` FROM devices d
+		 WHERE d.ip_address = ? OR d.id IN (SELECT device_id FROM device_addresses WHERE address = ?)
+		 ORDER BY d.ip_address = ? DESC, d.last_seen DESC LIMIT 1`, ipAddress, ipAddress, ipAddress,
+	))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get device by IP: %w", err)
 	}
 
+	return db.loadDevice(device)
+}
+
+// loadDevice fills in the port count and addresses of a single device
+func (db *DB) loadDevice(device *models.Device) (*models.Device, error) {
 	// Get port count
-	err = db.QueryRow(
-		`SELECT COUNT(*) FROM ports WHERE device_id = ?`, device.ID,
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM ports WHERE device_id = ? AND state <> 'closed'`, device.ID,
 	).Scan(&device.PortCount)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to get port count: %w", err)
 	}
 
-	return &device, nil
+	device.Addresses, err = db.getDeviceAddresses(device.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return device, nil
 }
 
 // GetDeviceDetails retrieves a device with its ports
@@ -646,8 +1100,8 @@ func (db *DB) GetDeviceDetails(id int64) (*models.DeviceDetails, error) {
 
 	// Get the ports for this device
 	rows, err := db.Query(
-		`SELECT id, device_id, port_number, protocol, service_name, service_version, first_seen, last_seen
-		 FROM ports WHERE device_id = ? ORDER BY port_number`, id,
+		`SELECT id, device_id, port_number, protocol, service_name, service_version, state, COALESCE(reason, ''), COALESCE(cpes, ''), first_seen, last_seen
+		 FROM ports WHERE device_id = ? ORDER BY port_number, protocol`, id,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get ports: %w", err)
@@ -657,6 +1111,7 @@ func (db *DB) GetDeviceDetails(id int64) (*models.DeviceDetails, error) {
 	var ports []*models.Port
 	for rows.Next() {
 		var port models.Port
+		var cpes string
 		err := rows.Scan(
 			&port.ID,
 			&port.DeviceID,
@@ -664,12 +1119,16 @@ func (db *DB) GetDeviceDetails(id int64) (*models.DeviceDetails, error) {
 			&port.Protocol,
 			&port.ServiceName,
 			&port.ServiceVersion,
+			&port.State,
+			&port.Reason,
+			&cpes,
 			&port.FirstSeen,
 			&port.LastSeen,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan port row: %w", err)
 		}
+		port.CPEs = strings.Fields(cpes)
 		ports = append(ports, &port)
 	}
 
@@ -677,19 +1136,76 @@ func (db *DB) GetDeviceDetails(id int64) (*models.DeviceDetails, error) {
 		return nil, fmt.Errorf("error iterating port rows: %w", err)
 	}
 
+	device.OSMatches, err = db.getOSMatches(id)
+	if err != nil {
+		return nil, err
+	}
+
+	vulnerabilities, err := db.GetVulnerabilities(VulnerabilityFilter{DeviceID: id})
+	if err != nil {
+		return nil, err
+	}
+
+	// Attach script results to the ports they ran against
+	scripts, err := db.GetDeviceScriptResults(id)
+	if err != nil {
+		return nil, err
+	}
+
+	portsByID := make(map[int64]*models.Port, len(ports))
+	for _, port := range ports {
+		portsByID[port.ID] = port
+	}
+
+	// Attach the certificate each port currently presents
+	certs, err := db.GetCertificates(CertificateFilter{DeviceID: id})
+	if err != nil {
+		return nil, err
+	}
+	for _, cert := range certs {
+		for _, port := range ports {
+			if port.PortNumber == cert.PortNumber && port.Protocol == cert.Protocol {
+				port.Certificate = cert
+			}
+		}
+	}
+
+	var hostScripts []*models.ScriptResult
+	for _, script := range scripts {
+		if port, ok := portsByID[script.PortID]; ok {
+			port.Scripts = append(port.Scripts, script)
+		} else {
+			hostScripts = append(hostScripts, script)
+		}
+	}
+
 	return &models.DeviceDetails{
-		Device: *device,
-		Ports:  ports,
+		Device:          *device,
+		Ports:           ports,
+		Scripts:         hostScripts,
+		Vulnerabilities: vulnerabilities,
 	}, nil
 }
 
 // GetAllDevices retrieves all devices
 func (db *DB) GetAllDevices() ([]*models.Device, error) {
+	return db.queryDevices(`ORDER BY d.last_seen DESC`)
+}
+
+// GetDevicesByVendor retrieves the devices whose vendor contains the given
+// text, ignoring case
+func (db *DB) GetDevicesByVendor(vendor string) ([]*models.Device, error) {
+	return db.queryDevices(`WHERE d.vendor LIKE ? ORDER BY d.last_seen DESC`, "%"+vendor+"%")
+}
+
+// queryDevices retrieves the devices selected by the WHERE and ORDER BY
+// clauses that follow "FROM devices d" in a query, with their port counts
+func (db *DB) queryDevices(clauses string, args ...interface{}) ([]*models.Device, error) {
 	rows, err := db.Query(
-		`SELECT d.id, d.ip_address, d.mac_address, d.hostname, d.os_fingerprint, d.first_seen, d.last_seen,
-		 (SELECT COUNT(*) FROM ports WHERE device_id = d.id) as port_count
+		`SELECT `+deviceColumns+`,
+		 (SELECT COUNT(*) FROM ports WHERE device_id = d.id AND state <> 'closed') as port_count
 		 FROM devices d
-		 ORDER BY d.last_seen DESC`,
+		 `+clauses, args...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query devices: %w", err)
@@ -698,21 +1214,13 @@ func (db *DB) GetAllDevices() ([]*models.Device, error) {
 
 	var devices []*models.Device
 	for rows.Next() {
-		var device models.Device
-		err := rows.Scan(
-			&device.ID,
-			&device.IPAddress,
-			&device.MACAddress,
-			&device.Hostname,
-			&device.OSFingerprint,
-			&device.FirstSeen,
-			&device.LastSeen,
-			&device.PortCount,
-		)
+		var portCount int
+		device, err := scanDeviceRow(rows, &portCount)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan device row: %w", err)
 		}
-		devices = append(devices, &device)
+		device.PortCount = portCount
+		devices = append(devices, device)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -800,12 +1308,13 @@ func (db *DB) UpdateScanFromModel(scan *models.Scan) error {
 // GetScan retrieves a scan by ID
 func (db *DB) GetScan(id int64) (*models.Scan, error) {
 	var scan models.Scan
-	var errorMsg sql.NullString
+	var errorMsg, exclusions sql.NullString
+	var progress scanProgressColumns
 
 	err := db.QueryRow(
-		`SELECT id, timestamp, template, duration, devices_found, ports_found, status, error_message
+		`SELECT id, timestamp, template, duration, devices_found, ports_found, status, error_message, exclusions, COALESCE(source, 'scan'), `+scanProgressSelect+`
 		 FROM scans WHERE id = ?`, id,
-	).Scan(
+	).Scan(append([]interface{}{
 		&scan.ID,
 		&scan.Timestamp,
 		&scan.Template,
@@ -814,7 +1323,9 @@ func (db *DB) GetScan(id int64) (*models.Scan, error) {
 		&scan.PortsFound,
 		&scan.Status,
 		&errorMsg,
-	)
+		&exclusions,
+		&scan.Source,
+	}, progress.dest()...)...)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to get scan: %w", err)
@@ -823,6 +1334,8 @@ func (db *DB) GetScan(id int64) (*models.Scan, error) {
 	if errorMsg.Valid {
 		scan.ErrorMessage = errorMsg.String
 	}
+	scan.Progress = progress.model()
+	scan.Exclusions = decodeExclusionList(exclusions)
 
 	return &scan, nil
 }
@@ -830,7 +1343,7 @@ func (db *DB) GetScan(id int64) (*models.Scan, error) {
 // GetRecentScans retrieves recent scans with a limit
 func (db *DB) GetRecentScans(limit int) ([]*models.Scan, error) {
 	rows, err := db.Query(
-		`SELECT id, timestamp, template, duration, devices_found, ports_found, status, error_message
+		`SELECT id, timestamp, template, duration, devices_found, ports_found, status, error_message, exclusions, COALESCE(source, 'scan'), `+scanProgressSelect+`
 		 FROM scans
 		 ORDER BY timestamp DESC
 		 LIMIT ?`, limit,
@@ -843,9 +1356,10 @@ func (db *DB) GetRecentScans(limit int) ([]*models.Scan, error) {
 	var scans []*models.Scan
 	for rows.Next() {
 		var scan models.Scan
-		var errorMsg sql.NullString
+		var errorMsg, exclusions sql.NullString
+		var progress scanProgressColumns
 
-		err := rows.Scan(
+		err := rows.Scan(append([]interface{}{
 			&scan.ID,
 			&scan.Timestamp,
 			&scan.Template,
@@ -854,7 +1368,9 @@ func (db *DB) GetRecentScans(limit int) ([]*models.Scan, error) {
 			&scan.PortsFound,
 			&scan.Status,
 			&errorMsg,
-		)
+			&exclusions,
+			&scan.Source,
+		}, progress.dest()...)...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
@@ -862,6 +1378,8 @@ func (db *DB) GetRecentScans(limit int) ([]*models.Scan, error) {
 		if errorMsg.Valid {
 			scan.ErrorMessage = errorMsg.String
 		}
+		scan.Progress = progress.model()
+		scan.Exclusions = decodeExclusionList(exclusions)
 
 		scans = append(scans, &scan)
 	}
@@ -923,13 +1441,18 @@ func (db *DB) OptimizeDatabase() error {
 	return nil
 }
 
-// BackupDatabase creates a backup of the database
+// BackupDatabase creates a backup of the database in the backups directory
+// next to the database file
 func (db *DB) BackupDatabase() (string, error) {
+	return db.BackupDatabaseTo(filepath.Join(filepath.Dir(db.Path), "backups"))
+}
+
+// BackupDatabaseTo creates a backup of the database in backupDir
+func (db *DB) BackupDatabaseTo(backupDir string) (string, error) {
 	db.Lock()
 	defer db.Unlock()
 
 	// Create backup directory
-	backupDir := filepath.Join(filepath.Dir(db.Path), "backups")
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create backup directory: %w", err)
 	}
@@ -989,46 +1512,23 @@ func copyFile(src, dst string) error {
 	return nil
 }
 
-// SearchDevices searches devices by IP, hostname, or OS
+// SearchDevices searches devices by any of their IP addresses, hostname, OS,
+// MAC address, vendor, or NetBIOS name, workgroup or SMB OS. IPv6 addresses match in compressed or expanded notation.
 func (db *DB) SearchDevices(query string) ([]*models.Device, error) {
 	// Add wildcards for LIKE query
 	likeQuery := "%" + query + "%"
+	addressQuery := "%" + normalizeAddressQuery(query) + "%"
 
-	rows, err := db.Query(
-		`SELECT d.id, d.ip_address, d.mac_address, d.hostname, d.os_fingerprint, d.first_seen, d.last_seen,
-		(SELECT COUNT(*) FROM ports WHERE device_id = d.id) as port_count
-		FROM devices d
-		WHERE d.ip_address LIKE ? OR d.hostname LIKE ? OR d.os_fingerprint LIKE ? OR d.mac_address LIKE ?
-		ORDER BY d.last_seen DESC`,
-		likeQuery, likeQuery, likeQuery, likeQuery,
+	devices, err := db.queryDevices(
+		`WHERE d.ip_address LIKE ?1 OR d.hostname LIKE ?2 OR d.os_fingerprint LIKE ?2 OR d.mac_address LIKE ?2 OR d.vendor LIKE ?2
+		 OR d.netbios_name LIKE ?2 OR d.workgroup LIKE ?2 OR d.smb_os LIKE ?2
+		 OR EXISTS (SELECT 1 FROM device_addresses a WHERE a.device_id = d.id AND a.address LIKE ?1)
+		 ORDER BY d.last_seen DESC`,
+		addressQuery, likeQuery,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search devices: %w", err)
 	}
-	defer rows.Close()
-
-	var devices []*models.Device
-	for rows.Next() {
-		var device models.Device
-		err := rows.Scan(
-			&device.ID,
-			&device.IPAddress,
-			&device.MACAddress,
-			&device.Hostname,
-			&device.OSFingerprint,
-			&device.FirstSeen,
-			&device.LastSeen,
-			&device.PortCount,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan device row: %w", err)
-		}
-		devices = append(devices, &device)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating device rows: %w", err)
-	}
 
 	return devices, nil
 }
@@ -1054,34 +1554,37 @@ func (db *DB) CleanOldData(retentionDays int) (int, error) {
 		}
 	}()
 
-	// Order is important for foreign key constraints
-	// First delete changes (which reference devices and scans)
-	res, err := tx.Exec("DELETE FROM changes WHERE timestamp < ?", cutoff)
-	if err != nil {
-		return 0, fmt.Errorf("failed to delete old changes: %w", err)
-	}
-	changeCount, _ := res.RowsAffected()
-
-	// Delete old scans
-	res, err = tx.Exec("DELETE FROM scans WHERE timestamp < ?", cutoff)
-	if err != nil {
-		return 0, fmt.Errorf("failed to delete old scans: %w", err)
-	}
-	scanCount, _ := res.RowsAffected()
-
-	// Delete old devices (their ports will cascade due to foreign key)
-	res, err = tx.Exec("DELETE FROM devices WHERE last_seen < ?", cutoff)
-	if err != nil {
-		return 0, fmt.Errorf("failed to delete old devices: %w", err)
-	}
-	deviceCount, _ := res.RowsAffected()
-
-	// Delete old logs
-	res, err = tx.Exec("DELETE FROM logs WHERE timestamp < ?", cutoff)
-	if err != nil {
-		return 0, fmt.Errorf("failed to delete old logs: %w", err)
+	// Order is important for foreign key constraints: changes reference
+	// devices and scans, and deleting a scan or device deletes what was
+	// observed in it. Queued and running jobs, unresolved findings and the
+	// certificates ports currently present are kept whatever their age.
+	cleanups := []struct {
+		name  string
+		query string
+	}{
+		{"changes", `DELETE FROM changes WHERE timestamp < ?`},
+		{"scans", `DELETE FROM scans WHERE timestamp < ?`},
+		{"devices", `DELETE FROM devices WHERE last_seen < ?`},
+		{"logs", `DELETE FROM logs WHERE timestamp < ?`},
+		{"scanJobs", `DELETE FROM scan_jobs WHERE status NOT IN ('queued', 'running') AND COALESCE(finished_at, created_at) < ?`},
+		{"scheduleRuns", `DELETE FROM schedule_runs WHERE run_at < ?`},
+		{"maintenanceRuns", `DELETE FROM maintenance_runs WHERE finished_at < ?`},
+		{"auditEntries", `DELETE FROM audit_log WHERE timestamp < ?`},
+		{"resolvedVulnerabilities", `DELETE FROM vulnerability_findings WHERE resolved_at < ?`},
+		{"replacedCertificates", `DELETE FROM certificates WHERE replaced_at < ?`},
+	}
+
+	event := db.logger.Info()
+	totalDeleted := 0
+	for _, cleanup := range cleanups {
+		res, err := tx.Exec(cleanup.query, cutoff)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete old %s: %w", cleanup.name, err)
+		}
+		count, _ := res.RowsAffected()
+		event = event.Int(cleanup.name, int(count))
+		totalDeleted += int(count)
 	}
-	logCount, _ := res.RowsAffected()
 
 	// Commit the transaction
 	if err = tx.Commit(); err != nil {
@@ -1091,15 +1594,7 @@ func (db *DB) CleanOldData(retentionDays int) (int, error) {
 	// Set tx to nil to prevent rollback in deferred function
 	tx = nil
 
-	totalDeleted := int(scanCount + deviceCount + changeCount + logCount)
-
-	db.logger.Info().
-		Int("scans", int(scanCount)).
-		Int("devices", int(deviceCount)).
-		Int("changes", int(changeCount)).
-		Int("logs", int(logCount)).
-		Int("total", totalDeleted).
-		Msg("Cleaned old data")
+	event.Int("total", totalDeleted).Msg("Cleaned old data")
 
 	return totalDeleted, nil
 }
@@ -1182,12 +1677,46 @@ func (db *DB) GetDatabaseStats() (map[string]interface{}, error) {
 
 	// Get port count
 	var portCount int
-	err = db.QueryRow("SELECT COUNT(*) FROM ports").Scan(&portCount)
+	err = db.QueryRow("SELECT COUNT(*) FROM ports WHERE state <> 'closed'").Scan(&portCount)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get port count: %w", err)
 	}
 	stats["portCount"] = portCount
 
+	// Get ports and devices that reconciliation found gone
+	var closedPorts int
+	err = db.QueryRow("SELECT COUNT(*) FROM ports WHERE state = 'closed'").Scan(&closedPorts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get closed port count: %w", err)
+	}
+	stats["closedPorts"] = closedPorts
+
+	var offlineDevices int
+	err = db.QueryRow("SELECT COUNT(*) FROM devices WHERE offline_since IS NOT NULL").Scan(&offlineDevices)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get offline device count: %w", err)
+	}
+	stats["offlineDevices"] = offlineDevices
+
+	// Get devices whose MAC address is locally administered, as randomized
+	// by phones and laptops for privacy
+	var randomizedMACs int
+	err = db.QueryRow(
+		`SELECT COUNT(*) FROM devices WHERE upper(substr(mac_address, 2, 1)) IN ('2', '3', '6', '7', 'A', 'B', 'E', 'F')`,
+	).Scan(&randomizedMACs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get randomized MAC count: %w", err)
+	}
+	stats["randomizedMacs"] = randomizedMACs
+
+	// Get vulnerability findings that have not been resolved
+	var activeVulnerabilities int
+	err = db.QueryRow("SELECT COUNT(*) FROM vulnerability_findings WHERE resolved_at IS NULL").Scan(&activeVulnerabilities)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active vulnerability count: %w", err)
+	}
+	stats["activeVulnerabilities"] = activeVulnerabilities
+
 	// Get scan count
 	var scanCount int
 	err = db.QueryRow("SELECT COUNT(*) FROM scans").Scan(&scanCount)
@@ -1243,9 +1772,10 @@ func (db *DB) GetDatabaseStats() (map[string]interface{}, error) {
 		stats["sizeBytes"] = fileInfo.Size()
 	}
 
-	// Get OS distribution
+	// Get OS distribution by family, falling back to the fingerprint of
+	// devices whose family is not known
 	osDistribution := make(map[string]int)
-	rows, err := db.Query("SELECT COALESCE(os_fingerprint, 'Unknown') as os, COUNT(*) FROM devices GROUP BY os_fingerprint")
+	rows, err := db.Query(`SELECT ` + osFamilyExpr + ` as os, COUNT(*) FROM devices GROUP BY os`)
 	if err != nil {
 		db.logger.Warn().Err(err).Msg("Failed to get OS distribution")
 	} else {
@@ -1268,7 +1798,7 @@ func (db *DB) GetDatabaseStats() (map[string]interface{}, error) {
 
 	// Get service distribution
 	serviceDistribution := make(map[string]int)
-	rows, err = db.Query("SELECT COALESCE(service_name, 'Unknown') as service, COUNT(*) FROM ports GROUP BY service_name")
+	rows, err = db.Query("SELECT COALESCE(service_name, 'Unknown') as service, COUNT(*) FROM ports WHERE state <> 'closed' GROUP BY service_name")
 	if err != nil {
 		db.logger.Warn().Err(err).Msg("Failed to get service distribution")
 	} else {
@@ -293,6 +293,73 @@ func TestSavePort(t *testing.T) {
 	}
 }
 
+// TestSavePortState tests storing port states and recording state changes
+func TestSavePortState(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if _, err := db.CreateScan("udp"); err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+
+	deviceID, err := db.SaveDevice(&models.Device{IPAddress: "192.168.1.201", MACAddress: "AA:BB:CC:DD:EE:01"})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+
+	// Ports saved without a state are open; the same port number may be
+	// stored once per protocol
+	ports := []*models.Port{
+		{DeviceID: deviceID, PortNumber: 53, Protocol: "tcp", ServiceName: "domain"},
+		{DeviceID: deviceID, PortNumber: 53, Protocol: "udp", ServiceName: "domain", State: "open|filtered", Reason: "no-response"},
+		{DeviceID: deviceID, PortNumber: 53, Protocol: "udp", ServiceName: "domain", State: "open", Reason: "udp-response"},
+	}
+	for _, port := range ports {
+		if err := db.SavePort(port); err != nil {
+			t.Fatalf("Failed to save port: %v", err)
+		}
+	}
+
+	details, err := db.GetDeviceDetails(deviceID)
+	if err != nil {
+		t.Fatalf("Failed to get device details: %v", err)
+	}
+
+	if len(details.Ports) != 2 {
+		t.Fatalf("Expected 2 ports, got %d", len(details.Ports))
+	}
+	if details.Ports[0].Protocol != "tcp" || details.Ports[0].State != "open" || details.Ports[0].Reason != "" {
+		t.Errorf("Unexpected TCP port: %+v", details.Ports[0])
+	}
+	if details.Ports[1].Protocol != "udp" || details.Ports[1].State != "open" || details.Ports[1].Reason != "udp-response" {
+		t.Errorf("Unexpected UDP port: %+v", details.Ports[1])
+	}
+
+	rows, err := db.Query(`SELECT change_type, details FROM changes WHERE device_id = ? AND change_type <> 'new_device' ORDER BY id`, deviceID)
+	if err != nil {
+		t.Fatalf("Failed to query changes: %v", err)
+	}
+	defer rows.Close()
+
+	var changes []string
+	for rows.Next() {
+		var changeType, details string
+		if err := rows.Scan(&changeType, &details); err != nil {
+			t.Fatalf("Failed to scan change: %v", err)
+		}
+		changes = append(changes, changeType+": "+details)
+	}
+
+	want := []string{
+		"new_port: New port discovered: 53/tcp - domain",
+		"new_port: New port discovered: 53/udp (open|filtered) - domain",
+		"port_state_change: Port 53/udp state changed: open|filtered -> open (udp-response)",
+	}
+	if fmt.Sprint(changes) != fmt.Sprint(want) {
+		t.Errorf("Expected changes %q, got %q", want, changes)
+	}
+}
+
 // TestGetAllDevices tests retrieving all devices
 func TestGetAllDevices(t *testing.T) {
 	db, _, cleanup := setupTestDB(t)
@@ -0,0 +1,157 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// exclusionColumns lists the columns read by scanExclusionRow
+const exclusionColumns = `id, target, reason, created_at, expires_at`
+
+// scanExclusionRow reads an exclusion from a query result
+func scanExclusionRow(row rowScanner) (*models.Exclusion, error) {
+	var exclusion models.Exclusion
+	var expiresAt sql.NullTime
+
+	if err := row.Scan(&exclusion.ID, &exclusion.Target, &exclusion.Reason, &exclusion.CreatedAt, &expiresAt); err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		exclusion.ExpiresAt = &expiresAt.Time
+	}
+	exclusion.Source = "database"
+
+	return &exclusion, nil
+}
+
+// nullableTime converts an optional time to a value for a nullable column
+func nullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
+// CreateExclusion stores a new exclusion
+func (db *DB) CreateExclusion(exclusion *models.Exclusion) (int64, error) {
+	res, err := db.Exec(
+		`INSERT INTO exclusions (target, reason, created_at, expires_at) VALUES (?, ?, ?, ?)`,
+		exclusion.Target, exclusion.Reason, time.Now(), nullableTime(exclusion.ExpiresAt),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create exclusion: %w", err)
+	}
+
+	return res.LastInsertId()
+}
+
+// UpdateExclusion replaces the target, reason and expiry of an exclusion
+func (db *DB) UpdateExclusion(exclusion *models.Exclusion) error {
+	res, err := db.Exec(
+		`UPDATE exclusions SET target = ?, reason = ?, expires_at = ? WHERE id = ?`,
+		exclusion.Target, exclusion.Reason, nullableTime(exclusion.ExpiresAt), exclusion.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update exclusion %d: %w", exclusion.ID, err)
+	}
+
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return fmt.Errorf("failed to update exclusion %d: %w", exclusion.ID, sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// GetExclusion retrieves an exclusion by ID
+func (db *DB) GetExclusion(id int64) (*models.Exclusion, error) {
+	exclusion, err := scanExclusionRow(db.QueryRow(
+		`SELECT `+exclusionColumns+` FROM exclusions WHERE id = ?`, id,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exclusion: %w", err)
+	}
+
+	return exclusion, nil
+}
+
+// GetExclusions retrieves stored exclusions. Unless includeExpired is set,
+// only exclusions that have not expired at the given time are returned.
+func (db *DB) GetExclusions(includeExpired bool, now time.Time) ([]*models.Exclusion, error) {
+	query := `SELECT ` + exclusionColumns + ` FROM exclusions`
+	var args []interface{}
+	if !includeExpired {
+		query += ` WHERE expires_at IS NULL OR expires_at > ?`
+		args = append(args, now)
+	}
+	query += ` ORDER BY id`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query exclusions: %w", err)
+	}
+	defer rows.Close()
+
+	exclusions := []*models.Exclusion{}
+	for rows.Next() {
+		exclusion, err := scanExclusionRow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan exclusion row: %w", err)
+		}
+		exclusions = append(exclusions, exclusion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating exclusion rows: %w", err)
+	}
+
+	return exclusions, nil
+}
+
+// DeleteExclusion removes an exclusion
+func (db *DB) DeleteExclusion(id int64) error {
+	res, err := db.Exec(`DELETE FROM exclusions WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete exclusion %d: %w", id, err)
+	}
+
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return fmt.Errorf("failed to delete exclusion %d: %w", id, sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// SetScanExclusions records the exclusions that were in effect for a scan
+func (db *DB) SetScanExclusions(scanID int64, targets []string) error {
+	encoded, err := json.Marshal(targets)
+	if err != nil {
+		return fmt.Errorf("failed to encode exclusions: %w", err)
+	}
+
+	if _, err := db.Exec(`UPDATE scans SET exclusions = ? WHERE id = ?`, string(encoded), scanID); err != nil {
+		return fmt.Errorf("failed to record exclusions for scan #%d: %w", scanID, err)
+	}
+
+	return nil
+}
+
+// decodeExclusionList decodes the exclusions column of a scan
+func decodeExclusionList(value sql.NullString) []string {
+	if !value.Valid || value.String == "" {
+		return nil
+	}
+
+	var targets []string
+	if err := json.Unmarshal([]byte(value.String), &targets); err != nil {
+		return nil
+	}
+
+	return targets
+}
@@ -0,0 +1,91 @@
+// internal/database/exclusions_test.go
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestExclusions tests storing exclusions and recording them on scans
+func TestExclusions(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	expired := now.Add(-time.Hour)
+
+	id, err := db.CreateExclusion(&models.Exclusion{Target: "192.168.1.1", Reason: "Core router"})
+	if err != nil {
+		t.Fatalf("Failed to create exclusion: %v", err)
+	}
+
+	if _, err := db.CreateExclusion(&models.Exclusion{Target: "10.0.0.0/8", Reason: "Old lab", ExpiresAt: &expired}); err != nil {
+		t.Fatalf("Failed to create expired exclusion: %v", err)
+	}
+
+	active, err := db.GetExclusions(false, now)
+	if err != nil {
+		t.Fatalf("Failed to list exclusions: %v", err)
+	}
+
+	if len(active) != 1 || active[0].Target != "192.168.1.1" || active[0].Source != "database" {
+		t.Errorf("Expected only the unexpired exclusion, got %+v", active)
+	}
+
+	all, err := db.GetExclusions(true, now)
+	if err != nil {
+		t.Fatalf("Failed to list all exclusions: %v", err)
+	}
+
+	if len(all) != 2 {
+		t.Errorf("Expected 2 exclusions including expired, got %d", len(all))
+	}
+
+	// Update the exclusion
+	future := now.Add(time.Hour)
+	update := &models.Exclusion{ID: id, Target: "192.168.1.0/30", Reason: "Core routers", ExpiresAt: &future}
+	if err := db.UpdateExclusion(update); err != nil {
+		t.Fatalf("Failed to update exclusion: %v", err)
+	}
+
+	stored, err := db.GetExclusion(id)
+	if err != nil {
+		t.Fatalf("Failed to get exclusion: %v", err)
+	}
+
+	if stored.Target != "192.168.1.0/30" || stored.ExpiresAt == nil {
+		t.Errorf("Unexpected updated exclusion: %+v", stored)
+	}
+
+	// Delete the exclusion
+	if err := db.DeleteExclusion(id); err != nil {
+		t.Fatalf("Failed to delete exclusion: %v", err)
+	}
+
+	if err := db.DeleteExclusion(id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows deleting missing exclusion, got %v", err)
+	}
+
+	// Scans record the exclusions in effect
+	scanID, err := db.CreateScan("default")
+	if err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+
+	if err := db.SetScanExclusions(scanID, []string{"192.168.1.1", "10.0.0.0/8"}); err != nil {
+		t.Fatalf("Failed to set scan exclusions: %v", err)
+	}
+
+	scan, err := db.GetScan(scanID)
+	if err != nil {
+		t.Fatalf("Failed to get scan: %v", err)
+	}
+
+	if len(scan.Exclusions) != 2 || scan.Exclusions[1] != "10.0.0.0/8" {
+		t.Errorf("Unexpected scan exclusions: %v", scan.Exclusions)
+	}
+}
@@ -0,0 +1,407 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// ErrInvalidIdentityChange is returned for a merge or split of devices that
+// cannot be made, such as merging a device into itself
+var ErrInvalidIdentityChange = errors.New("invalid device merge or split")
+
+// resolveDevice finds the existing device an observed host is, trusting the
+// evidence in order of how well it survives an address change:
+//
+//  1. MAC address, preferring a device already at the observed address
+//  2. hostname, if exactly one device has it and its OS fingerprint does not
+//     contradict the observation
+//  3. IP address, the most recent device seen at it
+//
+// A host with a MAC address is never matched by hostname or IP address to a
+// device with a different MAC address. It returns sql.ErrNoRows if the host
+// is new.
+func resolveDevice(tx *sql.Tx, device *models.Device) (int64, error) {
+	var id int64
+
+	if device.MACAddress != "" {
+		err := tx.QueryRow(
+			`SELECT id FROM devices WHERE mac_address = ? COLLATE NOCASE
+			 ORDER BY ip_address = ? DESC, last_seen DESC LIMIT 1`,
+			device.MACAddress, device.IPAddress,
+		).Scan(&id)
+		if err != sql.ErrNoRows {
+			return id, err
+		}
+	}
+
+	if device.Hostname != "" {
+		id, err := resolveByHostname(tx, device)
+		if err != sql.ErrNoRows {
+			return id, err
+		}
+	}
+
+	err := tx.QueryRow(
+		`SELECT d.id FROM device_addresses a JOIN devices d ON d.id = a.device_id
+		 WHERE a.address = ? AND (? = '' OR COALESCE(d.mac_address, '') = '')
+		 ORDER BY COALESCE(d.mac_address, '') = ? DESC, a.last_seen DESC LIMIT 1`,
+		device.IPAddress, device.MACAddress, device.MACAddress,
+	).Scan(&id)
+
+	return id, err
+}
+
+// resolveByHostname finds the only device with a host's hostname whose OS
+// fingerprint, where both are known, matches the host's
+func resolveByHostname(tx *sql.Tx, device *models.Device) (int64, error) {
+	rows, err := tx.Query(
+		`SELECT id, COALESCE(os_fingerprint, '') FROM devices
+		 WHERE hostname = ? COLLATE NOCASE AND (? = '' OR COALESCE(mac_address, '') = '')`,
+		device.Hostname, device.MACAddress,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var matches []int64
+	for rows.Next() {
+		var id int64
+		var fingerprint string
+		if err := rows.Scan(&id, &fingerprint); err != nil {
+			return 0, err
+		}
+		if fingerprint == "" || device.OSFingerprint == "" || fingerprint == device.OSFingerprint {
+			matches = append(matches, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// A hostname shared by several devices identifies none of them
+	if len(matches) != 1 {
+		return 0, sql.ErrNoRows
+	}
+	return matches[0], nil
+}
+
+// MergeDevices merges devices that are the same host into the target device.
+// Their ports, addresses, script results, changes and observations move to
+// the target, which keeps its own primary address and gains any MAC address,
+// hostname or OS fingerprint it lacks. Where both have the same port or
+// address the target's is kept, covering the times both were seen, and where
+// both were found by the same scan the target's observation is kept.
+func (db *DB) MergeDevices(targetID int64, sourceIDs []int64) error {
+	if len(sourceIDs) == 0 {
+		return fmt.Errorf("%w: no devices to merge", ErrInvalidIdentityChange)
+	}
+	for _, sourceID := range sourceIDs {
+		if sourceID == targetID {
+			return fmt.Errorf("%w: cannot merge device %d into itself", ErrInvalidIdentityChange, targetID)
+		}
+	}
+
+	db.Lock()
+	defer db.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err := deviceAddress(tx, targetID); err != nil {
+		return err
+	}
+
+	var changes []*models.Change
+	for _, sourceID := range sourceIDs {
+		sourceIP, err := deviceAddress(tx, sourceID)
+		if err != nil {
+			return err
+		}
+
+		if err := mergeDevice(tx, targetID, sourceID); err != nil {
+			return fmt.Errorf("failed to merge device %d into %d: %w", sourceID, targetID, err)
+		}
+
+		change, err := db.insertChange(tx, 0, targetID, "device_merged",
+			fmt.Sprintf("Merged device %d (%s) into this device", sourceID, sourceIP))
+		if err != nil {
+			return err
+		}
+		changes = append(changes, change)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	tx = nil
+
+	db.logger.Info().Int64("deviceID", targetID).Ints64("merged", sourceIDs).Msg("Merged devices")
+
+	db.publishChanges(changes)
+
+	return nil
+}
+
+// mergeDevice moves everything recorded about one device to another and
+// deletes it
+func mergeDevice(tx *sql.Tx, targetID, sourceID int64) error {
+	statements := []string{
+		// Ports both devices have keep the target's row and its script results
+		`UPDATE ports SET
+		   first_seen = MIN(first_seen, (SELECT s.first_seen FROM ports s WHERE s.device_id = ?2 AND s.port_number = ports.port_number AND s.protocol = ports.protocol)),
+		   last_seen = MAX(last_seen, (SELECT s.last_seen FROM ports s WHERE s.device_id = ?2 AND s.port_number = ports.port_number AND s.protocol = ports.protocol))
+		 WHERE device_id = ?1 AND EXISTS (SELECT 1 FROM ports s WHERE s.device_id = ?2 AND s.port_number = ports.port_number AND s.protocol = ports.protocol)`,
+		`UPDATE script_results SET port_id = (
+		   SELECT t.id FROM ports t JOIN ports s ON s.port_number = t.port_number AND s.protocol = t.protocol
+		   WHERE s.id = script_results.port_id AND t.device_id = ?1)
+		 WHERE port_id IN (SELECT s.id FROM ports s JOIN ports t ON t.port_number = s.port_number AND t.protocol = s.protocol
+		   WHERE s.device_id = ?2 AND t.device_id = ?1)`,
+		`DELETE FROM ports WHERE device_id = ?2 AND EXISTS (
+		   SELECT 1 FROM ports t WHERE t.device_id = ?1 AND t.port_number = ports.port_number AND t.protocol = ports.protocol)`,
+		`UPDATE ports SET device_id = ?1 WHERE device_id = ?2`,
+
+		// Addresses both devices were seen at cover both times
+		`UPDATE device_addresses SET
+		   first_seen = MIN(first_seen, (SELECT s.first_seen FROM device_addresses s WHERE s.device_id = ?2 AND s.address = device_addresses.address)),
+		   last_seen = MAX(last_seen, (SELECT s.last_seen FROM device_addresses s WHERE s.device_id = ?2 AND s.address = device_addresses.address))
+		 WHERE device_id = ?1 AND address IN (SELECT address FROM device_addresses WHERE device_id = ?2)`,
+		`DELETE FROM device_addresses WHERE device_id = ?2 AND address IN (SELECT address FROM device_addresses WHERE device_id = ?1)`,
+		`UPDATE device_addresses SET device_id = ?1 WHERE device_id = ?2`,
+
+		`UPDATE script_results SET device_id = ?1 WHERE device_id = ?2`,
+		`UPDATE changes SET device_id = ?1 WHERE device_id = ?2`,
+
+		// Scans that found both keep the target's observation
+		`DELETE FROM scan_port_observations WHERE device_id = ?2 AND scan_id IN (SELECT scan_id FROM scan_host_observations WHERE device_id = ?1)`,
+		`DELETE FROM scan_host_observations WHERE device_id = ?2 AND scan_id IN (SELECT scan_id FROM scan_host_observations WHERE device_id = ?1)`,
+		`UPDATE scan_port_observations SET device_id = ?1 WHERE device_id = ?2`,
+		`UPDATE scan_host_observations SET device_id = ?1 WHERE device_id = ?2`,
+
+		// Findings both devices have keep the target's row, covering both times
+		`UPDATE vulnerability_findings SET
+		   first_seen = MIN(first_seen, (SELECT s.first_seen FROM vulnerability_findings s WHERE s.device_id = ?2 AND s.port_number = vulnerability_findings.port_number AND s.protocol = vulnerability_findings.protocol AND s.cve_id = vulnerability_findings.cve_id)),
+		   last_seen = MAX(last_seen, (SELECT s.last_seen FROM vulnerability_findings s WHERE s.device_id = ?2 AND s.port_number = vulnerability_findings.port_number AND s.protocol = vulnerability_findings.protocol AND s.cve_id = vulnerability_findings.cve_id))
+		 WHERE device_id = ?1 AND EXISTS (SELECT 1 FROM vulnerability_findings s WHERE s.device_id = ?2 AND s.port_number = vulnerability_findings.port_number AND s.protocol = vulnerability_findings.protocol AND s.cve_id = vulnerability_findings.cve_id)`,
+		`DELETE FROM vulnerability_findings WHERE device_id = ?2 AND EXISTS (
+		   SELECT 1 FROM vulnerability_findings t WHERE t.device_id = ?1 AND t.port_number = vulnerability_findings.port_number AND t.protocol = vulnerability_findings.protocol AND t.cve_id = vulnerability_findings.cve_id)`,
+		`UPDATE vulnerability_findings SET device_id = ?1 WHERE device_id = ?2`,
+
+		// Certificates both devices have seen on a port keep the target's row;
+		// the target's current certificate stays current
+		`UPDATE certificates SET
+		   first_seen = MIN(first_seen, (SELECT s.first_seen FROM certificates s WHERE s.device_id = ?2 AND s.port_number = certificates.port_number AND s.protocol = certificates.protocol AND s.sha256_fingerprint = certificates.sha256_fingerprint)),
+		   last_seen = MAX(last_seen, (SELECT s.last_seen FROM certificates s WHERE s.device_id = ?2 AND s.port_number = certificates.port_number AND s.protocol = certificates.protocol AND s.sha256_fingerprint = certificates.sha256_fingerprint))
+		 WHERE device_id = ?1 AND EXISTS (SELECT 1 FROM certificates s WHERE s.device_id = ?2 AND s.port_number = certificates.port_number AND s.protocol = certificates.protocol AND s.sha256_fingerprint = certificates.sha256_fingerprint)`,
+		`DELETE FROM certificates WHERE device_id = ?2 AND EXISTS (
+		   SELECT 1 FROM certificates t WHERE t.device_id = ?1 AND t.port_number = certificates.port_number AND t.protocol = certificates.protocol AND t.sha256_fingerprint = certificates.sha256_fingerprint)`,
+		`UPDATE certificates SET replaced_at = last_seen WHERE device_id = ?2 AND replaced_at IS NULL AND EXISTS (
+		   SELECT 1 FROM certificates t WHERE t.device_id = ?1 AND t.port_number = certificates.port_number AND t.protocol = certificates.protocol AND t.replaced_at IS NULL)`,
+		`UPDATE certificates SET device_id = ?1 WHERE device_id = ?2`,
+
+		// The target keeps its own OS matches, if it has any
+		`DELETE FROM device_os_matches WHERE device_id = ?2 AND EXISTS (SELECT 1 FROM device_os_matches WHERE device_id = ?1)`,
+		`UPDATE device_os_matches SET device_id = ?1 WHERE device_id = ?2`,
+
+		// The target fills in what it does not know from the source
+		`UPDATE devices SET
+		   mac_address = CASE WHEN COALESCE(mac_address, '') = '' THEN (SELECT mac_address FROM devices WHERE id = ?2) ELSE mac_address END,
+		   vendor = CASE WHEN COALESCE(mac_address, '') = '' THEN (SELECT vendor FROM devices WHERE id = ?2) ELSE vendor END,
+		   hostname = CASE WHEN COALESCE(hostname, '') = '' THEN (SELECT hostname FROM devices WHERE id = ?2) ELSE hostname END,
+		   os_fingerprint = CASE WHEN COALESCE(os_fingerprint, '') = '' THEN (SELECT os_fingerprint FROM devices WHERE id = ?2) ELSE os_fingerprint END,
+		   os_accuracy = CASE WHEN COALESCE(os_fingerprint, '') = '' THEN (SELECT os_accuracy FROM devices WHERE id = ?2) ELSE os_accuracy END,
+		   os_family = CASE WHEN COALESCE(os_fingerprint, '') = '' THEN (SELECT os_family FROM devices WHERE id = ?2) ELSE os_family END,
+		   device_type = CASE WHEN COALESCE(os_fingerprint, '') = '' THEN (SELECT device_type FROM devices WHERE id = ?2) ELSE device_type END,
+		   os_cpes = CASE WHEN COALESCE(os_fingerprint, '') = '' THEN (SELECT os_cpes FROM devices WHERE id = ?2) ELSE os_cpes END,
+		   netbios_name = CASE WHEN COALESCE(netbios_name, '') = '' THEN (SELECT netbios_name FROM devices WHERE id = ?2) ELSE netbios_name END,
+		   workgroup = CASE WHEN COALESCE(workgroup, '') = '' THEN (SELECT workgroup FROM devices WHERE id = ?2) ELSE workgroup END,
+		   smb_os = CASE WHEN COALESCE(smb_os, '') = '' THEN (SELECT smb_os FROM devices WHERE id = ?2) ELSE smb_os END,
+		   first_seen = MIN(first_seen, (SELECT first_seen FROM devices WHERE id = ?2)),
+		   last_seen = MAX(last_seen, (SELECT last_seen FROM devices WHERE id = ?2))
+		 WHERE id = ?1`,
+		`DELETE FROM devices WHERE id = ?2`,
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, targetID, sourceID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SplitDevice moves addresses wrongly attributed to a device to a new device
+// and returns its ID. The new device takes the given MAC address and
+// hostname, which may be empty, and the observations made at the moved
+// addresses. Ports stay with the original device; the next scan of the new
+// device finds its own. The original device must keep at least one address.
+func (db *DB) SplitDevice(deviceID int64, addresses []string, macAddress, hostname string) (int64, error) {
+	if len(addresses) == 0 {
+		return 0, fmt.Errorf("%w: no addresses to split", ErrInvalidIdentityChange)
+	}
+
+	db.Lock()
+	defer db.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	primary, err := deviceAddress(tx, deviceID)
+	if err != nil {
+		return 0, err
+	}
+
+	moved := make(map[string]bool)
+	var firstSeen, lastSeen time.Time
+	for i, address := range addresses {
+		address = NormalizeIP(address)
+		addresses[i] = address
+
+		var seenFrom, seenTo time.Time
+		err := tx.QueryRow(
+			`SELECT first_seen, last_seen FROM device_addresses WHERE device_id = ? AND address = ?`, deviceID, address,
+		).Scan(&seenFrom, &seenTo)
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("%w: device %d has not been seen at %s", ErrInvalidIdentityChange, deviceID, address)
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to read addresses of device %d: %w", deviceID, err)
+		}
+
+		moved[address] = true
+		if firstSeen.IsZero() || seenFrom.Before(firstSeen) {
+			firstSeen = seenFrom
+		}
+		if seenTo.After(lastSeen) {
+			lastSeen = seenTo
+		}
+	}
+
+	// The original device keeps its most recent remaining address
+	var remaining string
+	err = tx.QueryRow(
+		`SELECT address FROM device_addresses
+		 WHERE device_id = ? AND address NOT IN (`+placeholders(len(addresses))+`)
+		 ORDER BY address = ? DESC, last_seen DESC LIMIT 1`,
+		append(append([]interface{}{deviceID}, stringArgs(addresses)...), primary)...,
+	).Scan(&remaining)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w: device %d must keep at least one address", ErrInvalidIdentityChange, deviceID)
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read addresses of device %d: %w", deviceID, err)
+	}
+
+	res, err := tx.Exec(
+		`INSERT INTO devices (ip_address, mac_address, hostname, os_fingerprint, first_seen, last_seen)
+		 VALUES (?, ?, ?, '', ?, ?)`,
+		addresses[0], macAddress, hostname, firstSeen, lastSeen,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert device: %w", err)
+	}
+	newID, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get inserted device ID: %w", err)
+	}
+
+	in := placeholders(len(addresses))
+	moves := []struct {
+		statement string
+		args      []interface{}
+	}{
+		{
+			`UPDATE scan_port_observations SET device_id = ? WHERE device_id = ? AND scan_id IN (
+			   SELECT scan_id FROM scan_host_observations WHERE device_id = ? AND ip_address IN (` + in + `))`,
+			append([]interface{}{newID, deviceID, deviceID}, stringArgs(addresses)...),
+		},
+		{
+			`UPDATE scan_host_observations SET device_id = ? WHERE device_id = ? AND ip_address IN (` + in + `)`,
+			append([]interface{}{newID, deviceID}, stringArgs(addresses)...),
+		},
+		{
+			`UPDATE device_addresses SET device_id = ? WHERE device_id = ? AND address IN (` + in + `)`,
+			append([]interface{}{newID, deviceID}, stringArgs(addresses)...),
+		},
+	}
+	for _, move := range moves {
+		if _, err := tx.Exec(move.statement, move.args...); err != nil {
+			return 0, fmt.Errorf("failed to split device %d: %w", deviceID, err)
+		}
+	}
+
+	if moved[primary] {
+		if _, err := tx.Exec(`UPDATE devices SET ip_address = ? WHERE id = ?`, remaining, deviceID); err != nil {
+			return 0, fmt.Errorf("failed to update device: %w", err)
+		}
+	}
+
+	list := strings.Join(addresses, ", ")
+	var changes []*models.Change
+	for _, record := range []struct {
+		deviceID int64
+		details  string
+	}{
+		{deviceID, fmt.Sprintf("Split %s into device %d", list, newID)},
+		{newID, fmt.Sprintf("Split from device %d with %s", deviceID, list)},
+	} {
+		change, err := db.insertChange(tx, 0, record.deviceID, "device_split", record.details)
+		if err != nil {
+			return 0, err
+		}
+		changes = append(changes, change)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	tx = nil
+
+	db.logger.Info().Int64("deviceID", deviceID).Int64("newDeviceID", newID).Strs("addresses", addresses).Msg("Split device")
+
+	db.publishChanges(changes)
+
+	return newID, nil
+}
+
+// deviceAddress returns the primary address of a device, or an error
+// wrapping sql.ErrNoRows if there is no such device
+func deviceAddress(tx *sql.Tx, deviceID int64) (string, error) {
+	var address string
+	err := tx.QueryRow(`SELECT ip_address FROM devices WHERE id = ?`, deviceID).Scan(&address)
+	if err != nil {
+		return "", fmt.Errorf("failed to get device %d: %w", deviceID, err)
+	}
+	return address, nil
+}
+
+// placeholders returns n comma-separated query placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// stringArgs converts strings to query arguments
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
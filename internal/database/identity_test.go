@@ -0,0 +1,235 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestDeviceIdentity tests that a host keeps its device when its address
+// changes, identified by MAC address and then by hostname
+func TestDeviceIdentity(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	save := func(device *models.Device) int64 {
+		t.Helper()
+		id, err := db.SaveDevice(device)
+		if err != nil {
+			t.Fatalf("Failed to save device %s: %v", device.IPAddress, err)
+		}
+		return id
+	}
+
+	// A new DHCP lease keeps the device, identified by MAC address
+	laptop := save(&models.Device{IPAddress: "192.168.1.10", MACAddress: "00:11:22:33:44:AA"})
+	if id := save(&models.Device{IPAddress: "192.168.1.20", MACAddress: "00:11:22:33:44:aa"}); id != laptop {
+		t.Errorf("Expected the laptop to keep device %d at its new address, got %d", laptop, id)
+	}
+	if details := changeDetails(t, db, laptop, "ip_changed"); !reflect.DeepEqual(details, []string{"IP address changed: 192.168.1.10 -> 192.168.1.20"}) {
+		t.Errorf("Unexpected ip_changed changes: %v", details)
+	}
+	device, err := db.GetDevice(laptop)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if device.IPAddress != "192.168.1.20" || len(device.Addresses) != 2 {
+		t.Errorf("Expected the laptop at 192.168.1.20 with 2 addresses, got %s and %v", device.IPAddress, device.Addresses)
+	}
+
+	// Another MAC address at the laptop's old address is another device
+	if id := save(&models.Device{IPAddress: "192.168.1.10", MACAddress: "00:11:22:33:44:BB"}); id == laptop {
+		t.Errorf("Expected a host with another MAC address to be a new device")
+	}
+
+	// Without a MAC address, as seen from another network, by hostname
+	nas := save(&models.Device{IPAddress: "10.0.0.30", Hostname: "nas"})
+	other := save(&models.Device{IPAddress: "10.0.0.31", Hostname: "printer"})
+	if id := save(&models.Device{IPAddress: "10.0.0.31", Hostname: "NAS"}); id != nas {
+		t.Errorf("Expected the NAS to keep device %d at the printer's old address, got %d", nas, id)
+	}
+	if id := save(&models.Device{IPAddress: "10.0.0.32", Hostname: "printer"}); id != other {
+		t.Errorf("Expected the printer to keep device %d, got %d", other, id)
+	}
+
+	// A hostname with a contradicting OS fingerprint does not identify a device
+	linux := save(&models.Device{IPAddress: "10.0.0.40", Hostname: "box", OSFingerprint: "Linux 5.x"})
+	if id := save(&models.Device{IPAddress: "10.0.0.41", Hostname: "box", OSFingerprint: "Windows 10"}); id == linux {
+		t.Errorf("Expected a host with another OS to be a new device")
+	}
+
+	// A device first seen without a MAC address gains one at the same address
+	remote := save(&models.Device{IPAddress: "10.0.0.50"})
+	if id := save(&models.Device{IPAddress: "10.0.0.50", MACAddress: "00:11:22:33:44:CC"}); id != remote {
+		t.Errorf("Expected device %d to gain its MAC address, got %d", remote, id)
+	}
+
+	var newDevices int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM changes WHERE change_type = 'new_device'`).Scan(&newDevices); err != nil {
+		t.Fatalf("Failed to count changes: %v", err)
+	}
+	if newDevices != 7 {
+		t.Errorf("Expected 7 new devices, got %d", newDevices)
+	}
+}
+
+// TestMergeDevices tests merging duplicate devices into one
+func TestMergeDevices(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	first, err := db.CreateScan("default")
+	if err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+	second, err := db.CreateScan("default")
+	if err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+
+	target, err := db.SaveDevice(&models.Device{IPAddress: "10.0.0.5"})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	source, err := db.SaveDevice(&models.Device{IPAddress: "10.0.0.6", MACAddress: "00:11:22:33:44:06", Hostname: "nas"})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+
+	for _, port := range []*models.Port{
+		{DeviceID: target, PortNumber: 22, Protocol: "tcp", ServiceName: "ssh"},
+		{DeviceID: source, PortNumber: 22, Protocol: "tcp", ServiceName: "ssh"},
+		{DeviceID: source, PortNumber: 445, Protocol: "tcp", ServiceName: "microsoft-ds"},
+	} {
+		if err := db.SavePort(port); err != nil {
+			t.Fatalf("Failed to save port: %v", err)
+		}
+	}
+	err = db.SaveScriptResult(&models.ScriptResult{DeviceID: source, PortNumber: 22, Protocol: "tcp", ScriptID: "ssh-hostkey", Output: "key"})
+	if err != nil {
+		t.Fatalf("Failed to save script result: %v", err)
+	}
+
+	for _, obs := range []*models.HostObservation{
+		{ScanID: first, DeviceID: target, IPAddress: "10.0.0.5"},
+		{ScanID: first, DeviceID: source, IPAddress: "10.0.0.6"},
+		{ScanID: second, DeviceID: source, IPAddress: "10.0.0.6"},
+	} {
+		obs.ObservedAt = time.Now()
+		if err := db.SaveHostObservation(obs); err != nil {
+			t.Fatalf("Failed to save observation: %v", err)
+		}
+	}
+
+	if err := db.MergeDevices(target, []int64{target}); !errors.Is(err, ErrInvalidIdentityChange) {
+		t.Errorf("Expected merging a device into itself to fail, got %v", err)
+	}
+	if err := db.MergeDevices(target, []int64{9999}); err == nil {
+		t.Errorf("Expected merging an unknown device to fail")
+	}
+
+	if err := db.MergeDevices(target, []int64{source}); err != nil {
+		t.Fatalf("Failed to merge devices: %v", err)
+	}
+
+	if _, err := db.GetDevice(source); err == nil {
+		t.Errorf("Expected merged device to be deleted")
+	}
+
+	details, err := db.GetDeviceDetails(target)
+	if err != nil {
+		t.Fatalf("Failed to get device details: %v", err)
+	}
+	if details.IPAddress != "10.0.0.5" || details.MACAddress != "00:11:22:33:44:06" || details.Hostname != "nas" {
+		t.Errorf("Expected the target to keep its address and gain the MAC address and hostname, got %+v", details.Device)
+	}
+	if len(details.Ports) != 2 || len(details.Addresses) != 2 {
+		t.Errorf("Expected 2 ports and both addresses, got %d ports and %v", len(details.Ports), details.Addresses)
+	}
+	if len(details.Ports[0].Scripts) != 1 {
+		t.Errorf("Expected the script result on the merged port 22, got %+v", details.Ports[0].Scripts)
+	}
+
+	history, err := db.GetDeviceHistory(target, time.Time{}, time.Time{}, 0)
+	if err != nil {
+		t.Fatalf("Failed to get device history: %v", err)
+	}
+	if len(history) != 2 || history[0].ScanID != second || history[1].IPAddress != "10.0.0.5" {
+		t.Errorf("Expected the target's observation of the first scan and the source's of the second, got %+v", history)
+	}
+
+	if details := changeDetails(t, db, target, "new_device"); len(details) != 2 {
+		t.Errorf("Expected the source's changes to move to the target, got %v", details)
+	}
+	if details := changeDetails(t, db, target, "device_merged"); len(details) != 1 {
+		t.Errorf("Expected 1 device_merged change, got %v", details)
+	}
+}
+
+// TestSplitDevice tests moving addresses wrongly attributed to a device to a
+// new device
+func TestSplitDevice(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	scanID, err := db.CreateScan("default")
+	if err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+
+	deviceID, err := db.SaveDevice(&models.Device{IPAddress: "10.0.0.70", Hostname: "web"})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	// Another host with the same hostname is taken for the same device
+	if id, err := db.SaveDevice(&models.Device{IPAddress: "10.0.0.71", Hostname: "web"}); err != nil || id != deviceID {
+		t.Fatalf("Expected the second host to be matched by hostname, got %d (%v)", id, err)
+	}
+	err = db.SaveHostObservation(&models.HostObservation{ScanID: scanID, DeviceID: deviceID, IPAddress: "10.0.0.71", ObservedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("Failed to save observation: %v", err)
+	}
+
+	if _, err := db.SplitDevice(deviceID, []string{"10.0.0.99"}, "", ""); !errors.Is(err, ErrInvalidIdentityChange) {
+		t.Errorf("Expected splitting an unknown address to fail, got %v", err)
+	}
+	if _, err := db.SplitDevice(deviceID, []string{"10.0.0.70", "10.0.0.71"}, "", ""); !errors.Is(err, ErrInvalidIdentityChange) {
+		t.Errorf("Expected splitting every address to fail, got %v", err)
+	}
+
+	newID, err := db.SplitDevice(deviceID, []string{"10.0.0.71"}, "00:11:22:33:44:71", "web2")
+	if err != nil {
+		t.Fatalf("Failed to split device: %v", err)
+	}
+
+	original, err := db.GetDevice(deviceID)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if original.IPAddress != "10.0.0.70" || !reflect.DeepEqual(original.Addresses, []string{"10.0.0.70"}) {
+		t.Errorf("Expected the original device back at 10.0.0.70 alone, got %s and %v", original.IPAddress, original.Addresses)
+	}
+
+	split, err := db.GetDevice(newID)
+	if err != nil {
+		t.Fatalf("Failed to get split device: %v", err)
+	}
+	if split.IPAddress != "10.0.0.71" || split.MACAddress != "00:11:22:33:44:71" || split.Hostname != "web2" {
+		t.Errorf("Unexpected split device: %+v", split)
+	}
+
+	if hosts, err := db.GetScanObservations(scanID); err != nil || len(hosts) != 1 || hosts[0].DeviceID != newID {
+		t.Errorf("Expected the observation at 10.0.0.71 to move to the split device, got %+v (%v)", hosts, err)
+	}
+	if details := changeDetails(t, db, newID, "device_split"); len(details) != 1 {
+		t.Errorf("Expected 1 device_split change on the new device, got %v", details)
+	}
+
+	// The split device is now identified by its MAC address
+	if id, err := db.SaveDevice(&models.Device{IPAddress: "10.0.0.72", MACAddress: "00:11:22:33:44:71", Hostname: "web"}); err != nil || id != newID {
+		t.Errorf("Expected the split device to be identified by MAC address, got %d (%v)", id, err)
+	}
+}
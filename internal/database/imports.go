@@ -0,0 +1,46 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"panopticon-scanner/internal/models"
+)
+
+// CreateImportedScan records a scan whose output was imported rather than
+// produced by the scanner. The hash identifies the imported file so the same
+// output is not imported twice.
+func (db *DB) CreateImportedScan(scan *models.Scan, hash string) (int64, error) {
+	result, err := db.Exec(
+		`INSERT INTO scans (timestamp, template, status, duration, devices_found, ports_found, source, import_hash)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		scan.Timestamp, scan.Template, "running", scan.Duration, 0, 0, "import", hash,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create imported scan: %w", err)
+	}
+
+	scanID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get inserted scan ID: %w", err)
+	}
+
+	return scanID, nil
+}
+
+// GetImportedScanID returns the scan an imported file with the given hash was
+// recorded as, or 0 if it has not been imported. Failed imports are ignored so
+// the file can be imported again.
+func (db *DB) GetImportedScanID(hash string) (int64, error) {
+	var id int64
+	err := db.QueryRow(
+		`SELECT id FROM scans WHERE import_hash = ? AND status <> 'error' ORDER BY id LIMIT 1`, hash,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up imported scan: %w", err)
+	}
+	return id, nil
+}
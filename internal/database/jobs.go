@@ -0,0 +1,235 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// scanJobColumns lists the columns read by scanJobRow
+const scanJobColumns = `id, priority, params, requested_by, COALESCE(label, ''), status, scan_id, error_message, created_at, started_at, finished_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanJobRow reads a scan job from a query result
+func scanJobRow(row rowScanner) (*models.ScanJob, error) {
+	var job models.ScanJob
+	var params string
+	var scanID sql.NullInt64
+	var errorMessage sql.NullString
+	var startedAt, finishedAt sql.NullTime
+
+	err := row.Scan(
+		&job.ID,
+		&job.Priority,
+		&params,
+		&job.RequestedBy,
+		&job.Label,
+		&job.Status,
+		&scanID,
+		&errorMessage,
+		&job.CreatedAt,
+		&startedAt,
+		&finishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(params), &job.Parameters); err != nil {
+		return nil, fmt.Errorf("failed to decode parameters for scan job %d: %w", job.ID, err)
+	}
+
+	job.ScanID = scanID.Int64
+	job.Error = errorMessage.String
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+
+	return &job, nil
+}
+
+// EnqueueScanJob adds a scan job to the queue
+func (db *DB) EnqueueScanJob(job *models.ScanJob) (int64, error) {
+	params, err := json.Marshal(job.Parameters)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode scan parameters: %w", err)
+	}
+
+	res, err := db.Exec(
+		`INSERT INTO scan_jobs (priority, params, requested_by, label, status, created_at)
+		 VALUES (?, ?, ?, ?, 'queued', ?)`,
+		job.Priority, string(params), job.RequestedBy, job.Label, time.Now(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue scan job: %w", err)
+	}
+
+	return res.LastInsertId()
+}
+
+// GetScanJob retrieves a scan job by ID
+func (db *DB) GetScanJob(id int64) (*models.ScanJob, error) {
+	job, err := scanJobRow(db.QueryRow(
+		`SELECT `+scanJobColumns+` FROM scan_jobs WHERE id = ?`, id,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scan job: %w", err)
+	}
+
+	return job, nil
+}
+
+// GetPendingScanJobs retrieves running and queued scan jobs in the order they
+// will run. Queued jobs have their queue position set, starting at 1.
+func (db *DB) GetPendingScanJobs() ([]*models.ScanJob, error) {
+	rows, err := db.Query(
+		`SELECT ` + scanJobColumns + ` FROM scan_jobs
+		 WHERE status IN ('running', 'queued')
+		 ORDER BY status = 'running' DESC, priority DESC, id ASC`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scan jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []*models.ScanJob{}
+	position := 0
+	for rows.Next() {
+		job, err := scanJobRow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job row: %w", err)
+		}
+		if job.Status == "queued" {
+			position++
+			job.Position = position
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating scan job rows: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// GetScanJobPosition returns the position of a queued job, starting at 1
+func (db *DB) GetScanJobPosition(id int64) (int, error) {
+	var position int
+
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM scan_jobs j, scan_jobs target
+		 WHERE target.id = ? AND j.status = 'queued'
+		 AND (j.priority > target.priority OR (j.priority = target.priority AND j.id <= target.id))`, id,
+	).Scan(&position)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get scan job position: %w", err)
+	}
+
+	return position, nil
+}
+
+// ClaimNextScanJob marks the highest priority queued job as running and
+// returns it. It returns nil if the queue is empty.
+func (db *DB) ClaimNextScanJob() (*models.ScanJob, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	job, err := scanJobRow(tx.QueryRow(
+		`SELECT ` + scanJobColumns + ` FROM scan_jobs
+		 WHERE status = 'queued' ORDER BY priority DESC, id ASC LIMIT 1`,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next scan job: %w", err)
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(
+		`UPDATE scan_jobs SET status = 'running', started_at = ? WHERE id = ?`, now, job.ID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim scan job %d: %w", job.ID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	job.Status = "running"
+	job.StartedAt = &now
+
+	return job, nil
+}
+
+// FinishScanJob records the outcome of a scan job
+func (db *DB) FinishScanJob(id int64, status string, scanID int64, errorMsg string) error {
+	var scanRef interface{}
+	if scanID > 0 {
+		scanRef = scanID
+	}
+
+	_, err := db.Exec(
+		`UPDATE scan_jobs SET status = ?, scan_id = ?, error_message = ?, finished_at = ? WHERE id = ?`,
+		status, scanRef, errorMsg, time.Now(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update scan job %d: %w", id, err)
+	}
+
+	return nil
+}
+
+// RequeueScanJob returns a claimed job to the queue
+func (db *DB) RequeueScanJob(id int64) error {
+	_, err := db.Exec(
+		`UPDATE scan_jobs SET status = 'queued', started_at = NULL WHERE id = ?`, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to requeue scan job %d: %w", id, err)
+	}
+
+	return nil
+}
+
+// RequeueRunningScanJobs returns jobs interrupted by a shutdown to the queue
+func (db *DB) RequeueRunningScanJobs() (int64, error) {
+	res, err := db.Exec(
+		`UPDATE scan_jobs SET status = 'queued', started_at = NULL WHERE status = 'running'`,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue running scan jobs: %w", err)
+	}
+
+	return res.RowsAffected()
+}
+
+// CancelQueuedScanJob cancels a job that has not started yet. It reports
+// false if the job is not queued.
+func (db *DB) CancelQueuedScanJob(id int64) (bool, error) {
+	res, err := db.Exec(
+		`UPDATE scan_jobs SET status = 'cancelled', finished_at = ? WHERE id = ? AND status = 'queued'`,
+		time.Now(), id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel scan job %d: %w", id, err)
+	}
+
+	affected, _ := res.RowsAffected()
+	return affected > 0, nil
+}
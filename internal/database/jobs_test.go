@@ -0,0 +1,99 @@
+// internal/database/jobs_test.go
+package database
+
+import (
+	"testing"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestScanJobs tests the persistent scan queue
+func TestScanJobs(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	enqueue := func(priority int, template string) int64 {
+		id, err := db.EnqueueScanJob(&models.ScanJob{
+			Priority:    priority,
+			Parameters:  models.ScanParameters{Template: template},
+			RequestedBy: "test",
+		})
+		if err != nil {
+			t.Fatalf("Failed to enqueue scan job: %v", err)
+		}
+		return id
+	}
+
+	low := enqueue(0, "quick")
+	high := enqueue(10, "default")
+	highLater := enqueue(10, "thorough")
+
+	// Higher priority jobs go first, then oldest first
+	positions := map[int64]int{high: 1, highLater: 2, low: 3}
+	for id, want := range positions {
+		got, err := db.GetScanJobPosition(id)
+		if err != nil {
+			t.Fatalf("Failed to get position: %v", err)
+		}
+		if got != want {
+			t.Errorf("Job %d: expected position %d, got %d", id, want, got)
+		}
+	}
+
+	job, err := db.ClaimNextScanJob()
+	if err != nil {
+		t.Fatalf("Failed to claim job: %v", err)
+	}
+	if job == nil || job.ID != high || job.Status != "running" || job.Parameters.Template != "default" {
+		t.Fatalf("Expected to claim job %d, got %+v", high, job)
+	}
+
+	pending, err := db.GetPendingScanJobs()
+	if err != nil {
+		t.Fatalf("Failed to list pending jobs: %v", err)
+	}
+	if len(pending) != 3 || pending[0].ID != high || pending[1].ID != highLater || pending[1].Position != 1 {
+		t.Errorf("Unexpected pending jobs: %+v", pending)
+	}
+
+	// Jobs left running by a shutdown return to the queue
+	requeued, err := db.RequeueRunningScanJobs()
+	if err != nil {
+		t.Fatalf("Failed to requeue running jobs: %v", err)
+	}
+	if requeued != 1 {
+		t.Errorf("Expected 1 requeued job, got %d", requeued)
+	}
+
+	job, _ = db.ClaimNextScanJob()
+	scanID, _ := db.CreateScan("default")
+	if err := db.FinishScanJob(job.ID, "completed", scanID, ""); err != nil {
+		t.Fatalf("Failed to finish job: %v", err)
+	}
+
+	finished, err := db.GetScanJob(job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if finished.Status != "completed" || finished.ScanID != scanID || finished.FinishedAt == nil {
+		t.Errorf("Unexpected finished job: %+v", finished)
+	}
+
+	// Only queued jobs can be cancelled
+	if ok, err := db.CancelQueuedScanJob(job.ID); err != nil || ok {
+		t.Errorf("Expected completed job not to be cancelled, got %v, %v", ok, err)
+	}
+	if ok, err := db.CancelQueuedScanJob(low); err != nil || !ok {
+		t.Errorf("Expected queued job to be cancelled, got %v, %v", ok, err)
+	}
+
+	job, _ = db.ClaimNextScanJob()
+	if job == nil || job.ID != highLater {
+		t.Errorf("Expected to claim job %d, got %+v", highLater, job)
+	}
+
+	job, err = db.ClaimNextScanJob()
+	if err != nil || job != nil {
+		t.Errorf("Expected empty queue, got %+v, %v", job, err)
+	}
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"panopticon-scanner/internal/models"
+)
+
+// maintenanceRunColumns lists the columns read by scanMaintenanceRunRow
+const maintenanceRunColumns = `id, task, scheduled_at, started_at, finished_at, status, COALESCE(details, ''), COALESCE(error_message, '')`
+
+// scanMaintenanceRunRow reads a maintenance run from a query result
+func scanMaintenanceRunRow(row rowScanner) (*models.MaintenanceRun, error) {
+	var run models.MaintenanceRun
+
+	err := row.Scan(
+		&run.ID,
+		&run.Task,
+		&run.ScheduledAt,
+		&run.StartedAt,
+		&run.FinishedAt,
+		&run.Status,
+		&run.Details,
+		&run.Error,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+// AddMaintenanceRun records the outcome of a maintenance task
+func (db *DB) AddMaintenanceRun(run *models.MaintenanceRun) (int64, error) {
+	res, err := db.Exec(
+		`INSERT INTO maintenance_runs (task, scheduled_at, started_at, finished_at, status, details, error_message)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		run.Task, run.ScheduledAt, run.StartedAt, run.FinishedAt, run.Status, run.Details, run.Error,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record %s maintenance run: %w", run.Task, err)
+	}
+
+	return res.LastInsertId()
+}
+
+// GetMaintenanceRuns returns the most recent maintenance runs, newest first
+func (db *DB) GetMaintenanceRuns(limit int) ([]*models.MaintenanceRun, error) {
+	rows, err := db.Query(
+		`SELECT `+maintenanceRunColumns+` FROM maintenance_runs ORDER BY finished_at DESC, id DESC LIMIT ?`, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query maintenance runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []*models.MaintenanceRun{}
+	for rows.Next() {
+		run, err := scanMaintenanceRunRow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan maintenance run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+// GetLastCompletedMaintenanceRun returns the latest successful run of a
+// maintenance task, or nil if it has never completed
+func (db *DB) GetLastCompletedMaintenanceRun(task string) (*models.MaintenanceRun, error) {
+	row := db.QueryRow(
+		`SELECT `+maintenanceRunColumns+` FROM maintenance_runs
+		WHERE task = ? AND status = 'completed' ORDER BY finished_at DESC, id DESC LIMIT 1`, task,
+	)
+
+	run, err := scanMaintenanceRunRow(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last %s maintenance run: %w", task, err)
+	}
+
+	return run, nil
+}
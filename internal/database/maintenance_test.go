@@ -0,0 +1,155 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestMaintenanceRuns tests recording maintenance task outcomes
+func TestMaintenanceRuns(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	last, err := db.GetLastCompletedMaintenanceRun("backup")
+	if err != nil || last != nil {
+		t.Fatalf("Expected no completed backup, got %+v (%v)", last, err)
+	}
+
+	now := time.Now()
+	runs := []*models.MaintenanceRun{
+		{Task: "backup", ScheduledAt: now.Add(-48 * time.Hour), StartedAt: now.Add(-48 * time.Hour), FinishedAt: now.Add(-48 * time.Hour), Status: "completed", Details: "/backups/old.db"},
+		{Task: "backup", ScheduledAt: now.Add(-24 * time.Hour), StartedAt: now.Add(-24 * time.Hour), FinishedAt: now.Add(-24 * time.Hour), Status: "error", Error: "disk full"},
+		{Task: "optimize", ScheduledAt: now, StartedAt: now, FinishedAt: now, Status: "completed"},
+	}
+	for _, run := range runs {
+		if _, err := db.AddMaintenanceRun(run); err != nil {
+			t.Fatalf("Failed to add maintenance run: %v", err)
+		}
+	}
+
+	// Failed runs do not count as the last backup
+	last, err = db.GetLastCompletedMaintenanceRun("backup")
+	if err != nil {
+		t.Fatalf("Failed to get last backup: %v", err)
+	}
+
+	if last == nil || last.Details != "/backups/old.db" {
+		t.Errorf("Expected the completed backup, got %+v", last)
+	}
+
+	history, err := db.GetMaintenanceRuns(2)
+	if err != nil {
+		t.Fatalf("Failed to get maintenance runs: %v", err)
+	}
+
+	if len(history) != 2 || history[0].Task != "optimize" || history[1].Error != "disk full" {
+		t.Errorf("Unexpected maintenance history: %+v", history)
+	}
+}
+
+// TestCleanOldDataHistory tests that retention cleanup prunes the history
+// tables, keeping recent rows and those still in use
+func TestCleanOldDataHistory(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now()
+	old := now.AddDate(0, 0, -60)
+
+	deviceID, err := db.SaveDevice(&models.Device{IPAddress: "10.0.0.5"})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatalf("Failed to insert test data: %v", err)
+		}
+	}
+	exec(`INSERT INTO vulnerabilities (cve_id, imported_at) VALUES ('CVE-2024-0001', ?), ('CVE-2024-0002', ?), ('CVE-2024-0003', ?)`, now, now, now)
+
+	tests := []struct {
+		table string
+		setup func()
+		kept  string // rows expected to survive, by the value of their kept column
+	}{
+		{"scan_jobs", func() {
+			for _, job := range []struct {
+				status   string
+				created  time.Time
+				finished interface{}
+			}{
+				{"completed", old, old}, {"error", old, old}, {"queued", old, nil}, {"completed", now, now},
+			} {
+				exec(`INSERT INTO scan_jobs (priority, params, requested_by, label, status, created_at, finished_at) VALUES (0, '{}', 'tester', ?, ?, ?, ?)`,
+					job.status, job.status, job.created, job.finished)
+			}
+		}, "label"},
+		{"schedule_runs", func() {
+			exec(`INSERT INTO schedule_runs (schedule, scheduled_at, run_at, status) VALUES ('old', ?, ?, 'queued'), ('recent', ?, ?, 'queued')`, old, old, now, now)
+		}, "schedule"},
+		{"maintenance_runs", func() {
+			exec(`INSERT INTO maintenance_runs (task, scheduled_at, started_at, finished_at, status) VALUES ('old', ?, ?, ?, 'completed'), ('recent', ?, ?, ?, 'completed')`, old, old, old, now, now, now)
+		}, "task"},
+		{"audit_log", func() {
+			exec(`INSERT INTO audit_log (timestamp, action, actor) VALUES (?, 'scan_authorized', 'old'), (?, 'scan_authorized', 'recent')`, old, now)
+		}, "actor"},
+		{"vulnerability_findings", func() {
+			exec(`INSERT INTO vulnerability_findings (device_id, cve_id, cpe, first_seen, last_seen, resolved_at) VALUES
+				(?, 'CVE-2024-0001', 'resolved long ago', ?, ?, ?), (?, 'CVE-2024-0002', 'resolved recently', ?, ?, ?), (?, 'CVE-2024-0003', 'unresolved', ?, ?, NULL)`,
+				deviceID, old, old, old, deviceID, old, now, now, deviceID, old, old)
+		}, "cpe"},
+		{"certificates", func() {
+			for _, cert := range []struct {
+				fingerprint string
+				replacedAt  interface{}
+			}{
+				{"replaced long ago", old}, {"replaced recently", now}, {"current", nil},
+			} {
+				exec(`INSERT INTO certificates (device_id, port_number, protocol, sha256_fingerprint, not_before, not_after, first_seen, last_seen, replaced_at)
+					VALUES (?, 443, 'tcp', ?, ?, ?, ?, ?, ?)`, deviceID, cert.fingerprint, old, now, old, old, cert.replacedAt)
+			}
+		}, "sha256_fingerprint"},
+	}
+
+	for _, tt := range tests {
+		tt.setup()
+	}
+
+	if _, err := db.CleanOldData(30); err != nil {
+		t.Fatalf("Failed to clean old data: %v", err)
+	}
+
+	want := map[string][]string{
+		"scan_jobs":              {"completed", "queued"},
+		"schedule_runs":          {"recent"},
+		"maintenance_runs":       {"recent"},
+		"audit_log":              {"recent"},
+		"vulnerability_findings": {"resolved recently", "unresolved"},
+		"certificates":           {"current", "replaced recently"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.table, func(t *testing.T) {
+			rows, err := db.Query(`SELECT ` + tt.kept + ` FROM ` + tt.table + ` ORDER BY ` + tt.kept)
+			if err != nil {
+				t.Fatalf("Failed to query %s: %v", tt.table, err)
+			}
+			defer rows.Close()
+
+			var kept []string
+			for rows.Next() {
+				var value string
+				if err := rows.Scan(&value); err != nil {
+					t.Fatalf("Failed to scan row: %v", err)
+				}
+				kept = append(kept, value)
+			}
+			if !reflect.DeepEqual(kept, want[tt.table]) {
+				t.Errorf("Expected %s to keep %v, got %v", tt.table, want[tt.table], kept)
+			}
+		})
+	}
+}
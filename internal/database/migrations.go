@@ -0,0 +1,248 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// columnMigration describes a column added to a table after its initial release
+type columnMigration struct {
+	table      string
+	column     string
+	definition string
+}
+
+// columnMigrations lists columns that older databases may be missing
+var columnMigrations = []columnMigration{
+	{"scans", "progress_percent", "REAL DEFAULT 0"},
+	{"scans", "progress_phase", "TEXT"},
+	{"scans", "progress_eta", "TIMESTAMP"},
+	{"scans", "hosts_completed", "INTEGER DEFAULT 0"},
+	{"scans", "hosts_up", "INTEGER DEFAULT 0"},
+	{"scans", "progress_updated_at", "TIMESTAMP"},
+	{"scans", "exclusions", "TEXT"},
+	{"scans", "source", "TEXT DEFAULT 'scan'"},
+	{"scans", "import_hash", "TEXT"},
+	{"scans", "targets", "TEXT"},
+	{"scans", "probed_ports", "TEXT"},
+	{"scan_jobs", "label", "TEXT"},
+	{"ports", "state", "TEXT NOT NULL DEFAULT 'open'"},
+	{"ports", "reason", "TEXT"},
+	{"ports", "missed_scans", "INTEGER DEFAULT 0"},
+	{"ports", "cpes", "TEXT"},
+	{"devices", "missed_scans", "INTEGER DEFAULT 0"},
+	{"devices", "offline_since", "TIMESTAMP"},
+	{"devices", "vendor", "TEXT"},
+	{"devices", "netbios_name", "TEXT"},
+	{"devices", "workgroup", "TEXT"},
+	{"devices", "smb_os", "TEXT"},
+	{"devices", "os_accuracy", "INTEGER"},
+	{"devices", "os_family", "TEXT"},
+	{"devices", "device_type", "TEXT"},
+	{"devices", "os_cpes", "TEXT"},
+	{"devices", "address_changed_at", "TIMESTAMP"},
+}
+
+// migrateDB adds columns introduced after the initial schema and fills in
+// tables that older versions did not maintain
+func (db *DB) migrateDB() error {
+	for _, m := range columnMigrations {
+		if err := db.addColumnIfMissing(m.table, m.column, m.definition); err != nil {
+			return err
+		}
+	}
+
+	// Indexes on added columns can only be created once the columns exist
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_scans_import_hash ON scans(import_hash)`); err != nil {
+		return fmt.Errorf("failed to create import hash index: %w", err)
+	}
+
+	if err := db.dropDeviceAddressUniqueness(); err != nil {
+		return err
+	}
+
+	if err := db.makeChangeScanOptional(); err != nil {
+		return err
+	}
+
+	return db.backfillDeviceAddresses()
+}
+
+// dropDeviceAddressUniqueness rebuilds the devices table of older databases,
+// which allowed only one device per IP and MAC address pair, so that a device
+// can move to an address another device once had. Devices are identified by
+// resolveDevice instead.
+func (db *DB) dropDeviceAddressUniqueness() error {
+	var schema string
+	err := db.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'devices'`).Scan(&schema)
+	if err != nil {
+		return fmt.Errorf("failed to read schema of devices: %w", err)
+	}
+	if !strings.Contains(schema, "UNIQUE(ip_address, mac_address)") {
+		return nil
+	}
+
+	// Dropping the old table must not cascade to the tables referencing it
+	var foreignKeys int
+	if err := db.QueryRow(`PRAGMA foreign_keys`).Scan(&foreignKeys); err != nil {
+		return fmt.Errorf("failed to read foreign key setting: %w", err)
+	}
+	if _, err := db.Exec(`PRAGMA foreign_keys=OFF`); err != nil {
+		return fmt.Errorf("failed to disable foreign keys: %w", err)
+	}
+	defer db.Exec(fmt.Sprintf(`PRAGMA foreign_keys=%d`, foreignKeys))
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	statements := []string{
+		`CREATE TABLE devices_new (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ip_address TEXT NOT NULL,
+			mac_address TEXT,
+			hostname TEXT,
+			os_fingerprint TEXT,
+			first_seen TIMESTAMP NOT NULL,
+			last_seen TIMESTAMP NOT NULL,
+			missed_scans INTEGER DEFAULT 0,
+			offline_since TIMESTAMP,
+			vendor TEXT,
+			netbios_name TEXT,
+			workgroup TEXT,
+			smb_os TEXT,
+			os_accuracy INTEGER,
+			os_family TEXT,
+			device_type TEXT,
+			os_cpes TEXT,
+			address_changed_at TIMESTAMP
+		)`,
+		`INSERT INTO devices_new (id, ip_address, mac_address, hostname, os_fingerprint, first_seen, last_seen, missed_scans, offline_since,
+		   vendor, netbios_name, workgroup, smb_os, os_accuracy, os_family, device_type, os_cpes, address_changed_at)
+		 SELECT id, ip_address, mac_address, hostname, os_fingerprint, first_seen, last_seen, missed_scans, offline_since,
+		   vendor, netbios_name, workgroup, smb_os, os_accuracy, os_family, device_type, os_cpes, address_changed_at FROM devices`,
+		`DROP TABLE devices`,
+		`ALTER TABLE devices_new RENAME TO devices`,
+		`CREATE INDEX IF NOT EXISTS idx_devices_ip ON devices(ip_address)`,
+		`CREATE INDEX IF NOT EXISTS idx_devices_mac ON devices(mac_address)`,
+		`CREATE INDEX IF NOT EXISTS idx_devices_hostname ON devices(hostname)`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("failed to rebuild devices table: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	tx = nil
+
+	db.logger.Info().Msg("Allowed devices to share addresses")
+
+	return nil
+}
+
+// makeChangeScanOptional rebuilds the changes table of older databases, where
+// every change had to belong to a scan, so that changes made outside a scan
+// can be recorded. Changes that were attributed to a scan that does not exist
+// lose their scan.
+func (db *DB) makeChangeScanOptional() error {
+	var notNull int
+	err := db.QueryRow(`SELECT "notnull" FROM pragma_table_info('changes') WHERE name = 'scan_id'`).Scan(&notNull)
+	if err != nil {
+		return fmt.Errorf("failed to read columns of changes: %w", err)
+	}
+	if notNull == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	statements := []string{
+		`CREATE TABLE changes_new (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			scan_id INTEGER,
+			device_id INTEGER NOT NULL,
+			change_type TEXT NOT NULL,
+			details TEXT NOT NULL,
+			timestamp TIMESTAMP NOT NULL,
+			FOREIGN KEY (scan_id) REFERENCES scans(id) ON DELETE CASCADE,
+			FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE
+		)`,
+		`INSERT INTO changes_new (id, scan_id, device_id, change_type, details, timestamp)
+		 SELECT id, CASE WHEN scan_id IN (SELECT id FROM scans) THEN scan_id END, device_id, change_type, details, timestamp
+		 FROM changes WHERE device_id IN (SELECT id FROM devices)`,
+		`DROP TABLE changes`,
+		`ALTER TABLE changes_new RENAME TO changes`,
+		`CREATE INDEX IF NOT EXISTS idx_changes_scan_id ON changes(scan_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_changes_device_id ON changes(device_id)`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("failed to rebuild changes table: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	tx = nil
+
+	db.logger.Info().Msg("Allowed changes without a scan")
+
+	return nil
+}
+
+// addColumnIfMissing adds a column to a table unless it already exists
+func (db *DB) addColumnIfMissing(table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal interface{}
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return fmt.Errorf("failed to read columns of %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	rows.Close()
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+
+	db.logger.Info().Str("table", table).Str("column", column).Msg("Added database column")
+
+	return nil
+}
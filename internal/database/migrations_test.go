@@ -0,0 +1,121 @@
+// internal/database/migrations_test.go
+package database
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestMigrateDB tests that databases created by older versions gain new columns
+func TestMigrateDB(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "panopticon-migrate-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	dbPath := filepath.Join(tempDir, "old.db")
+
+	// Create a scans table using the original schema
+	old, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_, err = old.Exec(`CREATE TABLE scans (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp TIMESTAMP NOT NULL,
+		template TEXT NOT NULL,
+		duration INTEGER DEFAULT 0,
+		devices_found INTEGER DEFAULT 0,
+		ports_found INTEGER DEFAULT 0,
+		status TEXT NOT NULL,
+		error_message TEXT
+	)`)
+	if err != nil {
+		t.Fatalf("Failed to create old scans table: %v", err)
+	}
+	// Devices were unique on their IP and MAC addresses
+	_, err = old.Exec(`CREATE TABLE devices (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		ip_address TEXT NOT NULL,
+		mac_address TEXT,
+		hostname TEXT,
+		os_fingerprint TEXT,
+		first_seen TIMESTAMP NOT NULL,
+		last_seen TIMESTAMP NOT NULL,
+		UNIQUE(ip_address, mac_address)
+	)`)
+	if err != nil {
+		t.Fatalf("Failed to create old devices table: %v", err)
+	}
+	_, err = old.Exec(`INSERT INTO devices (ip_address, mac_address, hostname, os_fingerprint, first_seen, last_seen)
+		VALUES ('192.168.1.4', '', 'old', '', datetime('now'), datetime('now'))`)
+	if err != nil {
+		t.Fatalf("Failed to insert old device: %v", err)
+	}
+	// Changes had to belong to a scan
+	_, err = old.Exec(`CREATE TABLE changes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		scan_id INTEGER NOT NULL,
+		device_id INTEGER NOT NULL,
+		change_type TEXT NOT NULL,
+		details TEXT NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		FOREIGN KEY (scan_id) REFERENCES scans(id) ON DELETE CASCADE,
+		FOREIGN KEY (device_id) REFERENCES devices(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		t.Fatalf("Failed to create old changes table: %v", err)
+	}
+	old.Close()
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open old database: %v", err)
+	}
+	defer db.Close()
+
+	scanID, err := db.CreateScan("default")
+	if err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+
+	scan, err := db.GetScan(scanID)
+	if err != nil {
+		t.Fatalf("Failed to read scan from migrated table: %v", err)
+	}
+
+	if scan.Progress != nil {
+		t.Errorf("Expected no progress for a new scan, got %+v", scan.Progress)
+	}
+
+	// Changes can be recorded outside a scan
+	if _, err := db.SaveDevice(&models.Device{IPAddress: "192.168.1.5"}); err != nil {
+		t.Fatalf("Failed to save device in migrated database: %v", err)
+	}
+
+	var unattributed int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM changes WHERE scan_id IS NULL`).Scan(&unattributed); err != nil || unattributed != 1 {
+		t.Errorf("Expected 1 change without a scan, got %d (%v)", unattributed, err)
+	}
+
+	// Devices are kept, and one can move to the address of another
+	if device, err := db.GetDeviceByIP("192.168.1.4"); err != nil || device.Hostname != "old" {
+		t.Fatalf("Expected the old device to survive migration, got %+v (%v)", device, err)
+	}
+	if _, err := db.SaveDevice(&models.Device{IPAddress: "192.168.1.4", Hostname: "new"}); err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	if _, err := db.SaveDevice(&models.Device{IPAddress: "192.168.1.5", Hostname: "new"}); err != nil {
+		t.Errorf("Failed to move a device to another device's address: %v", err)
+	}
+
+	// Migrating again is a no-op
+	if err := db.migrateDB(); err != nil {
+		t.Errorf("Second migration failed: %v", err)
+	}
+}
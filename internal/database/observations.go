@@ -0,0 +1,188 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// observationColumns lists the columns read by scanObservationRow
+const observationColumns = `scan_id, device_id, ip_address, COALESCE(mac_address, ''), COALESCE(hostname, ''), COALESCE(os_fingerprint, ''), observed_at`
+
+// scanObservationRow reads a host observation from a query result
+func scanObservationRow(row rowScanner) (*models.HostObservation, error) {
+	var obs models.HostObservation
+	err := row.Scan(&obs.ScanID, &obs.DeviceID, &obs.IPAddress, &obs.MACAddress, &obs.Hostname, &obs.OSFingerprint, &obs.ObservedAt)
+	if err != nil {
+		return nil, err
+	}
+	obs.Ports = []*models.PortObservation{}
+	return &obs, nil
+}
+
+// SaveHostObservation records what a scan found on a host and its ports.
+// Saving the same host for the same scan again replaces the earlier record.
+// Times are stored in UTC so that they compare correctly as text.
+func (db *DB) SaveHostObservation(obs *models.HostObservation) error {
+	db.Lock()
+	defer db.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec(
+		`INSERT INTO scan_host_observations (scan_id, device_id, ip_address, mac_address, hostname, os_fingerprint, observed_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(scan_id, device_id) DO UPDATE SET
+		   ip_address = excluded.ip_address, mac_address = excluded.mac_address, hostname = excluded.hostname,
+		   os_fingerprint = excluded.os_fingerprint, observed_at = excluded.observed_at`,
+		obs.ScanID, obs.DeviceID, NormalizeIP(obs.IPAddress), obs.MACAddress, obs.Hostname, obs.OSFingerprint, obs.ObservedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save observation of device %d in scan %d: %w", obs.DeviceID, obs.ScanID, err)
+	}
+
+	for _, port := range obs.Ports {
+		_, err := tx.Exec(
+			`INSERT INTO scan_port_observations (scan_id, device_id, port_number, protocol, state, reason, service_name, service_version)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			 ON CONFLICT(scan_id, device_id, port_number, protocol) DO UPDATE SET
+			   state = excluded.state, reason = excluded.reason,
+			   service_name = excluded.service_name, service_version = excluded.service_version`,
+			obs.ScanID, obs.DeviceID, port.PortNumber, port.Protocol, port.State, port.Reason, port.ServiceName, port.ServiceVersion,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save observation of port %d/%s in scan %d: %w", port.PortNumber, port.Protocol, obs.ScanID, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	tx = nil
+
+	return nil
+}
+
+// GetScanObservations returns the hosts a scan found, with the ports it found
+// on each
+func (db *DB) GetScanObservations(scanID int64) ([]*models.HostObservation, error) {
+	return db.queryObservations(
+		`SELECT `+observationColumns+` FROM scan_host_observations
+		 WHERE scan_id = ? ORDER BY ip_address`, scanID,
+	)
+}
+
+// GetDeviceHistory returns the observations of a device, newest first. Zero
+// times leave the range open at that end; a limit of zero returns them all.
+func (db *DB) GetDeviceHistory(deviceID int64, from, to time.Time, limit int) ([]*models.HostObservation, error) {
+	query := `SELECT ` + observationColumns + ` FROM scan_host_observations WHERE device_id = ?`
+	args := []interface{}{deviceID}
+
+	if !from.IsZero() {
+		query += ` AND observed_at >= ?`
+		args = append(args, from.UTC())
+	}
+	if !to.IsZero() {
+		query += ` AND observed_at <= ?`
+		args = append(args, to.UTC())
+	}
+	query += ` ORDER BY observed_at DESC, scan_id DESC`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	return db.queryObservations(query, args...)
+}
+
+// GetDeviceObservationAt returns the latest observation of a device made at
+// or before the given time, which is what the inventory held for it then. It
+// returns nil if the device had not been observed by then.
+func (db *DB) GetDeviceObservationAt(deviceID int64, at time.Time) (*models.HostObservation, error) {
+	observations, err := db.GetDeviceHistory(deviceID, time.Time{}, at, 1)
+	if err != nil || len(observations) == 0 {
+		return nil, err
+	}
+	return observations[0], nil
+}
+
+// GetInventoryAt reconstructs the inventory at the given time from the latest
+// observation of each device made at or before it
+func (db *DB) GetInventoryAt(at time.Time) ([]*models.HostObservation, error) {
+	return db.queryObservations(
+		`SELECT `+observationColumns+` FROM scan_host_observations o
+		 WHERE o.id = (
+		   SELECT latest.id FROM scan_host_observations latest
+		   WHERE latest.device_id = o.device_id AND latest.observed_at <= ?
+		   ORDER BY latest.observed_at DESC, latest.scan_id DESC LIMIT 1
+		 )
+		 ORDER BY o.ip_address`, at.UTC(),
+	)
+}
+
+// queryObservations runs a query for host observations and loads the ports
+// of each
+func (db *DB) queryObservations(query string, args ...interface{}) ([]*models.HostObservation, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query observations: %w", err)
+	}
+	defer rows.Close()
+
+	observations := []*models.HostObservation{}
+	for rows.Next() {
+		obs, err := scanObservationRow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan observation row: %w", err)
+		}
+		observations = append(observations, obs)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating observation rows: %w", err)
+	}
+	rows.Close()
+
+	for _, obs := range observations {
+		if obs.Ports, err = db.getPortObservations(obs.ScanID, obs.DeviceID); err != nil {
+			return nil, err
+		}
+	}
+
+	return observations, nil
+}
+
+// getPortObservations returns the ports a scan found on a device
+func (db *DB) getPortObservations(scanID, deviceID int64) ([]*models.PortObservation, error) {
+	rows, err := db.Query(
+		`SELECT port_number, protocol, state, reason, service_name, service_version
+		 FROM scan_port_observations WHERE scan_id = ? AND device_id = ?
+		 ORDER BY port_number, protocol`, scanID, deviceID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query port observations: %w", err)
+	}
+	defer rows.Close()
+
+	ports := []*models.PortObservation{}
+	for rows.Next() {
+		var port models.PortObservation
+		var reason, serviceName, serviceVersion sql.NullString
+		if err := rows.Scan(&port.PortNumber, &port.Protocol, &port.State, &reason, &serviceName, &serviceVersion); err != nil {
+			return nil, fmt.Errorf("failed to scan port observation row: %w", err)
+		}
+		port.Reason, port.ServiceName, port.ServiceVersion = reason.String, serviceName.String, serviceVersion.String
+		ports = append(ports, &port)
+	}
+
+	return ports, rows.Err()
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestObservations tests recording what each scan found and reconstructing
+// past inventory from it
+func TestObservations(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	deviceID, err := db.SaveDevice(&models.Device{IPAddress: "10.0.0.5", MACAddress: "00:11:22:33:44:05"})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	otherID, err := db.SaveDevice(&models.Device{IPAddress: "10.0.0.6"})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+
+	march2 := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+	march4 := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+
+	observe := func(deviceID int64, ip string, at time.Time, ports ...*models.PortObservation) int64 {
+		t.Helper()
+
+		scanID, err := db.CreateScan("default")
+		if err != nil {
+			t.Fatalf("Failed to create scan: %v", err)
+		}
+		err = db.SaveHostObservation(&models.HostObservation{
+			ScanID: scanID, DeviceID: deviceID, IPAddress: ip, ObservedAt: at, Ports: ports,
+		})
+		if err != nil {
+			t.Fatalf("Failed to save observation: %v", err)
+		}
+		return scanID
+	}
+
+	ssh := &models.PortObservation{PortNumber: 22, Protocol: "tcp", State: "open", ServiceName: "ssh"}
+	http := &models.PortObservation{PortNumber: 80, Protocol: "tcp", State: "open", ServiceName: "http", ServiceVersion: "nginx 1.24"}
+
+	first := observe(deviceID, "10.0.0.5", march2, ssh, http)
+	observe(otherID, "10.0.0.6", march4)
+	second := observe(deviceID, "10.0.0.5", march4, ssh)
+
+	// Saving a host again for the same scan replaces its observation
+	err = db.SaveHostObservation(&models.HostObservation{
+		ScanID: first, DeviceID: deviceID, IPAddress: "10.0.0.5", Hostname: "nas", ObservedAt: march2,
+		Ports: []*models.PortObservation{ssh, http},
+	})
+	if err != nil {
+		t.Fatalf("Failed to save observation again: %v", err)
+	}
+
+	hosts, err := db.GetScanObservations(first)
+	if err != nil {
+		t.Fatalf("Failed to get scan observations: %v", err)
+	}
+	if len(hosts) != 1 || hosts[0].Hostname != "nas" || len(hosts[0].Ports) != 2 {
+		t.Fatalf("Unexpected observations of scan %d: %+v", first, hosts)
+	}
+	if port := hosts[0].Ports[1]; port.PortNumber != 80 || port.ServiceVersion != "nginx 1.24" {
+		t.Errorf("Unexpected port observation: %+v", port)
+	}
+
+	history, err := db.GetDeviceHistory(deviceID, time.Time{}, time.Time{}, 0)
+	if err != nil {
+		t.Fatalf("Failed to get device history: %v", err)
+	}
+	if len(history) != 2 || history[0].ScanID != second || history[1].ScanID != first {
+		t.Errorf("Expected history newest first, got %+v", history)
+	}
+
+	history, err = db.GetDeviceHistory(deviceID, march2.Add(time.Hour), time.Time{}, 0)
+	if err != nil {
+		t.Fatalf("Failed to get device history: %v", err)
+	}
+	if len(history) != 1 || history[0].ScanID != second {
+		t.Errorf("Expected only the later observation, got %+v", history)
+	}
+
+	// What was open on March 3rd
+	march3 := time.Date(2024, 3, 3, 23, 59, 59, 0, time.UTC)
+	obs, err := db.GetDeviceObservationAt(deviceID, march3)
+	if err != nil {
+		t.Fatalf("Failed to get observation: %v", err)
+	}
+	if obs == nil || obs.ScanID != first || len(obs.Ports) != 2 {
+		t.Errorf("Expected the March 2nd observation with 2 ports, got %+v", obs)
+	}
+
+	if obs, err := db.GetDeviceObservationAt(deviceID, march2.Add(-time.Hour)); err != nil || obs != nil {
+		t.Errorf("Expected no observation before the first scan, got %+v (%v)", obs, err)
+	}
+
+	inventory, err := db.GetInventoryAt(march3)
+	if err != nil {
+		t.Fatalf("Failed to get inventory: %v", err)
+	}
+	if len(inventory) != 1 || inventory[0].DeviceID != deviceID {
+		t.Errorf("Expected only 10.0.0.5 in the March 3rd inventory, got %+v", inventory)
+	}
+
+	inventory, err = db.GetInventoryAt(march4)
+	if err != nil {
+		t.Fatalf("Failed to get inventory: %v", err)
+	}
+	if len(inventory) != 2 || inventory[0].ScanID != second || len(inventory[0].Ports) != 1 {
+		t.Errorf("Expected both devices with the latest observation of 10.0.0.5, got %+v", inventory)
+	}
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"panopticon-scanner/internal/models"
+)
+
+// osFamilyExpr groups the devices of a query on devices by OS family, or by
+// OS fingerprint if the family is not known
+const osFamilyExpr = `COALESCE(NULLIF(os_family, ''), NULLIF(os_fingerprint, ''), 'Unknown')`
+
+// saveDeviceOS records the accuracy, family, type and CPEs of a device's OS
+// fingerprint and replaces its OS matches within a transaction
+func saveDeviceOS(tx *sql.Tx, deviceID int64, device *models.Device) error {
+	_, err := tx.Exec(
+		`UPDATE devices SET os_accuracy = ?, os_family = ?, device_type = ?, os_cpes = ? WHERE id = ?`,
+		device.OSAccuracy, device.OSFamily, device.DeviceType, strings.Join(device.OSCPEs, " "), deviceID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save OS details of device %d: %w", deviceID, err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM device_os_matches WHERE device_id = ?`, deviceID); err != nil {
+		return fmt.Errorf("failed to clear OS matches of device %d: %w", deviceID, err)
+	}
+
+	for i, match := range device.OSMatches {
+		classes, err := json.Marshal(match.Classes)
+		if err != nil {
+			return fmt.Errorf("failed to encode OS classes: %w", err)
+		}
+		_, err = tx.Exec(
+			`INSERT INTO device_os_matches (device_id, position, name, accuracy, classes) VALUES (?, ?, ?, ?, ?)`,
+			deviceID, i, match.Name, match.Accuracy, string(classes),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save OS match of device %d: %w", deviceID, err)
+		}
+	}
+
+	return nil
+}
+
+// getOSMatches returns every OS guess of a device's latest fingerprint, most
+// accurate first
+func (db *DB) getOSMatches(deviceID int64) ([]*models.OSMatch, error) {
+	rows, err := db.Query(
+		`SELECT name, accuracy, COALESCE(classes, '') FROM device_os_matches WHERE device_id = ? ORDER BY position`,
+		deviceID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query OS matches: %w", err)
+	}
+	defer rows.Close()
+
+	var matches []*models.OSMatch
+	for rows.Next() {
+		var match models.OSMatch
+		var classes string
+		if err := rows.Scan(&match.Name, &match.Accuracy, &classes); err != nil {
+			return nil, fmt.Errorf("failed to scan OS match row: %w", err)
+		}
+		if classes != "" {
+			if err := json.Unmarshal([]byte(classes), &match.Classes); err != nil {
+				return nil, fmt.Errorf("failed to decode OS classes: %w", err)
+			}
+		}
+		matches = append(matches, &match)
+	}
+
+	return matches, rows.Err()
+}
+
+// GetOSDistribution counts devices by OS family, or by OS fingerprint if the
+// family is not known. A vendor restricts the count to devices whose vendor
+// contains it.
+func (db *DB) GetOSDistribution(vendor string) (map[string]int, error) {
+	rows, err := db.Query(
+		`SELECT `+osFamilyExpr+` as os, COUNT(*) FROM devices WHERE ? = '' OR vendor LIKE ? GROUP BY os`,
+		vendor, "%"+vendor+"%",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query OS distribution: %w", err)
+	}
+	defer rows.Close()
+
+	osDistribution := make(map[string]int)
+	for rows.Next() {
+		var os string
+		var count int
+		if err := rows.Scan(&os, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan OS distribution row: %w", err)
+		}
+		osDistribution[os] = count
+	}
+
+	return osDistribution, rows.Err()
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"testing"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestOSDistribution tests counting devices by OS family rather than by the
+// exact fingerprint
+func TestOSDistribution(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, device := range []*models.Device{
+		{IPAddress: "10.0.0.1", OSFingerprint: "Linux 4.15 - 5.8", OSFamily: "Linux", Vendor: "Example"},
+		{IPAddress: "10.0.0.2", OSFingerprint: "Linux 5.0 - 5.14", OSFamily: "Linux"},
+		{IPAddress: "10.0.0.3", OSFingerprint: "Microsoft Windows 10 1909", OSFamily: "Windows", Vendor: "Example"},
+		{IPAddress: "10.0.0.4", OSFingerprint: "Windows Server 2019"},
+		{IPAddress: "10.0.0.5"},
+	} {
+		if _, err := db.SaveDevice(device); err != nil {
+			t.Fatalf("Failed to save device: %v", err)
+		}
+	}
+
+	distribution, err := db.GetOSDistribution("")
+	if err != nil {
+		t.Fatalf("Failed to get OS distribution: %v", err)
+	}
+	want := map[string]int{"Linux": 2, "Windows": 1, "Windows Server 2019": 1, "Unknown": 1}
+	if len(distribution) != len(want) {
+		t.Errorf("Expected %v, got %v", want, distribution)
+	}
+	for os, count := range want {
+		if distribution[os] != count {
+			t.Errorf("Expected %d devices running %s, got %d", count, os, distribution[os])
+		}
+	}
+
+	distribution, err = db.GetOSDistribution("example")
+	if err != nil {
+		t.Fatalf("Failed to get OS distribution: %v", err)
+	}
+	if len(distribution) != 2 || distribution["Linux"] != 1 || distribution["Windows"] != 1 {
+		t.Errorf("Expected the Example devices only, got %v", distribution)
+	}
+
+	stats, err := db.GetDatabaseStats()
+	if err != nil {
+		t.Fatalf("Failed to get database stats: %v", err)
+	}
+	if stats["osDistribution"].(map[string]int)["Linux"] != 2 {
+		t.Errorf("Expected database stats grouped by family, got %v", stats["osDistribution"])
+	}
+}
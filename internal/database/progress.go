@@ -0,0 +1,66 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"panopticon-scanner/internal/models"
+)
+
+// scanProgressSelect lists the progress columns read by scanProgressColumns
+const scanProgressSelect = `progress_percent, progress_phase, progress_eta, hosts_completed, hosts_up, progress_updated_at`
+
+// scanProgressColumns holds the nullable progress columns of a scan row
+type scanProgressColumns struct {
+	percent        sql.NullFloat64
+	phase          sql.NullString
+	eta            sql.NullTime
+	hostsCompleted sql.NullInt64
+	hostsUp        sql.NullInt64
+	updatedAt      sql.NullTime
+}
+
+// dest returns scan destinations in the order of scanProgressSelect
+func (p *scanProgressColumns) dest() []interface{} {
+	return []interface{}{&p.percent, &p.phase, &p.eta, &p.hostsCompleted, &p.hostsUp, &p.updatedAt}
+}
+
+// model converts the columns to a progress report, or nil if none was recorded
+func (p *scanProgressColumns) model() *models.ScanProgress {
+	if !p.updatedAt.Valid {
+		return nil
+	}
+
+	progress := &models.ScanProgress{
+		Percent:        p.percent.Float64,
+		Phase:          p.phase.String,
+		HostsCompleted: int(p.hostsCompleted.Int64),
+		HostsUp:        int(p.hostsUp.Int64),
+		UpdatedAt:      p.updatedAt.Time,
+	}
+	if p.eta.Valid {
+		progress.ETA = &p.eta.Time
+	}
+
+	return progress
+}
+
+// UpdateScanProgress records the latest progress reported for a running scan
+func (db *DB) UpdateScanProgress(id int64, progress *models.ScanProgress) error {
+	var eta interface{}
+	if progress.ETA != nil {
+		eta = *progress.ETA
+	}
+
+	_, err := db.Exec(
+		`UPDATE scans
+		 SET progress_percent = ?, progress_phase = ?, progress_eta = ?, hosts_completed = ?, hosts_up = ?, progress_updated_at = ?
+		 WHERE id = ?`,
+		progress.Percent, progress.Phase, eta, progress.HostsCompleted, progress.HostsUp, progress.UpdatedAt, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update progress of scan #%d: %w", id, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// GetCurrentDeviceAddresses returns the addresses each device is currently
+// at, keyed by device ID: its primary address, then the addresses in the
+// other family seen since the primary address last changed. Addresses a
+// device has moved away from are left out.
+func (db *DB) GetCurrentDeviceAddresses() (map[int64][]string, error) {
+	rows, err := db.Query(
+		`SELECT d.id, d.ip_address, a.address FROM devices d
+		 LEFT JOIN device_addresses a ON a.device_id = d.id
+		   AND a.family <> CASE WHEN instr(d.ip_address, ':') > 0 THEN 'ipv6' ELSE 'ipv4' END
+		   AND (d.address_changed_at IS NULL OR a.last_seen >= d.address_changed_at)
+		 ORDER BY d.id, a.address`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query device addresses: %w", err)
+	}
+	defer rows.Close()
+
+	addresses := make(map[int64][]string)
+	for rows.Next() {
+		var deviceID int64
+		var primary string
+		var address sql.NullString
+		if err := rows.Scan(&deviceID, &primary, &address); err != nil {
+			return nil, fmt.Errorf("failed to scan device address: %w", err)
+		}
+		if _, ok := addresses[deviceID]; !ok {
+			addresses[deviceID] = []string{primary}
+		}
+		if address.Valid {
+			addresses[deviceID] = append(addresses[deviceID], address.String)
+		}
+	}
+
+	return addresses, rows.Err()
+}
+
+// GetActivePorts returns the ports of a device that have not been closed
+func (db *DB) GetActivePorts(deviceID int64) ([]*models.Port, error) {
+	rows, err := db.Query(
+		`SELECT id, device_id, port_number, protocol, state
+		 FROM ports WHERE device_id = ? AND state <> 'closed'
+		 ORDER BY port_number, protocol`, deviceID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ports of device %d: %w", deviceID, err)
+	}
+	defer rows.Close()
+
+	var ports []*models.Port
+	for rows.Next() {
+		var port models.Port
+		if err := rows.Scan(&port.ID, &port.DeviceID, &port.PortNumber, &port.Protocol, &port.State); err != nil {
+			return nil, fmt.Errorf("failed to scan port row: %w", err)
+		}
+		ports = append(ports, &port)
+	}
+
+	return ports, rows.Err()
+}
+
+// MarkDeviceMissed records that a scan covering a device's address did not
+// find it. Once the device has been missed by threshold consecutive scans it
+// is marked offline and a device_offline change is recorded against scanID.
+// It reports whether the device went offline.
+func (db *DB) MarkDeviceMissed(scanID, deviceID int64, threshold int) (bool, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err := tx.Exec(`UPDATE devices SET missed_scans = missed_scans + 1 WHERE id = ?`, deviceID); err != nil {
+		return false, fmt.Errorf("failed to record missed device: %w", err)
+	}
+
+	var ipAddress string
+	var missed int
+	var offlineSince sql.NullTime
+	err = tx.QueryRow(
+		`SELECT ip_address, missed_scans, offline_since FROM devices WHERE id = ?`, deviceID,
+	).Scan(&ipAddress, &missed, &offlineSince)
+	if err != nil {
+		return false, fmt.Errorf("failed to get missed device: %w", err)
+	}
+
+	// Devices already offline stay offline without another change
+	var changes []*models.Change
+	wentOffline := !offlineSince.Valid && missed >= threshold
+	if wentOffline {
+		if _, err := tx.Exec(`UPDATE devices SET offline_since = ? WHERE id = ?`, time.Now(), deviceID); err != nil {
+			return false, fmt.Errorf("failed to mark device offline: %w", err)
+		}
+
+		change, err := db.insertChange(tx, scanID, deviceID, "device_offline",
+			fmt.Sprintf("Device offline: %s (missed by %d scans)", ipAddress, missed))
+		if err != nil {
+			return false, err
+		}
+		changes = append(changes, change)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	tx = nil
+
+	db.publishChanges(changes)
+
+	return wentOffline, nil
+}
+
+// MarkPortMissed records that a scan probing a port of a device it found got
+// no answer from the port. Once the port has been missed by threshold
+// consecutive scans it is closed and a port_closed change is recorded against
+// scanID. It reports whether the port was closed.
+func (db *DB) MarkPortMissed(scanID, portID int64, threshold int) (bool, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err := tx.Exec(`UPDATE ports SET missed_scans = missed_scans + 1 WHERE id = ?`, portID); err != nil {
+		return false, fmt.Errorf("failed to record missed port: %w", err)
+	}
+
+	var deviceID int64
+	var portNumber, missed int
+	var protocol, state string
+	err = tx.QueryRow(
+		`SELECT device_id, port_number, protocol, state, missed_scans FROM ports WHERE id = ?`, portID,
+	).Scan(&deviceID, &portNumber, &protocol, &state, &missed)
+	if err != nil {
+		return false, fmt.Errorf("failed to get missed port: %w", err)
+	}
+
+	var changes []*models.Change
+	closed := state != "closed" && missed >= threshold
+	if closed {
+		if _, err := tx.Exec(`UPDATE ports SET state = 'closed', reason = NULL WHERE id = ?`, portID); err != nil {
+			return false, fmt.Errorf("failed to close port: %w", err)
+		}
+
+		change, err := db.insertChange(tx, scanID, deviceID, "port_closed",
+			fmt.Sprintf("Port %d/%s closed (%s, missed by %d scans)", portNumber, protocol, state, missed))
+		if err != nil {
+			return false, err
+		}
+		changes = append(changes, change)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	tx = nil
+
+	db.publishChanges(changes)
+
+	return closed, nil
+}
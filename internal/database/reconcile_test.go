@@ -0,0 +1,235 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// changeDetails returns the details of a device's changes of one type
+func changeDetails(t *testing.T, db *DB, deviceID int64, changeType string) []string {
+	t.Helper()
+
+	rows, err := db.Query(
+		`SELECT details FROM changes WHERE device_id = ? AND change_type = ? ORDER BY id`, deviceID, changeType,
+	)
+	if err != nil {
+		t.Fatalf("Failed to query changes: %v", err)
+	}
+	defer rows.Close()
+
+	var details []string
+	for rows.Next() {
+		var detail string
+		if err := rows.Scan(&detail); err != nil {
+			t.Fatalf("Failed to scan change: %v", err)
+		}
+		details = append(details, detail)
+	}
+	return details
+}
+
+// TestMarkPortMissed tests that a port is closed only after the configured
+// number of consecutive misses and reopens when it answers again
+func TestMarkPortMissed(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	scanID, err := db.CreateScan("default")
+	if err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+
+	deviceID, err := db.SaveDevice(&models.Device{IPAddress: "192.168.1.50", MACAddress: "00:11:22:33:44:50"})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+
+	if err := db.SavePort(&models.Port{DeviceID: deviceID, PortNumber: 22, Protocol: "tcp", ServiceName: "ssh"}); err != nil {
+		t.Fatalf("Failed to save port: %v", err)
+	}
+
+	ports, err := db.GetActivePorts(deviceID)
+	if err != nil || len(ports) != 1 {
+		t.Fatalf("Expected 1 active port, got %d (%v)", len(ports), err)
+	}
+	portID := ports[0].ID
+
+	// A single miss followed by an answer does not count towards closing
+	if closed, err := db.MarkPortMissed(scanID, portID, 2); err != nil || closed {
+		t.Fatalf("Expected port to stay open after one miss, got closed=%v err=%v", closed, err)
+	}
+	if err := db.SavePort(&models.Port{DeviceID: deviceID, PortNumber: 22, Protocol: "tcp", ServiceName: "ssh"}); err != nil {
+		t.Fatalf("Failed to save port: %v", err)
+	}
+	if closed, err := db.MarkPortMissed(scanID, portID, 2); err != nil || closed {
+		t.Fatalf("Expected missed count to be reset by an answer, got closed=%v err=%v", closed, err)
+	}
+
+	if closed, err := db.MarkPortMissed(scanID, portID, 2); err != nil || !closed {
+		t.Fatalf("Expected port to close after two misses, got closed=%v err=%v", closed, err)
+	}
+
+	// Further misses do not record the closure again
+	if closed, err := db.MarkPortMissed(scanID, portID, 2); err != nil || closed {
+		t.Errorf("Expected closed port to stay closed silently, got closed=%v err=%v", closed, err)
+	}
+
+	if details := changeDetails(t, db, deviceID, "port_closed"); len(details) != 1 ||
+		details[0] != "Port 22/tcp closed (open, missed by 2 scans)" {
+		t.Errorf("Unexpected port_closed changes: %v", details)
+	}
+
+	device, err := db.GetDevice(deviceID)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if device.PortCount != 0 {
+		t.Errorf("Expected closed port to be left out of the port count, got %d", device.PortCount)
+	}
+
+	details, err := db.GetDeviceDetails(deviceID)
+	if err != nil {
+		t.Fatalf("Failed to get device details: %v", err)
+	}
+	if len(details.Ports) != 1 || details.Ports[0].State != "closed" {
+		t.Errorf("Expected the closed port in device details, got %+v", details.Ports)
+	}
+
+	stats, err := db.GetDatabaseStats()
+	if err != nil {
+		t.Fatalf("Failed to get database stats: %v", err)
+	}
+	if stats["portCount"] != 0 || stats["closedPorts"] != 1 {
+		t.Errorf("Expected 0 ports and 1 closed port, got %v and %v", stats["portCount"], stats["closedPorts"])
+	}
+
+	// The port answers again
+	if err := db.SavePort(&models.Port{DeviceID: deviceID, PortNumber: 22, Protocol: "tcp", ServiceName: "ssh"}); err != nil {
+		t.Fatalf("Failed to save port: %v", err)
+	}
+	if details := changeDetails(t, db, deviceID, "port_state_change"); len(details) != 1 ||
+		details[0] != "Port 22/tcp state changed: closed -> open" {
+		t.Errorf("Unexpected port_state_change changes: %v", details)
+	}
+}
+
+// TestMarkDeviceMissed tests that a device is reported offline after the
+// configured number of consecutive misses and returns when seen again
+func TestMarkDeviceMissed(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	scanID, err := db.CreateScan("default")
+	if err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+
+	device := &models.Device{IPAddress: "192.168.1.51", MACAddress: "00:11:22:33:44:51"}
+	deviceID, err := db.SaveDevice(device)
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		if offline, err := db.MarkDeviceMissed(scanID, deviceID, 3); err != nil || offline {
+			t.Fatalf("Expected device to stay online after %d misses, got offline=%v err=%v", i, offline, err)
+		}
+	}
+	if offline, err := db.MarkDeviceMissed(scanID, deviceID, 3); err != nil || !offline {
+		t.Fatalf("Expected device to go offline after 3 misses, got offline=%v err=%v", offline, err)
+	}
+	if offline, err := db.MarkDeviceMissed(scanID, deviceID, 3); err != nil || offline {
+		t.Errorf("Expected offline device to stay offline silently, got offline=%v err=%v", offline, err)
+	}
+
+	stored, err := db.GetDevice(deviceID)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if stored.OfflineSince == nil {
+		t.Fatalf("Expected offline device to have an offline time")
+	}
+
+	if details := changeDetails(t, db, deviceID, "device_offline"); len(details) != 1 ||
+		details[0] != "Device offline: 192.168.1.51 (missed by 3 scans)" {
+		t.Errorf("Unexpected device_offline changes: %v", details)
+	}
+
+	stats, err := db.GetDatabaseStats()
+	if err != nil {
+		t.Fatalf("Failed to get database stats: %v", err)
+	}
+	if stats["offlineDevices"] != 1 {
+		t.Errorf("Expected 1 offline device, got %v", stats["offlineDevices"])
+	}
+
+	// The device is seen again
+	if _, err := db.SaveDevice(device); err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+
+	stored, err = db.GetDevice(deviceID)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if stored.OfflineSince != nil {
+		t.Errorf("Expected returned device to be online, offline since %v", stored.OfflineSince)
+	}
+	if details := changeDetails(t, db, deviceID, "device_returned"); len(details) != 1 {
+		t.Errorf("Expected 1 device_returned change, got %v", details)
+	}
+
+	// Its missed count starts again
+	if offline, err := db.MarkDeviceMissed(scanID, deviceID, 3); err != nil || offline {
+		t.Errorf("Expected returned device to need 3 more misses, got offline=%v err=%v", offline, err)
+	}
+}
+
+// TestGetCurrentDeviceAddresses tests that only the addresses a device is at
+// now are returned, not those it moved away from
+func TestGetCurrentDeviceAddresses(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	save := func(device *models.Device) int64 {
+		t.Helper()
+		id, err := db.SaveDevice(device)
+		if err != nil {
+			t.Fatalf("Failed to save device: %v", err)
+		}
+		return id
+	}
+
+	// A dual-stack host
+	nasID := save(&models.Device{IPAddress: "10.0.0.20", MACAddress: "00:11:22:33:44:20"})
+	save(&models.Device{IPAddress: "2001:db8::20", MACAddress: "00:11:22:33:44:20"})
+
+	// A laptop that was given a new address by DHCP, having last been seen
+	// over IPv6 the day before
+	laptopID := save(&models.Device{IPAddress: "10.0.0.5", MACAddress: "00:11:22:33:44:05"})
+	save(&models.Device{IPAddress: "2001:db8::5", MACAddress: "00:11:22:33:44:05"})
+	_, err := db.Exec(
+		`UPDATE device_addresses SET last_seen = ? WHERE device_id = ? AND address = '2001:db8::5'`,
+		time.Now().Add(-24*time.Hour).Truncate(time.Hour), laptopID,
+	)
+	if err != nil {
+		t.Fatalf("Failed to age address: %v", err)
+	}
+	save(&models.Device{IPAddress: "10.0.1.9", MACAddress: "00:11:22:33:44:05"})
+
+	addresses, err := db.GetCurrentDeviceAddresses()
+	if err != nil {
+		t.Fatalf("Failed to get device addresses: %v", err)
+	}
+
+	want := map[int64][]string{
+		nasID:    {"10.0.0.20", "2001:db8::20"},
+		laptopID: {"10.0.1.9"},
+	}
+	if !reflect.DeepEqual(addresses, want) {
+		t.Errorf("Expected current addresses %v, got %v", want, addresses)
+	}
+}
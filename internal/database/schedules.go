@@ -0,0 +1,169 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// scheduleColumns lists the columns read by scanScheduleRow
+const scheduleColumns = `name, cron, template, COALESCE(target_network, ''), COALESCE(site, ''), COALESCE(jitter, ''), blackouts, enabled`
+
+// scanScheduleRow reads a schedule from a query result
+func scanScheduleRow(row rowScanner) (*models.Schedule, error) {
+	var schedule models.Schedule
+	var blackouts sql.NullString
+
+	err := row.Scan(
+		&schedule.Name,
+		&schedule.Cron,
+		&schedule.Template,
+		&schedule.TargetNetwork,
+		&schedule.Site,
+		&schedule.Jitter,
+		&blackouts,
+		&schedule.Enabled,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if blackouts.Valid && blackouts.String != "" {
+		if err := json.Unmarshal([]byte(blackouts.String), &schedule.Blackouts); err != nil {
+			return nil, fmt.Errorf("failed to decode blackout windows for schedule %s: %w", schedule.Name, err)
+		}
+	}
+	schedule.Source = "database"
+
+	return &schedule, nil
+}
+
+// SaveSchedule creates or updates a user-defined schedule
+func (db *DB) SaveSchedule(schedule *models.Schedule) error {
+	blackouts, err := json.Marshal(schedule.Blackouts)
+	if err != nil {
+		return fmt.Errorf("failed to encode blackout windows: %w", err)
+	}
+
+	now := time.Now()
+	_, err = db.Exec(
+		`INSERT INTO schedules (name, cron, template, target_network, site, jitter, blackouts, enabled, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(name) DO UPDATE SET
+		 	cron = excluded.cron,
+		 	template = excluded.template,
+		 	target_network = excluded.target_network,
+		 	site = excluded.site,
+		 	jitter = excluded.jitter,
+		 	blackouts = excluded.blackouts,
+		 	enabled = excluded.enabled,
+		 	updated_at = excluded.updated_at`,
+		schedule.Name, schedule.Cron, schedule.Template, schedule.TargetNetwork, schedule.Site,
+		schedule.Jitter, string(blackouts), schedule.Enabled, now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save schedule %s: %w", schedule.Name, err)
+	}
+
+	return nil
+}
+
+// GetSchedule retrieves a user-defined schedule by name
+func (db *DB) GetSchedule(name string) (*models.Schedule, error) {
+	schedule, err := scanScheduleRow(db.QueryRow(
+		`SELECT `+scheduleColumns+` FROM schedules WHERE name = ?`, name,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schedule: %w", err)
+	}
+
+	return schedule, nil
+}
+
+// GetSchedules retrieves all user-defined schedules
+func (db *DB) GetSchedules() ([]*models.Schedule, error) {
+	rows, err := db.Query(`SELECT ` + scheduleColumns + ` FROM schedules ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []*models.Schedule
+	for rows.Next() {
+		schedule, err := scanScheduleRow(rows)
+		if err != nil {
+			db.logger.Warn().Err(err).Msg("Skipping unreadable schedule")
+			continue
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating schedule rows: %w", err)
+	}
+
+	return schedules, nil
+}
+
+// DeleteSchedule removes a user-defined schedule. Its run history is kept.
+func (db *DB) DeleteSchedule(name string) error {
+	res, err := db.Exec(`DELETE FROM schedules WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule %s: %w", name, err)
+	}
+
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return fmt.Errorf("failed to delete schedule %s: %w", name, sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// AddScheduleRun records an occurrence of a schedule
+func (db *DB) AddScheduleRun(run *models.ScheduleRun) (int64, error) {
+	if run.RunAt.IsZero() {
+		run.RunAt = time.Now()
+	}
+
+	var jobID interface{}
+	if run.JobID > 0 {
+		jobID = run.JobID
+	}
+
+	res, err := db.Exec(
+		`INSERT INTO schedule_runs (schedule, scheduled_at, run_at, status, job_id, message) VALUES (?, ?, ?, ?, ?, ?)`,
+		run.Schedule, run.ScheduledAt, run.RunAt, run.Status, jobID, run.Message,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record run of schedule %s: %w", run.Schedule, err)
+	}
+
+	return res.LastInsertId()
+}
+
+// GetScheduleRuns returns the most recent runs of a schedule, newest first
+func (db *DB) GetScheduleRuns(name string, limit int) ([]*models.ScheduleRun, error) {
+	rows, err := db.Query(
+		`SELECT id, schedule, scheduled_at, run_at, status, COALESCE(job_id, 0), COALESCE(message, '')
+		FROM schedule_runs WHERE schedule = ? ORDER BY run_at DESC, id DESC LIMIT ?`, name, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query runs of schedule %s: %w", name, err)
+	}
+	defer rows.Close()
+
+	runs := []*models.ScheduleRun{}
+	for rows.Next() {
+		var run models.ScheduleRun
+		if err := rows.Scan(&run.ID, &run.Schedule, &run.ScheduledAt, &run.RunAt, &run.Status, &run.JobID, &run.Message); err != nil {
+			return nil, fmt.Errorf("failed to scan schedule run: %w", err)
+		}
+		runs = append(runs, &run)
+	}
+
+	return runs, rows.Err()
+}
@@ -0,0 +1,83 @@
+// internal/database/schedules_test.go
+package database
+
+import (
+	"testing"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestSchedules tests storing schedules and their run history
+func TestSchedules(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	schedule := &models.Schedule{
+		Name:      "nightly",
+		Cron:      "0 2 * * *",
+		Template:  "thorough",
+		Jitter:    "10m",
+		Blackouts: []models.BlackoutWindow{{Start: "09:00", End: "17:00", Days: []string{"mon"}}},
+		Enabled:   true,
+	}
+
+	if err := db.SaveSchedule(schedule); err != nil {
+		t.Fatalf("Failed to save schedule: %v", err)
+	}
+
+	stored, err := db.GetSchedule("nightly")
+	if err != nil {
+		t.Fatalf("Failed to get schedule: %v", err)
+	}
+
+	if stored.Cron != "0 2 * * *" || len(stored.Blackouts) != 1 || stored.Blackouts[0].Days[0] != "mon" || !stored.Enabled || stored.Source != "database" {
+		t.Errorf("Unexpected stored schedule: %+v", stored)
+	}
+
+	// Saving again updates the existing schedule
+	schedule.Enabled = false
+	schedule.Blackouts = nil
+	if err := db.SaveSchedule(schedule); err != nil {
+		t.Fatalf("Failed to update schedule: %v", err)
+	}
+
+	schedules, err := db.GetSchedules()
+	if err != nil {
+		t.Fatalf("Failed to list schedules: %v", err)
+	}
+
+	if len(schedules) != 1 || schedules[0].Enabled || len(schedules[0].Blackouts) != 0 {
+		t.Errorf("Expected one disabled schedule, got %+v", schedules)
+	}
+
+	// Record runs
+	now := time.Now()
+	runs := []*models.ScheduleRun{
+		{Schedule: "nightly", ScheduledAt: now.Add(-time.Hour), RunAt: now.Add(-time.Hour), Status: "queued", JobID: 4},
+		{Schedule: "nightly", ScheduledAt: now, RunAt: now, Status: "skipped", Message: "blackout window"},
+		{Schedule: "other", ScheduledAt: now, RunAt: now, Status: "queued", JobID: 5},
+	}
+	for _, run := range runs {
+		if _, err := db.AddScheduleRun(run); err != nil {
+			t.Fatalf("Failed to add schedule run: %v", err)
+		}
+	}
+
+	history, err := db.GetScheduleRuns("nightly", 10)
+	if err != nil {
+		t.Fatalf("Failed to get schedule runs: %v", err)
+	}
+
+	if len(history) != 2 || history[0].Status != "skipped" || history[1].JobID != 4 {
+		t.Errorf("Unexpected run history: %+v", history)
+	}
+
+	if err := db.DeleteSchedule("nightly"); err != nil {
+		t.Fatalf("Failed to delete schedule: %v", err)
+	}
+
+	if err := db.DeleteSchedule("nightly"); err == nil {
+		t.Errorf("Expected error when deleting missing schedule, got nil")
+	}
+}
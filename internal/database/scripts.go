@@ -0,0 +1,156 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// scriptResultColumns lists the columns read by scanScriptResultRow, for a
+// query joining script_results r with devices d and ports p
+const scriptResultColumns = `r.id, r.device_id, d.ip_address, COALESCE(r.port_id, 0), COALESCE(p.port_number, 0), COALESCE(p.protocol, ''),
+	COALESCE(r.scan_id, 0), r.script_id, COALESCE(r.output, ''), r.data, r.first_seen, r.last_seen`
+
+// scriptResultJoins joins script results with their device and port
+const scriptResultJoins = `FROM script_results r
+	JOIN devices d ON d.id = r.device_id
+	LEFT JOIN ports p ON p.id = r.port_id`
+
+// scanScriptResultRow reads a script result from a query result
+func scanScriptResultRow(row rowScanner) (*models.ScriptResult, error) {
+	var result models.ScriptResult
+	var data sql.NullString
+
+	err := row.Scan(
+		&result.ID,
+		&result.DeviceID,
+		&result.IPAddress,
+		&result.PortID,
+		&result.PortNumber,
+		&result.Protocol,
+		&result.ScanID,
+		&result.ScriptID,
+		&result.Output,
+		&data,
+		&result.FirstSeen,
+		&result.LastSeen,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.Valid && data.String != "" {
+		result.Data = []byte(data.String)
+	}
+
+	return &result, nil
+}
+
+// SaveScriptResult stores the output of an NSE script, replacing the output
+// the same script last produced for the host or port. Port scripts are linked
+// to the port by PortNumber and Protocol, which must already be saved.
+func (db *DB) SaveScriptResult(result *models.ScriptResult) error {
+	db.Lock()
+	defer db.Unlock()
+
+	var portID interface{}
+	if result.PortNumber > 0 {
+		var id int64
+		err := db.QueryRow(
+			`SELECT id FROM ports WHERE device_id = ? AND port_number = ? AND protocol = ?`,
+			result.DeviceID, result.PortNumber, result.Protocol,
+		).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("failed to find port %d/%s of device %d for script %s: %w",
+				result.PortNumber, result.Protocol, result.DeviceID, result.ScriptID, err)
+		}
+		portID = id
+	}
+
+	var scanID interface{}
+	if result.ScanID > 0 {
+		scanID = result.ScanID
+	}
+
+	var data interface{}
+	if len(result.Data) > 0 {
+		data = string(result.Data)
+	}
+
+	now := time.Now()
+
+	res, err := db.Exec(
+		`UPDATE script_results SET scan_id = ?, output = ?, data = ?, last_seen = ?
+		 WHERE device_id = ? AND port_id IS ? AND script_id = ?`,
+		scanID, result.Output, data, now, result.DeviceID, portID, result.ScriptID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update result of script %s: %w", result.ScriptID, err)
+	}
+
+	if updated, _ := res.RowsAffected(); updated > 0 {
+		return nil
+	}
+
+	_, err = db.Exec(
+		`INSERT INTO script_results (device_id, port_id, scan_id, script_id, output, data, first_seen, last_seen)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		result.DeviceID, portID, scanID, result.ScriptID, result.Output, data, now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert result of script %s: %w", result.ScriptID, err)
+	}
+
+	return nil
+}
+
+// GetDeviceScriptResults returns the script results for a device and its
+// ports, host scripts first
+func (db *DB) GetDeviceScriptResults(deviceID int64) ([]*models.ScriptResult, error) {
+	rows, err := db.Query(
+		`SELECT `+scriptResultColumns+` `+scriptResultJoins+`
+		WHERE r.device_id = ?
+		ORDER BY COALESCE(p.port_number, 0), p.protocol, r.script_id`, deviceID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query script results of device %d: %w", deviceID, err)
+	}
+	defer rows.Close()
+
+	return scanScriptResults(rows)
+}
+
+// SearchScriptResults returns script results whose output contains query,
+// optionally only those of one script, most recently seen first
+func (db *DB) SearchScriptResults(query, scriptID string, limit int) ([]*models.ScriptResult, error) {
+	likeQuery := "%" + query + "%"
+
+	rows, err := db.Query(
+		`SELECT `+scriptResultColumns+` `+scriptResultJoins+`
+		WHERE (r.output LIKE ? OR r.data LIKE ?) AND (? = '' OR r.script_id = ?)
+		ORDER BY r.last_seen DESC, r.id DESC LIMIT ?`,
+		likeQuery, likeQuery, scriptID, scriptID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search script results: %w", err)
+	}
+	defer rows.Close()
+
+	return scanScriptResults(rows)
+}
+
+// scanScriptResults reads every script result from rows
+func scanScriptResults(rows *sql.Rows) ([]*models.ScriptResult, error) {
+	results := []*models.ScriptResult{}
+	for rows.Next() {
+		result, err := scanScriptResultRow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan script result: %w", err)
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
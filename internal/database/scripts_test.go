@@ -0,0 +1,70 @@
+package database
+
+import (
+	"testing"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestScriptResults tests storing and searching NSE script output
+func TestScriptResults(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	deviceID, err := db.SaveDevice(&models.Device{IPAddress: "192.168.1.30", MACAddress: "00:11:22:33:44:30"})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+
+	if err := db.SavePort(&models.Port{DeviceID: deviceID, PortNumber: 443, Protocol: "tcp", ServiceName: "https"}); err != nil {
+		t.Fatalf("Failed to save port: %v", err)
+	}
+
+	results := []*models.ScriptResult{
+		{DeviceID: deviceID, ScriptID: "smb-os-discovery", Output: "OS: Windows Server 2019"},
+		{DeviceID: deviceID, PortNumber: 443, Protocol: "tcp", ScriptID: "ssl-cert", Output: "Subject: commonName=old.example.com"},
+		{DeviceID: deviceID, PortNumber: 443, Protocol: "tcp", ScriptID: "ssl-cert", Output: "Subject: commonName=nas.example.com",
+			Data: []byte(`{"subject":{"commonName":"nas.example.com"}}`)},
+	}
+	for _, result := range results {
+		if err := db.SaveScriptResult(result); err != nil {
+			t.Fatalf("Failed to save script result: %v", err)
+		}
+	}
+
+	// Results for ports that were never saved are refused
+	if err := db.SaveScriptResult(&models.ScriptResult{DeviceID: deviceID, PortNumber: 22, Protocol: "tcp", ScriptID: "ssh-hostkey"}); err == nil {
+		t.Errorf("Expected error for script result on unknown port, got nil")
+	}
+
+	stored, err := db.GetDeviceScriptResults(deviceID)
+	if err != nil {
+		t.Fatalf("Failed to get script results: %v", err)
+	}
+
+	if len(stored) != 2 || stored[0].ScriptID != "smb-os-discovery" || stored[0].PortID != 0 {
+		t.Fatalf("Expected the host script and one port script, got %+v", stored)
+	}
+
+	if stored[1].PortNumber != 443 || stored[1].Output != "Subject: commonName=nas.example.com" || string(stored[1].Data) != `{"subject":{"commonName":"nas.example.com"}}` {
+		t.Errorf("Expected the latest ssl-cert output, got %+v", stored[1])
+	}
+
+	found, err := db.SearchScriptResults("nas.example", "", 10)
+	if err != nil {
+		t.Fatalf("Failed to search script results: %v", err)
+	}
+
+	if len(found) != 1 || found[0].IPAddress != "192.168.1.30" {
+		t.Errorf("Unexpected search results: %+v", found)
+	}
+
+	found, err = db.SearchScriptResults("", "smb-os-discovery", 10)
+	if err != nil {
+		t.Fatalf("Failed to search script results: %v", err)
+	}
+
+	if len(found) != 1 || found[0].ScriptID != "smb-os-discovery" {
+		t.Errorf("Unexpected search results by script: %+v", found)
+	}
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// SaveScanTemplate creates or updates a user-defined scan template
+func (db *DB) SaveScanTemplate(template *models.ScanTemplate) error {
+	args, err := json.Marshal(template.NmapArgs)
+	if err != nil {
+		return fmt.Errorf("failed to encode nmap arguments: %w", err)
+	}
+
+	now := time.Now()
+	_, err = db.Exec(
+		`INSERT INTO scan_templates (name, description, nmap_args, rate_limit, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(name) DO UPDATE SET
+		 	description = excluded.description,
+		 	nmap_args = excluded.nmap_args,
+		 	rate_limit = excluded.rate_limit,
+		 	updated_at = excluded.updated_at`,
+		template.Name, template.Description, string(args), template.RateLimit, now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save scan template %s: %w", template.Name, err)
+	}
+
+	return nil
+}
+
+// GetScanTemplate retrieves a user-defined scan template by name
+func (db *DB) GetScanTemplate(name string) (*models.ScanTemplate, error) {
+	var template models.ScanTemplate
+	var description sql.NullString
+	var args string
+
+	err := db.QueryRow(
+		`SELECT name, description, nmap_args, rate_limit FROM scan_templates WHERE name = ?`, name,
+	).Scan(&template.Name, &description, &args, &template.RateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scan template: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(args), &template.NmapArgs); err != nil {
+		return nil, fmt.Errorf("failed to decode nmap arguments for template %s: %w", name, err)
+	}
+
+	template.ID = template.Name
+	template.Description = description.String
+	template.Source = "database"
+
+	return &template, nil
+}
+
+// GetScanTemplates retrieves all user-defined scan templates
+func (db *DB) GetScanTemplates() ([]*models.ScanTemplate, error) {
+	rows, err := db.Query(
+		`SELECT name, description, nmap_args, rate_limit FROM scan_templates ORDER BY name`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scan templates: %w", err)
+	}
+	defer rows.Close()
+
+	var templates []*models.ScanTemplate
+	for rows.Next() {
+		var template models.ScanTemplate
+		var description sql.NullString
+		var args string
+
+		if err := rows.Scan(&template.Name, &description, &args, &template.RateLimit); err != nil {
+			return nil, fmt.Errorf("failed to scan template row: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(args), &template.NmapArgs); err != nil {
+			db.logger.Warn().Err(err).Str("template", template.Name).Msg("Skipping template with invalid nmap arguments")
+			continue
+		}
+
+		template.ID = template.Name
+		template.Description = description.String
+		template.Source = "database"
+		templates = append(templates, &template)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating template rows: %w", err)
+	}
+
+	return templates, nil
+}
+
+// DeleteScanTemplate removes a user-defined scan template
+func (db *DB) DeleteScanTemplate(name string) error {
+	res, err := db.Exec(`DELETE FROM scan_templates WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete scan template %s: %w", name, err)
+	}
+
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return fmt.Errorf("failed to delete scan template %s: %w", name, sql.ErrNoRows)
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+// internal/database/templates_test.go
+package database
+
+import (
+	"testing"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestScanTemplates tests storing user-defined scan templates
+func TestScanTemplates(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	template := &models.ScanTemplate{
+		Name:        "iot-safe",
+		Description: "Gentle scan for IoT devices",
+		NmapArgs:    []string{"-sT", "-T2"},
+		RateLimit:   50,
+	}
+
+	if err := db.SaveScanTemplate(template); err != nil {
+		t.Fatalf("Failed to save template: %v", err)
+	}
+
+	stored, err := db.GetScanTemplate("iot-safe")
+	if err != nil {
+		t.Fatalf("Failed to get template: %v", err)
+	}
+
+	if len(stored.NmapArgs) != 2 || stored.NmapArgs[1] != "-T2" {
+		t.Errorf("Unexpected nmap args: %v", stored.NmapArgs)
+	}
+
+	// Saving again updates the existing template
+	template.RateLimit = 75
+	if err := db.SaveScanTemplate(template); err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	templates, err := db.GetScanTemplates()
+	if err != nil {
+		t.Fatalf("Failed to list templates: %v", err)
+	}
+
+	if len(templates) != 1 || templates[0].RateLimit != 75 {
+		t.Errorf("Expected one updated template, got %+v", templates)
+	}
+
+	if err := db.DeleteScanTemplate("iot-safe"); err != nil {
+		t.Fatalf("Failed to delete template: %v", err)
+	}
+
+	if err := db.DeleteScanTemplate("iot-safe"); err == nil {
+		t.Errorf("Expected error when deleting missing template, got nil")
+	}
+}
@@ -0,0 +1,409 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"panopticon-scanner/internal/models"
+	"panopticon-scanner/internal/nvd"
+)
+
+// VulnerabilityFilter selects vulnerability findings. Zero fields select
+// every unresolved finding.
+type VulnerabilityFilter struct {
+	DeviceID        int64
+	CVEID           string
+	Severity        string  // e.g. CRITICAL, case-insensitive
+	MinCVSS         float64 // lowest CVSS base score
+	IncludeResolved bool
+	Limit           int
+}
+
+// vulnerabilityColumns lists the columns read by scanVulnerabilityRow, for a
+// query joining vulnerability_findings f with devices d and vulnerabilities v
+const vulnerabilityColumns = `f.id, f.device_id, d.ip_address, f.port_number, f.protocol, f.cve_id, f.cpe,
+	COALESCE(v.description, ''), COALESCE(v.cvss, 0), COALESCE(v.severity, ''), v.published,
+	f.first_seen, f.last_seen, COALESCE(f.first_scan_id, 0), COALESCE(f.last_scan_id, 0), f.resolved_at`
+
+// vulnerabilityJoins joins findings with their device and CVE
+const vulnerabilityJoins = `FROM vulnerability_findings f
+	JOIN devices d ON d.id = f.device_id
+	JOIN vulnerabilities v ON v.cve_id = f.cve_id`
+
+// scanVulnerabilityRow reads a finding from a query result
+func scanVulnerabilityRow(row rowScanner) (*models.Vulnerability, error) {
+	var vulnerability models.Vulnerability
+	var published, resolvedAt sql.NullTime
+
+	err := row.Scan(
+		&vulnerability.ID,
+		&vulnerability.DeviceID,
+		&vulnerability.IPAddress,
+		&vulnerability.PortNumber,
+		&vulnerability.Protocol,
+		&vulnerability.CVEID,
+		&vulnerability.CPE,
+		&vulnerability.Description,
+		&vulnerability.CVSS,
+		&vulnerability.Severity,
+		&published,
+		&vulnerability.FirstSeen,
+		&vulnerability.LastSeen,
+		&vulnerability.FirstScanID,
+		&vulnerability.LastScanID,
+		&resolvedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if published.Valid {
+		vulnerability.Published = &published.Time
+	}
+	if resolvedAt.Valid {
+		vulnerability.ResolvedAt = &resolvedAt.Time
+	}
+
+	return &vulnerability, nil
+}
+
+// ImportVulnerabilities stores CVEs read from NVD feeds, replacing any
+// already imported, then matches every device against them. It returns the
+// number of CVEs imported and of unresolved findings.
+func (db *DB) ImportVulnerabilities(cves []*nvd.CVE) (int, int, error) {
+	imported, err := db.saveVulnerabilities(cves)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var deviceIDs []int64
+	rows, err := db.Query(`SELECT id FROM devices ORDER BY id`)
+	if err != nil {
+		return imported, 0, fmt.Errorf("failed to query devices: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return imported, 0, fmt.Errorf("failed to scan device ID: %w", err)
+		}
+		deviceIDs = append(deviceIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return imported, 0, fmt.Errorf("error iterating device rows: %w", err)
+	}
+
+	findings := 0
+	for _, id := range deviceIDs {
+		matched, err := db.MatchVulnerabilities(ScanContext{}, id)
+		if err != nil {
+			return imported, findings, err
+		}
+		findings += matched
+	}
+
+	db.logger.Info().Int("cves", imported).Int("findings", findings).Msg("Imported vulnerabilities")
+
+	return imported, findings, nil
+}
+
+// saveVulnerabilities stores CVEs and the CPEs they affect
+func (db *DB) saveVulnerabilities(cves []*nvd.CVE) (int, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	now := time.Now()
+	imported := 0
+	for _, cve := range cves {
+		if cve.ID == "" {
+			continue
+		}
+
+		var published interface{}
+		if !cve.Published.IsZero() {
+			published = cve.Published
+		}
+
+		_, err := tx.Exec(
+			`INSERT INTO vulnerabilities (cve_id, description, cvss, severity, published, imported_at)
+			 VALUES (?, ?, ?, ?, ?, ?)
+			 ON CONFLICT(cve_id) DO UPDATE SET
+			   description = excluded.description, cvss = excluded.cvss, severity = excluded.severity,
+			   published = excluded.published, imported_at = excluded.imported_at`,
+			cve.ID, cve.Description, cve.CVSS, strings.ToUpper(cve.Severity), published, now,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to save %s: %w", cve.ID, err)
+		}
+
+		if _, err := tx.Exec(`DELETE FROM vulnerability_cpes WHERE cve_id = ?`, cve.ID); err != nil {
+			return 0, fmt.Errorf("failed to clear CPEs of %s: %w", cve.ID, err)
+		}
+
+		for _, match := range cve.Matches {
+			cpe, ok := nvd.ParseCPE(match.CPE)
+			if !ok {
+				continue
+			}
+			_, err := tx.Exec(
+				`INSERT INTO vulnerability_cpes (cve_id, part, vendor, product, criteria,
+				   version_start_including, version_start_excluding, version_end_including, version_end_excluding)
+				 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				cve.ID, cpe.Part, cpe.Vendor, cpe.Product, match.CPE,
+				match.VersionStartIncluding, match.VersionStartExcluding, match.VersionEndIncluding, match.VersionEndExcluding,
+			)
+			if err != nil {
+				return 0, fmt.Errorf("failed to save CPE of %s: %w", cve.ID, err)
+			}
+		}
+		imported++
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	tx = nil
+
+	return imported, nil
+}
+
+// MatchVulnerabilities matches the CPEs of the services on a device's open
+// ports and of its OS against imported CVEs. Findings are recorded against
+// the scan in sc with the time the software was last seen; findings the
+// device no longer matches are resolved, and resolved findings it matches
+// again are reopened. It returns the number of findings matched.
+func (db *DB) MatchVulnerabilities(sc ScanContext, deviceID int64) (int, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	software, err := deviceSoftware(tx, deviceID)
+	if err != nil {
+		return 0, err
+	}
+
+	type findingKey struct {
+		port     int
+		protocol string
+		cveID    string
+	}
+	matched := make(map[findingKey]bool)
+	scanID := sql.NullInt64{Int64: sc.ScanID, Valid: sc.ScanID != 0}
+
+	for _, sw := range software {
+		cpe, ok := nvd.ParseCPE(sw.cpe)
+		if !ok {
+			continue
+		}
+		cveIDs, err := matchCPE(tx, cpe)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, cveID := range cveIDs {
+			key := findingKey{sw.port, sw.protocol, cveID}
+			if matched[key] {
+				continue
+			}
+			matched[key] = true
+
+			_, err := tx.Exec(
+				`INSERT INTO vulnerability_findings (device_id, port_number, protocol, cve_id, cpe, first_seen, last_seen, first_scan_id, last_scan_id)
+				 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+				 ON CONFLICT(device_id, port_number, protocol, cve_id) DO UPDATE SET
+				   cpe = excluded.cpe, last_seen = excluded.last_seen,
+				   last_scan_id = COALESCE(excluded.last_scan_id, last_scan_id), resolved_at = NULL`,
+				deviceID, sw.port, sw.protocol, cveID, sw.cpe, sw.seen, sw.seen, scanID, scanID,
+			)
+			if err != nil {
+				return 0, fmt.Errorf("failed to save finding %s on device %d: %w", cveID, deviceID, err)
+			}
+		}
+	}
+
+	// Resolve findings for software that is no longer found
+	rows, err := tx.Query(
+		`SELECT id, port_number, protocol, cve_id FROM vulnerability_findings WHERE device_id = ? AND resolved_at IS NULL`,
+		deviceID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query findings of device %d: %w", deviceID, err)
+	}
+	var resolved []int64
+	for rows.Next() {
+		var id int64
+		var key findingKey
+		if err := rows.Scan(&id, &key.port, &key.protocol, &key.cveID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan finding row: %w", err)
+		}
+		if !matched[key] {
+			resolved = append(resolved, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating finding rows: %w", err)
+	}
+
+	now := time.Now()
+	for _, id := range resolved {
+		if _, err := tx.Exec(`UPDATE vulnerability_findings SET resolved_at = ? WHERE id = ?`, now, id); err != nil {
+			return 0, fmt.Errorf("failed to resolve finding %d: %w", id, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	tx = nil
+
+	if len(matched) > 0 || len(resolved) > 0 {
+		db.logger.Debug().
+			Int64("deviceID", deviceID).
+			Int("matched", len(matched)).
+			Int("resolved", len(resolved)).
+			Msg("Matched vulnerabilities")
+	}
+
+	return len(matched), nil
+}
+
+// softwareCPE is a CPE found on a device, on a port or, with port 0, in its OS
+type softwareCPE struct {
+	port     int
+	protocol string
+	cpe      string
+	seen     time.Time
+}
+
+// deviceSoftware returns the CPEs of the services on a device's open ports
+// and of its OS
+func deviceSoftware(tx *sql.Tx, deviceID int64) ([]softwareCPE, error) {
+	rows, err := tx.Query(
+		`SELECT port_number, protocol, cpes, last_seen FROM ports
+		 WHERE device_id = ? AND state <> 'closed' AND COALESCE(cpes, '') <> ''`, deviceID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query CPEs of device %d: %w", deviceID, err)
+	}
+	defer rows.Close()
+
+	var software []softwareCPE
+	for rows.Next() {
+		var port softwareCPE
+		var cpes string
+		if err := rows.Scan(&port.port, &port.protocol, &cpes, &port.seen); err != nil {
+			return nil, fmt.Errorf("failed to scan port row: %w", err)
+		}
+		for _, cpe := range strings.Fields(cpes) {
+			port.cpe = cpe
+			software = append(software, port)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating port rows: %w", err)
+	}
+
+	var osCPEs string
+	var lastSeen time.Time
+	err = tx.QueryRow(`SELECT COALESCE(os_cpes, ''), last_seen FROM devices WHERE id = ?`, deviceID).Scan(&osCPEs, &lastSeen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OS CPEs of device %d: %w", deviceID, err)
+	}
+	for _, cpe := range strings.Fields(osCPEs) {
+		software = append(software, softwareCPE{cpe: cpe, seen: lastSeen})
+	}
+
+	return software, nil
+}
+
+// matchCPE returns the IDs of the imported CVEs that affect a CPE
+func matchCPE(tx *sql.Tx, cpe nvd.CPE) ([]string, error) {
+	rows, err := tx.Query(
+		`SELECT cve_id, criteria, COALESCE(version_start_including, ''), COALESCE(version_start_excluding, ''),
+		   COALESCE(version_end_including, ''), COALESCE(version_end_excluding, '')
+		 FROM vulnerability_cpes WHERE vendor = ? AND product = ? AND part = ?`,
+		cpe.Vendor, cpe.Product, cpe.Part,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query CVEs of %s:%s: %w", cpe.Vendor, cpe.Product, err)
+	}
+	defer rows.Close()
+
+	var cveIDs []string
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var cveID string
+		var match nvd.Match
+		err := rows.Scan(&cveID, &match.CPE, &match.VersionStartIncluding, &match.VersionStartExcluding,
+			&match.VersionEndIncluding, &match.VersionEndExcluding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan CVE CPE row: %w", err)
+		}
+		if !seen[cveID] && match.Matches(cpe) {
+			seen[cveID] = true
+			cveIDs = append(cveIDs, cveID)
+		}
+	}
+
+	return cveIDs, rows.Err()
+}
+
+// GetVulnerabilities returns the findings selected by filter, highest CVSS
+// score first
+func (db *DB) GetVulnerabilities(filter VulnerabilityFilter) ([]*models.Vulnerability, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = -1 // SQLite for no limit
+	}
+
+	rows, err := db.Query(
+		`SELECT `+vulnerabilityColumns+` `+vulnerabilityJoins+`
+		WHERE (?1 = 0 OR f.device_id = ?1)
+		  AND (?2 = '' OR f.cve_id = ?2)
+		  AND (?3 = '' OR v.severity = upper(?3))
+		  AND COALESCE(v.cvss, 0) >= ?4
+		  AND (?5 OR f.resolved_at IS NULL)
+		ORDER BY COALESCE(v.cvss, 0) DESC, f.device_id, f.port_number, f.protocol, f.cve_id
+		LIMIT ?6`,
+		filter.DeviceID, filter.CVEID, filter.Severity, filter.MinCVSS, filter.IncludeResolved, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query vulnerabilities: %w", err)
+	}
+	defer rows.Close()
+
+	vulnerabilities := []*models.Vulnerability{}
+	for rows.Next() {
+		vulnerability, err := scanVulnerabilityRow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan vulnerability row: %w", err)
+		}
+		vulnerabilities = append(vulnerabilities, vulnerability)
+	}
+
+	return vulnerabilities, rows.Err()
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"testing"
+
+	"panopticon-scanner/internal/models"
+	"panopticon-scanner/internal/nvd"
+)
+
+// testCVEs affect OpenSSH before 9.3 and every Linux kernel
+var testCVEs = []*nvd.CVE{
+	{
+		ID: "CVE-2023-38408", Description: "ssh-agent search path", CVSS: 9.8, Severity: "critical",
+		Matches: []*nvd.Match{{CPE: "cpe:2.3:a:openbsd:openssh:*:*:*:*:*:*:*:*", VersionEndExcluding: "9.3"}},
+	},
+	{
+		ID: "CVE-2000-0001", Description: "kernel", CVSS: 5.5, Severity: "MEDIUM",
+		Matches: []*nvd.Match{{CPE: "cpe:2.3:o:linux:linux_kernel:*:*:*:*:*:*:*:*"}},
+	},
+	{
+		ID: "CVE-2021-41773", Description: "path traversal", CVSS: 7.5, Severity: "HIGH",
+		Matches: []*nvd.Match{{CPE: "cpe:2.3:a:apache:http_server:2.4.49:*:*:*:*:*:*:*"}},
+	},
+}
+
+// TestMatchVulnerabilities tests matching service and OS CPEs against
+// imported CVEs, and resolving findings once the software is gone
+func TestMatchVulnerabilities(t *testing.T) {
+	db, _, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	deviceID, err := db.SaveDevice(&models.Device{
+		IPAddress: "10.0.0.1", OSFingerprint: "Linux 5.0 - 5.14", OSCPEs: []string{"cpe:/o:linux:linux_kernel:5"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	port := &models.Port{
+		DeviceID: deviceID, PortNumber: 22, Protocol: "tcp", ServiceName: "ssh", ServiceVersion: "OpenSSH 7.4",
+		CPEs: []string{"cpe:/a:openbsd:openssh:7.4"},
+	}
+	if err := db.SavePort(port); err != nil {
+		t.Fatalf("Failed to save port: %v", err)
+	}
+
+	imported, findings, err := db.ImportVulnerabilities(testCVEs)
+	if err != nil {
+		t.Fatalf("Failed to import vulnerabilities: %v", err)
+	}
+	if imported != 3 || findings != 2 {
+		t.Errorf("Expected 3 CVEs and 2 findings, got %d and %d", imported, findings)
+	}
+
+	details, err := db.GetDeviceDetails(deviceID)
+	if err != nil {
+		t.Fatalf("Failed to get device details: %v", err)
+	}
+	if len(details.Ports) != 1 || len(details.Ports[0].CPEs) != 1 {
+		t.Errorf("Expected the port's CPE to be stored, got %+v", details.Ports)
+	}
+	if len(details.Vulnerabilities) != 2 {
+		t.Fatalf("Expected 2 vulnerabilities, got %+v", details.Vulnerabilities)
+	}
+	ssh, kernel := details.Vulnerabilities[0], details.Vulnerabilities[1]
+	if ssh.CVEID != "CVE-2023-38408" || ssh.PortNumber != 22 || ssh.Protocol != "tcp" || ssh.CVSS != 9.8 ||
+		ssh.Severity != "CRITICAL" || ssh.CPE != "cpe:/a:openbsd:openssh:7.4" || ssh.FirstScanID != 0 {
+		t.Errorf("Unexpected service finding: %+v", ssh)
+	}
+	if kernel.CVEID != "CVE-2000-0001" || kernel.PortNumber != 0 {
+		t.Errorf("Unexpected OS finding: %+v", kernel)
+	}
+
+	// A scan finds the same version, then an upgrade
+	scanID, err := db.CreateScan("default")
+	if err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+	if _, err := db.MatchVulnerabilities(ScanContext{ScanID: scanID}, deviceID); err != nil {
+		t.Fatalf("Failed to match vulnerabilities: %v", err)
+	}
+	found, err := db.GetVulnerabilities(VulnerabilityFilter{CVEID: "CVE-2023-38408"})
+	if err != nil {
+		t.Fatalf("Failed to get vulnerabilities: %v", err)
+	}
+	if len(found) != 1 || found[0].ID != ssh.ID || found[0].LastScanID != scanID || !found[0].FirstSeen.Equal(ssh.FirstSeen) {
+		t.Errorf("Expected the finding to be seen again by scan %d, got %+v", scanID, found)
+	}
+
+	port.ServiceVersion = "OpenSSH 9.6"
+	port.CPEs = []string{"cpe:/a:openbsd:openssh:9.6"}
+	if err := db.IngestPort(ScanContext{ScanID: scanID}, port); err != nil {
+		t.Fatalf("Failed to save port: %v", err)
+	}
+	if matched, err := db.MatchVulnerabilities(ScanContext{ScanID: scanID}, deviceID); err != nil || matched != 1 {
+		t.Fatalf("Expected the kernel finding only, got %d: %v", matched, err)
+	}
+
+	active, err := db.GetVulnerabilities(VulnerabilityFilter{DeviceID: deviceID})
+	if err != nil {
+		t.Fatalf("Failed to get vulnerabilities: %v", err)
+	}
+	if len(active) != 1 || active[0].CVEID != "CVE-2000-0001" {
+		t.Errorf("Expected the upgrade to resolve the OpenSSH finding, got %+v", active)
+	}
+	all, err := db.GetVulnerabilities(VulnerabilityFilter{DeviceID: deviceID, IncludeResolved: true, MinCVSS: 9})
+	if err != nil {
+		t.Fatalf("Failed to get vulnerabilities: %v", err)
+	}
+	if len(all) != 1 || all[0].ResolvedAt == nil {
+		t.Errorf("Expected the resolved OpenSSH finding, got %+v", all)
+	}
+
+	stats, err := db.GetDatabaseStats()
+	if err != nil {
+		t.Fatalf("Failed to get database stats: %v", err)
+	}
+	if stats["activeVulnerabilities"] != 1 {
+		t.Errorf("Expected 1 active vulnerability, got %v", stats["activeVulnerabilities"])
+	}
+
+	// Merged devices keep one finding per port and CVE
+	otherID, err := db.SaveDevice(&models.Device{
+		IPAddress: "10.0.0.2", OSFingerprint: "Linux 5.0 - 5.14", OSCPEs: []string{"cpe:/o:linux:linux_kernel:5"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	if _, err := db.MatchVulnerabilities(ScanContext{}, otherID); err != nil {
+		t.Fatalf("Failed to match vulnerabilities: %v", err)
+	}
+	if err := db.MergeDevices(deviceID, []int64{otherID}); err != nil {
+		t.Fatalf("Failed to merge devices: %v", err)
+	}
+	if merged, err := db.GetVulnerabilities(VulnerabilityFilter{IncludeResolved: true}); err != nil || len(merged) != 2 {
+		t.Errorf("Expected 2 findings after the merge, got %d: %v", len(merged), err)
+	}
+}
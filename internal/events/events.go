@@ -0,0 +1,218 @@
+// Package events provides an in-process publish/subscribe bus for scan and
+// device events. Subscribers receive events on buffered channels; events for
+// subscribers that fall behind are dropped rather than blocking publishers.
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event types published by the scanner and database
+const (
+	TypeScanQueued     = "scan_queued"
+	TypeScanStatus     = "scan_status"
+	TypeScanProgress   = "scan_progress"
+	TypeDeviceFound    = "device_found"
+	TypeDeviceChanged  = "device_changed"
+	TypeDeviceOffline  = "device_offline"
+	TypeDeviceReturned = "device_returned"
+	TypePortFound      = "port_found"
+	TypePortChanged    = "port_changed"
+	TypePortClosed     = "port_closed"
+
+	// TypeEventsDropped tells a client how many events it missed by falling behind
+	TypeEventsDropped = "events_dropped"
+)
+
+// knownTypes lists the event types clients may subscribe to
+var knownTypes = map[string]bool{
+	TypeScanQueued:     true,
+	TypeScanStatus:     true,
+	TypeScanProgress:   true,
+	TypeDeviceFound:    true,
+	TypeDeviceChanged:  true,
+	TypeDeviceOffline:  true,
+	TypeDeviceReturned: true,
+	TypePortFound:      true,
+	TypePortChanged:    true,
+	TypePortClosed:     true,
+}
+
+// IsKnownType reports whether events of the given type are published
+func IsKnownType(eventType string) bool {
+	return knownTypes[eventType]
+}
+
+// historySize is the number of recent events kept for clients that reconnect
+const historySize = 256
+
+// Event is a single message published on the bus
+type Event struct {
+	ID        uint64      `json:"id"`
+	Type      string      `json:"type"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// Bus distributes events to subscribers
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[*Subscription]struct{}
+	history     []Event
+	nextID      uint64
+	closed      bool
+}
+
+// Subscription receives the events matching its filter
+type Subscription struct {
+	bus     *Bus
+	events  chan Event
+	types   map[string]bool
+	dropped uint64
+	once    sync.Once
+}
+
+// NewBus creates an empty event bus
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish sends an event to every matching subscriber. It never blocks: if a
+// subscriber's buffer is full the event is dropped for that subscriber only.
+// Publishing on a nil bus is a no-op.
+func (b *Bus) Publish(eventType string, data interface{}) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.nextID++
+	event := Event{
+		ID:        b.nextID,
+		Type:      eventType,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	b.history = append(b.history, event)
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+
+	for sub := range b.subscribers {
+		if !sub.Matches(eventType) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	}
+}
+
+// Subscribe registers a subscriber for the given event types, or for all
+// events if types is empty. buffer is the number of events held for the
+// subscriber before new events are dropped.
+func (b *Bus) Subscribe(types []string, buffer int) *Subscription {
+	if buffer < 1 {
+		buffer = 1
+	}
+
+	sub := &Subscription{
+		bus:    b,
+		events: make(chan Event, buffer),
+		types:  make(map[string]bool, len(types)),
+	}
+	for _, t := range types {
+		if t != "" {
+			sub.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		sub.once.Do(func() { close(sub.events) })
+		return sub
+	}
+	b.subscribers[sub] = struct{}{}
+
+	return sub
+}
+
+// Since returns retained events published after the given event ID that
+// match the subscription's filter
+func (b *Bus) Since(id uint64, sub *Subscription) []Event {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var events []Event
+	for _, event := range b.history {
+		if event.ID > id && sub.Matches(event.Type) {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+// SubscriberCount returns the number of active subscribers
+func (b *Bus) SubscriberCount() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return len(b.subscribers)
+}
+
+// Close closes every subscription and stops accepting events
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+
+	for sub := range b.subscribers {
+		sub.once.Do(func() { close(sub.events) })
+	}
+	b.subscribers = nil
+}
+
+// Events returns the channel on which events are delivered. It is closed
+// when the subscription or the bus is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Matches reports whether the subscription wants events of the given type
+func (s *Subscription) Matches(eventType string) bool {
+	return len(s.types) == 0 || s.types[eventType]
+}
+
+// Dropped returns the number of events dropped because the subscriber was too slow
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close unregisters the subscription and closes its channel
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	delete(s.bus.subscribers, s)
+	s.once.Do(func() { close(s.events) })
+}
@@ -0,0 +1,93 @@
+// internal/events/events_test.go
+package events
+
+import (
+	"testing"
+)
+
+// TestPublishSubscribe tests filtered delivery of events
+func TestPublishSubscribe(t *testing.T) {
+	bus := NewBus()
+	defer bus.Close()
+
+	all := bus.Subscribe(nil, 10)
+	scans := bus.Subscribe([]string{TypeScanStatus}, 10)
+
+	bus.Publish(TypeScanStatus, map[string]interface{}{"status": "running"})
+	bus.Publish(TypeDeviceFound, map[string]interface{}{"deviceId": 1})
+
+	if got := len(all.Events()); got != 2 {
+		t.Errorf("Expected 2 events for unfiltered subscriber, got %d", got)
+	}
+
+	if got := len(scans.Events()); got != 1 {
+		t.Fatalf("Expected 1 event for filtered subscriber, got %d", got)
+	}
+
+	event := <-scans.Events()
+	if event.Type != TypeScanStatus || event.ID != 1 {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+
+	scans.Close()
+	if bus.SubscriberCount() != 1 {
+		t.Errorf("Expected 1 subscriber after close, got %d", bus.SubscriberCount())
+	}
+
+	if _, ok := <-scans.Events(); ok {
+		t.Errorf("Expected closed subscription channel")
+	}
+}
+
+// TestSlowSubscriber tests that a full subscriber drops events without blocking
+func TestSlowSubscriber(t *testing.T) {
+	bus := NewBus()
+	defer bus.Close()
+
+	slow := bus.Subscribe(nil, 2)
+	fast := bus.Subscribe(nil, 10)
+
+	for i := 0; i < 5; i++ {
+		bus.Publish(TypeScanProgress, i)
+	}
+
+	if slow.Dropped() != 3 {
+		t.Errorf("Expected 3 dropped events, got %d", slow.Dropped())
+	}
+
+	if fast.Dropped() != 0 || len(fast.Events()) != 5 {
+		t.Errorf("Expected fast subscriber to receive every event, dropped %d", fast.Dropped())
+	}
+}
+
+// TestSince tests replaying retained events
+func TestSince(t *testing.T) {
+	bus := NewBus()
+
+	for i := 0; i < historySize+10; i++ {
+		bus.Publish(TypeScanProgress, i)
+	}
+	bus.Publish(TypeScanStatus, "completed")
+
+	sub := bus.Subscribe([]string{TypeScanStatus}, 1)
+	replay := bus.Since(0, sub)
+	if len(replay) != 1 || replay[0].Data != "completed" {
+		t.Errorf("Expected only the matching event to be replayed, got %d events", len(replay))
+	}
+
+	all := bus.Subscribe(nil, 1)
+	if replay := bus.Since(0, all); len(replay) != historySize {
+		t.Errorf("Expected %d retained events, got %d", historySize, len(replay))
+	}
+
+	// Closing the bus closes every subscription
+	bus.Close()
+	if _, ok := <-sub.Events(); ok {
+		t.Errorf("Expected subscription to be closed with the bus")
+	}
+
+	// Publishing on a closed or nil bus is a no-op
+	bus.Publish(TypeScanStatus, "ignored")
+	var nilBus *Bus
+	nilBus.Publish(TypeScanStatus, "ignored")
+}
@@ -0,0 +1,297 @@
+// Package maintenance runs the periodic database and file housekeeping for the
+// Panopticon Scanner: backups, database optimization and removal of data and
+// scan output past its retention period. Tasks run in the window given by the
+// maintenance schedule and each run's outcome is recorded in the database.
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"panopticon-scanner/internal/config"
+	"panopticon-scanner/internal/database"
+	"panopticon-scanner/internal/models"
+	"panopticon-scanner/internal/scanner"
+	"panopticon-scanner/internal/scheduler"
+)
+
+// Maintenance task names, as recorded in the maintenance_runs table
+const (
+	TaskBackup        = "backup"
+	TaskOptimize      = "optimize"
+	TaskCleanupData   = "cleanup_data"
+	TaskCleanupOutput = "cleanup_output"
+)
+
+// jobName is the scheduler job that runs the maintenance window
+const jobName = "maintenance"
+
+// task is a maintenance task and how often it needs to run
+type task struct {
+	name    string
+	enabled bool
+
+	// frequency is the minimum time between completed runs; zero runs the
+	// task in every maintenance window
+	frequency time.Duration
+
+	// run performs the task and returns a short description of what it did
+	run func() (string, error)
+}
+
+// Service runs maintenance tasks on the configured schedule
+type Service struct {
+	config      *config.Config
+	db          *database.DB
+	scanService *scanner.ScanService
+	scheduler   *scheduler.Scheduler
+	logger      zerolog.Logger
+}
+
+// New creates a new maintenance service
+func New(cfg *config.Config, db *database.DB, scanService *scanner.ScanService) *Service {
+	return &Service{
+		config:      cfg,
+		db:          db,
+		scanService: scanService,
+		scheduler:   scheduler.New(),
+		logger:      log.With().Str("component", "maintenance").Logger(),
+	}
+}
+
+// Start schedules the maintenance window. An empty schedule disables
+// scheduled maintenance.
+func (s *Service) Start() error {
+	if s.config.Maintenance.Schedule == "" {
+		s.logger.Info().Msg("No maintenance schedule configured; scheduled maintenance is disabled")
+		return nil
+	}
+
+	schedule, err := scheduler.Parse(s.config.Maintenance.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid maintenance schedule: %w", err)
+	}
+
+	// Check the task frequencies now rather than at the first window
+	tasks, err := s.tasks()
+	if err != nil {
+		return err
+	}
+
+	// A task is considered once per window, so a frequency shorter than the
+	// time between windows cannot be honoured
+	if interval := windowInterval(schedule, time.Now()); interval > 0 {
+		for _, t := range tasks {
+			if t.enabled && t.frequency > 0 && t.frequency < interval {
+				s.logger.Warn().
+					Str("task", t.name).
+					Dur("frequency", t.frequency).
+					Dur("windowInterval", interval).
+					Msg("Maintenance task frequency is shorter than the time between maintenance windows; it will run once per window")
+			}
+		}
+	}
+
+	s.scheduler.Set(scheduler.Job{
+		Name:     jobName,
+		Schedule: schedule,
+		Run:      s.Run,
+	})
+	s.scheduler.Start(context.Background())
+
+	next, _ := s.scheduler.NextRun(jobName)
+	s.logger.Info().
+		Str("schedule", schedule.String()).
+		Time("nextRun", next).
+		Msg("Maintenance scheduler started")
+
+	return nil
+}
+
+// Stop stops the maintenance scheduler and waits for a running task to finish
+func (s *Service) Stop() {
+	s.scheduler.Stop()
+}
+
+// Run runs every enabled task that is due in the maintenance window scheduled
+// at the given time. Tasks run one at a time; no new task starts once ctx is
+// cancelled.
+func (s *Service) Run(ctx context.Context, scheduled time.Time) {
+	tasks, err := s.tasks()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Skipping maintenance")
+		return
+	}
+
+	for _, t := range tasks {
+		if ctx.Err() != nil {
+			return
+		}
+		if !t.enabled {
+			continue
+		}
+
+		due, err := s.due(t, scheduled)
+		if err != nil {
+			s.logger.Error().Err(err).Str("task", t.name).Msg("Failed to check whether maintenance task is due")
+			continue
+		}
+		if !due {
+			s.logger.Debug().Str("task", t.name).Msg("Maintenance task not due")
+			continue
+		}
+
+		s.runTask(t, scheduled)
+	}
+}
+
+// tasks returns the maintenance tasks in the order they run. Old data is
+// removed before optimizing so the space it used is reclaimed, and the backup
+// runs last so it is as small as possible.
+func (s *Service) tasks() ([]task, error) {
+	optimizeFrequency, err := frequency(s.config.Database.OptimizeFrequency)
+	if err != nil {
+		return nil, fmt.Errorf("invalid optimize frequency: %w", err)
+	}
+
+	backupFrequency, err := frequency(s.config.Database.BackupFrequency)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup frequency: %w", err)
+	}
+
+	return []task{
+		{
+			name:    TaskCleanupData,
+			enabled: s.config.Maintenance.CleanupOldData && s.config.Database.DataRetentionDays > 0,
+			run:     s.cleanupData,
+		},
+		{
+			name:    TaskCleanupOutput,
+			enabled: s.config.Maintenance.CleanupOutputFiles,
+			run:     s.cleanupOutput,
+		},
+		{
+			name:      TaskOptimize,
+			enabled:   s.config.Maintenance.DatabaseOptimize,
+			frequency: optimizeFrequency,
+			run:       s.optimize,
+		},
+		{
+			name:      TaskBackup,
+			enabled:   s.config.Maintenance.DatabaseBackup,
+			frequency: backupFrequency,
+			run:       s.backup,
+		},
+	}, nil
+}
+
+// frequency parses a task frequency, treating an empty value as zero
+func frequency(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// intervalSamples is how many upcoming windows are compared to find the
+// shortest time between them
+const intervalSamples = 64
+
+// windowInterval returns the shortest time between the upcoming windows of a
+// schedule after the given time, or zero if it has fewer than two
+func windowInterval(schedule *scheduler.Schedule, from time.Time) time.Duration {
+	var shortest time.Duration
+	previous := schedule.Next(from)
+	for i := 0; i < intervalSamples && !previous.IsZero(); i++ {
+		next := schedule.Next(previous)
+		if next.IsZero() {
+			break
+		}
+		if gap := next.Sub(previous); shortest == 0 || gap < shortest {
+			shortest = gap
+		}
+		previous = next
+	}
+	return shortest
+}
+
+// due reports whether a task should run in the window scheduled at the given
+// time. Windows are compared by their scheduled times so that a task with a
+// frequency equal to the schedule's period is not put off by how long the
+// previous window took.
+func (s *Service) due(t task, scheduled time.Time) (bool, error) {
+	if t.frequency <= 0 {
+		return true, nil
+	}
+
+	last, err := s.db.GetLastCompletedMaintenanceRun(t.name)
+	if err != nil {
+		return false, err
+	}
+	if last == nil {
+		return true, nil
+	}
+
+	return !scheduled.Before(last.ScheduledAt.Add(t.frequency)), nil
+}
+
+// runTask runs a task and records its outcome
+func (s *Service) runTask(t task, scheduled time.Time) {
+	logger := s.logger.With().Str("task", t.name).Logger()
+	logger.Info().Msg("Running maintenance task")
+
+	run := &models.MaintenanceRun{
+		Task:        t.name,
+		ScheduledAt: scheduled,
+		StartedAt:   time.Now(),
+		Status:      "completed",
+	}
+
+	details, err := t.run()
+	run.FinishedAt = time.Now()
+	run.Details = details
+	if err != nil {
+		run.Status, run.Error = "error", err.Error()
+		logger.Error().Err(err).Msg("Maintenance task failed")
+	} else {
+		logger.Info().
+			Str("details", details).
+			Dur("duration", run.FinishedAt.Sub(run.StartedAt)).
+			Msg("Maintenance task completed")
+	}
+
+	if _, err := s.db.AddMaintenanceRun(run); err != nil {
+		logger.Error().Err(err).Msg("Failed to record maintenance run")
+	}
+}
+
+// cleanupData removes inventory, history and logs past the retention period
+func (s *Service) cleanupData() (string, error) {
+	deleted, err := s.db.CleanOldData(s.config.Database.DataRetentionDays)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d records deleted", deleted), nil
+}
+
+// cleanupOutput removes scan output files past the retention period
+func (s *Service) cleanupOutput() (string, error) {
+	return "", s.scanService.Clean()
+}
+
+// optimize vacuums and analyzes the database
+func (s *Service) optimize() (string, error) {
+	return "", s.db.OptimizeDatabase()
+}
+
+// backup writes a copy of the database to the backup directory
+func (s *Service) backup() (string, error) {
+	if s.config.Database.BackupDir == "" {
+		return s.db.BackupDatabase()
+	}
+	return s.db.BackupDatabaseTo(s.config.Database.BackupDir)
+}
@@ -0,0 +1,153 @@
+package maintenance
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"panopticon-scanner/internal/config"
+	"panopticon-scanner/internal/database"
+	"panopticon-scanner/internal/scanner"
+	"panopticon-scanner/internal/scheduler"
+)
+
+// setupTestService creates a maintenance service backed by a temporary database
+func setupTestService(t *testing.T) (string, *config.Config, *database.DB, *Service) {
+	tempDir, err := ioutil.TempDir("", "maintenance-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	cfg := config.GetConfig()
+	cfg.Scanner.OutputDir = filepath.Join(tempDir, "scans")
+	cfg.Database.Path = filepath.Join(tempDir, "test.db")
+	cfg.Database.BackupDir = filepath.Join(tempDir, "backups")
+	os.MkdirAll(cfg.Scanner.OutputDir, 0755)
+
+	db, err := database.New(cfg.Database.Path)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	return tempDir, cfg, db, New(cfg, db, scanner.New(cfg, db))
+}
+
+// TestRun tests that each maintenance window runs the tasks that are due
+func TestRun(t *testing.T) {
+	tempDir, cfg, db, service := setupTestService(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	cfg.Maintenance.DatabaseBackup = true
+	cfg.Maintenance.DatabaseOptimize = true
+	cfg.Maintenance.CleanupOldData = true
+	cfg.Maintenance.CleanupOutputFiles = false
+	cfg.Database.BackupFrequency = "168h"
+	cfg.Database.OptimizeFrequency = "24h"
+	cfg.Database.DataRetentionDays = 30
+
+	window := time.Date(2024, 3, 4, 2, 0, 0, 0, time.Local)
+	service.Run(context.Background(), window)
+
+	runs, err := db.GetMaintenanceRuns(10)
+	if err != nil {
+		t.Fatalf("Failed to get maintenance runs: %v", err)
+	}
+
+	if len(runs) != 3 {
+		t.Fatalf("Expected 3 maintenance runs, got %d", len(runs))
+	}
+
+	for _, run := range runs {
+		if run.Status != "completed" || run.Task == TaskCleanupOutput {
+			t.Errorf("Unexpected maintenance run: %+v", run)
+		}
+	}
+
+	backups, _ := filepath.Glob(filepath.Join(cfg.Database.BackupDir, "*.db"))
+	if len(backups) != 1 {
+		t.Errorf("Expected 1 backup in the backup directory, got %d", len(backups))
+	}
+
+	// A day later the backup is not yet due again
+	service.Run(context.Background(), window.Add(24*time.Hour))
+
+	runs, err = db.GetMaintenanceRuns(10)
+	if err != nil {
+		t.Fatalf("Failed to get maintenance runs: %v", err)
+	}
+
+	counts := make(map[string]int)
+	for _, run := range runs {
+		counts[run.Task]++
+	}
+
+	if counts[TaskBackup] != 1 || counts[TaskOptimize] != 2 || counts[TaskCleanupData] != 2 {
+		t.Errorf("Unexpected maintenance runs after the second window: %v", counts)
+	}
+
+	// A week after the first window the backup runs again
+	service.Run(context.Background(), window.Add(7*24*time.Hour))
+
+	last, err := db.GetLastCompletedMaintenanceRun(TaskBackup)
+	if err != nil || last == nil {
+		t.Fatalf("Failed to get last backup: %v", err)
+	}
+
+	if !last.ScheduledAt.Equal(window.Add(7 * 24 * time.Hour)) {
+		t.Errorf("Expected the backup to run in the window a week later, got %v", last.ScheduledAt)
+	}
+}
+
+// TestStart tests validation of the maintenance schedule
+func TestStart(t *testing.T) {
+	tempDir, cfg, db, service := setupTestService(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	cfg.Maintenance.Schedule = "not a schedule"
+	if err := service.Start(); err == nil {
+		t.Errorf("Expected error for invalid maintenance schedule, got nil")
+	}
+
+	cfg.Maintenance.Schedule = "0 2 * * *"
+	if err := service.Start(); err != nil {
+		t.Fatalf("Failed to start maintenance service: %v", err)
+	}
+	defer service.Stop()
+
+	if _, ok := service.scheduler.NextRun(jobName); !ok {
+		t.Errorf("Expected the maintenance window to be scheduled")
+	}
+}
+
+// TestWindowInterval tests finding the shortest time between maintenance
+// windows, which task frequencies are checked against
+func TestWindowInterval(t *testing.T) {
+	from := time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC) // a Wednesday
+
+	tests := []struct {
+		schedule string
+		want     time.Duration
+	}{
+		{"0 2 * * *", 24 * time.Hour},
+		{"@weekly", 7 * 24 * time.Hour},
+		{"0 2 * * 1-5", 24 * time.Hour},
+		{"0 2,14 * * *", 12 * time.Hour},
+		{"@every 6h", 6 * time.Hour},
+		{"0 0 30 2 *", 0},
+	}
+
+	for _, tt := range tests {
+		schedule, err := scheduler.Parse(tt.schedule)
+		if err != nil {
+			t.Fatalf("Failed to parse schedule %q: %v", tt.schedule, err)
+		}
+		if got := windowInterval(schedule, from); got != tt.want {
+			t.Errorf("%s: expected interval %v, got %v", tt.schedule, tt.want, got)
+		}
+	}
+}
@@ -3,7 +3,10 @@
 // system status, and other entities used by the application.
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Device represents a basic network device
 type Device struct {
@@ -15,24 +18,173 @@ type Device struct {
 	FirstSeen    time.Time `json:"firstSeen"`
 	LastSeen     time.Time `json:"lastSeen"`
 	PortCount    int       `json:"portCount,omitempty"`
+	Addresses    []string  `json:"addresses,omitempty"` // every IPv4 and IPv6 address, in device details
+	OfflineSince *time.Time `json:"offlineSince,omitempty"` // set once the device has been missed by enough scans
+	Vendor       string    `json:"vendor,omitempty"`        // manufacturer, from the MAC address's OUI
+	RandomizedMAC bool     `json:"randomizedMac,omitempty"` // the MAC address is locally administered, as by privacy features
+	NetBIOSName  string    `json:"netbiosName,omitempty"`   // Windows computer name, from nbstat or smb-os-discovery
+	Workgroup    string    `json:"workgroup,omitempty"`     // NetBIOS workgroup or domain
+	SMBOS        string    `json:"smbOs,omitempty"`         // operating system reported over SMB
+	OSAccuracy   int       `json:"osAccuracy,omitempty"`    // nmap's confidence in the OS fingerprint, in percent
+	OSFamily     string    `json:"osFamily,omitempty"`      // e.g. Linux, Windows, iOS
+	DeviceType   string    `json:"deviceType,omitempty"`    // e.g. general purpose, router, printer, phone
+	OSCPEs       []string  `json:"osCpes,omitempty"`        // CPEs of the OS fingerprint
+	OSMatches    []*OSMatch `json:"osMatches,omitempty"`    // every OS guess, most accurate first, in device details
+}
+
+// OSMatch represents one of nmap's guesses at the operating system of a host
+type OSMatch struct {
+	Name     string     `json:"name"`
+	Accuracy int        `json:"accuracy"`
+	Classes  []*OSClass `json:"classes,omitempty"`
+}
+
+// OSClass represents a classification of an OS match
+type OSClass struct {
+	Type       string   `json:"type,omitempty"`
+	Vendor     string   `json:"vendor,omitempty"`
+	Family     string   `json:"family,omitempty"`
+	Generation string   `json:"generation,omitempty"`
+	Accuracy   int      `json:"accuracy"`
+	CPEs       []string `json:"cpes,omitempty"`
+}
+
+// Vulnerability represents a CVE found in a service on one of a device's
+// ports, or in its OS when PortNumber is zero
+type Vulnerability struct {
+	ID          int64      `json:"id"`
+	DeviceID    int64      `json:"deviceId"`
+	IPAddress   string     `json:"ipAddress"`
+	PortNumber  int        `json:"portNumber,omitempty"`
+	Protocol    string     `json:"protocol,omitempty"`
+	CVEID       string     `json:"cveId"`
+	CPE         string     `json:"cpe"` // the CPE of the service or OS that matched
+	Description string     `json:"description"`
+	CVSS        float64    `json:"cvss"`
+	Severity    string     `json:"severity,omitempty"`
+	Published   *time.Time `json:"published,omitempty"`
+	FirstSeen   time.Time  `json:"firstSeen"`
+	LastSeen    time.Time  `json:"lastSeen"`
+	FirstScanID int64      `json:"firstScanId,omitempty"`
+	LastScanID  int64      `json:"lastScanId,omitempty"`
+	ResolvedAt  *time.Time `json:"resolvedAt,omitempty"` // set once the vulnerable software is no longer found
+}
+
+// DeviceAddress represents an address a device has been seen at
+type DeviceAddress struct {
+	Address   string    `json:"address"`
+	Family    string    `json:"family"` // ipv4 or ipv6
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
 }
 
 // DeviceDetails represents a device with its associated ports
 type DeviceDetails struct {
 	Device
-	Ports []*Port `json:"ports"`
+	Ports           []*Port          `json:"ports"`
+	Scripts         []*ScriptResult  `json:"scripts,omitempty"`         // host script results
+	Vulnerabilities []*Vulnerability `json:"vulnerabilities,omitempty"` // unresolved findings
 }
 
 // Port represents a network port on a device
 type Port struct {
-	ID             int64     `json:"id"`
-	DeviceID       int64     `json:"deviceId"`
-	PortNumber     int       `json:"portNumber"`
-	Protocol       string    `json:"protocol"`
-	ServiceName    string    `json:"serviceName"`
-	ServiceVersion string    `json:"serviceVersion"`
-	FirstSeen      time.Time `json:"firstSeen"`
-	LastSeen       time.Time `json:"lastSeen"`
+	ID             int64           `json:"id"`
+	DeviceID       int64           `json:"deviceId"`
+	PortNumber     int             `json:"portNumber"`
+	Protocol       string          `json:"protocol"`
+	ServiceName    string          `json:"serviceName"`
+	ServiceVersion string          `json:"serviceVersion"`
+	State          string          `json:"state"`            // open, open|filtered, filtered, or closed once missed by enough scans
+	Reason         string          `json:"reason,omitempty"` // nmap's reason for the state, e.g. syn-ack, udp-response
+	CPEs           []string        `json:"cpes,omitempty"`   // CPEs of the service, from version detection
+	FirstSeen      time.Time       `json:"firstSeen"`
+	LastSeen       time.Time       `json:"lastSeen"`
+	Scripts        []*ScriptResult `json:"scripts,omitempty"`
+	Certificate    *Certificate    `json:"certificate,omitempty"` // TLS certificate the service presents
+}
+
+// Certificate represents a TLS certificate presented by the service on a
+// port. A port keeps every certificate it has presented; the current one
+// has no ReplacedAt.
+type Certificate struct {
+	ID                 int64      `json:"id"`
+	DeviceID           int64      `json:"deviceId"`
+	IPAddress          string     `json:"ipAddress,omitempty"` // in listings
+	PortNumber         int        `json:"portNumber"`
+	Protocol           string     `json:"protocol"`
+	Subject            string     `json:"subject"`        // e.g. CN=intranet.example.com,O=Example
+	SANs               []string   `json:"sans,omitempty"` // subject alternative names, e.g. DNS:intranet.example.com, IP:10.0.0.5
+	Issuer             string     `json:"issuer"`
+	NotBefore          time.Time  `json:"notBefore"`
+	NotAfter           time.Time  `json:"notAfter"`
+	KeyType            string     `json:"keyType"` // rsa, ec, ed25519 or dsa
+	KeyBits            int        `json:"keyBits,omitempty"`
+	SignatureAlgorithm string     `json:"signatureAlgorithm"` // e.g. SHA256-RSA
+	SHA256Fingerprint  string     `json:"sha256Fingerprint"`  // of the DER encoding, in lower case hex
+	SelfSigned         bool       `json:"selfSigned,omitempty"`
+	FirstSeen          time.Time  `json:"firstSeen"`
+	LastSeen           time.Time  `json:"lastSeen"`
+	FirstScanID        int64      `json:"firstScanId,omitempty"`
+	LastScanID         int64      `json:"lastScanId,omitempty"`
+	ReplacedAt         *time.Time `json:"replacedAt,omitempty"` // set once the port presents another certificate
+}
+
+// ScriptResult represents the latest output of an NSE script for a host or
+// one of its ports
+type ScriptResult struct {
+	ID         int64           `json:"id"`
+	DeviceID   int64           `json:"deviceId"`
+	IPAddress  string          `json:"ipAddress,omitempty"` // in search results
+	PortID     int64           `json:"portId,omitempty"`
+	PortNumber int             `json:"portNumber,omitempty"`
+	Protocol   string          `json:"protocol,omitempty"`
+	ScanID     int64           `json:"scanId,omitempty"`
+	ScriptID   string          `json:"scriptId"`
+	Output     string          `json:"output"`
+	Data       json.RawMessage `json:"data,omitempty"` // structured output from <elem> and <table>
+	FirstSeen  time.Time       `json:"firstSeen"`
+	LastSeen   time.Time       `json:"lastSeen"`
+}
+
+// HostObservation represents what one scan found on a host
+type HostObservation struct {
+	ScanID        int64              `json:"scanId"`
+	DeviceID      int64              `json:"deviceId"`
+	IPAddress     string             `json:"ipAddress"`
+	MACAddress    string             `json:"macAddress,omitempty"`
+	Hostname      string             `json:"hostname,omitempty"`
+	OSFingerprint string             `json:"osFingerprint,omitempty"`
+	ObservedAt    time.Time          `json:"observedAt"`
+	Ports         []*PortObservation `json:"ports"`
+}
+
+// PortObservation represents the state one scan found a port in
+type PortObservation struct {
+	PortNumber     int    `json:"portNumber"`
+	Protocol       string `json:"protocol"`
+	State          string `json:"state"`
+	Reason         string `json:"reason,omitempty"`
+	ServiceName    string `json:"serviceName,omitempty"`
+	ServiceVersion string `json:"serviceVersion,omitempty"`
+}
+
+// ScanDiff represents the differences between what two scans found
+type ScanDiff struct {
+	FromScanID int64            `json:"fromScanId"`
+	ToScanID   int64            `json:"toScanId"`
+	Summary    map[string]int   `json:"summary"` // number of changes of each type
+	Changes    []*ScanDiffEntry `json:"changes"`
+}
+
+// ScanDiffEntry represents one difference between two scans
+type ScanDiffEntry struct {
+	Type       string `json:"type"` // host_added, host_removed, port_opened, port_closed, port_state_changed, service_changed, version_changed, os_changed
+	DeviceID   int64  `json:"deviceId"`
+	IPAddress  string `json:"ipAddress"`
+	PortNumber int    `json:"portNumber,omitempty"`
+	Protocol   string `json:"protocol,omitempty"`
+	Before     string `json:"before,omitempty"`
+	After      string `json:"after,omitempty"`
 }
 
 // Scan represents a network scan operation
@@ -43,16 +195,29 @@ type Scan struct {
 	Duration     int       `json:"duration"`
 	DevicesFound int       `json:"devicesFound"`
 	PortsFound   int       `json:"portsFound"`
-	Status       string    `json:"status"` // running, completed, error
+	Status       string    `json:"status"` // running, completed, error, cancelled
+	Source       string    `json:"source,omitempty"` // scan, import
 	ErrorMessage string    `json:"errorMessage,omitempty"`
+	Progress     *ScanProgress `json:"progress,omitempty"`
+	Exclusions   []string  `json:"exclusions,omitempty"`
+}
+
+// ScanProgress represents the progress nmap last reported for a scan
+type ScanProgress struct {
+	Percent        float64    `json:"percent"`
+	Phase          string     `json:"phase,omitempty"`
+	ETA            *time.Time `json:"eta,omitempty"`
+	HostsCompleted int        `json:"hostsCompleted"`
+	HostsUp        int        `json:"hostsUp"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
 }
 
 // Change represents a detected change in the network
 type Change struct {
 	ID         int64     `json:"id"`
-	ScanID     int64     `json:"scanId"`
+	ScanID     int64     `json:"scanId,omitempty"` // zero for changes made outside a scan
 	DeviceID   int64     `json:"deviceId"`
-	ChangeType string    `json:"changeType"` // new_device, device_change, new_port, port_change, etc.
+	ChangeType string    `json:"changeType"` // new_device, device_change, ip_changed, device_merged, device_split, new_port, port_change, port_state_change, port_closed, device_offline, device_returned, etc.
 	Details    string    `json:"details"`
 	Timestamp  time.Time `json:"timestamp"`
 }
@@ -64,6 +229,103 @@ type ScanParameters struct {
 	RateLimit     int    `json:"rateLimit,omitempty"`
 	ScanAllPorts  bool   `json:"scanAllPorts,omitempty"`
 	DisablePing   bool   `json:"disablePing,omitempty"`
+	Site          string `json:"site,omitempty"`
+
+	// Protocols replaces the template's scan technique with a scan of each
+	// protocol: tcp, udp or sctp
+	Protocols []string `json:"protocols,omitempty"`
+}
+
+// Exclusion represents a host or network that must never be scanned
+type Exclusion struct {
+	ID        int64      `json:"id,omitempty"`
+	Target    string     `json:"target"`
+	Reason    string     `json:"reason"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Source    string     `json:"source,omitempty"` // config, database
+}
+
+// Schedule represents a recurring scan
+type Schedule struct {
+	Name          string           `json:"name"`
+	Cron          string           `json:"cron"`
+	Template      string           `json:"template"`
+	TargetNetwork string           `json:"targetNetwork,omitempty"`
+	Site          string           `json:"site,omitempty"`
+	Jitter        string           `json:"jitter,omitempty"`
+	Blackouts     []BlackoutWindow `json:"blackouts,omitempty"`
+	Enabled       bool             `json:"enabled"`
+	Source        string           `json:"source,omitempty"` // config, database
+	NextRun       *time.Time       `json:"nextRun,omitempty"`
+	LastRun       *ScheduleRun     `json:"lastRun,omitempty"`
+}
+
+// BlackoutWindow represents a daily period during which a schedule must not run
+type BlackoutWindow struct {
+	Start string   `json:"start"` // HH:MM
+	End   string   `json:"end"`   // HH:MM
+	Days  []string `json:"days,omitempty"`
+}
+
+// ScheduleRun represents one occurrence of a schedule
+type ScheduleRun struct {
+	ID          int64     `json:"id"`
+	Schedule    string    `json:"schedule"`
+	ScheduledAt time.Time `json:"scheduledAt"`
+	RunAt       time.Time `json:"runAt"`
+	Status      string    `json:"status"` // queued, skipped, error
+	JobID       int64     `json:"jobId,omitempty"`
+	Message     string    `json:"message,omitempty"`
+}
+
+// MaintenanceRun represents one run of a database maintenance task
+type MaintenanceRun struct {
+	ID          int64     `json:"id"`
+	Task        string    `json:"task"` // backup, optimize, cleanup_data, cleanup_output
+	ScheduledAt time.Time `json:"scheduledAt"`
+	StartedAt   time.Time `json:"startedAt"`
+	FinishedAt  time.Time `json:"finishedAt"`
+	Status      string    `json:"status"` // completed, error
+	Details     string    `json:"details,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// AuditEntry represents a recorded decision on a scan request
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"` // scan_authorized, scan_rejected
+	Actor     string    `json:"actor"`
+	Target    string    `json:"target"`
+	Site      string    `json:"site,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// ScanRequest represents a request to queue a scan. Priority defaults to that
+// of manual scans and may not exceed it. Label is free text from the client,
+// such as a ticket or the person asking; it is stored with the job but never
+// used as the requester.
+type ScanRequest struct {
+	ScanParameters
+	Priority *int   `json:"priority,omitempty"`
+	Label    string `json:"label,omitempty"`
+}
+
+// ScanJob represents a queued scan request
+type ScanJob struct {
+	ID          int64          `json:"id"`
+	Priority    int            `json:"priority"`
+	Parameters  ScanParameters `json:"parameters"`
+	RequestedBy string         `json:"requestedBy"`
+	Label       string         `json:"label,omitempty"`
+	Status      string         `json:"status"` // queued, running, completed, error, cancelled
+	ScanID      int64          `json:"scanId,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	Position    int            `json:"position,omitempty"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	StartedAt   *time.Time     `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time     `json:"finishedAt,omitempty"`
 }
 
 // SystemStatus represents the overall system status
@@ -133,6 +395,7 @@ type ScanTemplate struct {
 	Description string   `json:"description"`
 	NmapArgs    []string `json:"nmapArgs"`
 	RateLimit   int      `json:"rateLimit"`
+	Source      string   `json:"source,omitempty"` // builtin, config, database
 }
 
 // NetworkStats represents network statistics
@@ -144,6 +407,10 @@ type NetworkStats struct {
 	ServiceDistribution map[string]int   `json:"serviceDistribution"`
 	NewDevices         int               `json:"newDevices"`
 	ChangedDevices     int               `json:"changedDevices"`
+	ClosedPorts        int               `json:"closedPorts"`
+	OfflineDevices     int               `json:"offlineDevices"`
+	VendorDistribution map[string]int    `json:"vendorDistribution"`
+	RandomizedMACs     int               `json:"randomizedMacs"`
 	ActiveVulnerabilities int            `json:"activeVulnerabilities"`
 }
 
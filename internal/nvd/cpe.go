@@ -0,0 +1,174 @@
+package nvd
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CPE is the part of a CPE name used for matching
+type CPE struct {
+	Part    string // a (application), o (operating system) or h (hardware)
+	Vendor  string
+	Product string
+	Version string // empty, * or - if not known
+}
+
+// ParseCPE parses a CPE name in either the 2.3 formatted string binding
+// (cpe:2.3:a:openbsd:openssh:7.4:...) used by NVD feeds or the 2.2 URI
+// binding (cpe:/a:openbsd:openssh:7.4) reported by nmap. It returns false
+// for anything else.
+func ParseCPE(name string) (CPE, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	var fields []string
+	switch {
+	case strings.HasPrefix(name, "cpe:2.3:"):
+		fields = splitFormatted(strings.TrimPrefix(name, "cpe:2.3:"))
+	case strings.HasPrefix(name, "cpe:/"):
+		fields = strings.Split(strings.TrimPrefix(name, "cpe:/"), ":")
+		for i, field := range fields {
+			fields[i] = strings.ReplaceAll(field, "%2f", "/")
+		}
+	default:
+		return CPE{}, false
+	}
+
+	if len(fields) < 3 || fields[0] == "" || fields[1] == "" || fields[2] == "" {
+		return CPE{}, false
+	}
+	cpe := CPE{Part: fields[0], Vendor: fields[1], Product: fields[2]}
+	if len(fields) > 3 {
+		cpe.Version = fields[3]
+	}
+	return cpe, true
+}
+
+// splitFormatted splits the fields of a 2.3 formatted string, which may
+// contain backslash-escaped colons, and unescapes them
+func splitFormatted(s string) []string {
+	var fields []string
+	var field strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			field.WriteByte(s[i])
+		case s[i] == ':':
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteByte(s[i])
+		}
+	}
+	return append(fields, field.String())
+}
+
+// anyVersion reports whether a CPE version matches every version
+func anyVersion(version string) bool {
+	return version == "" || version == "*" || version == "-"
+}
+
+// Matches reports whether software identified by a CPE is affected. The
+// part, vendor and product must be the same. If the match gives a range of
+// versions, the version must be known and fall within it; otherwise the
+// match's version, unless it is a wildcard, must be the same.
+func (m *Match) Matches(cpe CPE) bool {
+	criteria, ok := ParseCPE(m.CPE)
+	if !ok || criteria.Part != cpe.Part || criteria.Vendor != cpe.Vendor || criteria.Product != cpe.Product {
+		return false
+	}
+
+	if !m.hasRange() {
+		return anyVersion(criteria.Version) || criteria.Version == cpe.Version
+	}
+
+	// A version such as "7" from an OS class is too coarse to place within a
+	// range such as 7.4 to 7.9
+	version := cpe.Version
+	if anyVersion(version) {
+		return false
+	}
+	inRange := func(bound string, ok func(int) bool) bool {
+		if bound == "" {
+			return true
+		}
+		if len(versionSegments(version)) < len(versionSegments(bound)) {
+			return false
+		}
+		return ok(CompareVersions(version, bound))
+	}
+	return inRange(m.VersionStartIncluding, func(c int) bool { return c >= 0 }) &&
+		inRange(m.VersionStartExcluding, func(c int) bool { return c > 0 }) &&
+		inRange(m.VersionEndIncluding, func(c int) bool { return c <= 0 }) &&
+		inRange(m.VersionEndExcluding, func(c int) bool { return c < 0 })
+}
+
+// hasRange reports whether the match gives a range of versions
+func (m *Match) hasRange() bool {
+	return m.VersionStartIncluding != "" || m.VersionStartExcluding != "" ||
+		m.VersionEndIncluding != "" || m.VersionEndExcluding != ""
+}
+
+// CompareVersions compares two version strings, returning -1, 0 or 1.
+// Versions are split into segments at dots, dashes, underscores and changes
+// between digits and letters, so 7.4p1 is 7, 4, p, 1. Numeric segments
+// compare as numbers and sort before letters; a version that is a prefix
+// of another sorts first.
+func CompareVersions(a, b string) int {
+	as, bs := versionSegments(a), versionSegments(b)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := compareSegments(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// versionSegments splits a version into its segments
+func versionSegments(version string) []string {
+	var segments []string
+	start := -1
+	digits := false
+	for i := 0; i <= len(version); i++ {
+		var c byte
+		if i < len(version) {
+			c = version[i]
+		}
+		isDigit := c >= '0' && c <= '9'
+		isAlnum := isDigit || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if start >= 0 && (!isAlnum || isDigit != digits) {
+			segments = append(segments, strings.ToLower(version[start:i]))
+			start = -1
+		}
+		if isAlnum && start < 0 {
+			start, digits = i, isDigit
+		}
+	}
+	return segments
+}
+
+// compareSegments compares two version segments
+func compareSegments(a, b string) int {
+	an, aErr := strconv.ParseUint(a, 10, 64)
+	bn, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		if an < bn {
+			return -1
+		} else if an > bn {
+			return 1
+		}
+		return 0
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,275 @@
+// Package nvd reads vulnerability feeds published by the National
+// Vulnerability Database and matches the CPEs of scanned software against
+// them. Feeds are read from local files, in the JSON format of the NVD's 2.0
+// API or of its older 1.1 data feeds, so no network access is needed.
+package nvd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrInvalidFeed is returned when a file is not an NVD JSON feed
+var ErrInvalidFeed = errors.New("invalid NVD feed")
+
+// CVE is a vulnerability and the CPEs it affects
+type CVE struct {
+	ID          string
+	Description string
+	CVSS        float64 // base score of the newest CVSS version reported
+	Severity    string  // e.g. CRITICAL, HIGH, MEDIUM, LOW
+	Published   time.Time
+	Matches     []*Match
+}
+
+// Match is a vulnerable CPE, or range of versions of one, from the
+// configurations of a CVE. Empty bounds leave the range open at that end.
+type Match struct {
+	CPE                   string `json:"cpe"`
+	VersionStartIncluding string `json:"versionStartIncluding,omitempty"`
+	VersionStartExcluding string `json:"versionStartExcluding,omitempty"`
+	VersionEndIncluding   string `json:"versionEndIncluding,omitempty"`
+	VersionEndExcluding   string `json:"versionEndExcluding,omitempty"`
+}
+
+// feed covers both the 2.0 API format and the 1.1 data feed format
+type feed struct {
+	Vulnerabilities []struct {
+		CVE apiCVE `json:"cve"`
+	} `json:"vulnerabilities"`
+	CVEItems []legacyItem `json:"CVE_Items"`
+}
+
+type description struct {
+	Lang  string `json:"lang"`
+	Value string `json:"value"`
+}
+
+type cpeMatch struct {
+	Vulnerable            bool   `json:"vulnerable"`
+	Criteria              string `json:"criteria"` // 2.0 API
+	CPE23URI              string `json:"cpe23Uri"` // 1.1 data feeds
+	VersionStartIncluding string `json:"versionStartIncluding"`
+	VersionStartExcluding string `json:"versionStartExcluding"`
+	VersionEndIncluding   string `json:"versionEndIncluding"`
+	VersionEndExcluding   string `json:"versionEndExcluding"`
+}
+
+type node struct {
+	Negate         bool       `json:"negate"`
+	CPEMatch       []cpeMatch `json:"cpeMatch"`  // 2.0 API
+	CPEMatchLegacy []cpeMatch `json:"cpe_match"` // 1.1 data feeds
+	Children       []node     `json:"children"`
+}
+
+type apiMetric struct {
+	Type     string `json:"type"` // Primary or Secondary
+	CVSSData struct {
+		BaseScore    float64 `json:"baseScore"`
+		BaseSeverity string  `json:"baseSeverity"`
+	} `json:"cvssData"`
+	BaseSeverity string `json:"baseSeverity"` // CVSS v2 reports its severity here
+}
+
+type apiCVE struct {
+	ID           string        `json:"id"`
+	Published    string        `json:"published"`
+	Descriptions []description `json:"descriptions"`
+	Metrics      struct {
+		V31 []apiMetric `json:"cvssMetricV31"`
+		V30 []apiMetric `json:"cvssMetricV30"`
+		V2  []apiMetric `json:"cvssMetricV2"`
+	} `json:"metrics"`
+	Configurations []struct {
+		Nodes []node `json:"nodes"`
+	} `json:"configurations"`
+}
+
+type legacyItem struct {
+	CVE struct {
+		Meta struct {
+			ID string `json:"ID"`
+		} `json:"CVE_data_meta"`
+		Description struct {
+			Data []description `json:"description_data"`
+		} `json:"description"`
+	} `json:"cve"`
+	Configurations struct {
+		Nodes []node `json:"nodes"`
+	} `json:"configurations"`
+	Impact struct {
+		V3 struct {
+			CVSS struct {
+				BaseScore    float64 `json:"baseScore"`
+				BaseSeverity string  `json:"baseSeverity"`
+			} `json:"cvssV3"`
+		} `json:"baseMetricV3"`
+		V2 struct {
+			CVSS struct {
+				BaseScore float64 `json:"baseScore"`
+			} `json:"cvssV2"`
+			Severity string `json:"severity"`
+		} `json:"baseMetricV2"`
+	} `json:"impact"`
+	PublishedDate string `json:"publishedDate"`
+}
+
+// Parse reads a feed, which may be gzipped, and returns the CVEs in it
+func Parse(r io.Reader) ([]*CVE, error) {
+	br := bufio.NewReader(r)
+	var src io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFeed, err)
+		}
+		defer gz.Close()
+		src = gz
+	}
+
+	var f feed
+	if err := json.NewDecoder(src).Decode(&f); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFeed, err)
+	}
+	if f.Vulnerabilities == nil && f.CVEItems == nil {
+		return nil, fmt.Errorf("%w: no vulnerabilities or CVE_Items", ErrInvalidFeed)
+	}
+
+	cves := make([]*CVE, 0, len(f.Vulnerabilities)+len(f.CVEItems))
+	for _, v := range f.Vulnerabilities {
+		cves = append(cves, v.CVE.convert())
+	}
+	for _, item := range f.CVEItems {
+		cves = append(cves, item.convert())
+	}
+	return cves, nil
+}
+
+// Load reads a feed from a file
+func Load(path string) ([]*CVE, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open NVD feed: %w", err)
+	}
+	defer f.Close()
+
+	cves, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cves, nil
+}
+
+// convert converts a CVE in the 2.0 API format
+func (c *apiCVE) convert() *CVE {
+	cve := &CVE{
+		ID:          c.ID,
+		Description: englishDescription(c.Descriptions),
+		Published:   parseTime(c.Published),
+	}
+
+	for _, metrics := range [][]apiMetric{c.Metrics.V31, c.Metrics.V30, c.Metrics.V2} {
+		if metric := primaryMetric(metrics); metric != nil {
+			cve.CVSS = metric.CVSSData.BaseScore
+			cve.Severity = metric.CVSSData.BaseSeverity
+			if cve.Severity == "" {
+				cve.Severity = metric.BaseSeverity
+			}
+			break
+		}
+	}
+
+	for _, configuration := range c.Configurations {
+		cve.Matches = appendMatches(cve.Matches, configuration.Nodes)
+	}
+	return cve
+}
+
+// convert converts a CVE in the 1.1 data feed format
+func (item *legacyItem) convert() *CVE {
+	cve := &CVE{
+		ID:          item.CVE.Meta.ID,
+		Description: englishDescription(item.CVE.Description.Data),
+		Published:   parseTime(item.PublishedDate),
+		Matches:     appendMatches(nil, item.Configurations.Nodes),
+	}
+
+	if v3 := item.Impact.V3.CVSS; v3.BaseSeverity != "" {
+		cve.CVSS, cve.Severity = v3.BaseScore, v3.BaseSeverity
+	} else if item.Impact.V2.Severity != "" {
+		cve.CVSS, cve.Severity = item.Impact.V2.CVSS.BaseScore, item.Impact.V2.Severity
+	}
+	return cve
+}
+
+// primaryMetric returns the NVD's own metric, or the first one if the NVD
+// has not scored the CVE itself
+func primaryMetric(metrics []apiMetric) *apiMetric {
+	for i := range metrics {
+		if metrics[i].Type == "Primary" {
+			return &metrics[i]
+		}
+	}
+	if len(metrics) > 0 {
+		return &metrics[0]
+	}
+	return nil
+}
+
+// appendMatches collects the vulnerable CPEs of configuration nodes and
+// their children. The platforms a vulnerable CPE must run on to be affected
+// are not considered, nor are negated nodes.
+func appendMatches(matches []*Match, nodes []node) []*Match {
+	for _, n := range nodes {
+		if n.Negate {
+			continue
+		}
+		for _, m := range append(n.CPEMatch, n.CPEMatchLegacy...) {
+			cpe := m.Criteria
+			if cpe == "" {
+				cpe = m.CPE23URI
+			}
+			if !m.Vulnerable || cpe == "" {
+				continue
+			}
+			matches = append(matches, &Match{
+				CPE:                   cpe,
+				VersionStartIncluding: m.VersionStartIncluding,
+				VersionStartExcluding: m.VersionStartExcluding,
+				VersionEndIncluding:   m.VersionEndIncluding,
+				VersionEndExcluding:   m.VersionEndExcluding,
+			})
+		}
+		matches = appendMatches(matches, n.Children)
+	}
+	return matches
+}
+
+// englishDescription returns the English description of a CVE
+func englishDescription(descriptions []description) string {
+	for _, d := range descriptions {
+		if d.Lang == "en" {
+			return d.Value
+		}
+	}
+	if len(descriptions) > 0 {
+		return descriptions[0].Value
+	}
+	return ""
+}
+
+// parseTime parses the publication times of either feed format
+func parseTime(value string) time.Time {
+	for _, layout := range []string{"2006-01-02T15:04:05.000", "2006-01-02T15:04:05", "2006-01-02T15:04Z", time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,202 @@
+package nvd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const apiFeed = `{
+  "resultsPerPage": 1,
+  "format": "NVD_CVE",
+  "version": "2.0",
+  "vulnerabilities": [{
+    "cve": {
+      "id": "CVE-2023-38408",
+      "published": "2023-07-20T03:15:10.170",
+      "descriptions": [
+        {"lang": "es", "value": "La función PKCS#11..."},
+        {"lang": "en", "value": "The PKCS#11 feature in ssh-agent in OpenSSH before 9.3p2 has an insufficiently trustworthy search path."}
+      ],
+      "metrics": {
+        "cvssMetricV31": [
+          {"source": "cna@example.com", "type": "Secondary", "cvssData": {"version": "3.1", "baseScore": 7.5, "baseSeverity": "HIGH"}},
+          {"source": "nvd@nist.gov", "type": "Primary", "cvssData": {"version": "3.1", "baseScore": 9.8, "baseSeverity": "CRITICAL"}}
+        ]
+      },
+      "configurations": [{
+        "nodes": [{
+          "operator": "OR", "negate": false,
+          "cpeMatch": [
+            {"vulnerable": true, "criteria": "cpe:2.3:a:openbsd:openssh:*:*:*:*:*:*:*:*", "versionEndExcluding": "9.3", "matchCriteriaId": "1"},
+            {"vulnerable": true, "criteria": "cpe:2.3:a:openbsd:openssh:9.3:-:*:*:*:*:*:*", "matchCriteriaId": "2"},
+            {"vulnerable": false, "criteria": "cpe:2.3:o:linux:linux_kernel:-:*:*:*:*:*:*:*", "matchCriteriaId": "3"}
+          ]
+        }]
+      }]
+    }
+  }]
+}`
+
+const legacyFeed = `{
+  "CVE_data_type": "CVE",
+  "CVE_Items": [{
+    "cve": {
+      "CVE_data_meta": {"ID": "CVE-2017-15906"},
+      "description": {"description_data": [{"lang": "en", "value": "The process_open function in sftp-server.c in OpenSSH before 7.6 does not properly prevent write operations in readonly mode."}]}
+    },
+    "configurations": {
+      "nodes": [{
+        "operator": "AND",
+        "children": [{
+          "operator": "OR",
+          "cpe_match": [{"vulnerable": true, "cpe23Uri": "cpe:2.3:a:openbsd:openssh:*:*:*:*:*:*:*:*", "versionEndIncluding": "7.5"}]
+        }]
+      }]
+    },
+    "impact": {
+      "baseMetricV2": {"cvssV2": {"baseScore": 5.0}, "severity": "MEDIUM"}
+    },
+    "publishedDate": "2017-10-26T03:29Z"
+  }]
+}`
+
+// TestParse tests reading both feed formats
+func TestParse(t *testing.T) {
+	cves, err := Parse(strings.NewReader(apiFeed))
+	if err != nil {
+		t.Fatalf("Failed to parse API feed: %v", err)
+	}
+	if len(cves) != 1 {
+		t.Fatalf("Expected 1 CVE, got %d", len(cves))
+	}
+	cve := cves[0]
+	if cve.ID != "CVE-2023-38408" || cve.CVSS != 9.8 || cve.Severity != "CRITICAL" {
+		t.Errorf("Expected the NVD's own score, got %+v", cve)
+	}
+	if !strings.HasPrefix(cve.Description, "The PKCS#11 feature") {
+		t.Errorf("Expected the English description, got %q", cve.Description)
+	}
+	if cve.Published.Year() != 2023 {
+		t.Errorf("Unexpected publication time: %v", cve.Published)
+	}
+	if len(cve.Matches) != 2 || cve.Matches[0].VersionEndExcluding != "9.3" {
+		t.Errorf("Expected the 2 vulnerable CPEs, got %+v", cve.Matches)
+	}
+
+	// Legacy feeds, gzipped as the NVD published them
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(legacyFeed))
+	gz.Close()
+
+	cves, err = Parse(&buf)
+	if err != nil {
+		t.Fatalf("Failed to parse legacy feed: %v", err)
+	}
+	if len(cves) != 1 {
+		t.Fatalf("Expected 1 CVE, got %d", len(cves))
+	}
+	cve = cves[0]
+	if cve.ID != "CVE-2017-15906" || cve.CVSS != 5.0 || cve.Severity != "MEDIUM" || cve.Published.Year() != 2017 {
+		t.Errorf("Unexpected CVE: %+v", cve)
+	}
+	if len(cve.Matches) != 1 || cve.Matches[0].VersionEndIncluding != "7.5" {
+		t.Errorf("Expected the CPE of the child node, got %+v", cve.Matches)
+	}
+
+	for _, invalid := range []string{`not json`, `{"results": []}`} {
+		if _, err := Parse(strings.NewReader(invalid)); !errors.Is(err, ErrInvalidFeed) {
+			t.Errorf("Expected ErrInvalidFeed for %q, got %v", invalid, err)
+		}
+	}
+}
+
+// TestParseCPE tests parsing both CPE bindings
+func TestParseCPE(t *testing.T) {
+	tests := []struct {
+		name string
+		want CPE
+		ok   bool
+	}{
+		{"cpe:/a:openbsd:openssh:7.4", CPE{"a", "openbsd", "openssh", "7.4"}, true},
+		{"cpe:/o:linux:linux_kernel", CPE{"o", "linux", "linux_kernel", ""}, true},
+		{"cpe:2.3:a:Apache:HTTP_Server:2.4.49:*:*:*:*:*:*:*", CPE{"a", "apache", "http_server", "2.4.49"}, true},
+		{`cpe:2.3:a:example:one\:two:1.0:*:*:*:*:*:*:*`, CPE{"a", "example", "one:two", "1.0"}, true},
+		{"cpe:/a:openbsd", CPE{}, false},
+		{"openssh 7.4", CPE{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseCPE(tt.name)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ParseCPE(%q) = %+v, %v; expected %+v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// TestMatches tests matching CPEs against exact versions and version ranges
+func TestMatches(t *testing.T) {
+	before93 := &Match{CPE: "cpe:2.3:a:openbsd:openssh:*:*:*:*:*:*:*:*", VersionEndExcluding: "9.3"}
+	between := &Match{CPE: "cpe:2.3:a:apache:http_server:*:*:*:*:*:*:*:*", VersionStartIncluding: "2.4.0", VersionEndIncluding: "2.4.49"}
+	exact := &Match{CPE: "cpe:2.3:a:apache:http_server:2.4.50:*:*:*:*:*:*:*"}
+	anyKernel := &Match{CPE: "cpe:2.3:o:linux:linux_kernel:*:*:*:*:*:*:*:*"}
+
+	tests := []struct {
+		match *Match
+		cpe   string
+		want  bool
+	}{
+		{before93, "cpe:/a:openbsd:openssh:7.4", true},
+		{before93, "cpe:/a:openbsd:openssh:9.2p1", true},
+		{before93, "cpe:/a:openbsd:openssh:9.3", false},
+		{before93, "cpe:/a:openbsd:openssh:9.10", false},
+		{before93, "cpe:/a:openbsd:openssh", false},   // version unknown
+		{before93, "cpe:/a:openbsd:openssh:8", false}, // too coarse for the range
+		{before93, "cpe:/a:example:openssh:7.4", false},
+		{between, "cpe:/a:apache:http_server:2.4.49", true},
+		{between, "cpe:/a:apache:http_server:2.4.50", false},
+		{between, "cpe:/a:apache:http_server:2.2.34", false},
+		{exact, "cpe:/a:apache:http_server:2.4.50", true},
+		{exact, "cpe:/a:apache:http_server:2.4.51", false},
+		{anyKernel, "cpe:/o:linux:linux_kernel:4", true},
+		{anyKernel, "cpe:/a:linux:linux_kernel:4", false},
+	}
+
+	for _, tt := range tests {
+		cpe, ok := ParseCPE(tt.cpe)
+		if !ok {
+			t.Fatalf("Failed to parse %q", tt.cpe)
+		}
+		if got := tt.match.Matches(cpe); got != tt.want {
+			t.Errorf("%+v matching %q = %v, expected %v", tt.match, tt.cpe, got, tt.want)
+		}
+	}
+}
+
+// TestCompareVersions tests ordering version strings
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.10", "1.9", 1},
+		{"7.4", "7.4p1", -1},
+		{"7.4p1", "7.4p2", -1},
+		{"2.4.49", "2.4.5", 1},
+		{"1.0-beta", "1.0.1", 1},
+		{"1.1.1k", "1.1.1w", -1},
+	}
+
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, expected %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := CompareVersions(tt.b, tt.a); got != -tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, expected %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
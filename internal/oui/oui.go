@@ -0,0 +1,201 @@
+// Package oui looks up the manufacturer of network hardware from the IEEE
+// Organizationally Unique Identifier that starts its MAC address. A small
+// registry of common vendors is built in; the full registry can be loaded
+// from a local copy of the IEEE's oui.csv or oui.txt, or from nmap's
+// nmap-mac-prefixes, so no network access is needed.
+package oui
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+//go:embed oui.csv
+var builtin []byte
+
+// Prefix lengths in hex digits of the IEEE's large (MA-L), medium (MA-M) and
+// small (MA-S) assignments, longest first
+var prefixLengths = []int{9, 7, 6}
+
+var (
+	// txtLine matches an assignment in oui.txt, e.g. "00-00-0C   (hex)		Cisco Systems, Inc"
+	txtLine = regexp.MustCompile(`^([0-9A-Fa-f]{2})-([0-9A-Fa-f]{2})-([0-9A-Fa-f]{2})\s+\(hex\)\s+(.+)$`)
+
+	// prefixLine matches an assignment in nmap-mac-prefixes, e.g. "00000C Cisco Systems"
+	prefixLine = regexp.MustCompile(`^([0-9A-Fa-f]{6}|[0-9A-Fa-f]{7}|[0-9A-Fa-f]{9})\s+(.+)$`)
+)
+
+// Registry maps MAC address prefixes to the organizations they are assigned to
+type Registry struct {
+	vendors map[string]string
+}
+
+// Parse reads a registry in any of the supported formats: the IEEE's CSV
+// export, its oui.txt listing, or nmap-mac-prefixes. Lines that are not
+// assignments are skipped.
+func Parse(r io.Reader) (*Registry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OUI registry: %w", err)
+	}
+
+	registry := &Registry{vendors: make(map[string]string)}
+	if bytes.HasPrefix(bytes.TrimLeft(data, "\ufeff"), []byte("Registry,")) {
+		err = registry.parseCSV(data)
+	} else {
+		err = registry.parseText(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(registry.vendors) == 0 {
+		return nil, fmt.Errorf("no OUI assignments found")
+	}
+	return registry, nil
+}
+
+// parseCSV reads the IEEE's CSV export: Registry,Assignment,Organization Name,...
+func (r *Registry) parseCSV(data []byte) error {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	if _, err := reader.Read(); err != nil {
+		return fmt.Errorf("failed to read OUI registry header: %w", err)
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read OUI registry: %w", err)
+		}
+		if len(record) >= 3 {
+			r.add(record[1], record[2])
+		}
+	}
+}
+
+// parseText reads oui.txt or nmap-mac-prefixes
+func (r *Registry) parseText(data []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.Contains(line, "(base 16)") {
+			// oui.txt repeats each assignment without hyphens
+			continue
+		}
+		if match := txtLine.FindStringSubmatch(line); match != nil {
+			r.add(match[1]+match[2]+match[3], match[4])
+		} else if match := prefixLine.FindStringSubmatch(line); match != nil {
+			r.add(match[1], match[2])
+		}
+	}
+	return scanner.Err()
+}
+
+// add records an assignment, ignoring malformed ones
+func (r *Registry) add(prefix, organization string) {
+	prefix = strings.ToUpper(strings.TrimSpace(prefix))
+	organization = strings.TrimSpace(organization)
+	if organization == "" {
+		return
+	}
+	for _, length := range prefixLengths {
+		if len(prefix) == length && isHex(prefix) {
+			r.vendors[prefix] = organization
+			return
+		}
+	}
+}
+
+// Load reads a registry from a file
+func Load(path string) (*Registry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open OUI registry: %w", err)
+	}
+	defer f.Close()
+
+	registry, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return registry, nil
+}
+
+var (
+	builtinOnce     sync.Once
+	builtinRegistry *Registry
+)
+
+// Builtin returns the registry of common vendors built into the binary
+func Builtin() *Registry {
+	builtinOnce.Do(func() {
+		registry, err := Parse(bytes.NewReader(builtin))
+		if err != nil {
+			panic(fmt.Sprintf("invalid built-in OUI registry: %v", err))
+		}
+		builtinRegistry = registry
+	})
+	return builtinRegistry
+}
+
+// Len returns the number of assignments in the registry
+func (r *Registry) Len() int {
+	return len(r.vendors)
+}
+
+// Lookup returns the organization a MAC address was assigned to, using the
+// longest matching prefix, or "" if it is unknown. Locally administered
+// addresses are not assigned by the IEEE and are never found.
+func (r *Registry) Lookup(mac string) string {
+	digits, ok := hexDigits(mac)
+	if !ok || isLocal(digits) {
+		return ""
+	}
+	for _, length := range prefixLengths {
+		if vendor, ok := r.vendors[digits[:length]]; ok {
+			return vendor
+		}
+	}
+	return ""
+}
+
+// IsLocallyAdministered reports whether a MAC address was set locally rather
+// than assigned by a manufacturer. Phones and laptops that randomize their
+// MAC address for privacy use such addresses.
+func IsLocallyAdministered(mac string) bool {
+	digits, ok := hexDigits(mac)
+	return ok && isLocal(digits)
+}
+
+// isLocal reports whether the locally administered bit of the first octet is
+// set in a MAC address given as hex digits
+func isLocal(digits string) bool {
+	return strings.ContainsRune("2367ABEF", rune(digits[1]))
+}
+
+// hexDigits returns the 12 hex digits of a MAC address written with colons,
+// hyphens, dots or no separators, in upper case
+func hexDigits(mac string) (string, bool) {
+	digits := strings.ToUpper(strings.NewReplacer(":", "", "-", "", ".", "").Replace(strings.TrimSpace(mac)))
+	if len(digits) != 12 || !isHex(digits) {
+		return "", false
+	}
+	return digits, true
+}
+
+// isHex reports whether a string holds only upper case hex digits
+func isHex(s string) bool {
+	return strings.Trim(s, "0123456789ABCDEF") == ""
+}
@@ -0,0 +1,123 @@
+package oui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParse tests reading each supported registry format
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "IEEE CSV",
+			data: "\ufeffRegistry,Assignment,Organization Name,Organization Address\n" +
+				"MA-L,00000C,\"Cisco Systems, Inc\",170 West Tasman Drive San Jose CA US 95134\n" +
+				"MA-M,0050C2123,Example Medium,Somewhere\n",
+		},
+		{
+			name: "IEEE text",
+			data: "OUI/MA-L                                                    Organization\n" +
+				"company_id                                                  Organization\n\n" +
+				"00-00-0C   (hex)\t\tCisco Systems, Inc\n" +
+				"00000C     (base 16)\t\tCisco Systems, Inc\n" +
+				"\t\t\t\t170 West Tasman Drive\n",
+		},
+		{
+			name: "nmap-mac-prefixes",
+			data: "# $Id$ generated\n000000 Xerox\n00000C Cisco Systems, Inc\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, err := Parse(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("Failed to parse registry: %v", err)
+			}
+			if vendor := registry.Lookup("00:00:0c:12:34:56"); vendor != "Cisco Systems, Inc" {
+				t.Errorf("Expected Cisco Systems, Inc, got %q", vendor)
+			}
+		})
+	}
+
+	if _, err := Parse(strings.NewReader("nothing to see here\n")); err == nil {
+		t.Errorf("Expected a registry without assignments to be rejected")
+	}
+}
+
+// TestLookup tests matching MAC addresses written in any notation against the
+// longest assigned prefix
+func TestLookup(t *testing.T) {
+	registry, err := Parse(strings.NewReader("0050C2 IEEE Registration Authority\n0050C2123 Example Small\n3C5AB4 Google\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse registry: %v", err)
+	}
+
+	tests := []struct {
+		mac  string
+		want string
+	}{
+		{"00:50:C2:12:34:56", "Example Small"},
+		{"00:50:c2:99:00:01", "IEEE Registration Authority"},
+		{"3c-5a-b4-01-02-03", "Google"},
+		{"3c5a.b401.0203", "Google"},
+		{"AA:BB:CC:DD:EE:FF", ""}, // locally administered
+		{"00:11:22:33:44:55", ""}, // unknown
+		{"not a mac", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := registry.Lookup(tt.mac); got != tt.want {
+			t.Errorf("Lookup(%q) = %q, want %q", tt.mac, got, tt.want)
+		}
+	}
+}
+
+// TestIsLocallyAdministered tests recognizing randomized MAC addresses
+func TestIsLocallyAdministered(t *testing.T) {
+	tests := map[string]bool{
+		"00:11:22:33:44:55": false,
+		"3C:5A:B4:01:02:03": false,
+		"02:00:00:00:00:01": true,
+		"da:a1:19:0b:2c:3d": true,
+		"f6-12-34-56-78-9a": true,
+		"":                  false,
+		"bogus":             false,
+	}
+	for mac, want := range tests {
+		if got := IsLocallyAdministered(mac); got != want {
+			t.Errorf("IsLocallyAdministered(%q) = %v, want %v", mac, got, want)
+		}
+	}
+}
+
+// TestBuiltinAndLoad tests the built-in registry and loading one from a file
+func TestBuiltinAndLoad(t *testing.T) {
+	if Builtin().Len() == 0 {
+		t.Fatalf("Expected the built-in registry to have assignments")
+	}
+	if vendor := Builtin().Lookup("00:00:0C:00:00:01"); vendor == "" {
+		t.Errorf("Expected the built-in registry to know Cisco")
+	}
+
+	path := filepath.Join(t.TempDir(), "nmap-mac-prefixes")
+	if err := os.WriteFile(path, []byte("001122 Example Corp\n"), 0644); err != nil {
+		t.Fatalf("Failed to write registry: %v", err)
+	}
+	registry, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load registry: %v", err)
+	}
+	if registry.Len() != 1 || registry.Lookup("00:11:22:33:44:55") != "Example Corp" {
+		t.Errorf("Unexpected registry loaded from file")
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("Expected loading a missing file to fail")
+	}
+}
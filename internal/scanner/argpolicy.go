@@ -0,0 +1,401 @@
+package scanner
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ArgViolation explains why an nmap argument was rejected
+type ArgViolation struct {
+	Index  int    `json:"index"`
+	Arg    string `json:"arg"`
+	Reason string `json:"reason"`
+}
+
+// String returns a human-readable description of the violation
+func (v ArgViolation) String() string {
+	return fmt.Sprintf("argument %d (%s): %s", v.Index+1, v.Arg, v.Reason)
+}
+
+// nmapArg is a flag parsed from an nmap argument list along with its value
+type nmapArg struct {
+	Flag   string
+	Value  string
+	Tokens []string
+}
+
+// argSpec describes how an allowed nmap flag is used
+type argSpec struct {
+	// value validates the flag's value; flags without one take no value
+	value func(string) error
+
+	// attached allows short flags to take their value in the same
+	// argument, as in -p80 or -T4
+	attached bool
+
+	// portSelection marks flags that choose which ports are scanned
+	portSelection bool
+
+	// scanTechnique marks flags that choose how, and so over which
+	// protocol, ports are scanned
+	scanTechnique bool
+}
+
+var (
+	portListPattern = regexp.MustCompile(`^([TUS]:)?[0-9]*(-[0-9]*)?(,([TUS]:)?[0-9]*(-[0-9]*)?)*$`)
+	durationPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?(ms|s|m|h)?$`)
+	timingNames     = map[string]bool{"paranoid": true, "sneaky": true, "polite": true, "normal": true, "aggressive": true, "insane": true}
+	scriptPattern   = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+
+	// unsafeScriptCategories are NSE categories that attack or may crash hosts
+	unsafeScriptCategories = map[string]bool{"all": true, "brute": true, "dos": true, "exploit": true, "fuzzer": true, "intrusive": true, "malware": true}
+
+	// safeScriptCategories are the NSE categories templates may select
+	safeScriptCategories = map[string]bool{"default": true, "safe": true, "version": true}
+)
+
+// allowedScripts is the NSE scripts templates may select by name. Each is in
+// nmap's safe category and none is also intrusive, so they only gather
+// information. Wildcards are not allowed because a prefix such as http-*
+// also selects brute force and denial of service scripts.
+var allowedScripts = map[string]bool{
+	// General
+	"banner": true,
+
+	// Names and directories
+	"dns-nsid": true, "dns-recursion": true, "nbstat": true, "rpcinfo": true, "nfs-showmount": true,
+
+	// Windows
+	"smb-os-discovery": true, "smb-protocols": true, "smb-security-mode": true,
+	"smb2-security-mode": true, "smb2-time": true, "rdp-ntlm-info": true, "rdp-enum-encryption": true,
+
+	// TLS and SSH
+	"ssl-cert": true, "ssl-date": true, "tls-alpn": true, "tls-nextprotoneg": true,
+	"ssh-hostkey": true, "ssh2-enum-algos": true, "sshv1": true,
+
+	// Web
+	"http-title": true, "http-headers": true, "http-methods": true, "http-server-header": true,
+	"http-robots.txt": true, "http-favicon": true, "http-generator": true, "http-date": true,
+
+	// Mail, file transfer and remote access
+	"ftp-anon": true, "ftp-syst": true, "smtp-commands": true, "imap-capabilities": true,
+	"pop3-capabilities": true, "telnet-encryption": true, "vnc-info": true,
+
+	// Databases and caches
+	"mysql-info": true, "ms-sql-info": true, "mongodb-info": true, "redis-info": true, "memcached-info": true,
+
+	// Network services and devices
+	"snmp-info": true, "snmp-sysdescr": true, "ntp-info": true, "upnp-info": true,
+	"sip-methods": true, "ike-version": true, "cups-info": true,
+}
+
+// allowedArgs is the nmap flags templates may use. Anything else is rejected.
+var allowedArgs = map[string]argSpec{
+	// Scan techniques
+	"-sS": {scanTechnique: true}, "-sT": {scanTechnique: true}, "-sA": {scanTechnique: true},
+	"-sW": {scanTechnique: true}, "-sM": {scanTechnique: true}, "-sN": {scanTechnique: true},
+	"-sF": {scanTechnique: true}, "-sX": {scanTechnique: true}, "-sU": {scanTechnique: true},
+	"-sY": {scanTechnique: true}, "-sZ": {scanTechnique: true}, "-sO": {scanTechnique: true},
+	"-sn": {scanTechnique: true},
+
+	// Address family; IPv6 targets select it automatically
+	"-6": {},
+
+	// Host discovery
+	"-Pn": {}, "-PE": {}, "-PP": {}, "-PM": {}, "-PR": {}, "-n": {}, "-R": {},
+	"-PS":                {value: optional(validatePorts), attached: true},
+	"-PA":                {value: optional(validatePorts), attached: true},
+	"-PU":                {value: optional(validatePorts), attached: true},
+	"-PY":                {value: optional(validatePorts), attached: true},
+	"--disable-arp-ping": {},
+	"--traceroute":       {},
+
+	// Port selection
+	"-p":              {value: validatePorts, attached: true, portSelection: true},
+	"-F":              {portSelection: true},
+	"-r":              {},
+	"--top-ports":     {value: validateInt(1, 65535), portSelection: true},
+	"--port-ratio":    {value: validateRatio, portSelection: true},
+	"--exclude-ports": {value: validatePorts},
+
+	// Service and OS detection
+	"-sV":                 {},
+	"--version-intensity": {value: validateInt(0, 9)},
+	"--version-light":     {},
+	"--version-all":       {},
+	"-O":                  {},
+	"--osscan-limit":      {},
+	"--osscan-guess":      {},
+	"--max-os-tries":      {value: validateInt(1, 50)},
+	"-A":                  {},
+
+	// NSE scripts, by name or category
+	"-sC":              {},
+	"--script":         {value: validateScripts},
+	"--script-timeout": {value: validateDuration},
+
+	// Timing and performance
+	"-T":                     {value: validateTiming, attached: true},
+	"--min-hostgroup":        {value: validateInt(1, 65536)},
+	"--max-hostgroup":        {value: validateInt(1, 65536)},
+	"--min-parallelism":      {value: validateInt(1, 1024)},
+	"--max-parallelism":      {value: validateInt(1, 1024)},
+	"--min-rtt-timeout":      {value: validateDuration},
+	"--max-rtt-timeout":      {value: validateDuration},
+	"--initial-rtt-timeout":  {value: validateDuration},
+	"--max-retries":          {value: validateInt(0, 50)},
+	"--host-timeout":         {value: validateDuration},
+	"--scan-delay":           {value: validateDuration},
+	"--max-scan-delay":       {value: validateDuration},
+	"--min-rate":             {value: validateInt(1, 1000000)},
+	"--defeat-rst-ratelimit": {},
+
+	// Output detail that does not change where results go
+	"-v":       {},
+	"--open":   {},
+	"--reason": {},
+}
+
+// forbiddenArgs explains why commonly requested flags are not allowed. Keys
+// ending in "*" match any flag with that prefix.
+var forbiddenArgs = []struct {
+	prefix string
+	reason string
+}{
+	{"-o*", "output files are managed by the scanner"},
+	{"-i*", "input files are not allowed; targets come from the scan parameters"},
+	{"--script-args*", "script arguments can read local files; scripts run with their defaults"},
+	{"--script-updatedb", "nmap data files cannot be changed"},
+	{"--script-help", "script help does not scan"},
+	{"--script-trace", "script traces are not recorded"},
+	{"--datadir", "nmap data files cannot be changed"},
+	{"--servicedb", "nmap data files cannot be changed"},
+	{"--versiondb", "nmap data files cannot be changed"},
+	{"--resume", "resuming scans from files is not allowed"},
+	{"--stylesheet", "output files are managed by the scanner"},
+	{"--max-rate", "use the template rate limit instead of --max-rate"},
+	{"--exclude", "exclusions are managed through the exclusion list, not templates"},
+	{"--excludefile", "exclusions are managed through the exclusion list, not templates"},
+	{"--stats-every", "progress reporting is managed by the scanner"},
+}
+
+// ValidateNmapArgs checks nmap arguments against the argument policy and
+// returns every violation found
+func ValidateNmapArgs(args []string) []ArgViolation {
+	_, violations := parseNmapArgs(args)
+	return violations
+}
+
+// parseNmapArgs splits an argument list into flags and values, checking each
+// against the argument policy
+func parseNmapArgs(args []string) ([]nmapArg, []ArgViolation) {
+	var parsed []nmapArg
+	var violations []ArgViolation
+
+	reject := func(i int, reason string) {
+		violations = append(violations, ArgViolation{Index: i, Arg: args[i], Reason: reason})
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "" {
+			reject(i, "arguments must not be empty")
+			continue
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			reject(i, "targets are set by the scan parameters, not templates")
+			continue
+		}
+		if reason, forbidden := forbiddenReason(arg); forbidden {
+			reject(i, reason)
+			continue
+		}
+
+		flag, value, hasValue := splitArg(arg)
+		spec, ok := allowedArgs[flag]
+		if !ok {
+			reject(i, "flag is not on the list of allowed nmap arguments")
+			continue
+		}
+
+		parsedArg := nmapArg{Flag: flag, Tokens: []string{arg}}
+
+		if spec.value == nil {
+			if hasValue {
+				reject(i, "flag does not take a value")
+				continue
+			}
+			parsed = append(parsed, parsedArg)
+			continue
+		}
+
+		// The value is the next argument unless it was attached or is optional
+		if !hasValue && (!spec.attached || spec.value("") != nil) {
+			if i+1 >= len(args) {
+				reject(i, "flag requires a value")
+				continue
+			}
+			i++
+			value = args[i]
+			parsedArg.Tokens = append(parsedArg.Tokens, value)
+		}
+
+		if err := spec.value(value); err != nil {
+			violations = append(violations, ArgViolation{
+				Index:  i - len(parsedArg.Tokens) + 1,
+				Arg:    strings.Join(parsedArg.Tokens, " "),
+				Reason: err.Error(),
+			})
+			continue
+		}
+
+		parsedArg.Value = value
+		parsed = append(parsed, parsedArg)
+	}
+
+	return parsed, violations
+}
+
+// splitArg separates a flag from a value given as --flag=value or, for
+// short flags that allow it, as an attached suffix like -p80
+func splitArg(arg string) (string, string, bool) {
+	if strings.HasPrefix(arg, "--") {
+		if idx := strings.Index(arg, "="); idx >= 0 {
+			return arg[:idx], arg[idx+1:], true
+		}
+		return arg, "", false
+	}
+
+	if _, ok := allowedArgs[arg]; ok {
+		return arg, "", false
+	}
+
+	// Try the longest attached-value prefix first so -PS80 is not read as -P
+	for _, n := range []int{3, 2} {
+		if len(arg) > n {
+			if spec, ok := allowedArgs[arg[:n]]; ok && spec.attached {
+				return arg[:n], arg[n:], true
+			}
+		}
+	}
+
+	return arg, "", false
+}
+
+// forbiddenReason reports whether an argument is explicitly forbidden and why
+func forbiddenReason(arg string) (string, bool) {
+	flag := arg
+	if idx := strings.Index(arg, "="); idx >= 0 {
+		flag = arg[:idx]
+	}
+
+	for _, forbidden := range forbiddenArgs {
+		if prefix := strings.TrimSuffix(forbidden.prefix, "*"); prefix != forbidden.prefix {
+			if strings.HasPrefix(flag, prefix) {
+				return forbidden.reason, true
+			}
+		} else if flag == forbidden.prefix {
+			return forbidden.reason, true
+		}
+	}
+
+	return "", false
+}
+
+// optional allows a value validator to accept an empty value
+func optional(validate func(string) error) func(string) error {
+	return func(value string) error {
+		if value == "" {
+			return nil
+		}
+		return validate(value)
+	}
+}
+
+// validateInt returns a validator for integers in [min, max]
+func validateInt(min, max int) func(string) error {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < min || n > max {
+			return fmt.Errorf("value %q must be a whole number from %d to %d", value, min, max)
+		}
+		return nil
+	}
+}
+
+// validatePorts checks an nmap port list such as "22,80,1000-2000" or "T:80,U:53"
+func validatePorts(value string) error {
+	if value == "-" {
+		return nil
+	}
+	if value == "" || !portListPattern.MatchString(value) {
+		return fmt.Errorf("value %q is not a valid port list", value)
+	}
+
+	for _, part := range strings.Split(value, ",") {
+		if len(part) > 1 && part[1] == ':' {
+			part = part[2:]
+		}
+		for _, port := range strings.Split(part, "-") {
+			if port == "" {
+				continue
+			}
+			if n, err := strconv.Atoi(port); err != nil || n > 65535 {
+				return fmt.Errorf("value %q contains an invalid port %s", value, port)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateDuration checks an nmap time value such as "500ms", "30s" or "2m"
+func validateDuration(value string) error {
+	if !durationPattern.MatchString(value) {
+		return fmt.Errorf("value %q is not a valid time, such as 500ms, 30s or 5m", value)
+	}
+	return nil
+}
+
+// validateRatio checks a value between 0 and 1
+func validateRatio(value string) error {
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		return fmt.Errorf("value %q must be a number from 0 to 1", value)
+	}
+	return nil
+}
+
+// validateScripts checks an NSE script selection, a comma-separated list of
+// script names or categories such as "default,ssl-cert". Only the safe
+// categories and the scripts in allowedScripts are accepted; paths,
+// expressions and wildcards are rejected.
+func validateScripts(value string) error {
+	for _, script := range strings.Split(value, ",") {
+		switch {
+		case strings.Contains(script, "*"):
+			return fmt.Errorf("script wildcard %q is not allowed; name each script", script)
+		case !scriptPattern.MatchString(script):
+			return fmt.Errorf("value %q must list script names or categories, not paths or expressions", value)
+		case unsafeScriptCategories[script]:
+			return fmt.Errorf("script category %q is not allowed", script)
+		case !safeScriptCategories[script] && !allowedScripts[script]:
+			return fmt.Errorf("script %q is not on the list of allowed scripts", script)
+		}
+	}
+	return nil
+}
+
+// validateTiming checks an nmap timing template, 0-5 or its name
+func validateTiming(value string) error {
+	if n, err := strconv.Atoi(value); err == nil && n >= 0 && n <= 5 {
+		return nil
+	}
+	if timingNames[value] {
+		return nil
+	}
+	return fmt.Errorf("value %q must be a timing template from 0 to 5", value)
+}
@@ -0,0 +1,99 @@
+// internal/scanner/argpolicy_test.go
+package scanner
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestValidateNmapArgs tests the nmap argument policy
+func TestValidateNmapArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		bad  []int // indexes of rejected arguments
+	}{
+		{"scan types", []string{"-sS", "-sU", "-sV", "-O", "--osscan-guess"}, nil},
+		{"ports", []string{"-p", "22,80,1000-2000", "-p-", "-pT:80,U:53", "--top-ports", "100"}, nil},
+		{"timing", []string{"-T4", "-T", "polite", "--max-retries", "1", "--host-timeout=30m", "--scan-delay", "500ms"}, nil},
+		{"discovery", []string{"-Pn", "-PS22,80", "-PE", "--disable-arp-ping"}, nil},
+		{"input file", []string{"-iL", "/etc/shadow"}, []int{0, 1}},
+		{"output file", []string{"-oN", "/etc/passwd"}, []int{0, 1}},
+		{"scripts", []string{"--script", "http-title,ssl-cert", "-sC", "-A", "--script-timeout", "30s"}, nil},
+		{"script categories", []string{"--script=default,safe,smb-os-discovery,http-robots.txt"}, nil},
+		{"unsafe script category", []string{"--script", "safe,exploit"}, []int{0}},
+		{"unlisted script category", []string{"--script", "vuln"}, []int{0}},
+		{"script wildcard", []string{"--script", "s*"}, []int{0}},
+		{"script prefix wildcard", []string{"--script=ssl-cert,http-*"}, []int{0}},
+		{"brute force script", []string{"--script", "smb-brute"}, []int{0}},
+		{"denial of service script", []string{"--script", "http-slowloris"}, []int{0}},
+		{"script path", []string{"--script=/tmp/evil.nse"}, []int{0}},
+		{"script expression", []string{"--script", "not intrusive"}, []int{0}},
+		{"script args", []string{"--script-args", "userdb=/etc/shadow"}, []int{0, 1}},
+		{"data dir", []string{"--datadir", "/tmp"}, []int{0, 1}},
+		{"unknown flag", []string{"--send-eth"}, []int{0}},
+		{"target", []string{"-sS", "10.0.0.1"}, []int{1}},
+		{"bad port", []string{"-p", "70000"}, []int{0}},
+		{"bad timing", []string{"-T9"}, []int{0}},
+		{"missing value", []string{"--max-retries"}, []int{0}},
+		{"value on switch", []string{"--open=yes"}, []int{0}},
+		{"bad duration", []string{"--host-timeout", "soon"}, []int{0}},
+		{"rate limit", []string{"--max-rate", "10"}, []int{0, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := ValidateNmapArgs(tt.args)
+
+			var got []int
+			for _, v := range violations {
+				got = append(got, v.Index)
+				if v.Reason == "" || !strings.HasPrefix(v.Arg, tt.args[v.Index]) {
+					t.Errorf("Unexpected violation: %+v", v)
+				}
+			}
+
+			// The value of a forbidden flag is also reported as a stray argument
+			if len(got) != len(tt.bad) {
+				t.Fatalf("Expected violations at %v, got %+v", tt.bad, violations)
+			}
+			for i := range got {
+				if got[i] != tt.bad[i] {
+					t.Errorf("Expected violations at %v, got %+v", tt.bad, violations)
+					break
+				}
+			}
+		})
+	}
+}
+
+// TestBuiltinTemplatesFollowPolicy tests that the shipped templates are allowed
+func TestBuiltinTemplatesFollowPolicy(t *testing.T) {
+	for name, template := range builtinTemplates() {
+		if err := ValidateTemplate(template); err != nil {
+			t.Errorf("Built-in template %s is invalid: %v", name, err)
+		}
+	}
+}
+
+// TestScanAllPortsReplacesPortSelection tests that -p- replaces the template's ports
+func TestScanAllPortsReplacesPortSelection(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	template := &ScanTemplate{Name: "web", NmapArgs: []string{"-sS", "-p", "80,443", "--top-ports", "10", "-T4"}, RateLimit: 100}
+
+	cmd, err := scanService.prepareManualScanCommand(template, "out.xml", "", models.ScanParameters{ScanAllPorts: true})
+	if err != nil {
+		t.Fatalf("Failed to prepare command: %v", err)
+	}
+
+	args := strings.Join(cmd.Args, " ")
+	if strings.Contains(args, "80,443") || strings.Contains(args, "--top-ports") || !strings.Contains(args, "-sS -T4 -p-") {
+		t.Errorf("Unexpected nmap arguments: %s", args)
+	}
+}
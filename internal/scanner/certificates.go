@@ -0,0 +1,89 @@
+package scanner
+
+import (
+	"bytes"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+
+	"panopticon-scanner/internal/models"
+)
+
+// sslCertificate returns the certificate reported by the ssl-cert script of
+// a port, or nil if the script did not run. The certificate is read from the
+// PEM encoding ssl-cert includes in its structured output, so every detail
+// comes from the certificate itself rather than from nmap's summary.
+func sslCertificate(scripts []Script) *models.Certificate {
+	for _, script := range scripts {
+		if script.ID != "ssl-cert" {
+			continue
+		}
+		for _, elem := range script.Elems {
+			if elem.Key != "pem" {
+				continue
+			}
+			block, _ := pem.Decode([]byte(elem.Value))
+			if block == nil || block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				continue
+			}
+			return certificateDetails(cert)
+		}
+	}
+	return nil
+}
+
+// certificateDetails returns the details of a certificate that are stored
+func certificateDetails(cert *x509.Certificate) *models.Certificate {
+	fingerprint := sha256.Sum256(cert.Raw)
+
+	details := &models.Certificate{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		NotBefore:          cert.NotBefore.UTC(),
+		NotAfter:           cert.NotAfter.UTC(),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		SHA256Fingerprint:  hex.EncodeToString(fingerprint[:]),
+	}
+
+	// Self-signed server certificates are rarely CAs, which CheckSignatureFrom
+	// requires, so the signature is checked against the certificate's own key
+	details.SelfSigned = bytes.Equal(cert.RawSubject, cert.RawIssuer) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		details.KeyType, details.KeyBits = "rsa", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		details.KeyType, details.KeyBits = "ec", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		details.KeyType, details.KeyBits = "ed25519", 256
+	case *dsa.PublicKey:
+		details.KeyType, details.KeyBits = "dsa", key.P.BitLen()
+	default:
+		details.KeyType = cert.PublicKeyAlgorithm.String()
+	}
+
+	for _, name := range cert.DNSNames {
+		details.SANs = append(details.SANs, "DNS:"+name)
+	}
+	for _, ip := range cert.IPAddresses {
+		details.SANs = append(details.SANs, "IP:"+ip.String())
+	}
+	for _, email := range cert.EmailAddresses {
+		details.SANs = append(details.SANs, "email:"+email)
+	}
+	for _, uri := range cert.URIs {
+		details.SANs = append(details.SANs, "URI:"+uri.String())
+	}
+
+	return details
+}
@@ -0,0 +1,170 @@
+// internal/scanner/certificates_test.go
+package scanner
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"panopticon-scanner/internal/database"
+)
+
+// testCertificatePEM returns a self-signed certificate for commonName that
+// expires at notAfter, PEM encoded as ssl-cert reports it
+func testCertificatePEM(t *testing.T, key interface{}, commonName string, notAfter time.Time) string {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(notAfter.Unix()),
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"Example"}},
+		DNSNames:     []string{commonName, "www." + commonName},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.5")},
+		NotBefore:    notAfter.AddDate(0, -3, 0),
+		NotAfter:     notAfter,
+	}
+
+	var public interface{}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		public = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		public = &k.PublicKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, public, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// TestSSLCertificate tests reading certificate details from ssl-cert output
+func TestSSLCertificate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	notAfter := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	cert := sslCertificate([]Script{
+		{ID: "http-title", Output: "Intranet"},
+		{ID: "ssl-cert", Output: "Subject: commonName=intranet.example.com", Elems: []ScriptElem{
+			{Key: "sig_algo", Value: "sha256WithRSAEncryption"},
+			{Key: "pem", Value: testCertificatePEM(t, key, "intranet.example.com", notAfter)},
+		}},
+	})
+	if cert == nil {
+		t.Fatal("Expected a certificate")
+	}
+
+	if cert.Subject != "CN=intranet.example.com,O=Example" || cert.Issuer != cert.Subject || !cert.SelfSigned {
+		t.Errorf("Unexpected subject or issuer: %q, %q", cert.Subject, cert.Issuer)
+	}
+	if want := []string{"DNS:intranet.example.com", "DNS:www.intranet.example.com", "IP:10.0.0.5"}; !reflect.DeepEqual(cert.SANs, want) {
+		t.Errorf("Expected SANs %v, got %v", want, cert.SANs)
+	}
+	if !cert.NotAfter.Equal(notAfter) || !cert.NotBefore.Equal(notAfter.AddDate(0, -3, 0)) {
+		t.Errorf("Unexpected validity: %v to %v", cert.NotBefore, cert.NotAfter)
+	}
+	if cert.KeyType != "rsa" || cert.KeyBits != 2048 || cert.SignatureAlgorithm != "SHA256-RSA" {
+		t.Errorf("Unexpected key or signature: %s %d %s", cert.KeyType, cert.KeyBits, cert.SignatureAlgorithm)
+	}
+	if len(cert.SHA256Fingerprint) != 64 {
+		t.Errorf("Expected a SHA-256 fingerprint, got %q", cert.SHA256Fingerprint)
+	}
+
+	if cert := sslCertificate([]Script{{ID: "ssl-cert", Output: "Subject: commonName=x"}}); cert != nil {
+		t.Errorf("Expected no certificate without a PEM, got %+v", cert)
+	}
+}
+
+// TestProcessScanResultsCertificates tests that certificates are stored per
+// port, with a change recorded when a port presents a new one
+func TestProcessScanResultsCertificates(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	outputPath := filepath.Join(tempDir, "tls.xml")
+	scan := func(certPEM string) {
+		t.Helper()
+		output := `<?xml version="1.0"?>
+<nmaprun>
+<host><status state="up"/>
+<address addr="192.168.1.90" addrtype="ipv4"/>
+<ports>
+<port protocol="tcp" portid="443"><state state="open" reason="syn-ack"/>
+<service name="https" tunnel="ssl"/>
+<script id="ssl-cert" output="Subject: commonName=intranet.example.com">
+<elem key="pem">` + certPEM + `</elem>
+</script>
+</port>
+</ports>
+</host>
+</nmaprun>`
+		scanID, err := db.CreateScan("default")
+		if err != nil {
+			t.Fatalf("Failed to create scan: %v", err)
+		}
+		if err := ioutil.WriteFile(outputPath, []byte(output), 0644); err != nil {
+			t.Fatalf("Failed to write scan output: %v", err)
+		}
+		if _, _, err := scanService.processScanResults(scanID, outputPath, nil); err != nil {
+			t.Fatalf("Failed to process scan results: %v", err)
+		}
+	}
+
+	expiring := testCertificatePEM(t, key, "intranet.example.com", time.Now().Add(10*24*time.Hour).Truncate(time.Second))
+	renewed := testCertificatePEM(t, key, "intranet.example.com", time.Now().Add(90*24*time.Hour).Truncate(time.Second))
+	scan(expiring)
+	scan(expiring)
+	scan(renewed)
+
+	device, err := db.GetDeviceByIP("192.168.1.90")
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	details, err := db.GetDeviceDetails(device.ID)
+	if err != nil {
+		t.Fatalf("Failed to get device details: %v", err)
+	}
+	if len(details.Ports) != 1 || details.Ports[0].Certificate == nil {
+		t.Fatalf("Expected port 443 with its certificate, got %+v", details.Ports)
+	}
+	if cert := details.Ports[0].Certificate; cert.KeyType != "ec" || cert.KeyBits != 256 || cert.NotAfter.Before(time.Now().Add(60*24*time.Hour)) {
+		t.Errorf("Expected the renewed certificate, got %+v", cert)
+	}
+
+	history, err := db.GetCertificates(database.CertificateFilter{DeviceID: device.ID, IncludeReplaced: true})
+	if err != nil {
+		t.Fatalf("Failed to get certificates: %v", err)
+	}
+	if len(history) != 2 || history[0].ReplacedAt == nil || history[1].ReplacedAt != nil || history[0].LastScanID != history[0].FirstScanID+1 {
+		t.Errorf("Expected the expiring certificate, seen by 2 scans and replaced, then the renewed one, got %+v", history)
+	}
+
+	var changes int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM changes WHERE change_type = 'certificate_change'`).Scan(&changes); err != nil {
+		t.Fatalf("Failed to count changes: %v", err)
+	}
+	if changes != 1 {
+		t.Errorf("Expected 1 certificate change, got %d", changes)
+	}
+}
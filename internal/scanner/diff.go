@@ -0,0 +1,256 @@
+package scanner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"panopticon-scanner/internal/models"
+)
+
+// ErrScanNotCompleted is returned when a scan that has not completed is
+// compared with another
+var ErrScanNotCompleted = errors.New("scan has not completed")
+
+// Types of differences between two scans
+const (
+	DiffHostAdded       = "host_added"
+	DiffHostRemoved     = "host_removed"
+	DiffPortOpened      = "port_opened"
+	DiffPortClosed      = "port_closed"
+	DiffPortStateChange = "port_state_changed"
+	DiffServiceChanged  = "service_changed"
+	DiffVersionChanged  = "version_changed"
+	DiffOSChanged       = "os_changed"
+)
+
+// scanCoverage is what the later of two compared scans looked at. A host or
+// port it did not look at is not reported as removed or closed, so scans run
+// with different templates or targets can be compared.
+type scanCoverage struct {
+	scope  *scanScope // nil if the scan did not record its targets
+	probed probedPorts
+}
+
+// hostCovered reports whether the scan looked for a host at address
+func (c *scanCoverage) hostCovered(address string) bool {
+	return c != nil && c.scope != nil && c.scope.contains(address)
+}
+
+// portProbed reports whether the scan probed a port
+func (c *scanCoverage) portProbed(protocol string, port int) bool {
+	return c != nil && c.probed.contains(protocol, port)
+}
+
+// getScanCoverage returns what a scan looked at, as recorded when it ran
+func (s *ScanService) getScanCoverage(scanID int64) (*scanCoverage, error) {
+	recorded, err := s.db.GetScanCoverage(scanID)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []ScanInfo
+	for protocol, ports := range recorded.ProbedPorts {
+		infos = append(infos, ScanInfo{Protocol: protocol, Services: ports})
+	}
+
+	coverage := &scanCoverage{probed: parseScanInfo(infos)}
+	if recorded.Targets != "" {
+		scope, err := parseScanScope(recorded.Targets, recorded.Exclusions)
+		if err != nil {
+			s.logger.Warn().Err(err).Int64("scanID", scanID).Msg("Not reporting removed hosts for scan with unparsable scope")
+		} else {
+			coverage.scope = scope
+		}
+	}
+
+	return coverage, nil
+}
+
+// DiffScans compares what two completed scans found. It works from the
+// observations recorded for each scan, so it is unaffected by anything the
+// inventory learned since.
+func (s *ScanService) DiffScans(fromID, toID int64) (*models.ScanDiff, error) {
+	var observations [2][]*models.HostObservation
+	for i, scanID := range []int64{fromID, toID} {
+		scan, err := s.db.GetScan(scanID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %d", ErrScanNotFound, scanID)
+		}
+		if scan.Status != "completed" {
+			return nil, fmt.Errorf("%w: scan %d is %s", ErrScanNotCompleted, scanID, scan.Status)
+		}
+
+		observations[i], err = s.db.GetScanObservations(scanID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	coverage, err := s.getScanCoverage(toID)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &models.ScanDiff{
+		FromScanID: fromID,
+		ToScanID:   toID,
+		Summary:    make(map[string]int),
+		Changes:    diffObservations(observations[0], observations[1], coverage),
+	}
+	for _, change := range diff.Changes {
+		diff.Summary[change.Type]++
+	}
+
+	return diff, nil
+}
+
+// diffObservations lists the differences between the hosts found by two
+// scans, ordered by address. Hosts are matched by device, so a host that
+// changed address is reported as the same host. The ports of added and
+// removed hosts are reported as opened and closed. Hosts and ports the later
+// scan did not look at, according to coverage, are not reported as removed
+// or closed.
+func diffObservations(from, to []*models.HostObservation, coverage *scanCoverage) []*models.ScanDiffEntry {
+	before := make(map[int64]*models.HostObservation, len(from))
+	for _, host := range from {
+		before[host.DeviceID] = host
+	}
+	after := make(map[int64]bool, len(to))
+
+	var changes []*models.ScanDiffEntry
+	for _, host := range to {
+		after[host.DeviceID] = true
+
+		old, ok := before[host.DeviceID]
+		if !ok {
+			changes = append(changes, hostEntry(DiffHostAdded, host))
+			changes = append(changes, diffPorts(host, nil, host.Ports, coverage)...)
+			continue
+		}
+
+		// A scan without OS detection finds no fingerprint, which is not a change
+		if old.OSFingerprint != host.OSFingerprint && old.OSFingerprint != "" && host.OSFingerprint != "" {
+			entry := hostEntry(DiffOSChanged, host)
+			entry.Before, entry.After = old.OSFingerprint, host.OSFingerprint
+			changes = append(changes, entry)
+		}
+		changes = append(changes, diffPorts(host, old.Ports, host.Ports, coverage)...)
+	}
+
+	for _, host := range from {
+		if after[host.DeviceID] || !coverage.hostCovered(host.IPAddress) {
+			continue
+		}
+		changes = append(changes, hostEntry(DiffHostRemoved, host))
+		changes = append(changes, diffPorts(host, host.Ports, nil, coverage)...)
+	}
+
+	sortDiffEntries(changes)
+	return changes
+}
+
+// diffPorts lists the differences between the ports a host had in two scans,
+// in whichever state they were stored
+func diffPorts(host *models.HostObservation, from, to []*models.PortObservation, coverage *scanCoverage) []*models.ScanDiffEntry {
+	byKey := func(ports []*models.PortObservation) map[string]*models.PortObservation {
+		keyed := make(map[string]*models.PortObservation)
+		for _, port := range ports {
+			keyed[fmt.Sprintf("%d/%s", port.PortNumber, port.Protocol)] = port
+		}
+		return keyed
+	}
+	before, after := byKey(from), byKey(to)
+
+	var changes []*models.ScanDiffEntry
+	for key, port := range after {
+		old, ok := before[key]
+		if !ok {
+			entry := portEntry(DiffPortOpened, host, port)
+			entry.After = describePort(port)
+			changes = append(changes, entry)
+			continue
+		}
+
+		if old.State != port.State {
+			entry := portEntry(DiffPortStateChange, host, port)
+			entry.Before, entry.After = old.State, port.State
+			changes = append(changes, entry)
+		}
+		// A port without a service or version found on one side, such as one
+		// seen by a scan without version detection, has not changed
+		switch {
+		case old.ServiceName != port.ServiceName && old.ServiceName != "" && port.ServiceName != "":
+			entry := portEntry(DiffServiceChanged, host, port)
+			entry.Before, entry.After = describeService(old), describeService(port)
+			changes = append(changes, entry)
+		case old.ServiceVersion != port.ServiceVersion && old.ServiceVersion != "" && port.ServiceVersion != "":
+			entry := portEntry(DiffVersionChanged, host, port)
+			entry.Before, entry.After = old.ServiceVersion, port.ServiceVersion
+			changes = append(changes, entry)
+		}
+	}
+	for key, port := range before {
+		if _, ok := after[key]; !ok && coverage.portProbed(port.Protocol, port.PortNumber) {
+			entry := portEntry(DiffPortClosed, host, port)
+			entry.Before = describePort(port)
+			changes = append(changes, entry)
+		}
+	}
+
+	return changes
+}
+
+// hostEntry returns a difference concerning a whole host
+func hostEntry(diffType string, host *models.HostObservation) *models.ScanDiffEntry {
+	return &models.ScanDiffEntry{Type: diffType, DeviceID: host.DeviceID, IPAddress: host.IPAddress}
+}
+
+// portEntry returns a difference concerning one port of a host
+func portEntry(diffType string, host *models.HostObservation, port *models.PortObservation) *models.ScanDiffEntry {
+	entry := hostEntry(diffType, host)
+	entry.PortNumber, entry.Protocol = port.PortNumber, port.Protocol
+	return entry
+}
+
+// describeService returns the service found on a port with its version
+func describeService(port *models.PortObservation) string {
+	return strings.TrimSpace(port.ServiceName + " " + port.ServiceVersion)
+}
+
+// describePort returns the service found on a port, with the port's state
+// unless it was open
+func describePort(port *models.PortObservation) string {
+	if port.State == "open" || port.State == "" {
+		return describeService(port)
+	}
+	return strings.TrimSpace(describeService(port) + " (" + port.State + ")")
+}
+
+// sortDiffEntries orders differences by address, then port, with those
+// concerning the whole host first
+func sortDiffEntries(changes []*models.ScanDiffEntry) {
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.IPAddress != b.IPAddress {
+			ipA, ipB := net.ParseIP(a.IPAddress), net.ParseIP(b.IPAddress)
+			if ipA == nil || ipB == nil {
+				return a.IPAddress < b.IPAddress
+			}
+			return bytes.Compare(ipA.To16(), ipB.To16()) < 0
+		}
+		if a.DeviceID != b.DeviceID {
+			return a.DeviceID < b.DeviceID
+		}
+		if a.PortNumber != b.PortNumber {
+			return a.PortNumber < b.PortNumber
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		return a.Type < b.Type
+	})
+}
@@ -0,0 +1,233 @@
+// internal/scanner/diff_test.go
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestDiffObservations tests the differences found between two scans' hosts
+func TestDiffObservations(t *testing.T) {
+	port := func(number int, state, service, version string) *models.PortObservation {
+		return &models.PortObservation{PortNumber: number, Protocol: "tcp", State: state, ServiceName: service, ServiceVersion: version}
+	}
+
+	from := []*models.HostObservation{
+		{DeviceID: 1, IPAddress: "10.0.0.10", OSFingerprint: "Linux 5.x", Ports: []*models.PortObservation{
+			port(22, "open", "ssh", "OpenSSH 8.9"),
+			port(80, "open", "http", "nginx 1.22"),
+			port(443, "open", "https", ""),
+			port(8080, "filtered", "", ""),
+		}},
+		{DeviceID: 2, IPAddress: "10.0.0.9", Ports: []*models.PortObservation{port(3389, "open", "ms-wbt-server", "")}},
+	}
+	to := []*models.HostObservation{
+		{DeviceID: 1, IPAddress: "10.0.0.10", OSFingerprint: "Linux 6.x", Ports: []*models.PortObservation{
+			port(22, "open", "ssh", "OpenSSH 9.6"),
+			port(80, "open", "http-proxy", ""),
+			port(8080, "open", "http", ""),
+		}},
+		{DeviceID: 3, IPAddress: "10.0.0.100", Ports: []*models.PortObservation{port(53, "open", "domain", "")}},
+	}
+
+	var got []models.ScanDiffEntry
+	for _, entry := range diffObservations(from, to, testCoverage(t, "10.0.0.0/24", "tcp", "1-65535")) {
+		got = append(got, *entry)
+	}
+
+	want := []models.ScanDiffEntry{
+		{Type: DiffHostRemoved, DeviceID: 2, IPAddress: "10.0.0.9"},
+		{Type: DiffPortClosed, DeviceID: 2, IPAddress: "10.0.0.9", PortNumber: 3389, Protocol: "tcp", Before: "ms-wbt-server"},
+		{Type: DiffOSChanged, DeviceID: 1, IPAddress: "10.0.0.10", Before: "Linux 5.x", After: "Linux 6.x"},
+		{Type: DiffVersionChanged, DeviceID: 1, IPAddress: "10.0.0.10", PortNumber: 22, Protocol: "tcp", Before: "OpenSSH 8.9", After: "OpenSSH 9.6"},
+		{Type: DiffServiceChanged, DeviceID: 1, IPAddress: "10.0.0.10", PortNumber: 80, Protocol: "tcp", Before: "http nginx 1.22", After: "http-proxy"},
+		{Type: DiffPortClosed, DeviceID: 1, IPAddress: "10.0.0.10", PortNumber: 443, Protocol: "tcp", Before: "https"},
+		{Type: DiffPortStateChange, DeviceID: 1, IPAddress: "10.0.0.10", PortNumber: 8080, Protocol: "tcp", Before: "filtered", After: "open"},
+		{Type: DiffHostAdded, DeviceID: 3, IPAddress: "10.0.0.100"},
+		{Type: DiffPortOpened, DeviceID: 3, IPAddress: "10.0.0.100", PortNumber: 53, Protocol: "tcp", After: "domain"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected differences:\ngot  %+v\nwant %+v", got, want)
+	}
+
+	if changes := diffObservations(to, to, nil); len(changes) != 0 {
+		t.Errorf("Expected no differences between identical scans, got %+v", changes)
+	}
+}
+
+// testCoverage returns the coverage of a scan of targets that probed ports on
+// one protocol
+func testCoverage(t *testing.T, targets, protocol, ports string) *scanCoverage {
+	t.Helper()
+	scope, err := parseScanScope(targets, nil)
+	if err != nil {
+		t.Fatalf("Failed to parse scope: %v", err)
+	}
+	return &scanCoverage{scope: scope, probed: parseScanInfo([]ScanInfo{{Protocol: protocol, Services: ports}})}
+}
+
+// TestDiffObservationsMixedTemplates tests comparing scans that looked at
+// different ports, protocols and targets, or collected less detail
+func TestDiffObservationsMixedTemplates(t *testing.T) {
+	port := func(number int, protocol, state, service, version string) *models.PortObservation {
+		return &models.PortObservation{PortNumber: number, Protocol: protocol, State: state, ServiceName: service, ServiceVersion: version}
+	}
+
+	// A thorough scan with OS and version detection of every TCP port and
+	// the common UDP ones
+	thorough := []*models.HostObservation{
+		{DeviceID: 1, IPAddress: "10.0.0.10", OSFingerprint: "Linux 5.x", Ports: []*models.PortObservation{
+			port(22, "tcp", "open", "ssh", "OpenSSH 8.9"),
+			port(8443, "tcp", "open", "https-alt", "Jetty 9.4"),
+			port(53, "udp", "open", "domain", "dnsmasq 2.86"),
+		}},
+		{DeviceID: 2, IPAddress: "10.0.0.20", Ports: []*models.PortObservation{port(80, "tcp", "open", "http", "")}},
+		{DeviceID: 3, IPAddress: "10.0.1.30", Ports: []*models.PortObservation{port(80, "tcp", "open", "http", "")}},
+	}
+
+	tests := []struct {
+		name     string
+		to       []*models.HostObservation
+		coverage *scanCoverage
+		want     []models.ScanDiffEntry
+	}{
+		{
+			name: "quick scan of the top TCP ports without OS or version detection",
+			to: []*models.HostObservation{
+				{DeviceID: 1, IPAddress: "10.0.0.10", Ports: []*models.PortObservation{port(22, "tcp", "open", "ssh", "")}},
+			},
+			coverage: testCoverage(t, "10.0.0.0/24", "tcp", "21-23,80,443"),
+			want: []models.ScanDiffEntry{
+				{Type: DiffHostRemoved, DeviceID: 2, IPAddress: "10.0.0.20"},
+				{Type: DiffPortClosed, DeviceID: 2, IPAddress: "10.0.0.20", PortNumber: 80, Protocol: "tcp", Before: "http"},
+			},
+		},
+		{
+			name: "UDP scan",
+			to: []*models.HostObservation{
+				{DeviceID: 1, IPAddress: "10.0.0.10", Ports: []*models.PortObservation{port(53, "udp", "open|filtered", "domain", "")}},
+				{DeviceID: 2, IPAddress: "10.0.0.20", Ports: []*models.PortObservation{port(161, "udp", "open|filtered", "snmp", "")}},
+			},
+			coverage: testCoverage(t, "10.0.0.0/16", "udp", "53,161"),
+			want: []models.ScanDiffEntry{
+				{Type: DiffPortStateChange, DeviceID: 1, IPAddress: "10.0.0.10", PortNumber: 53, Protocol: "udp", Before: "open", After: "open|filtered"},
+				{Type: DiffPortOpened, DeviceID: 2, IPAddress: "10.0.0.20", PortNumber: 161, Protocol: "udp", After: "snmp (open|filtered)"},
+				{Type: DiffHostRemoved, DeviceID: 3, IPAddress: "10.0.1.30"},
+			},
+		},
+		{
+			name:     "scan without recorded coverage",
+			to:       []*models.HostObservation{{DeviceID: 1, IPAddress: "10.0.0.10"}},
+			coverage: &scanCoverage{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []models.ScanDiffEntry
+			for _, entry := range diffObservations(thorough, tt.to, tt.coverage) {
+				got = append(got, *entry)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unexpected differences:\ngot  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDiffScans tests that only completed scans can be compared
+func TestDiffScans(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	completed, err := db.CreateScan("default")
+	if err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+	if err := db.UpdateScan(completed, "completed", 0, 0, 0, ""); err != nil {
+		t.Fatalf("Failed to update scan: %v", err)
+	}
+	running, err := db.CreateScan("default")
+	if err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+
+	diff, err := scanService.DiffScans(completed, completed)
+	if err != nil {
+		t.Fatalf("Failed to compare scan with itself: %v", err)
+	}
+	if len(diff.Changes) != 0 || len(diff.Summary) != 0 {
+		t.Errorf("Expected no differences, got %+v", diff)
+	}
+
+	if _, err := scanService.DiffScans(completed, running); !errors.Is(err, ErrScanNotCompleted) {
+		t.Errorf("Expected ErrScanNotCompleted, got %v", err)
+	}
+	if _, err := scanService.DiffScans(9999, completed); !errors.Is(err, ErrScanNotFound) {
+		t.Errorf("Expected ErrScanNotFound, got %v", err)
+	}
+}
+
+// TestDiffScansCoverage tests that comparisons use the targets and ports
+// recorded for the later scan
+func TestDiffScansCoverage(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	scan := func(targets, scanInfo, hosts string) int64 {
+		t.Helper()
+		scanID, err := db.CreateScan("default")
+		if err != nil {
+			t.Fatalf("Failed to create scan: %v", err)
+		}
+		scanService.recordTargets(scanID, targets)
+
+		outputPath := filepath.Join(tempDir, fmt.Sprintf("scan%d.xml", scanID))
+		output := `<?xml version="1.0"?><nmaprun>` + scanInfo + hosts + `</nmaprun>`
+		if err := ioutil.WriteFile(outputPath, []byte(output), 0644); err != nil {
+			t.Fatalf("Failed to write scan output: %v", err)
+		}
+		if _, _, err := scanService.processScanResults(scanID, outputPath, nil); err != nil {
+			t.Fatalf("Failed to process scan results: %v", err)
+		}
+		if err := db.UpdateScan(scanID, "completed", 0, 0, 0, ""); err != nil {
+			t.Fatalf("Failed to update scan: %v", err)
+		}
+		return scanID
+	}
+	host := func(address string, ports ...int) string {
+		output := `<host><status state="up"/><address addr="` + address + `" addrtype="ipv4"/><ports>`
+		for _, port := range ports {
+			output += fmt.Sprintf(`<port protocol="tcp" portid="%d"><state state="open"/><service name="unknown"/></port>`, port)
+		}
+		return output + `</ports></host>`
+	}
+
+	thorough := scan("192.168.1.0/24", `<scaninfo type="syn" protocol="tcp" services="1-65535"/>`,
+		host("192.168.1.10", 22, 8443)+host("192.168.1.11", 22)+host("192.168.1.12", 22))
+	quick := scan("192.168.1.10-11", `<scaninfo type="syn" protocol="tcp" services="22,80,443"/>`,
+		host("192.168.1.10", 22))
+
+	diff, err := scanService.DiffScans(thorough, quick)
+	if err != nil {
+		t.Fatalf("Failed to compare scans: %v", err)
+	}
+	want := map[string]int{DiffHostRemoved: 1, DiffPortClosed: 1}
+	if !reflect.DeepEqual(diff.Summary, want) {
+		t.Fatalf("Expected only the host the quick scan looked for to be removed, got %+v", diff.Changes)
+	}
+	for _, change := range diff.Changes {
+		if change.IPAddress != "192.168.1.11" {
+			t.Errorf("Unexpected change: %+v", change)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package scanner
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+var (
+	// ErrExclusionNotFound is returned when an exclusion does not exist
+	ErrExclusionNotFound = errors.New("exclusion not found")
+
+	// ErrInvalidExclusion is returned when an exclusion is missing required fields
+	ErrInvalidExclusion = errors.New("invalid exclusion")
+)
+
+// GetExclusions returns the exclusions from the configuration file followed by
+// those stored in the database. Expired entries are only included if requested.
+func (s *ScanService) GetExclusions(includeExpired bool) ([]*models.Exclusion, error) {
+	exclusions := []*models.Exclusion{}
+
+	for _, host := range s.config.Scanner.ExcludeHosts {
+		target := host
+		if parsed, err := ParseTarget(host); err == nil {
+			target = parsed.String()
+		}
+		exclusions = append(exclusions, &models.Exclusion{
+			Target: target,
+			Reason: "Listed in configuration file",
+			Source: "config",
+		})
+	}
+
+	stored, err := s.db.GetExclusions(includeExpired, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return append(exclusions, stored...), nil
+}
+
+// GetExclusion returns a stored exclusion by ID
+func (s *ScanService) GetExclusion(id int64) (*models.Exclusion, error) {
+	exclusion, err := s.db.GetExclusion(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %d", ErrExclusionNotFound, id)
+		}
+		return nil, err
+	}
+
+	return exclusion, nil
+}
+
+// CreateExclusion validates and stores a new exclusion
+func (s *ScanService) CreateExclusion(exclusion *models.Exclusion) (*models.Exclusion, error) {
+	if err := validateExclusion(exclusion); err != nil {
+		return nil, err
+	}
+
+	id, err := s.db.CreateExclusion(exclusion)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().
+		Int64("id", id).
+		Str("target", exclusion.Target).
+		Str("reason", exclusion.Reason).
+		Msg("Exclusion created")
+
+	return s.GetExclusion(id)
+}
+
+// UpdateExclusion validates and replaces a stored exclusion
+func (s *ScanService) UpdateExclusion(id int64, exclusion *models.Exclusion) (*models.Exclusion, error) {
+	if err := validateExclusion(exclusion); err != nil {
+		return nil, err
+	}
+
+	exclusion.ID = id
+	if err := s.db.UpdateExclusion(exclusion); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %d", ErrExclusionNotFound, id)
+		}
+		return nil, err
+	}
+
+	s.logger.Info().Int64("id", id).Str("target", exclusion.Target).Msg("Exclusion updated")
+
+	return s.GetExclusion(id)
+}
+
+// DeleteExclusion removes a stored exclusion
+func (s *ScanService) DeleteExclusion(id int64) error {
+	if err := s.db.DeleteExclusion(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %d", ErrExclusionNotFound, id)
+		}
+		return err
+	}
+
+	s.logger.Info().Int64("id", id).Msg("Exclusion deleted")
+
+	return nil
+}
+
+// validateExclusion checks an exclusion and normalizes its target
+func validateExclusion(exclusion *models.Exclusion) error {
+	target, err := ParseTarget(exclusion.Target)
+	if err != nil {
+		return err
+	}
+	exclusion.Target = target.String()
+
+	exclusion.Reason = strings.TrimSpace(exclusion.Reason)
+	if exclusion.Reason == "" {
+		return fmt.Errorf("%w: a reason is required", ErrInvalidExclusion)
+	}
+
+	if exclusion.ExpiresAt != nil && !exclusion.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: expiry must be in the future", ErrInvalidExclusion)
+	}
+
+	return nil
+}
+
+// checkConfigExclusions logs excluded hosts in the configuration that are not valid targets
+func (s *ScanService) checkConfigExclusions() {
+	for _, host := range s.config.Scanner.ExcludeHosts {
+		if _, err := ParseTarget(host); err != nil {
+			s.logger.Error().Err(err).Str("host", host).Msg("Invalid excluded host in configuration; scans will be refused until it is fixed")
+		}
+	}
+}
+
+// activeExclusions returns every exclusion currently in effect. An invalid
+// exclusion in the configuration is an error, so that a typo never causes a
+// host that should be protected to be scanned.
+func (s *ScanService) activeExclusions() ([]*TargetRange, error) {
+	var targets []*TargetRange
+	seen := make(map[string]bool)
+
+	add := func(target *TargetRange) {
+		if !seen[target.String()] {
+			seen[target.String()] = true
+			targets = append(targets, target)
+		}
+	}
+
+	for _, host := range s.config.Scanner.ExcludeHosts {
+		target, err := ParseTarget(host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid excluded host in configuration: %w", err)
+		}
+		add(target)
+	}
+
+	stored, err := s.db.GetExclusions(false, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load exclusions: %w", err)
+	}
+
+	for _, exclusion := range stored {
+		target, err := ParseTarget(exclusion.Target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclusion %d: %w", exclusion.ID, err)
+		}
+		add(target)
+	}
+
+	return targets, nil
+}
+
+// prepareExclusions writes the exclusions in effect for a scan of the given
+// address family to a file for nmap's --excludefile option. nmap refuses
+// exclusions from the other family, and they cannot match anyway. It returns
+// the file path, or "" if nothing is excluded, and the normalized targets for
+// the scan record.
+func (s *ScanService) prepareExclusions(outputPath string, ipv6 bool) (string, []string, error) {
+	targets, err := s.activeExclusions()
+	if err != nil {
+		return "", nil, err
+	}
+
+	excluded := make([]string, 0, len(targets))
+	var lines []string
+	for _, target := range targets {
+		if target.IsIPv6() != ipv6 {
+			continue
+		}
+		excluded = append(excluded, target.String())
+		lines = append(lines, target.NmapSpecs()...)
+	}
+
+	if len(lines) == 0 {
+		return "", excluded, nil
+	}
+
+	excludePath := strings.TrimSuffix(outputPath, ".xml") + ".exclude"
+	if err := os.WriteFile(excludePath, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return "", nil, fmt.Errorf("failed to write exclusion file: %w", err)
+	}
+
+	return excludePath, excluded, nil
+}
+
+// removeExcludeFile deletes a scan's exclusion file once nmap has finished
+func (s *ScanService) removeExcludeFile(excludePath string) {
+	if excludePath == "" {
+		return
+	}
+	if err := os.Remove(excludePath); err != nil && !os.IsNotExist(err) {
+		s.logger.Warn().Err(err).Str("file", excludePath).Msg("Failed to remove exclusion file")
+	}
+}
+
+// recordExclusions stores the exclusions in effect for a scan
+func (s *ScanService) recordExclusions(scanID int64, excluded []string) {
+	if err := s.db.SetScanExclusions(scanID, excluded); err != nil {
+		s.logger.Error().Err(err).Int64("scanID", scanID).Msg("Failed to record scan exclusions")
+	}
+}
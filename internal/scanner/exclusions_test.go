@@ -0,0 +1,140 @@
+// internal/scanner/exclusions_test.go
+package scanner
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// mockExcludeCommand creates a mock nmap that keeps a copy of its exclusion file
+func mockExcludeCommand(t *testing.T, tempDir string) string {
+	copyPath := filepath.Join(tempDir, "excluded.txt")
+	mockScript := `#!/bin/sh
+output=$2
+while [ $# -gt 0 ]; do
+  if [ "$1" = "--excludefile" ]; then
+    cp "$2" ` + copyPath + `
+  fi
+  shift
+done
+cp ` + filepath.Join(tempDir, "mock_scan.xml") + ` $output
+`
+	if err := ioutil.WriteFile(filepath.Join(tempDir, "nmap"), []byte(mockScript), 0755); err != nil {
+		t.Fatalf("Failed to write mock nmap script: %v", err)
+	}
+
+	return copyPath
+}
+
+// TestScanExclusions tests that exclusions are passed to nmap and recorded on the scan
+func TestScanExclusions(t *testing.T) {
+	tempDir, cfg, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	copyPath := mockExcludeCommand(t, tempDir)
+
+	// IPv6 exclusions are left out of IPv4 scans
+	cfg.Scanner.ExcludeHosts = []string{"192.168.1.1", "fe80::1"}
+	defer func() { cfg.Scanner.ExcludeHosts = nil }()
+
+	if _, err := scanService.CreateExclusion(&models.Exclusion{Target: "192.168.1.10-13", Reason: "Printers"}); err != nil {
+		t.Fatalf("Failed to create exclusion: %v", err)
+	}
+
+	// Deleted exclusions no longer apply
+	expires := time.Now().Add(time.Hour)
+	exclusion, err := scanService.CreateExclusion(&models.Exclusion{Target: "10.1.1.1", Reason: "Temporary", ExpiresAt: &expires})
+	if err != nil {
+		t.Fatalf("Failed to create exclusion: %v", err)
+	}
+	if err := scanService.DeleteExclusion(exclusion.ID); err != nil {
+		t.Fatalf("Failed to delete exclusion: %v", err)
+	}
+
+	scanID, err := scanService.RunScan(context.Background(), "default")
+	if err != nil {
+		t.Fatalf("Failed to run scan: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(copyPath)
+	if err != nil {
+		t.Fatalf("Expected nmap to receive an exclusion file: %v", err)
+	}
+
+	want := "192.168.1.1\n192.168.1.10/31\n192.168.1.12/31\n"
+	if string(data) != want {
+		t.Errorf("Unexpected exclusion file:\n%s\nwant:\n%s", data, want)
+	}
+
+	scan, err := db.GetScan(scanID)
+	if err != nil {
+		t.Fatalf("Failed to get scan: %v", err)
+	}
+
+	if strings.Join(scan.Exclusions, ",") != "192.168.1.1,192.168.1.10-192.168.1.13" {
+		t.Errorf("Unexpected scan exclusions: %v", scan.Exclusions)
+	}
+
+	// The exclusion file is removed once the scan finishes
+	files, _ := filepath.Glob(filepath.Join(cfg.Scanner.OutputDir, "*.exclude"))
+	if len(files) != 0 {
+		t.Errorf("Expected exclusion files to be removed, found %v", files)
+	}
+
+	// An invalid configured exclusion stops scans rather than being ignored
+	cfg.Scanner.ExcludeHosts = []string{"not-a-host"}
+	if _, err := scanService.RunScan(context.Background(), "default"); !errors.Is(err, ErrInvalidTarget) {
+		t.Errorf("Expected ErrInvalidTarget with invalid configured exclusion, got %v", err)
+	}
+}
+
+// TestExclusionValidation tests validation of exclusions
+func TestExclusionValidation(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		exclusion models.Exclusion
+		wantErr   error
+	}{
+		{"invalid target", models.Exclusion{Target: "example", Reason: "x"}, ErrInvalidTarget},
+		{"missing reason", models.Exclusion{Target: "192.168.1.1", Reason: " "}, ErrInvalidExclusion},
+		{"expired", models.Exclusion{Target: "192.168.1.1", Reason: "x", ExpiresAt: &past}, ErrInvalidExclusion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exclusion := tt.exclusion
+			if _, err := scanService.CreateExclusion(&exclusion); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// Targets are normalized
+	created, err := scanService.CreateExclusion(&models.Exclusion{Target: "192.168.1.0-255", Reason: "Office"})
+	if err != nil {
+		t.Fatalf("Failed to create exclusion: %v", err)
+	}
+
+	if created.Target != "192.168.1.0/24" {
+		t.Errorf("Expected normalized target 192.168.1.0/24, got %s", created.Target)
+	}
+
+	if _, err := scanService.UpdateExclusion(created.ID+100, &models.Exclusion{Target: "192.168.1.1", Reason: "x"}); !errors.Is(err, ErrExclusionNotFound) {
+		t.Errorf("Expected ErrExclusionNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// Result formats that can be imported
+const (
+	FormatNmap    = "nmap"
+	FormatMasscan = "masscan"
+	FormatZMap    = "zmap"
+	FormatNessus  = "nessus"
+)
+
+// ScanResults is the outcome of a scan, normalized from the format of the
+// tool that ran it
+type ScanResults struct {
+	Format string
+	Start  time.Time // zero if the format does not record it
+	End    time.Time
+	Hosts  []*HostResult
+}
+
+// HostResult is a host found by a scan along with its ports. Port script
+// output is held in each port's Scripts.
+type HostResult struct {
+	Device models.Device
+	// Addresses the host was also reported at besides Device.IPAddress, such
+	// as the IPv6 address of a host nmap reports with both families
+	Addresses []string
+	Ports     []*models.Port
+	Scripts   []*models.ScriptResult
+}
+
+// Importer converts the output of a scanning tool into scan results
+type Importer interface {
+	// Format names the format the importer reads
+	Format() string
+
+	// Detect reports whether data appears to be in the importer's format
+	Detect(data []byte) bool
+
+	// Parse converts data to scan results. Errors wrap ErrInvalidImport.
+	Parse(data []byte) (*ScanResults, error)
+}
+
+// importers returns the available importers in the order they are tried
+func (s *ScanService) importers() []Importer {
+	return []Importer{
+		nessusImporter{},
+		masscanImporter{},
+		nmapImporter{s},
+		zmapImporter{},
+	}
+}
+
+// detectImporter returns the importer for data's format, or nil if no
+// importer recognizes it
+func (s *ScanService) detectImporter(data []byte) Importer {
+	for _, importer := range s.importers() {
+		if importer.Detect(data) {
+			return importer
+		}
+	}
+	return nil
+}
+
+// xmlRoot returns the root element of an XML document, or nil if data does
+// not start with one
+func xmlRoot(data []byte) *xml.StartElement {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			return &t
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return nil
+			}
+		}
+	}
+}
+
+// xmlAttr returns the value of an element's attribute
+func xmlAttr(element *xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// nmapImporter reads nmap's XML output (-oX)
+type nmapImporter struct {
+	s *ScanService
+}
+
+// Format implements Importer
+func (nmapImporter) Format() string {
+	return FormatNmap
+}
+
+// Detect implements Importer. masscan also writes <nmaprun> documents but
+// names itself as their scanner.
+func (nmapImporter) Detect(data []byte) bool {
+	root := xmlRoot(data)
+	return root != nil && root.Name.Local == "nmaprun" && xmlAttr(root, "scanner") != "masscan"
+}
+
+// Parse implements Importer, refusing output nmap did not finish writing
+func (i nmapImporter) Parse(data []byte) (*ScanResults, error) {
+	var run NmapRun
+	if err := xml.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	if err := checkImportedRun(&run); err != nil {
+		return nil, err
+	}
+	return i.s.nmapResults(&run), nil
+}
+
+// checkImportedRun rejects output that nmap did not finish writing, since
+// its times and results are incomplete
+func checkImportedRun(run *NmapRun) error {
+	switch {
+	case run.Scanner != "nmap":
+		return fmt.Errorf("%w: not produced by nmap", ErrInvalidImport)
+	case run.Start <= 0:
+		return fmt.Errorf("%w: missing start time", ErrInvalidImport)
+	case run.RunStats.Finished.Time <= 0:
+		return fmt.Errorf("%w: missing finish time; the scan may not have completed", ErrInvalidImport)
+	case run.RunStats.Finished.Time < run.Start:
+		return fmt.Errorf("%w: scan finished before it started", ErrInvalidImport)
+	case run.RunStats.Finished.Exit == "error":
+		return fmt.Errorf("%w: nmap reported an error", ErrInvalidImport)
+	}
+	return nil
+}
+
+// hostIndex collects results for formats that report each port of a host
+// separately, keeping hosts in the order they were first seen
+type hostIndex struct {
+	hosts []*HostResult
+	byIP  map[string]*HostResult
+	ports map[string]*models.Port
+}
+
+// newHostIndex creates an empty host index
+func newHostIndex() *hostIndex {
+	return &hostIndex{byIP: make(map[string]*HostResult), ports: make(map[string]*models.Port)}
+}
+
+// host returns the result for an address, adding it if it is new
+func (h *hostIndex) host(ip string) *HostResult {
+	if host, ok := h.byIP[ip]; ok {
+		return host
+	}
+	host := &HostResult{Device: models.Device{IPAddress: ip}}
+	h.byIP[ip] = host
+	h.hosts = append(h.hosts, host)
+	return host
+}
+
+// port returns a host's entry for a port, adding the host and port if they
+// are new
+func (h *hostIndex) port(ip string, number int, protocol string) *models.Port {
+	key := fmt.Sprintf("%s %d/%s", ip, number, protocol)
+	if port, ok := h.ports[key]; ok {
+		return port
+	}
+	host := h.host(ip)
+	port := &models.Port{PortNumber: number, Protocol: protocol, State: "open"}
+	h.ports[key] = port
+	host.Ports = append(host.Ports, port)
+	return port
+}
+
+// timeRange tracks the earliest and latest times seen in a result file
+type timeRange struct {
+	start, end time.Time
+}
+
+// add extends the range to include t
+func (r *timeRange) add(t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	if r.start.IsZero() || t.Before(r.start) {
+		r.start = t
+	}
+	if t.After(r.end) {
+		r.end = t
+	}
+}
+
+// eachLine calls fn with each line of data
+func eachLine(data []byte, fn func(line string) error) error {
+	lines := bufio.NewScanner(bytes.NewReader(data))
+	lines.Buffer(nil, MaxImportSize)
+	for lines.Scan() {
+		if err := fn(lines.Text()); err != nil {
+			return err
+		}
+	}
+	return lines.Err()
+}
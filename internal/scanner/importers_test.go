@@ -0,0 +1,241 @@
+// internal/scanner/importers_test.go
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const masscanXMLOutput = `<?xml version="1.0"?>
+<!-- masscan v1.0 scan -->
+<nmaprun scanner="masscan" start="1677664800" version="1.0-BETA" xmloutputversion="1.03">
+<scaninfo type="syn" protocol="tcp" />
+<host endtime="1677664801"><address addr="10.2.0.1" addrtype="ipv4"/><ports><port protocol="tcp" portid="80"><state state="open" reason="syn-ack" reason_ttl="64"/></port></ports></host>
+<host endtime="1677664802"><address addr="10.2.0.1" addrtype="ipv4"/><ports><port protocol="tcp" portid="443"><state state="open" reason="syn-ack" reason_ttl="64"/></port></ports></host>
+<host endtime="1677664803"><address addr="10.2.0.2" addrtype="ipv4"/><ports><port protocol="tcp" portid="22"><state state="open" reason="syn-ack" reason_ttl="64"/><service name="ssh" banner="SSH-2.0-OpenSSH_8.9"/></port></ports></host>
+<runstats>
+<finished time="1677664830" timestr="2023-03-01 10:00:30" elapsed="30" />
+<hosts up="2" down="0" total="2" />
+</runstats>
+</nmaprun>`
+
+// masscanJSONOutput is in the format older masscan versions write, which
+// is not valid JSON as a whole
+const masscanJSONOutput = `[
+{   "ip": "10.2.0.1",   "timestamp": "1677664801", "ports": [ {"port": 80, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 64} ] },
+{   "ip": "10.2.0.1",   "timestamp": "1677664802", "ports": [ {"port": 443, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 64} ] },
+{   "ip": "10.2.0.2",   "timestamp": "1677664803", "ports": [ {"port": 22, "proto": "tcp", "service": {"name": "ssh", "banner": "SSH-2.0-OpenSSH_8.9"} } ] },
+{finished: 1}
+]`
+
+const masscanListOutput = `#masscan
+open tcp 80 10.2.0.1 1677664801
+open tcp 443 10.2.0.1 1677664802
+open tcp 22 10.2.0.2 1677664803
+banner tcp 22 10.2.0.2 1677664804 ssh SSH-2.0-OpenSSH_8.9
+# end
+`
+
+const zmapCSVOutput = `saddr,sport,classification,success,timestamp_ts
+10.2.0.1,80,synack,1,1677664801
+10.2.0.1,80,synack,1,1677664801
+10.2.0.2,80,rst,0,1677664802
+10.2.0.3,80,synack,1,1677664803
+`
+
+const zmapListOutput = `10.2.0.1
+10.2.0.3
+`
+
+const nessusOutput = `<?xml version="1.0" ?>
+<NessusClientData_v2>
+<Policy><policyName>Basic Network Scan</policyName></Policy>
+<Report name="Quarterly" xmlns:cm="http://www.nessus.org/cm">
+<ReportHost name="10.2.0.1"><HostProperties>
+<tag name="HOST_END_TIMESTAMP">1677665400</tag>
+<tag name="HOST_START_TIMESTAMP">1677664800</tag>
+<tag name="host-ip">10.2.0.1</tag>
+<tag name="host-fqdn">web01.example.com</tag>
+<tag name="mac-address">00:11:22:33:44:aa
+00:11:22:33:44:ab</tag>
+<tag name="operating-system">Linux Kernel 5.15</tag>
+</HostProperties>
+<ReportItem port="0" svc_name="general" protocol="tcp" severity="0" pluginID="19506" pluginName="Nessus Scan Information" pluginFamily="Settings"></ReportItem>
+<ReportItem port="80" svc_name="www" protocol="tcp" severity="0" pluginID="11219" pluginName="Nessus SYN scanner" pluginFamily="Port scanners"></ReportItem>
+<ReportItem port="80" svc_name="www" protocol="tcp" severity="2" pluginID="85582" pluginName="Web Application Potentially Vulnerable to Clickjacking" pluginFamily="Web Servers"></ReportItem>
+<ReportItem port="161" svc_name="snmp?" protocol="udp" severity="0" pluginID="10550" pluginName="SNMP Query Running Process List Disclosure" pluginFamily="SNMP"></ReportItem>
+</ReportHost>
+<ReportHost name="printer.example.com"><HostProperties>
+<tag name="HOST_START">Wed Mar  1 10:15:00 2023</tag>
+<tag name="HOST_END">Wed Mar  1 10:20:00 2023</tag>
+</HostProperties>
+</ReportHost>
+</Report>
+</NessusClientData_v2>`
+
+// describeResults summarizes scan results as "ip port/protocol service ..."
+// lines in a stable order
+func describeResults(results *ScanResults) []string {
+	var lines []string
+	for _, host := range results.Hosts {
+		line := host.Device.IPAddress
+		for _, port := range host.Ports {
+			line += fmt.Sprintf(" %d/%s", port.PortNumber, port.Protocol)
+			if port.ServiceName != "" {
+				line += ":" + port.ServiceName
+			}
+		}
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// TestImporters tests format detection and parsing for each importer
+func TestImporters(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	tests := []struct {
+		name   string
+		data   string
+		format string
+		hosts  []string
+		start  int64
+		end    int64
+	}{
+		{"nmap", importedScanOutput, FormatNmap, []string{"10.1.0.5 22/tcp:ssh 80/tcp:http"}, 1677664800, 1677664895},
+		{"masscan xml", masscanXMLOutput, FormatMasscan, []string{"10.2.0.1 80/tcp 443/tcp", "10.2.0.2 22/tcp:ssh"}, 1677664800, 1677664830},
+		{"masscan json", masscanJSONOutput, FormatMasscan, []string{"10.2.0.1 80/tcp 443/tcp", "10.2.0.2 22/tcp:ssh"}, 1677664801, 1677664803},
+		{"masscan list", masscanListOutput, FormatMasscan, []string{"10.2.0.1 80/tcp 443/tcp", "10.2.0.2 22/tcp:ssh"}, 1677664801, 1677664804},
+		{"zmap csv", zmapCSVOutput, FormatZMap, []string{"10.2.0.1 80/tcp", "10.2.0.3 80/tcp"}, 1677664801, 1677664803},
+		{"zmap list", zmapListOutput, FormatZMap, []string{"10.2.0.1", "10.2.0.3"}, 0, 0},
+		{"nessus", nessusOutput, FormatNessus, []string{"10.2.0.1 80/tcp:www 161/udp:snmp"}, 1677664800, 1677665400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			importer := scanService.detectImporter([]byte(tt.data))
+			if importer == nil || importer.Format() != tt.format {
+				t.Fatalf("Expected format %s to be detected, got %v", tt.format, importer)
+			}
+
+			results, err := importer.Parse([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+
+			if got := describeResults(results); fmt.Sprint(got) != fmt.Sprint(tt.hosts) {
+				t.Errorf("Expected hosts %q, got %q", tt.hosts, got)
+			}
+
+			if results.Start.Unix() != tt.start && !(tt.start == 0 && results.Start.IsZero()) {
+				t.Errorf("Expected start %d, got %v", tt.start, results.Start)
+			}
+			if results.End.Unix() != tt.end && !(tt.end == 0 && results.End.IsZero()) {
+				t.Errorf("Expected end %d, got %v", tt.end, results.End)
+			}
+		})
+	}
+}
+
+// TestNessusHostProperties tests that Nessus host properties fill in the device
+func TestNessusHostProperties(t *testing.T) {
+	results, err := nessusImporter{}.Parse([]byte(nessusOutput))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	device := results.Hosts[0].Device
+	if device.Hostname != "web01.example.com" || device.MACAddress != "00:11:22:33:44:AA" || device.OSFingerprint != "Linux Kernel 5.15" {
+		t.Errorf("Unexpected device: %+v", device)
+	}
+}
+
+// TestImportersInvalid tests that malformed files in each format are refused
+func TestImportersInvalid(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"masscan xml without start", strings.Replace(masscanXMLOutput, ` start="1677664800"`, "", 1)},
+		{"masscan json", `[{"ip": "10.2.0.1", "ports": [ {"port": "http"} ]}`},
+		{"masscan list", "#masscan\nopen tcp eighty 10.2.0.1 1677664801\n"},
+		{"zmap csv", "saddr,sport\nnot-an-address,80\n"},
+		{"zmap list", "10.2.0.1\nexample.com\n"},
+		{"nessus", "<NessusClientData_v2><Report><ReportHost name=\"10.2.0.1\">"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := scanService.ImportScan(strings.NewReader(tt.data), tt.name); !errors.Is(err, ErrInvalidImport) {
+				t.Errorf("Expected ErrInvalidImport, got %v", err)
+			}
+		})
+	}
+}
+
+// TestImportFormatsShareInventory tests that imports in different formats
+// update the same devices and record changes like native scans
+func TestImportFormatsShareInventory(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	masscanScan, err := scanService.ImportScan(strings.NewReader(masscanListOutput), "sweep.txt")
+	if err != nil {
+		t.Fatalf("Failed to import masscan output: %v", err)
+	}
+	if masscanScan.Template != "import-masscan" || masscanScan.DevicesFound != 2 || masscanScan.PortsFound != 3 {
+		t.Errorf("Unexpected masscan import: %+v", masscanScan)
+	}
+	if !masscanScan.Timestamp.Equal(time.Unix(1677664801, 0)) || masscanScan.Duration != 3 {
+		t.Errorf("Expected the times in the output, got %v and %ds", masscanScan.Timestamp, masscanScan.Duration)
+	}
+
+	zmapScan, err := scanService.ImportScan(strings.NewReader(zmapCSVOutput), "port80.csv")
+	if err != nil {
+		t.Fatalf("Failed to import ZMap output: %v", err)
+	}
+	if zmapScan.Template != "import-zmap" || zmapScan.DevicesFound != 2 || zmapScan.PortsFound != 2 {
+		t.Errorf("Unexpected ZMap import: %+v", zmapScan)
+	}
+
+	var devices int
+	if err := db.QueryRow("SELECT COUNT(*) FROM devices").Scan(&devices); err != nil {
+		t.Fatalf("Failed to count devices: %v", err)
+	}
+	if devices != 3 {
+		t.Errorf("Expected 3 devices, got %d", devices)
+	}
+
+	changes := make(map[string]int)
+	rows, err := db.Query("SELECT change_type FROM changes")
+	if err != nil {
+		t.Fatalf("Failed to query changes: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var changeType string
+		if err := rows.Scan(&changeType); err != nil {
+			t.Fatalf("Failed to scan change: %v", err)
+		}
+		changes[changeType]++
+	}
+
+	// Two new devices and three new ports from masscan; ZMap finds port 80
+	// again on one of them and adds a device with a new port
+	if changes["new_device"] != 3 || changes["new_port"] != 4 || len(changes) != 2 {
+		t.Errorf("Unexpected changes: %v", changes)
+	}
+}
@@ -0,0 +1,147 @@
+package scanner
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+
+	"panopticon-scanner/internal/models"
+)
+
+// MaxImportSize is the largest file that can be imported, after decompression
+const MaxImportSize = 256 << 20
+
+// importTemplatePrefix prefixes the format in the template name recorded for
+// imported scans, as in "import-masscan"
+const importTemplatePrefix = "import-"
+
+var (
+	// ErrInvalidImport is returned when an imported file is not complete output
+	// in a supported format
+	ErrInvalidImport = errors.New("invalid scan results")
+
+	// ErrDuplicateImport is returned when a file has already been imported
+	ErrDuplicateImport = errors.New("scan output has already been imported")
+)
+
+// ImportScan stores the results of scans run elsewhere: nmap XML, masscan,
+// ZMap or Nessus output, detected from the file's contents, which may be
+// gzip-compressed. The import is recorded as a scan with source "import" and
+// the start and end times of the original run where the format records them,
+// and its hosts are stored like the results of the scanner's own scans.
+func (s *ScanService) ImportScan(r io.Reader, name string) (*models.Scan, error) {
+	data, err := readImport(r)
+	if err != nil {
+		return nil, err
+	}
+
+	importer := s.detectImporter(data)
+	if importer == nil {
+		return nil, fmt.Errorf("%w: unrecognized format", ErrInvalidImport)
+	}
+
+	results, err := importer.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	// Imports run one at a time so the same file cannot slip in twice
+	s.importLock.Lock()
+	defer s.importLock.Unlock()
+
+	existing, err := s.db.GetImportedScanID(hash)
+	if err != nil {
+		return nil, err
+	}
+	if existing != 0 {
+		return nil, fmt.Errorf("%w as scan %d", ErrDuplicateImport, existing)
+	}
+
+	// Keep the output alongside the scanner's own so retention applies to it
+	if err := os.MkdirAll(s.config.Scanner.OutputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create scan output directory: %w", err)
+	}
+	outputPath := filepath.Join(s.config.Scanner.OutputDir,
+		fmt.Sprintf("import_%s.%s", uuid.New().String(), importer.Format()))
+	if err := ioutil.WriteFile(outputPath, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write imported scan output: %w", err)
+	}
+
+	// Formats that do not record when they ran are dated by the import
+	started, finished := results.Start, results.End
+	if started.IsZero() {
+		started = time.Now()
+	}
+	if finished.Before(started) {
+		finished = started
+	}
+	duration := finished.Sub(started)
+
+	scanID, err := s.db.CreateImportedScan(&models.Scan{
+		Timestamp: started,
+		Template:  importTemplatePrefix + importer.Format(),
+		Duration:  int(duration.Seconds()),
+	}, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := s.logger.With().Int64("scanID", scanID).Str("file", name).Str("format", importer.Format()).Logger()
+	logger.Info().Time("started", started).Int("hosts", len(results.Hosts)).Msg("Importing scan results")
+
+	deviceCount, portCount := s.storeResults(scanID, results)
+
+	if err := s.db.UpdateScan(scanID, "completed", deviceCount, portCount, duration, ""); err != nil {
+		return nil, err
+	}
+
+	// Compress the output to save space if enabled
+	if s.config.Scanner.CompressOutput {
+		go s.compressOutputFile(outputPath)
+	}
+
+	logger.Info().
+		Int("devices", deviceCount).
+		Int("ports", portCount).
+		Msg("Imported scan results")
+
+	return s.db.GetScan(scanID)
+}
+
+// readImport reads an imported file, decompressing it if it is gzipped
+func readImport(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+
+	var src io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+		defer gz.Close()
+		src = gz
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(src, MaxImportSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	if len(data) > MaxImportSize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrInvalidImport, MaxImportSize)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,221 @@
+// internal/scanner/imports_test.go
+package scanner
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"panopticon-scanner/internal/models"
+)
+
+// importedScanOutput is complete nmap output from a run started at
+// 2023-03-01 10:00:00 UTC that took 95 seconds
+const importedScanOutput = `<?xml version="1.0"?>
+<nmaprun scanner="nmap" args="nmap -sS -oX out.xml 10.1.0.0/24" start="1677664800" version="7.94">
+<host><status state="up"/>
+<address addr="10.1.0.5" addrtype="ipv4"/>
+<address addr="00:11:22:33:44:77" addrtype="mac"/>
+<ports>
+<port protocol="tcp" portid="22"><state state="open" reason="syn-ack"/><service name="ssh"/></port>
+<port protocol="tcp" portid="80"><state state="open" reason="syn-ack"/><service name="http"/></port>
+</ports>
+</host>
+<host><status state="down"/>
+<address addr="10.1.0.6" addrtype="ipv4"/>
+</host>
+<runstats><finished time="1677664895" elapsed="95.12" exit="success"/><hosts up="1" down="1" total="2"/></runstats>
+</nmaprun>`
+
+// gzipped returns data compressed with gzip
+func gzipped(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(data)); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestImportScan tests importing nmap output produced elsewhere
+func TestImportScan(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	scan, err := scanService.ImportScan(bytes.NewReader(gzipped(t, importedScanOutput)), "contractor.xml.gz")
+	if err != nil {
+		t.Fatalf("Failed to import scan: %v", err)
+	}
+
+	if scan.Source != "import" || scan.Status != "completed" || scan.Template != "import-nmap" {
+		t.Errorf("Unexpected imported scan: %+v", scan)
+	}
+
+	if !scan.Timestamp.Equal(time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC)) || scan.Duration != 95 {
+		t.Errorf("Expected the original start time and duration, got %v and %ds", scan.Timestamp, scan.Duration)
+	}
+
+	if scan.DevicesFound != 1 || scan.PortsFound != 2 {
+		t.Errorf("Expected 1 device and 2 ports, got %d and %d", scan.DevicesFound, scan.PortsFound)
+	}
+
+	device, err := db.GetDeviceByIP("10.1.0.5")
+	if err != nil {
+		t.Fatalf("Imported device was not stored: %v", err)
+	}
+	if device.MACAddress != "00:11:22:33:44:77" {
+		t.Errorf("Unexpected imported device: %+v", device)
+	}
+
+	// The hosts take their place in history at the end of the original run
+	hosts, err := scanService.GetScanHosts(scan.ID)
+	if err != nil {
+		t.Fatalf("Failed to get scan hosts: %v", err)
+	}
+	if len(hosts) != 1 || hosts[0].DeviceID != device.ID || len(hosts[0].Ports) != 2 {
+		t.Fatalf("Unexpected scan hosts: %+v", hosts)
+	}
+	if !hosts[0].ObservedAt.Equal(time.Date(2023, 3, 1, 10, 1, 35, 0, time.UTC)) {
+		t.Errorf("Expected observation at the end of the run, got %v", hosts[0].ObservedAt)
+	}
+
+	if _, err := scanService.GetScanHosts(scan.ID + 100); !errors.Is(err, ErrScanNotFound) {
+		t.Errorf("Expected ErrScanNotFound, got %v", err)
+	}
+
+	// The same output is refused, compressed or not
+	_, err = scanService.ImportScan(strings.NewReader(importedScanOutput), "contractor.xml")
+	if !errors.Is(err, ErrDuplicateImport) {
+		t.Errorf("Expected ErrDuplicateImport, got %v", err)
+	}
+}
+
+// TestImportScanInvalid tests that malformed and incomplete output is refused
+func TestImportScanInvalid(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"not xml", "Nmap scan report for 10.1.0.5"},
+		{"other document", `<?xml version="1.0"?><report start="1677664800"/>`},
+		{"truncated", importedScanOutput[:len(importedScanOutput)/2]},
+		{"unfinished", strings.Replace(importedScanOutput, `<runstats><finished time="1677664895" elapsed="95.12" exit="success"/>`, "<runstats>", 1)},
+		{"no start time", strings.Replace(importedScanOutput, ` start="1677664800"`, "", 1)},
+		{"not nmap", strings.Replace(importedScanOutput, `scanner="nmap"`, `scanner="unicornscan"`, 1)},
+		{"nmap error", strings.Replace(importedScanOutput, `exit="success"`, `exit="error"`, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := scanService.ImportScan(strings.NewReader(tt.data), tt.name); !errors.Is(err, ErrInvalidImport) {
+				t.Errorf("Expected ErrInvalidImport, got %v", err)
+			}
+		})
+	}
+
+	if _, err := scanService.ImportScan(bytes.NewReader(gzipped(t, importedScanOutput)[:20]), "truncated.gz"); !errors.Is(err, ErrInvalidImport) {
+		t.Errorf("Expected ErrInvalidImport for truncated gzip, got %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM scans").Scan(&count); err != nil {
+		t.Fatalf("Failed to count scans: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected no scans to be recorded, got %d", count)
+	}
+}
+
+// TestImportScanKeepsNewerInventory tests that importing results older than
+// the inventory records them in history without replacing what later scans
+// found
+func TestImportScanKeepsNewerInventory(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	// Scanned today, since moved to another address
+	deviceID, err := db.SaveDevice(&models.Device{IPAddress: "10.1.0.50", MACAddress: "00:11:22:33:44:77", Hostname: "web"})
+	if err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	if err := db.SavePort(&models.Port{DeviceID: deviceID, PortNumber: 22, Protocol: "tcp", ServiceName: "ssh", ServiceVersion: "OpenSSH 9.6"}); err != nil {
+		t.Fatalf("Failed to save port: %v", err)
+	}
+	before, err := db.GetDevice(deviceID)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+
+	scan, err := scanService.ImportScan(strings.NewReader(importedScanOutput), "2023.xml")
+	if err != nil {
+		t.Fatalf("Failed to import scan: %v", err)
+	}
+
+	device, err := db.GetDevice(deviceID)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if device.IPAddress != "10.1.0.50" || device.Hostname != "web" || !device.LastSeen.Equal(before.LastSeen) {
+		t.Errorf("Expected the newer inventory to be kept, got %+v", device)
+	}
+
+	var changes int
+	err = db.QueryRow(
+		`SELECT COUNT(*) FROM changes WHERE device_id = ? AND change_type IN ('device_change', 'ip_changed', 'port_change')`, deviceID,
+	).Scan(&changes)
+	if err != nil {
+		t.Fatalf("Failed to count changes: %v", err)
+	}
+	if changes != 0 {
+		t.Errorf("Expected no changes from the older results, got %d", changes)
+	}
+
+	// The port only the import found is dated by the original run
+	details, err := db.GetDeviceDetails(deviceID)
+	if err != nil {
+		t.Fatalf("Failed to get device details: %v", err)
+	}
+	for _, port := range details.Ports {
+		switch port.PortNumber {
+		case 22:
+			if port.ServiceVersion != "OpenSSH 9.6" || port.LastSeen.Year() == 2023 {
+				t.Errorf("Expected port 22 to keep the newer scan's data, got %+v", port)
+			}
+		case 80:
+			if port.LastSeen.Year() != 2023 {
+				t.Errorf("Expected port 80 to be dated by the original run, got %+v", port)
+			}
+		}
+	}
+
+	// The observation is still recorded, and the old address kept in history
+	hosts, err := scanService.GetScanHosts(scan.ID)
+	if err != nil {
+		t.Fatalf("Failed to get scan hosts: %v", err)
+	}
+	if len(hosts) != 1 || hosts[0].DeviceID != deviceID || hosts[0].IPAddress != "10.1.0.5" {
+		t.Errorf("Expected the imported observation, got %+v", hosts)
+	}
+
+	addresses, err := db.GetDeviceAddressHistory(deviceID)
+	if err != nil {
+		t.Fatalf("Failed to get address history: %v", err)
+	}
+	if len(addresses) != 2 || addresses[0].Address != "10.1.0.50" || addresses[1].Address != "10.1.0.5" {
+		t.Errorf("Expected the imported address in history, got %+v", addresses)
+	}
+}
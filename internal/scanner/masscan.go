@@ -0,0 +1,241 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// masscanBannerTypes are masscan banner types that describe content rather
+// than name the service on the port
+var masscanBannerTypes = map[string]bool{"title": true, "html": true, "X509": true, "X509CAcert": true}
+
+// masscanImporter reads masscan's XML (-oX), JSON (-oJ and -oD) and list
+// (-oL) output
+type masscanImporter struct{}
+
+// masscanRecord is a host entry in masscan's JSON output
+type masscanRecord struct {
+	IP        string          `json:"ip"`
+	Timestamp json.RawMessage `json:"timestamp"`
+	Ports     []struct {
+		Port    int    `json:"port"`
+		Proto   string `json:"proto"`
+		Status  string `json:"status"`
+		Reason  string `json:"reason"`
+		Service *struct {
+			Name string `json:"name"`
+		} `json:"service"`
+	} `json:"ports"`
+}
+
+// Format implements Importer
+func (masscanImporter) Format() string {
+	return FormatMasscan
+}
+
+// Detect implements Importer
+func (masscanImporter) Detect(data []byte) bool {
+	if root := xmlRoot(data); root != nil {
+		return root.Name.Local == "nmaprun" && xmlAttr(root, "scanner") == "masscan"
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("#masscan")) {
+		return true
+	}
+	return (bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{"))) &&
+		bytes.Contains(trimmed, []byte(`"ip"`)) && bytes.Contains(trimmed, []byte(`"ports"`))
+}
+
+// Parse implements Importer
+func (i masscanImporter) Parse(data []byte) (*ScanResults, error) {
+	if xmlRoot(data) != nil {
+		return i.parseXML(data)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("#masscan")) {
+		return i.parseList(data)
+	}
+	return i.parseJSON(data)
+}
+
+// parseXML reads masscan's XML output, which lists each open port as a
+// separate host
+func (masscanImporter) parseXML(data []byte) (*ScanResults, error) {
+	var run NmapRun
+	if err := xml.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	if run.Start <= 0 {
+		return nil, fmt.Errorf("%w: missing start time", ErrInvalidImport)
+	}
+
+	index := newHostIndex()
+	var times timeRange
+	times.add(time.Unix(run.Start, 0))
+	if run.RunStats.Finished.Time > 0 {
+		times.add(time.Unix(run.RunStats.Finished.Time, 0))
+	}
+
+	for _, host := range run.Hosts {
+		ip := ""
+		for _, addr := range host.Addresses {
+			if addr.AddrType == "ipv4" || addr.AddrType == "ipv6" {
+				ip = addr.Addr
+			}
+		}
+		if ip == "" {
+			continue
+		}
+		if host.EndTime > 0 {
+			times.add(time.Unix(host.EndTime, 0))
+		}
+
+		index.host(ip)
+		for _, p := range host.Ports.Port {
+			number, err := strconv.Atoi(p.PortID)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid port %q", ErrInvalidImport, p.PortID)
+			}
+			if !storedPortStates[p.State.State] || !isScannedProtocol(p.Protocol) {
+				continue
+			}
+			port := index.port(ip, number, p.Protocol)
+			port.Reason = p.State.Reason
+			if p.Service.Name != "" && !masscanBannerTypes[p.Service.Name] {
+				port.ServiceName = p.Service.Name
+			}
+		}
+	}
+
+	return &ScanResults{Format: FormatMasscan, Start: times.start, End: times.end, Hosts: index.hosts}, nil
+}
+
+// parseList reads masscan's list output, lines of the form
+// "open tcp 80 10.0.0.1 1677664800" and "banner tcp 80 10.0.0.1 1677664801 http ..."
+func (masscanImporter) parseList(data []byte) (*ScanResults, error) {
+	index := newHostIndex()
+	var times timeRange
+
+	err := eachLine(data, func(line string) error {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			return nil
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			return fmt.Errorf("%w: unexpected line %q", ErrInvalidImport, line)
+		}
+		status, protocol, ip := fields[0], fields[1], fields[3]
+
+		number, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return fmt.Errorf("%w: invalid port in line %q", ErrInvalidImport, line)
+		}
+		seen, err := parseUnixTime(fields[4])
+		if err != nil {
+			return fmt.Errorf("%w: invalid timestamp in line %q", ErrInvalidImport, line)
+		}
+		times.add(seen)
+
+		index.host(ip)
+		if !isScannedProtocol(protocol) {
+			return nil
+		}
+
+		switch status {
+		case "open":
+			index.port(ip, number, protocol)
+		case "banner":
+			port := index.port(ip, number, protocol)
+			if len(fields) > 5 && port.ServiceName == "" && !masscanBannerTypes[fields[5]] {
+				port.ServiceName = fields[5]
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ScanResults{Format: FormatMasscan, Start: times.start, End: times.end, Hosts: index.hosts}, nil
+}
+
+// parseJSON reads masscan's JSON output. Older versions of masscan do not
+// write valid JSON, so unless the whole file parses as an array of records,
+// each line is read as a record.
+func (masscanImporter) parseJSON(data []byte) (*ScanResults, error) {
+	var records []masscanRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		records = nil
+		err = eachLine(data, func(line string) error {
+			line = strings.Trim(strings.TrimSpace(line), ",")
+			if line == "" || line == "[" || line == "]" || strings.HasPrefix(line, "{finished") {
+				return nil
+			}
+
+			var record masscanRecord
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidImport, err)
+			}
+			records = append(records, record)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	index := newHostIndex()
+	var times timeRange
+
+	for _, record := range records {
+		if record.IP == "" {
+			return nil, fmt.Errorf("%w: record without an IP address", ErrInvalidImport)
+		}
+
+		if len(record.Timestamp) > 0 {
+			seen, err := parseUnixTime(strings.Trim(string(record.Timestamp), `"`))
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid timestamp %s", ErrInvalidImport, record.Timestamp)
+			}
+			times.add(seen)
+		}
+
+		index.host(record.IP)
+		for _, p := range record.Ports {
+			if !isScannedProtocol(p.Proto) || (p.Status != "" && !storedPortStates[p.Status]) {
+				continue
+			}
+			port := index.port(record.IP, p.Port, p.Proto)
+			if p.Reason != "" {
+				port.Reason = p.Reason
+			}
+			if p.Service != nil && port.ServiceName == "" && !masscanBannerTypes[p.Service.Name] {
+				port.ServiceName = p.Service.Name
+			}
+		}
+	}
+
+	return &ScanResults{Format: FormatMasscan, Start: times.start, End: times.end, Hosts: index.hosts}, nil
+}
+
+// parseUnixTime parses a time given in seconds since the epoch
+func parseUnixTime(value string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// isScannedProtocol reports whether ports of a protocol are stored
+func isScannedProtocol(protocol string) bool {
+	_, ok := protocolScanArgs[protocol]
+	return ok
+}
@@ -0,0 +1,127 @@
+package scanner
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// nessusTimeLayout is the layout of the HOST_START and HOST_END properties
+const nessusTimeLayout = "Mon Jan _2 15:04:05 2006"
+
+// nessusImporter reads Nessus exports (.nessus, version 2)
+type nessusImporter struct{}
+
+// nessusReport is the root of a .nessus file
+type nessusReport struct {
+	XMLName xml.Name     `xml:"NessusClientData_v2"`
+	Hosts   []nessusHost `xml:"Report>ReportHost"`
+}
+
+// nessusHost is a scanned host with its properties and findings
+type nessusHost struct {
+	Name       string       `xml:"name,attr"`
+	Properties []nessusTag  `xml:"HostProperties>tag"`
+	Items      []nessusItem `xml:"ReportItem"`
+}
+
+// nessusTag is a host property
+type nessusTag struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+// nessusItem is a plugin finding, reported against a port or against the
+// host as port 0
+type nessusItem struct {
+	Port     int    `xml:"port,attr"`
+	Protocol string `xml:"protocol,attr"`
+	Service  string `xml:"svc_name,attr"`
+}
+
+// Format implements Importer
+func (nessusImporter) Format() string {
+	return FormatNessus
+}
+
+// Detect implements Importer
+func (nessusImporter) Detect(data []byte) bool {
+	root := xmlRoot(data)
+	return root != nil && root.Name.Local == "NessusClientData_v2"
+}
+
+// Parse implements Importer. Any port a finding was reported against is
+// recorded as open.
+func (nessusImporter) Parse(data []byte) (*ScanResults, error) {
+	var report nessusReport
+	if err := xml.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+
+	index := newHostIndex()
+	var times timeRange
+
+	for _, h := range report.Hosts {
+		properties := make(map[string]string, len(h.Properties))
+		for _, tag := range h.Properties {
+			properties[tag.Name] = strings.TrimSpace(tag.Value)
+		}
+
+		ip := properties["host-ip"]
+		if ip == "" && net.ParseIP(h.Name) != nil {
+			ip = h.Name
+		}
+		if ip == "" {
+			continue
+		}
+
+		times.add(nessusTime(properties, "HOST_START"))
+		times.add(nessusTime(properties, "HOST_END"))
+
+		host := index.host(ip)
+		// Nessus lists every MAC address of a host, in lower case; use the
+		// first, in the upper case nmap reports
+		host.Device.MACAddress = strings.ToUpper(firstOf(properties["mac-address"]))
+		host.Device.OSFingerprint = firstOf(properties["operating-system"])
+		for _, name := range []string{"host-fqdn", "hostname", "netbios-name"} {
+			if properties[name] != "" {
+				host.Device.Hostname = properties[name]
+				break
+			}
+		}
+
+		for _, item := range h.Items {
+			if item.Port <= 0 || !isScannedProtocol(item.Protocol) {
+				continue
+			}
+			port := index.port(ip, item.Port, item.Protocol)
+			if service := strings.TrimSuffix(item.Service, "?"); service != "unknown" && port.ServiceName == "" {
+				port.ServiceName = service
+			}
+		}
+	}
+
+	return &ScanResults{Format: FormatNessus, Start: times.start, End: times.end, Hosts: index.hosts}, nil
+}
+
+// nessusTime returns a host's start or end time, preferring the
+// *_TIMESTAMP property newer versions of Nessus write
+func nessusTime(properties map[string]string, name string) time.Time {
+	if seen, err := parseUnixTime(properties[name+"_TIMESTAMP"]); err == nil {
+		return seen
+	}
+	if seen, err := time.ParseInLocation(nessusTimeLayout, properties[name], time.Local); err == nil {
+		return seen
+	}
+	return time.Time{}
+}
+
+// firstOf returns the first line of a multi-line property
+func firstOf(value string) string {
+	if i := strings.IndexByte(value, '\n'); i >= 0 {
+		value = value[:i]
+	}
+	return strings.TrimSpace(value)
+}
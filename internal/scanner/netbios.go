@@ -0,0 +1,96 @@
+package scanner
+
+import (
+	"regexp"
+	"strings"
+
+	"panopticon-scanner/internal/models"
+)
+
+var (
+	// nbstatName matches the computer name in nbstat's output, e.g.
+	// "NetBIOS name: WIN-SRV, NetBIOS user: <unknown>, NetBIOS MAC: ..."
+	nbstatName = regexp.MustCompile(`NetBIOS name: ([^,\s]+)`)
+
+	// nbstatGroup matches the workgroup or domain in the names nbstat lists
+	// in verbose mode, e.g. "  WORKGROUP<00>  Flags: <group><active>"
+	nbstatGroup = regexp.MustCompile(`(?m)^\s*(\S+)<00>\s+Flags: <group>`)
+
+	// smbOutputLine matches a "Key: value" line of smb-os-discovery's output
+	smbOutputLine = regexp.MustCompile(`(?m)^\s*([A-Za-z ]+): (.+)$`)
+)
+
+// applyNetBIOSScripts sets the NetBIOS name, workgroup and SMB OS of a device
+// from the output of the nbstat and smb-os-discovery host scripts.
+// smb-os-discovery is preferred, as it also reports the domain of hosts that
+// have joined one.
+func applyNetBIOSScripts(device *models.Device, scripts []Script) {
+	for _, script := range scripts {
+		if script.ID != "nbstat" {
+			continue
+		}
+		if match := nbstatName.FindStringSubmatch(script.Output); match != nil && !strings.HasPrefix(match[1], "<") {
+			device.NetBIOSName = match[1]
+		}
+		if match := nbstatGroup.FindStringSubmatch(script.Output); match != nil {
+			device.Workgroup = match[1]
+		}
+	}
+
+	for _, script := range scripts {
+		if script.ID != "smb-os-discovery" {
+			continue
+		}
+		values := smbOSDiscoveryValues(script)
+		if name := firstValue(values, "NetBIOS computer name", "server"); name != "" {
+			device.NetBIOSName = name
+		}
+		if group := firstValue(values, "NetBIOS domain name", "workgroup", "Workgroup", "domain"); group != "" {
+			device.Workgroup = group
+		}
+		if os := firstValue(values, "os", "OS"); os != "" {
+			device.SMBOS = os
+		}
+	}
+}
+
+// smbOSDiscoveryValues returns the values reported by smb-os-discovery, from
+// its structured output or, for older versions of nmap, its text output
+func smbOSDiscoveryValues(script Script) map[string]string {
+	values := make(map[string]string)
+	for _, elem := range script.Elems {
+		values[elem.Key] = cleanSMBValue(elem.Value)
+	}
+	if len(values) > 0 {
+		return values
+	}
+
+	for _, match := range smbOutputLine.FindAllStringSubmatch(script.Output, -1) {
+		value := cleanSMBValue(match[2])
+		if match[1] == "OS" {
+			// "Windows Server 2019 Standard 17763 (Windows Server 2019 Standard 6.3)"
+			if i := strings.Index(value, " ("); i > 0 {
+				value = value[:i]
+			}
+		}
+		values[match[1]] = value
+	}
+	return values
+}
+
+// cleanSMBValue removes the NUL terminators SMB strings are reported with,
+// which nmap writes as "\x00"
+func cleanSMBValue(value string) string {
+	value = strings.ReplaceAll(value, `\x00`, "")
+	return strings.TrimSpace(strings.Trim(value, "\x00"))
+}
+
+// firstValue returns the first non-empty value of the given keys
+func firstValue(values map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := values[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+// internal/scanner/netbios_test.go
+package scanner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestApplyNetBIOSScripts tests reading the NetBIOS name, workgroup and SMB
+// OS from nbstat and smb-os-discovery output
+func TestApplyNetBIOSScripts(t *testing.T) {
+	nbstat := Script{
+		ID: "nbstat",
+		Output: "NetBIOS name: FILESRV, NetBIOS user: <unknown>, NetBIOS MAC: 00:11:22:33:44:55 (Example)\n" +
+			"Names:\n" +
+			"  FILESRV<00>          Flags: <unique><active>\n" +
+			"  OFFICE<00>           Flags: <group><active>\n",
+	}
+	structured := Script{
+		ID:     "smb-os-discovery",
+		Output: "\n  OS: Windows Server 2019 Standard 17763 (Windows Server 2019 Standard 6.3)\n",
+		Elems: []ScriptElem{
+			{Key: "os", Value: "Windows Server 2019 Standard 17763"},
+			{Key: "server", Value: `DC01\x00`},
+			{Key: "NetBIOS computer name", Value: `DC01\x00`},
+			{Key: "NetBIOS domain name", Value: `CORP\x00`},
+			{Key: "domain_dns", Value: "corp.example.com"},
+		},
+	}
+	text := Script{
+		ID: "smb-os-discovery",
+		Output: "\n  OS: Windows 10 Pro 19045 (Windows 10 Pro 6.3)\n" +
+			"  Computer name: desktop\n" +
+			`  NetBIOS computer name: DESKTOP\x00` + "\n" +
+			`  Workgroup: HOME\x00` + "\n" +
+			"  System time: 2024-03-01T09:00:00+00:00\n",
+	}
+
+	tests := []struct {
+		name    string
+		scripts []Script
+		want    models.Device
+	}{
+		{"nbstat", []Script{nbstat}, models.Device{NetBIOSName: "FILESRV", Workgroup: "OFFICE"}},
+		{"structured smb-os-discovery", []Script{structured}, models.Device{NetBIOSName: "DC01", Workgroup: "CORP", SMBOS: "Windows Server 2019 Standard 17763"}},
+		{"text smb-os-discovery", []Script{text}, models.Device{NetBIOSName: "DESKTOP", Workgroup: "HOME", SMBOS: "Windows 10 Pro 19045"}},
+		{"smb-os-discovery preferred", []Script{structured, nbstat}, models.Device{NetBIOSName: "DC01", Workgroup: "CORP", SMBOS: "Windows Server 2019 Standard 17763"}},
+		{"unknown name", []Script{{ID: "nbstat", Output: "NetBIOS name: <unknown>, NetBIOS user: <unknown>"}}, models.Device{}},
+		{"other scripts", []Script{{ID: "ssh-hostkey", Output: "NetBIOS name: NOPE"}}, models.Device{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var device models.Device
+			applyNetBIOSScripts(&device, tt.scripts)
+			if device.NetBIOSName != tt.want.NetBIOSName || device.Workgroup != tt.want.Workgroup || device.SMBOS != tt.want.SMBOS {
+				t.Errorf("Expected %q, %q, %q, got %q, %q, %q",
+					tt.want.NetBIOSName, tt.want.Workgroup, tt.want.SMBOS,
+					device.NetBIOSName, device.Workgroup, device.SMBOS)
+			}
+		})
+	}
+}
+
+// TestProcessScanResultsNetBIOS tests that the NetBIOS details of hosts are
+// stored and changes to them recorded
+func TestProcessScanResultsNetBIOS(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	output := func(name string) string {
+		return `<?xml version="1.0"?>
+<nmaprun>
+<host><status state="up"/>
+<address addr="192.168.1.60" addrtype="ipv4"/>
+<ports>
+<port protocol="tcp" portid="445"><state state="open"/><service name="microsoft-ds"/></port>
+</ports>
+<hostscript>
+<script id="nbstat" output="NetBIOS name: ` + name + `, NetBIOS user: &lt;unknown&gt;, NetBIOS MAC: 00:11:22:33:44:60"/>
+<script id="smb-os-discovery" output="&#xa;  OS: Windows 10 Pro 19045 (Windows 10 Pro 6.3)&#xa;">
+<elem key="os">Windows 10 Pro 19045</elem>
+<elem key="NetBIOS computer name">` + name + `\x00</elem>
+<elem key="workgroup">WORKGROUP\x00</elem>
+</script>
+</hostscript>
+</host>
+</nmaprun>`
+	}
+
+	outputPath := filepath.Join(tempDir, "netbios.xml")
+	var scanID int64
+	for _, name := range []string{"PC-01", "PC-02"} {
+		var err error
+		scanID, err = db.CreateScan("default")
+		if err != nil {
+			t.Fatalf("Failed to create scan: %v", err)
+		}
+		if err := ioutil.WriteFile(outputPath, []byte(output(name)), 0644); err != nil {
+			t.Fatalf("Failed to write scan output: %v", err)
+		}
+		if _, _, err := scanService.processScanResults(scanID, outputPath, nil); err != nil {
+			t.Fatalf("Failed to process scan results: %v", err)
+		}
+	}
+
+	device, err := db.GetDeviceByIP("192.168.1.60")
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if device.NetBIOSName != "PC-02" || device.Workgroup != "WORKGROUP" || device.SMBOS != "Windows 10 Pro 19045" {
+		t.Errorf("Unexpected NetBIOS details: %+v", device)
+	}
+
+	changes, err := db.GetScanChanges(scanID)
+	if err != nil {
+		t.Fatalf("Failed to get changes: %v", err)
+	}
+	found := false
+	for _, change := range changes {
+		found = found || change.Details == "NetBIOS name changed: PC-01 -> PC-02; "
+	}
+	if !found {
+		t.Errorf("Expected a change to the NetBIOS name, got %+v", changes)
+	}
+
+	results, err := db.SearchDevices("workgroup")
+	if err != nil || len(results) != 1 || results[0].ID != device.ID {
+		t.Errorf("Expected to find the device by workgroup, got %+v (%v)", results, err)
+	}
+}
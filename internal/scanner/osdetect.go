@@ -0,0 +1,85 @@
+package scanner
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"panopticon-scanner/internal/models"
+)
+
+// deviceTypes maps nmap's device types to the broader types devices are
+// reported as. Types not listed are kept as they are, in lower case.
+var deviceTypes = map[string]string{
+	"broadband router": "router",
+	"voip phone":       "phone",
+	"print server":     "printer",
+}
+
+// applyOSMatches sets the OS fingerprint of a device from nmap's OS matches,
+// keeping every match with its accuracy. The family, device type and CPEs
+// come from the most accurate class of the best match.
+func applyOSMatches(device *models.Device, matches []OsMatch) {
+	if len(matches) == 0 {
+		return
+	}
+
+	device.OSMatches = make([]*models.OSMatch, 0, len(matches))
+	for _, match := range matches {
+		osMatch := &models.OSMatch{Name: match.Name, Accuracy: accuracy(match.Accuracy)}
+		for _, class := range match.OsClasses {
+			osMatch.Classes = append(osMatch.Classes, &models.OSClass{
+				Type:       class.Type,
+				Vendor:     class.Vendor,
+				Family:     class.Family,
+				Generation: class.Gen,
+				Accuracy:   accuracy(class.Accuracy),
+				CPEs:       class.CPEs,
+			})
+		}
+		sort.SliceStable(osMatch.Classes, func(i, j int) bool {
+			return osMatch.Classes[i].Accuracy > osMatch.Classes[j].Accuracy
+		})
+		device.OSMatches = append(device.OSMatches, osMatch)
+	}
+	sort.SliceStable(device.OSMatches, func(i, j int) bool {
+		return device.OSMatches[i].Accuracy > device.OSMatches[j].Accuracy
+	})
+
+	best := device.OSMatches[0]
+	device.OSFingerprint = best.Name
+	device.OSAccuracy = best.Accuracy
+
+	seen := make(map[string]bool)
+	for i, class := range best.Classes {
+		if i == 0 {
+			device.OSFamily = class.Family
+			device.DeviceType = deviceType(class.Type)
+		}
+		for _, cpe := range class.CPEs {
+			if !seen[cpe] {
+				seen[cpe] = true
+				device.OSCPEs = append(device.OSCPEs, cpe)
+			}
+		}
+	}
+}
+
+// deviceType returns the type a device is reported as for one of nmap's
+// device types
+func deviceType(nmapType string) string {
+	t := strings.ToLower(strings.TrimSpace(nmapType))
+	if mapped, ok := deviceTypes[t]; ok {
+		return mapped
+	}
+	return t
+}
+
+// accuracy parses one of nmap's accuracy percentages, which are 0 if missing
+func accuracy(value string) int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,134 @@
+// internal/scanner/osdetect_test.go
+package scanner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestApplyOSMatches tests keeping every OS match and deriving the family,
+// device type and CPEs from the best one
+func TestApplyOSMatches(t *testing.T) {
+	var device models.Device
+	applyOSMatches(&device, []OsMatch{
+		{
+			Name: "Linux 4.15 - 5.8", Accuracy: "92",
+			OsClasses: []OsClass{
+				{Type: "general purpose", Vendor: "Linux", Family: "Linux", Gen: "4.X", Accuracy: "92", CPEs: []string{"cpe:/o:linux:linux_kernel:4"}},
+				{Type: "general purpose", Vendor: "Linux", Family: "Linux", Gen: "5.X", Accuracy: "92", CPEs: []string{"cpe:/o:linux:linux_kernel:5"}},
+			},
+		},
+		{
+			Name: "Cisco RV320 router", Accuracy: "95",
+			OsClasses: []OsClass{
+				{Type: "broadband router", Vendor: "Cisco", Family: "embedded", Accuracy: "95", CPEs: []string{"cpe:/h:cisco:rv320"}},
+			},
+		},
+	})
+
+	if device.OSFingerprint != "Cisco RV320 router" || device.OSAccuracy != 95 {
+		t.Errorf("Expected the most accurate match, got %q at %d%%", device.OSFingerprint, device.OSAccuracy)
+	}
+	if device.OSFamily != "embedded" || device.DeviceType != "router" {
+		t.Errorf("Expected an embedded router, got %q %q", device.OSFamily, device.DeviceType)
+	}
+	if !reflect.DeepEqual(device.OSCPEs, []string{"cpe:/h:cisco:rv320"}) {
+		t.Errorf("Unexpected CPEs: %v", device.OSCPEs)
+	}
+	if len(device.OSMatches) != 2 || device.OSMatches[1].Name != "Linux 4.15 - 5.8" || len(device.OSMatches[1].Classes) != 2 {
+		t.Errorf("Expected both matches, most accurate first, got %+v", device.OSMatches)
+	}
+
+	var none models.Device
+	applyOSMatches(&none, nil)
+	if none.OSFingerprint != "" || none.OSMatches != nil {
+		t.Errorf("Expected no OS without matches, got %+v", none)
+	}
+}
+
+// TestProcessScanResultsOSAccuracy tests that OS details are stored and that
+// uncertain guesses do not replace a known OS
+func TestProcessScanResultsOSAccuracy(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	output := func(name, generation, accuracy string) string {
+		return `<?xml version="1.0"?>
+<nmaprun>
+<host><status state="up"/>
+<address addr="192.168.1.70" addrtype="ipv4"/>
+<os>
+<osmatch name="` + name + `" accuracy="` + accuracy + `">
+<osclass type="general purpose" vendor="Linux" osfamily="Linux" osgen="` + generation + `" accuracy="` + accuracy + `">
+<cpe>cpe:/o:linux:linux_kernel:` + generation[:1] + `</cpe>
+</osclass>
+</osmatch>
+</os>
+</host>
+</nmaprun>`
+	}
+
+	outputPath := filepath.Join(tempDir, "os.xml")
+	scan := func(name, generation, accuracy string) {
+		t.Helper()
+		scanID, err := db.CreateScan("default")
+		if err != nil {
+			t.Fatalf("Failed to create scan: %v", err)
+		}
+		if err := ioutil.WriteFile(outputPath, []byte(output(name, generation, accuracy)), 0644); err != nil {
+			t.Fatalf("Failed to write scan output: %v", err)
+		}
+		if _, _, err := scanService.processScanResults(scanID, outputPath, nil); err != nil {
+			t.Fatalf("Failed to process scan results: %v", err)
+		}
+	}
+
+	osOf := func() *models.DeviceDetails {
+		t.Helper()
+		device, err := db.GetDeviceByIP("192.168.1.70")
+		if err != nil {
+			t.Fatalf("Failed to get device: %v", err)
+		}
+		details, err := db.GetDeviceDetails(device.ID)
+		if err != nil {
+			t.Fatalf("Failed to get device details: %v", err)
+		}
+		return details
+	}
+
+	scan("Linux 5.0 - 5.14", "5.X", "96")
+	details := osOf()
+	if details.OSFingerprint != "Linux 5.0 - 5.14" || details.OSAccuracy != 96 || details.OSFamily != "Linux" ||
+		details.DeviceType != "general purpose" || !reflect.DeepEqual(details.OSCPEs, []string{"cpe:/o:linux:linux_kernel:5"}) {
+		t.Errorf("Unexpected OS details: %+v", details.Device)
+	}
+	if len(details.OSMatches) != 1 || details.OSMatches[0].Classes[0].Generation != "5.X" {
+		t.Errorf("Unexpected OS matches: %+v", details.OSMatches)
+	}
+
+	// A guess below the configured 90% does not replace the known OS
+	scan("Linux 4.15 - 5.8", "4.X", "85")
+	if details := osOf(); details.OSFingerprint != "Linux 5.0 - 5.14" || details.OSAccuracy != 96 {
+		t.Errorf("Expected the uncertain guess to be ignored, got %q at %d%%", details.OSFingerprint, details.OSAccuracy)
+	}
+
+	// A confident one does
+	scan("Linux 4.19", "4.X", "98")
+	if details := osOf(); details.OSFingerprint != "Linux 4.19" || details.OSAccuracy != 98 {
+		t.Errorf("Expected the confident guess to replace the OS, got %q at %d%%", details.OSFingerprint, details.OSAccuracy)
+	}
+
+	var osChanges int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM changes WHERE details LIKE '%OS changed%'`).Scan(&osChanges); err != nil {
+		t.Fatalf("Failed to count changes: %v", err)
+	}
+	if osChanges != 1 {
+		t.Errorf("Expected 1 OS change, got %d", osChanges)
+	}
+}
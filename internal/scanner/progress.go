@@ -0,0 +1,106 @@
+package scanner
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"panopticon-scanner/internal/events"
+	"panopticon-scanner/internal/models"
+)
+
+var (
+	// statsLinePattern matches nmap's periodic summary, e.g.
+	// "Stats: 0:01:02 elapsed; 12 hosts completed (3 up), 4 undergoing SYN Stealth Scan"
+	statsLinePattern = regexp.MustCompile(`^Stats: \S+ elapsed; (\d+) hosts? completed \((\d+) up\), \d+ undergoing (.+)$`)
+
+	// timingLinePattern matches nmap's per-phase estimate, e.g.
+	// "SYN Stealth Scan Timing: About 42.17% done; ETC: 14:05 (0:00:36 remaining)"
+	timingLinePattern = regexp.MustCompile(`^(.+) Timing: About ([0-9.]+)% done(?:; ETC: \S+ \((\d+):(\d{2}):(\d{2}) remaining\))?`)
+)
+
+// progressParser turns nmap --stats-every output into progress reports
+type progressParser struct {
+	progress models.ScanProgress
+}
+
+// parseLine updates the progress from a line of nmap output, reporting
+// whether the line contained progress information
+func (p *progressParser) parseLine(line string, now time.Time) bool {
+	line = strings.TrimSpace(line)
+
+	if m := statsLinePattern.FindStringSubmatch(line); m != nil {
+		p.progress.HostsCompleted, _ = strconv.Atoi(m[1])
+		p.progress.HostsUp, _ = strconv.Atoi(m[2])
+		p.setPhase(m[3])
+		p.progress.UpdatedAt = now
+		return true
+	}
+
+	if m := timingLinePattern.FindStringSubmatch(line); m != nil {
+		p.setPhase(m[1])
+		p.progress.Percent, _ = strconv.ParseFloat(m[2], 64)
+		if m[3] != "" {
+			remaining, err := time.ParseDuration(fmt.Sprintf("%sh%sm%ss", m[3], m[4], m[5]))
+			if err == nil {
+				eta := now.Add(remaining)
+				p.progress.ETA = &eta
+			}
+		}
+		p.progress.UpdatedAt = now
+		return true
+	}
+
+	return false
+}
+
+// setPhase records the current scan phase, clearing estimates from the previous phase
+func (p *progressParser) setPhase(phase string) {
+	if phase == p.progress.Phase {
+		return
+	}
+
+	p.progress.Phase = phase
+	p.progress.Percent = 0
+	p.progress.ETA = nil
+}
+
+// snapshot returns a copy of the current progress
+func (p *progressParser) snapshot() *models.ScanProgress {
+	progress := p.progress
+	if progress.ETA != nil {
+		eta := *progress.ETA
+		progress.ETA = &eta
+	}
+	return &progress
+}
+
+// statsArgs returns the nmap arguments that enable periodic progress output
+func (s *ScanService) statsArgs() []string {
+	interval, err := s.config.GetStatsInterval()
+	if err != nil || interval < time.Second {
+		interval = 10 * time.Second
+	}
+
+	return []string{"--stats-every", fmt.Sprintf("%ds", int(interval.Seconds()))}
+}
+
+// updateProgress publishes progress for a running scan
+func (s *ScanService) updateProgress(scanID int64, progress *models.ScanProgress) {
+	s.scanLock.Lock()
+	if s.scanStats.ScanID == scanID {
+		s.scanStats.Progress = *progress
+	}
+	s.scanLock.Unlock()
+
+	if err := s.db.UpdateScanProgress(scanID, progress); err != nil {
+		s.logger.Error().Err(err).Int64("scanID", scanID).Msg("Failed to record scan progress")
+	}
+
+	s.events.Publish(events.TypeScanProgress, map[string]interface{}{
+		"scanId":   scanID,
+		"progress": progress,
+	})
+}
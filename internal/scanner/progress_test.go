@@ -0,0 +1,53 @@
+// internal/scanner/progress_test.go
+package scanner
+
+import (
+	"testing"
+	"time"
+)
+
+// TestProgressParser tests parsing nmap --stats-every output
+func TestProgressParser(t *testing.T) {
+	now := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	parser := &progressParser{}
+
+	if parser.parseLine("Starting Nmap 7.94 ( https://nmap.org )", now) {
+		t.Errorf("Expected banner not to be parsed as progress")
+	}
+
+	if !parser.parseLine("Stats: 0:01:02 elapsed; 12 hosts completed (3 up), 4 undergoing SYN Stealth Scan", now) {
+		t.Fatalf("Expected stats line to be parsed")
+	}
+
+	progress := parser.snapshot()
+	if progress.HostsCompleted != 12 || progress.HostsUp != 3 || progress.Phase != "SYN Stealth Scan" {
+		t.Errorf("Unexpected progress after stats line: %+v", progress)
+	}
+
+	if !parser.parseLine("SYN Stealth Scan Timing: About 42.17% done; ETC: 14:05 (0:01:30 remaining)", now) {
+		t.Fatalf("Expected timing line to be parsed")
+	}
+
+	progress = parser.snapshot()
+	if progress.Percent != 42.17 {
+		t.Errorf("Expected 42.17%% done, got %v", progress.Percent)
+	}
+
+	if progress.ETA == nil || !progress.ETA.Equal(now.Add(90*time.Second)) {
+		t.Errorf("Expected ETA 90s from now, got %v", progress.ETA)
+	}
+
+	// A new phase resets the estimate from the previous phase
+	if !parser.parseLine("Service scan Timing: About 5.00% done", now) {
+		t.Fatalf("Expected timing line without ETC to be parsed")
+	}
+
+	progress = parser.snapshot()
+	if progress.Phase != "Service scan" || progress.Percent != 5 || progress.ETA != nil {
+		t.Errorf("Unexpected progress after phase change: %+v", progress)
+	}
+
+	if progress.HostsCompleted != 12 {
+		t.Errorf("Expected host counts to be kept across phases, got %d", progress.HostsCompleted)
+	}
+}
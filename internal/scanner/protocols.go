@@ -0,0 +1,67 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"panopticon-scanner/internal/models"
+)
+
+// ErrInvalidProtocol is returned when a scan requests an unknown protocol
+var ErrInvalidProtocol = errors.New("invalid scan protocol")
+
+// protocolScanArgs maps each scannable protocol to the nmap scan technique
+// used for it
+var protocolScanArgs = map[string]string{
+	"tcp":  "-sS",
+	"udp":  "-sU",
+	"sctp": "-sY",
+}
+
+// protocolOrder is the order protocol scan techniques are passed to nmap
+var protocolOrder = []string{"tcp", "udp", "sctp"}
+
+// storedPortStates are the port states recorded for a host. UDP and SCTP
+// ports that do not answer are reported as open|filtered or filtered, so
+// these are kept along with open ports; closed ports are not stored.
+var storedPortStates = map[string]bool{
+	"open":          true,
+	"open|filtered": true,
+	"filtered":      true,
+}
+
+// normalizeProtocols lowercases and deduplicates the protocols requested for
+// a scan, rejecting any that cannot be scanned
+func normalizeProtocols(params *models.ScanParameters) error {
+	if len(params.Protocols) == 0 {
+		return nil
+	}
+
+	requested := make(map[string]bool)
+	for _, protocol := range params.Protocols {
+		protocol = strings.ToLower(strings.TrimSpace(protocol))
+		if _, ok := protocolScanArgs[protocol]; !ok {
+			return fmt.Errorf("%w: %q (must be tcp, udp or sctp)", ErrInvalidProtocol, protocol)
+		}
+		requested[protocol] = true
+	}
+
+	params.Protocols = params.Protocols[:0]
+	for _, protocol := range protocolOrder {
+		if requested[protocol] {
+			params.Protocols = append(params.Protocols, protocol)
+		}
+	}
+
+	return nil
+}
+
+// protocolArgs returns the nmap scan techniques for the given protocols
+func protocolArgs(protocols []string) []string {
+	var args []string
+	for _, protocol := range protocols {
+		args = append(args, protocolScanArgs[protocol])
+	}
+	return args
+}
@@ -0,0 +1,151 @@
+// internal/scanner/protocols_test.go
+package scanner
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestNormalizeProtocols tests validating and ordering scan protocols
+func TestNormalizeProtocols(t *testing.T) {
+	params := models.ScanParameters{Protocols: []string{"SCTP", "udp", "tcp", "udp"}}
+	if err := normalizeProtocols(&params); err != nil {
+		t.Fatalf("Failed to normalize protocols: %v", err)
+	}
+
+	if want := []string{"tcp", "udp", "sctp"}; !reflect.DeepEqual(params.Protocols, want) {
+		t.Errorf("Expected protocols %v, got %v", want, params.Protocols)
+	}
+
+	params = models.ScanParameters{Protocols: []string{"tcp", "icmp"}}
+	if err := normalizeProtocols(&params); !errors.Is(err, ErrInvalidProtocol) {
+		t.Errorf("Expected ErrInvalidProtocol, got %v", err)
+	}
+}
+
+// TestProtocolsReplaceScanTechnique tests that requested protocols replace
+// the template's scan technique
+func TestProtocolsReplaceScanTechnique(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	template := &ScanTemplate{Name: "web", NmapArgs: []string{"-sS", "-sV", "-p", "T:80,U:161"}, RateLimit: 100}
+
+	cmd, err := scanService.prepareManualScanCommand(template, "out.xml", "", models.ScanParameters{Protocols: []string{"tcp", "udp"}})
+	if err != nil {
+		t.Fatalf("Failed to prepare command: %v", err)
+	}
+
+	args := strings.Join(cmd.Args, " ")
+	if !strings.Contains(args, "-sV -p T:80,U:161 -sS -sU") || strings.Count(args, "-sS") != 1 {
+		t.Errorf("Unexpected nmap arguments: %s", args)
+	}
+
+	cmd, err = scanService.prepareManualScanCommand(template, "out.xml", "", models.ScanParameters{Protocols: []string{"sctp"}, ScanAllPorts: true})
+	if err != nil {
+		t.Fatalf("Failed to prepare command: %v", err)
+	}
+
+	args = strings.Join(cmd.Args, " ")
+	if strings.Contains(args, "-sS") || !strings.Contains(args, "-sV -sY -p-") {
+		t.Errorf("Unexpected nmap arguments: %s", args)
+	}
+}
+
+// TestProcessScanResultsPortStates tests that UDP port states are stored with
+// their reasons and state changes are recorded
+func TestProcessScanResultsPortStates(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	scanID, err := db.CreateScan("udp")
+	if err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+
+	output := func(snmpState, snmpReason string) string {
+		return `<?xml version="1.0"?>
+<nmaprun>
+<host><status state="up"/>
+<address addr="192.168.1.40" addrtype="ipv4"/>
+<ports>
+<port protocol="udp" portid="53"><state state="open" reason="udp-response"/><service name="domain"/></port>
+<port protocol="udp" portid="161"><state state="` + snmpState + `" reason="` + snmpReason + `"/><service name="snmp"/></port>
+<port protocol="udp" portid="69"><state state="filtered" reason="admin-prohibited"/><service name="tftp"/></port>
+<port protocol="udp" portid="123"><state state="closed" reason="port-unreach"/><service name="ntp"/></port>
+<port protocol="sctp" portid="2905"><state state="open" reason="init-ack"/><service name="m3ua"/></port>
+</ports>
+</host>
+</nmaprun>`
+	}
+
+	outputPath := filepath.Join(tempDir, "udp.xml")
+	if err := ioutil.WriteFile(outputPath, []byte(output("open|filtered", "no-response")), 0644); err != nil {
+		t.Fatalf("Failed to write scan output: %v", err)
+	}
+
+	_, portCount, err := scanService.processScanResults(scanID, outputPath, nil)
+	if err != nil {
+		t.Fatalf("Failed to process scan results: %v", err)
+	}
+
+	// The closed port is not stored
+	if portCount != 4 {
+		t.Errorf("Expected 4 ports processed, got %d", portCount)
+	}
+
+	device, err := db.GetDeviceByIP("192.168.1.40")
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+
+	details, err := db.GetDeviceDetails(device.ID)
+	if err != nil {
+		t.Fatalf("Failed to get device details: %v", err)
+	}
+
+	states := make(map[string]string)
+	for _, port := range details.Ports {
+		states[port.Protocol+"/"+port.ServiceName] = port.State + " " + port.Reason
+	}
+
+	want := map[string]string{
+		"udp/domain": "open udp-response",
+		"udp/snmp":   "open|filtered no-response",
+		"udp/tftp":   "filtered admin-prohibited",
+		"sctp/m3ua":  "open init-ack",
+	}
+	if !reflect.DeepEqual(states, want) {
+		t.Errorf("Expected port states %v, got %v", want, states)
+	}
+
+	// SNMP answers in the next scan
+	if err := ioutil.WriteFile(outputPath, []byte(output("open", "udp-response")), 0644); err != nil {
+		t.Fatalf("Failed to write scan output: %v", err)
+	}
+
+	if _, _, err := scanService.processScanResults(scanID, outputPath, nil); err != nil {
+		t.Fatalf("Failed to process scan results: %v", err)
+	}
+
+	var changeDetails string
+	err = db.QueryRow(
+		`SELECT details FROM changes WHERE device_id = ? AND change_type = 'port_state_change'`, device.ID,
+	).Scan(&changeDetails)
+	if err != nil {
+		t.Fatalf("Expected a port state change: %v", err)
+	}
+
+	if changeDetails != "Port 161/udp state changed: open|filtered -> open (udp-response)" {
+		t.Errorf("Unexpected change details: %s", changeDetails)
+	}
+}
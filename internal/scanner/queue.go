@@ -0,0 +1,214 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"panopticon-scanner/internal/events"
+	"panopticon-scanner/internal/models"
+)
+
+// Default job priorities; jobs with a higher priority run first. Scans
+// requested through the API may ask for a priority from ScanPriorityScheduled
+// up to ScanPriorityManual, so they cannot run ahead of an operator's scans.
+const (
+	ScanPriorityScheduled = 0
+	ScanPriorityManual    = 10
+)
+
+// queuePollInterval is how often the worker checks the queue without being signalled
+const queuePollInterval = 30 * time.Second
+
+var (
+	// ErrJobNotFound is returned when a scan job does not exist
+	ErrJobNotFound = errors.New("scan job not found")
+
+	// ErrJobNotQueued is returned when removing a job that has already started
+	ErrJobNotQueued = errors.New("scan job is not queued")
+)
+
+// EnqueueScan checks a scan's protocols and its targets against the authorized
+// scopes, then adds it to the persistent queue and returns the queued job.
+// requestedBy is who the request came from, as recorded in the audit log;
+// label is free text from the requester kept with the job.
+func (s *ScanService) EnqueueScan(params models.ScanParameters, priority int, requestedBy, label string) (*models.ScanJob, error) {
+	if err := normalizeProtocols(&params); err != nil {
+		return nil, err
+	}
+
+	// Refuse targets outside the authorized scopes before they reach the queue
+	if err := s.authorizeScan(&params, requestedBy); err != nil {
+		return nil, err
+	}
+
+	id, err := s.db.EnqueueScanJob(&models.ScanJob{
+		Priority:    priority,
+		Parameters:  params,
+		RequestedBy: requestedBy,
+		Label:       label,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := s.db.GetScanJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Position, err = s.db.GetScanJobPosition(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().
+		Int64("jobID", id).
+		Int("priority", priority).
+		Str("requestedBy", requestedBy).
+		Int("position", job.Position).
+		Msg("Scan queued")
+
+	s.events.Publish(events.TypeScanQueued, job)
+	s.signalQueue()
+
+	return job, nil
+}
+
+// GetScanQueue returns the running and queued scan jobs in run order
+func (s *ScanService) GetScanQueue() ([]*models.ScanJob, error) {
+	return s.db.GetPendingScanJobs()
+}
+
+// CancelScanJob removes a job from the queue before it starts
+func (s *ScanService) CancelScanJob(id int64) error {
+	job, err := s.db.GetScanJob(id)
+	if err != nil {
+		return fmt.Errorf("%w: %d", ErrJobNotFound, id)
+	}
+
+	cancelled, err := s.db.CancelQueuedScanJob(id)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return fmt.Errorf("%w: job %d is %s", ErrJobNotQueued, id, job.Status)
+	}
+
+	s.logger.Info().Int64("jobID", id).Msg("Queued scan cancelled")
+
+	return nil
+}
+
+// signalQueue wakes the queue worker without blocking
+func (s *ScanService) signalQueue() {
+	select {
+	case s.queueSignal <- struct{}{}:
+	default:
+	}
+}
+
+// startQueueWorker requeues jobs interrupted by a previous shutdown and starts
+// the worker that drains the queue
+func (s *ScanService) startQueueWorker() {
+	s.scanLock.Lock()
+	if s.workerRunning {
+		s.scanLock.Unlock()
+		return
+	}
+	s.workerRunning = true
+	ctx := s.ctx
+	s.scanLock.Unlock()
+
+	requeued, err := s.db.RequeueRunningScanJobs()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to requeue interrupted scan jobs")
+	} else if requeued > 0 {
+		s.logger.Info().Int64("jobs", requeued).Msg("Requeued scan jobs interrupted by shutdown")
+	}
+
+	go s.runQueueWorker(ctx)
+}
+
+// runQueueWorker runs queued scans one at a time until ctx is cancelled
+func (s *ScanService) runQueueWorker(ctx context.Context) {
+	defer func() {
+		s.scanLock.Lock()
+		s.workerRunning = false
+		s.scanLock.Unlock()
+	}()
+
+	ticker := time.NewTicker(queuePollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.drainQueue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.queueSignal:
+		case <-ticker.C:
+		}
+	}
+}
+
+// drainQueue runs queued jobs until the queue is empty or a scan is already running
+func (s *ScanService) drainQueue(ctx context.Context) {
+	for ctx.Err() == nil {
+		s.scanLock.Lock()
+		busy := s.isScanning
+		s.scanLock.Unlock()
+
+		// The worker is signalled again when the running scan ends
+		if busy {
+			return
+		}
+
+		job, err := s.db.ClaimNextScanJob()
+		if err != nil {
+			s.logger.Error().Err(err).Msg("Failed to read scan queue")
+			return
+		}
+		if job == nil {
+			return
+		}
+
+		if !s.runJob(ctx, job) {
+			return
+		}
+	}
+}
+
+// runJob runs a claimed job and records its outcome. It reports false if the
+// job was returned to the queue.
+func (s *ScanService) runJob(ctx context.Context, job *models.ScanJob) bool {
+	s.logger.Info().
+		Int64("jobID", job.ID).
+		Str("template", job.Parameters.Template).
+		Str("requestedBy", job.RequestedBy).
+		Msg("Running queued scan")
+
+	scanID, err := s.RunManualScan(ctx, job.Parameters)
+
+	status, errorMsg := "completed", ""
+	switch {
+	case errors.Is(err, ErrScanInProgress) || ctx.Err() != nil:
+		// Another scan got there first, or we are shutting down; run it later
+		if err := s.db.RequeueScanJob(job.ID); err != nil {
+			s.logger.Error().Err(err).Int64("jobID", job.ID).Msg("Failed to requeue scan job")
+		}
+		return false
+	case errors.Is(err, ErrScanCancelled):
+		status, errorMsg = "cancelled", err.Error()
+	case err != nil:
+		status, errorMsg = "error", err.Error()
+	}
+
+	if err := s.db.FinishScanJob(job.ID, status, scanID, errorMsg); err != nil {
+		s.logger.Error().Err(err).Int64("jobID", job.ID).Msg("Failed to record scan job result")
+	}
+
+	return true
+}
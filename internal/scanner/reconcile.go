@@ -0,0 +1,263 @@
+package scanner
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// scanScope is the set of addresses a scan covered: its targets less the
+// hosts excluded from it
+type scanScope struct {
+	targets  []*TargetRange
+	excluded []*TargetRange
+}
+
+// newScanScope returns the scope of a scan of spec, or of the configured
+// target network if spec is empty, with the given exclusions. It returns nil,
+// so that nothing is reconciled, if the targets cannot be parsed.
+func (s *ScanService) newScanScope(spec string, excluded []string) *scanScope {
+	targets := s.scanTargets(spec)
+	scope, err := parseScanScope(targets, excluded)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("targetNetwork", targets).Msg("Not reconciling scan with unparsable scope")
+		return nil
+	}
+	return scope
+}
+
+// scanTargets returns the targets of a scan of spec, which are the configured
+// target network if spec is empty
+func (s *ScanService) scanTargets(spec string) string {
+	if strings.TrimSpace(spec) == "" {
+		return s.config.Scanner.TargetNetwork
+	}
+	return spec
+}
+
+// parseScanScope returns the scope of a scan of targets with the given
+// exclusions
+func parseScanScope(targets string, excluded []string) (*scanScope, error) {
+	parsed, err := ParseTargets(targets)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := &scanScope{targets: parsed}
+	for _, exclusion := range excluded {
+		target, err := ParseTarget(exclusion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclusion %q: %w", exclusion, err)
+		}
+		scope.excluded = append(scope.excluded, target)
+	}
+
+	return scope, nil
+}
+
+// recordTargets stores the targets a scan of spec was run against
+func (s *ScanService) recordTargets(scanID int64, spec string) {
+	if err := s.db.SetScanTargets(scanID, s.scanTargets(spec)); err != nil {
+		s.logger.Error().Err(err).Int64("scanID", scanID).Msg("Failed to record scan targets")
+	}
+}
+
+// contains reports whether the scan covered an address
+func (sc *scanScope) contains(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+
+	for _, excluded := range sc.excluded {
+		if excluded.Contains(ip) {
+			return false
+		}
+	}
+	for _, target := range sc.targets {
+		if target.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// portRange is an inclusive range of port numbers
+type portRange struct {
+	first, last int
+}
+
+// probedPorts holds the ports a scan probed on each protocol
+type probedPorts map[string][]portRange
+
+// parseScanInfo returns the ports listed in nmap's scaninfo elements. IP
+// protocol scans (-sO) list protocol numbers rather than ports and are
+// skipped, as are malformed lists.
+func parseScanInfo(infos []ScanInfo) probedPorts {
+	probed := make(probedPorts)
+	for _, info := range infos {
+		if _, ok := protocolScanArgs[info.Protocol]; !ok {
+			continue
+		}
+		ranges, err := parsePortList(info.Services)
+		if err != nil {
+			continue
+		}
+		probed[info.Protocol] = append(probed[info.Protocol], ranges...)
+	}
+	return probed
+}
+
+// parsePortList parses a list of ports and ranges such as "1,3-4,6-7"
+func parsePortList(list string) ([]portRange, error) {
+	var ranges []portRange
+	for _, field := range strings.Split(list, ",") {
+		if field == "" {
+			continue
+		}
+
+		first, last := field, field
+		if i := strings.Index(field, "-"); i >= 0 {
+			first, last = field[:i], field[i+1:]
+		}
+
+		start, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", first)
+		}
+		end, err := strconv.Atoi(last)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", last)
+		}
+		if start > end {
+			return nil, fmt.Errorf("invalid port range %q", field)
+		}
+		ranges = append(ranges, portRange{start, end})
+	}
+	return ranges, nil
+}
+
+// recordProbedPorts stores the ports nmap listed in its scaninfo elements,
+// so that later comparisons know which ports the scan looked at
+func (s *ScanService) recordProbedPorts(scanID int64, infos []ScanInfo) {
+	probed := make(map[string]string)
+	for _, info := range infos {
+		if _, ok := protocolScanArgs[info.Protocol]; !ok || info.Services == "" {
+			continue
+		}
+		if probed[info.Protocol] != "" {
+			probed[info.Protocol] += ","
+		}
+		probed[info.Protocol] += info.Services
+	}
+
+	if err := s.db.SetScanProbedPorts(scanID, probed); err != nil {
+		s.logger.Error().Err(err).Int64("scanID", scanID).Msg("Failed to record probed ports")
+	}
+}
+
+// contains reports whether a port was probed
+func (p probedPorts) contains(protocol string, port int) bool {
+	for _, r := range p[protocol] {
+		if port >= r.first && port <= r.last {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcile compares a completed scan with the inventory. Devices with a
+// current address in scope that the scan did not find are counted as missed, as are
+// the probed ports of found devices that did not answer. Devices and ports
+// missed by enough consecutive scans are reported offline and closed.
+func (s *ScanService) reconcile(scanID int64, scope *scanScope, results *ScanResults, probed probedPorts) {
+	settings := s.config.Scanner.Reconciliation
+	if !settings.Enabled {
+		return
+	}
+
+	found := make(map[int64]*HostResult)
+	for _, host := range results.Hosts {
+		if host.Device.ID != 0 {
+			found[host.Device.ID] = host
+		}
+	}
+
+	addresses, err := s.db.GetCurrentDeviceAddresses()
+	if err != nil {
+		s.logger.Error().Err(err).Int64("scanID", scanID).Msg("Failed to reconcile scan with inventory")
+		return
+	}
+
+	var offline, closed int
+	for deviceID, deviceAddresses := range addresses {
+		if host, ok := found[deviceID]; ok {
+			closed += s.reconcilePorts(scanID, deviceID, host, probed)
+			continue
+		}
+
+		covered := false
+		for _, address := range deviceAddresses {
+			if scope.contains(address) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			continue
+		}
+
+		wentOffline, err := s.db.MarkDeviceMissed(scanID, deviceID, settings.DeviceMissedScans)
+		if err != nil {
+			s.logger.Error().Err(err).Int64("deviceID", deviceID).Msg("Failed to record missed device")
+			continue
+		}
+		if wentOffline {
+			offline++
+		}
+	}
+
+	s.logger.Info().
+		Int64("scanID", scanID).
+		Int("offlineDevices", offline).
+		Int("closedPorts", closed).
+		Msg("Reconciled scan with inventory")
+}
+
+// reconcilePorts counts the probed ports of a found device that did not
+// answer as missed, and returns the number of ports that were closed
+func (s *ScanService) reconcilePorts(scanID, deviceID int64, host *HostResult, probed probedPorts) int {
+	if len(probed) == 0 {
+		return 0
+	}
+
+	answered := make(map[string]bool)
+	for _, port := range host.Ports {
+		answered[fmt.Sprintf("%d/%s", port.PortNumber, port.Protocol)] = true
+	}
+
+	ports, err := s.db.GetActivePorts(deviceID)
+	if err != nil {
+		s.logger.Error().Err(err).Int64("deviceID", deviceID).Msg("Failed to reconcile device ports")
+		return 0
+	}
+
+	closed := 0
+	for _, port := range ports {
+		if answered[fmt.Sprintf("%d/%s", port.PortNumber, port.Protocol)] || !probed.contains(port.Protocol, port.PortNumber) {
+			continue
+		}
+
+		wasClosed, err := s.db.MarkPortMissed(scanID, port.ID, s.config.Scanner.Reconciliation.PortMissedScans)
+		if err != nil {
+			s.logger.Error().Err(err).Int64("portID", port.ID).Msg("Failed to record missed port")
+			continue
+		}
+		if wasClosed {
+			closed++
+		}
+	}
+
+	return closed
+}
@@ -0,0 +1,228 @@
+// internal/scanner/reconcile_test.go
+package scanner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"panopticon-scanner/internal/models"
+)
+
+// TestParseScanInfo tests reading the probed ports from nmap's scaninfo
+func TestParseScanInfo(t *testing.T) {
+	probed := parseScanInfo([]ScanInfo{
+		{Type: "syn", Protocol: "tcp", Services: "1,3-4,22,80-90"},
+		{Type: "udp", Protocol: "udp", Services: "53,161"},
+		{Type: "ipproto", Protocol: "ip", Services: "1-255"},
+		{Type: "sctpinit", Protocol: "sctp", Services: "bogus"},
+	})
+
+	want := probedPorts{
+		"tcp": {{1, 1}, {3, 4}, {22, 22}, {80, 90}},
+		"udp": {{53, 53}, {161, 161}},
+	}
+	if !reflect.DeepEqual(probed, want) {
+		t.Errorf("Expected probed ports %v, got %v", want, probed)
+	}
+
+	tests := []struct {
+		protocol string
+		port     int
+		want     bool
+	}{
+		{"tcp", 4, true},
+		{"tcp", 5, false},
+		{"tcp", 85, true},
+		{"udp", 161, true},
+		{"udp", 22, false},
+		{"sctp", 1, false},
+	}
+	for _, tt := range tests {
+		if got := probed.contains(tt.protocol, tt.port); got != tt.want {
+			t.Errorf("contains(%s, %d) = %v, want %v", tt.protocol, tt.port, got, tt.want)
+		}
+	}
+}
+
+// TestScanScope tests which addresses a scan covered
+func TestScanScope(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	scope := scanService.newScanScope("192.168.1.0/24, 2001:db8::/120", []string{"192.168.1.10-20"})
+	if scope == nil {
+		t.Fatalf("Expected a scope for valid targets")
+	}
+
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{"192.168.1.1", true},
+		{"192.168.1.15", false},
+		{"192.168.2.1", false},
+		{"2001:db8::10", true},
+		{"2001:db8::1:1", false},
+		{"not-an-ip", false},
+	}
+	for _, tt := range tests {
+		if got := scope.contains(tt.address); got != tt.want {
+			t.Errorf("contains(%s) = %v, want %v", tt.address, got, tt.want)
+		}
+	}
+
+	// The configured target network is used when none is given
+	if scope := scanService.newScanScope("", nil); scope == nil || !scope.contains("192.168.1.200") {
+		t.Errorf("Expected scope of the configured target network")
+	}
+
+	if scope := scanService.newScanScope("192.168.1.0/33", nil); scope != nil {
+		t.Errorf("Expected no scope for invalid targets")
+	}
+}
+
+// TestReconcile tests that ports and devices missed by consecutive scans are
+// closed and reported offline, limited to the scanned targets and ports
+func TestReconcile(t *testing.T) {
+	tempDir, cfg, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	cfg.Scanner.Reconciliation.PortMissedScans = 2
+	cfg.Scanner.Reconciliation.DeviceMissedScans = 2
+	defer func() {
+		cfg.Scanner.Reconciliation.PortMissedScans = 2
+		cfg.Scanner.Reconciliation.DeviceMissedScans = 3
+	}()
+
+	// A device outside the scanned network, and one that moved out of it
+	for _, device := range []*models.Device{
+		{IPAddress: "10.0.0.5"},
+		{IPAddress: "192.168.1.30", MACAddress: "00:11:22:33:44:30"},
+		{IPAddress: "10.0.1.9", MACAddress: "00:11:22:33:44:30"},
+	} {
+		if _, err := db.SaveDevice(device); err != nil {
+			t.Fatalf("Failed to save device: %v", err)
+		}
+	}
+
+	host := func(ip string, ports ...int) string {
+		var b strings.Builder
+		fmt.Fprintf(&b, `<host><status state="up"/><address addr="%s" addrtype="ipv4"/><ports>`, ip)
+		for _, port := range ports {
+			fmt.Fprintf(&b, `<port protocol="tcp" portid="%d"><state state="open" reason="syn-ack"/></port>`, port)
+		}
+		b.WriteString(`</ports></host>`)
+		return b.String()
+	}
+
+	// .12 is excluded, so it is never counted as missed
+	scope := scanService.newScanScope("192.168.1.0/24", []string{"192.168.1.12"})
+	outputPath := filepath.Join(tempDir, "reconcile.xml")
+	scan := func(services string, hosts ...string) {
+		t.Helper()
+
+		scanID, err := db.CreateScan("default")
+		if err != nil {
+			t.Fatalf("Failed to create scan: %v", err)
+		}
+
+		output := `<?xml version="1.0"?><nmaprun><scaninfo type="syn" protocol="tcp" services="` + services + `"/>` +
+			strings.Join(hosts, "") + `</nmaprun>`
+		if err := ioutil.WriteFile(outputPath, []byte(output), 0644); err != nil {
+			t.Fatalf("Failed to write scan output: %v", err)
+		}
+
+		if _, _, err := scanService.processScanResults(scanID, outputPath, scope); err != nil {
+			t.Fatalf("Failed to process scan results: %v", err)
+		}
+	}
+
+	changes := func(changeType string) []string {
+		t.Helper()
+
+		rows, err := db.Query(
+			`SELECT d.ip_address, c.details FROM changes c JOIN devices d ON d.id = c.device_id
+			 WHERE c.change_type = ? ORDER BY c.id`, changeType,
+		)
+		if err != nil {
+			t.Fatalf("Failed to query changes: %v", err)
+		}
+		defer rows.Close()
+
+		var details []string
+		for rows.Next() {
+			var ip, detail string
+			if err := rows.Scan(&ip, &detail); err != nil {
+				t.Fatalf("Failed to scan change: %v", err)
+			}
+			details = append(details, ip+": "+detail)
+		}
+		return details
+	}
+
+	scan("1-65535", host("192.168.1.10", 22, 80, 8080), host("192.168.1.11", 443), host("192.168.1.12", 22))
+
+	// Port 80 and .11 are missed once; 8080 is not probed
+	scan("1-1024", host("192.168.1.10", 22))
+	if closed, offline := changes("port_closed"), changes("device_offline"); len(closed) != 0 || len(offline) != 0 {
+		t.Fatalf("Expected no changes after one miss, got %v and %v", closed, offline)
+	}
+
+	scan("1-1024", host("192.168.1.10", 22))
+
+	want := []string{"192.168.1.10: Port 80/tcp closed (open, missed by 2 scans)"}
+	if closed := changes("port_closed"); !reflect.DeepEqual(closed, want) {
+		t.Errorf("Expected port_closed changes %v, got %v", want, closed)
+	}
+	want = []string{"192.168.1.11: Device offline: 192.168.1.11 (missed by 2 scans)"}
+	if offline := changes("device_offline"); !reflect.DeepEqual(offline, want) {
+		t.Errorf("Expected device_offline changes %v, got %v", want, offline)
+	}
+
+	for ip, wantOffline := range map[string]bool{"192.168.1.11": true, "192.168.1.12": false, "10.0.0.5": false, "10.0.1.9": false} {
+		device, err := db.GetDeviceByIP(ip)
+		if err != nil {
+			t.Fatalf("Failed to get device %s: %v", ip, err)
+		}
+		if (device.OfflineSince != nil) != wantOffline {
+			t.Errorf("Expected %s offline=%v, got offline since %v", ip, wantOffline, device.OfflineSince)
+		}
+	}
+
+	device, err := db.GetDeviceByIP("192.168.1.10")
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if device.PortCount != 2 {
+		t.Errorf("Expected ports 22 and 8080 to remain, got %d ports", device.PortCount)
+	}
+
+	// .11 answers again
+	scan("1-1024", host("192.168.1.10", 22), host("192.168.1.11", 443))
+	if returned := changes("device_returned"); len(returned) != 1 || !strings.HasPrefix(returned[0], "192.168.1.11: ") {
+		t.Errorf("Expected .11 to return, got %v", returned)
+	}
+
+	// Without a scope nothing is reconciled
+	cfg.Scanner.Reconciliation.PortMissedScans = 1
+	scanID, err := db.CreateScan("default")
+	if err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+	if err := ioutil.WriteFile(outputPath, []byte(`<nmaprun><scaninfo type="syn" protocol="tcp" services="1-1024"/></nmaprun>`), 0644); err != nil {
+		t.Fatalf("Failed to write scan output: %v", err)
+	}
+	if _, _, err := scanService.processScanResults(scanID, outputPath, nil); err != nil {
+		t.Fatalf("Failed to process scan results: %v", err)
+	}
+	if closed := changes("port_closed"); len(closed) != 1 {
+		t.Errorf("Expected no further port_closed changes, got %v", closed)
+	}
+}
@@ -3,6 +3,8 @@ package scanner
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -12,7 +14,9 @@ import (
 
 	"panopticon-scanner/internal/config"
 	"panopticon-scanner/internal/database"
+	"panopticon-scanner/internal/events"
 	"panopticon-scanner/internal/models"
+	"panopticon-scanner/internal/nvd"
 )
 
 // mockNmapOutput creates a mock nmap XML output file for testing
@@ -90,6 +94,8 @@ func mockCommand(t *testing.T, tempDir string) {
 # Mock nmap that writes a pre-generated output file
 # The second argument should be the output file path
 echo "Mock nmap running..."
+echo "Stats: 0:00:05 elapsed; 1 hosts completed (1 up), 1 undergoing SYN Stealth Scan"
+echo "SYN Stealth Scan Timing: About 50.00% done; ETC: 14:05 (0:00:05 remaining)"
 cp ` + filepath.Join(tempDir, "mock_scan.xml") + ` $2
 `
 	// Write the mock script to a temporary file
@@ -233,6 +239,11 @@ func TestRunScan(t *testing.T) {
 		t.Fatalf("Failed to start scanner service: %v", err)
 	}
 
+	bus := events.NewBus()
+	defer bus.Close()
+	scanService.SetEventBus(bus)
+	sub := bus.Subscribe([]string{events.TypeScanStatus}, 10)
+
 	// Run a scan
 	scanID, err := scanService.RunScan(context.Background(), "default")
 	if err != nil {
@@ -278,6 +289,26 @@ func TestRunScan(t *testing.T) {
 	if scan.PortsFound != 5 {
 		t.Errorf("Expected scan ports found 5, got %d", scan.PortsFound)
 	}
+	// Progress reported by nmap is persisted and finished at 100%
+	if scan.Progress == nil {
+		t.Fatalf("Expected scan progress to be recorded")
+	}
+
+	if scan.Progress.Percent != 100 || scan.Progress.Phase != "SYN Stealth Scan" || scan.Progress.HostsCompleted != 1 {
+		t.Errorf("Unexpected scan progress: %+v", scan.Progress)
+	}
+
+	// Status changes are published as events
+	for _, want := range []string{"running", "completed"} {
+		select {
+		case event := <-sub.Events():
+			if status := event.Data.(map[string]interface{})["status"]; status != want {
+				t.Errorf("Expected %s status event, got %v", want, status)
+			}
+		default:
+			t.Fatalf("Expected %s status event to be published", want)
+		}
+	}
 }
 
 // TestRunManualScan tests running a manual scan with parameters
@@ -529,7 +560,7 @@ func TestProcessScanResults(t *testing.T) {
 	outputPath := mockNmapOutput(t, tempDir)
 
 	// Process the scan results directly
-	deviceCount, portCount, err := scanService.processScanResults(outputPath)
+	deviceCount, portCount, err := scanService.processScanResults(0, outputPath, nil)
 	if err != nil {
 		t.Errorf("Failed to process scan results: %v", err)
 	}
@@ -564,3 +595,372 @@ func TestProcessScanResults(t *testing.T) {
 		t.Errorf("Expected 5 ports in database, got %d", count)
 	}
 }
+
+// TestProcessScanResultsIPv6 tests that IPv6 hosts are stored and linked to
+// the IPv4 device with the same MAC address, and that a host reported with
+// both families keeps its IPv6 address
+func TestProcessScanResultsIPv6(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	ipv4Output := `<?xml version="1.0"?>
+<nmaprun>
+<host><status state="up"/>
+<address addr="192.168.1.20" addrtype="ipv4"/>
+<address addr="00:11:22:33:44:55" addrtype="mac"/>
+<ports><port protocol="tcp" portid="22"><state state="open"/><service name="ssh"/></port></ports>
+</host>
+<host><status state="up"/>
+<address addr="2001:DB8:0:0::21" addrtype="ipv6"/>
+<address addr="192.168.1.21" addrtype="ipv4"/>
+</host>
+</nmaprun>`
+
+	ipv6Output := `<?xml version="1.0"?>
+<nmaprun>
+<host><status state="up"/>
+<address addr="fe80::211:22ff:fe33:4455" addrtype="ipv6"/>
+<address addr="00:11:22:33:44:55" addrtype="mac"/>
+<ports><port protocol="tcp" portid="22"><state state="open"/><service name="ssh"/></port></ports>
+</host>
+<host><status state="up"/>
+<address addr="2001:db8::99" addrtype="ipv6"/>
+</host>
+</nmaprun>`
+
+	for i, output := range []string{ipv4Output, ipv6Output} {
+		outputPath := filepath.Join(tempDir, fmt.Sprintf("scan%d.xml", i))
+		if err := ioutil.WriteFile(outputPath, []byte(output), 0644); err != nil {
+			t.Fatalf("Failed to write scan output: %v", err)
+		}
+		if _, _, err := scanService.processScanResults(0, outputPath, nil); err != nil {
+			t.Fatalf("Failed to process scan results: %v", err)
+		}
+	}
+
+	devices, err := db.GetAllDevices()
+	if err != nil {
+		t.Fatalf("Failed to get devices: %v", err)
+	}
+
+	if len(devices) != 3 {
+		t.Fatalf("Expected 3 devices, got %d", len(devices))
+	}
+
+	dualStack, err := db.GetDeviceByIP("fe80::211:22ff:fe33:4455")
+	if err != nil {
+		t.Fatalf("Failed to get device by IPv6 address: %v", err)
+	}
+
+	if dualStack.IPAddress != "192.168.1.20" || len(dualStack.Addresses) != 2 || dualStack.PortCount != 1 {
+		t.Errorf("Expected the IPv6 address linked to the IPv4 device, got %+v", dualStack)
+	}
+
+	if _, err := db.GetDeviceByIP("2001:db8::99"); err != nil {
+		t.Errorf("Expected IPv6-only host to be stored, got %v", err)
+	}
+
+	bothFamilies, err := db.GetDeviceByIP("2001:db8::21")
+	if err != nil {
+		t.Fatalf("Failed to get device by its secondary IPv6 address: %v", err)
+	}
+	if bothFamilies.IPAddress != "192.168.1.21" || len(bothFamilies.Addresses) != 2 {
+		t.Errorf("Expected the IPv6 address kept alongside the IPv4 one, got %+v", bothFamilies)
+	}
+}
+
+// mockSlowCommand replaces the mock nmap with one that runs until it is killed
+func mockSlowCommand(t *testing.T, tempDir string) {
+	mockScript := `#!/bin/sh
+# Mock nmap that never finishes on its own
+sleep 30
+`
+	scriptPath := filepath.Join(tempDir, "nmap")
+	if err := ioutil.WriteFile(scriptPath, []byte(mockScript), 0755); err != nil {
+		t.Fatalf("Failed to write slow mock nmap script: %v", err)
+	}
+}
+
+// waitForActiveScan waits until the service reports a running scan and returns its ID
+func waitForActiveScan(t *testing.T, scanService *ScanService) int64 {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		scanService.scanLock.Lock()
+		for id := range scanService.activeScans {
+			scanService.scanLock.Unlock()
+			return id
+		}
+		scanService.scanLock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for scan to start")
+	return 0
+}
+
+// TestCancelScan tests cancelling a running scan
+func TestCancelScan(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	mockSlowCommand(t, tempDir)
+
+	if err := scanService.Start(); err != nil {
+		t.Fatalf("Failed to start scanner service: %v", err)
+	}
+
+	// Start a scan that will not finish by itself
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := scanService.RunScan(context.Background(), "default")
+		errCh <- err
+	}()
+
+	scanID := waitForActiveScan(t, scanService)
+
+	if err := scanService.CancelScan(scanID); err != nil {
+		t.Fatalf("Failed to cancel scan: %v", err)
+	}
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, ErrScanCancelled) {
+			t.Errorf("Expected ErrScanCancelled, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Scan did not stop after cancellation")
+	}
+
+	// Verify the cancellation was recorded
+	scan, err := scanService.GetScan(scanID)
+	if err != nil {
+		t.Fatalf("Failed to get scan: %v", err)
+	}
+	if scan.Status != "cancelled" {
+		t.Errorf("Expected scan status 'cancelled', got '%s'", scan.Status)
+	}
+
+	if status := scanService.GetStatus(); status.Status != "cancelled" {
+		t.Errorf("Expected service status 'cancelled', got '%s'", status.Status)
+	}
+
+	// A finished scan cannot be cancelled again
+	if err := scanService.CancelScan(scanID); !errors.Is(err, ErrScanNotRunning) {
+		t.Errorf("Expected ErrScanNotRunning, got: %v", err)
+	}
+
+	// Unknown scans are reported as not found
+	if err := scanService.CancelScan(scanID + 1000); !errors.Is(err, ErrScanNotFound) {
+		t.Errorf("Expected ErrScanNotFound, got: %v", err)
+	}
+}
+
+// TestStopCancelsRunningScan tests that stopping the service cancels a running scan
+func TestStopCancelsRunningScan(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	mockSlowCommand(t, tempDir)
+
+	if err := scanService.Start(); err != nil {
+		t.Fatalf("Failed to start scanner service: %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := scanService.RunScan(context.Background(), "default")
+		errCh <- err
+	}()
+
+	scanID := waitForActiveScan(t, scanService)
+
+	// Stop waits for the scan to be cleaned up
+	if err := scanService.Stop(); err != nil {
+		t.Fatalf("Failed to stop scanner service: %v", err)
+	}
+
+	if err := <-errCh; !errors.Is(err, ErrScanCancelled) {
+		t.Errorf("Expected ErrScanCancelled, got: %v", err)
+	}
+
+	scan, err := scanService.GetScan(scanID)
+	if err != nil {
+		t.Fatalf("Failed to get scan: %v", err)
+	}
+	if scan.Status != "cancelled" {
+		t.Errorf("Expected scan status 'cancelled', got '%s'", scan.Status)
+	}
+
+	// New scans are rejected once the service is stopped
+	if _, err := scanService.RunScan(context.Background(), "default"); err == nil {
+		t.Errorf("Expected error when scanning after stop, got nil")
+	}
+}
+
+// waitForEmptyQueue waits until the queue worker has run every job
+func waitForEmptyQueue(t *testing.T, scanService *ScanService) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		jobs, err := scanService.GetScanQueue()
+		if err != nil {
+			t.Fatalf("Failed to get scan queue: %v", err)
+		}
+		if len(jobs) == 0 {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for scan queue to drain")
+}
+
+// TestScanQueue tests queueing scans and draining the queue
+func TestScanQueue(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	scanService.SetMockModeForTesting(true)
+
+	// Queue jobs before the worker is running
+	scheduled, err := scanService.EnqueueScan(models.ScanParameters{Template: "quick"}, ScanPriorityScheduled, "scheduler", "")
+	if err != nil {
+		t.Fatalf("Failed to queue scan: %v", err)
+	}
+	manual, err := scanService.EnqueueScan(models.ScanParameters{Template: "default"}, ScanPriorityManual, "tester", "")
+	if err != nil {
+		t.Fatalf("Failed to queue scan: %v", err)
+	}
+	removed, err := scanService.EnqueueScan(models.ScanParameters{Template: "default"}, ScanPriorityScheduled, "tester", "")
+	if err != nil {
+		t.Fatalf("Failed to queue scan: %v", err)
+	}
+
+	if scheduled.Position != 1 || manual.Position != 1 || removed.Position != 3 {
+		t.Errorf("Unexpected queue positions: %d, %d, %d", scheduled.Position, manual.Position, removed.Position)
+	}
+
+	queue, err := scanService.GetScanQueue()
+	if err != nil {
+		t.Fatalf("Failed to get scan queue: %v", err)
+	}
+	if len(queue) != 3 || queue[0].ID != manual.ID {
+		t.Errorf("Expected manual scan first in queue, got %+v", queue)
+	}
+
+	// Queued jobs can be removed until they start
+	if err := scanService.CancelScanJob(removed.ID); err != nil {
+		t.Fatalf("Failed to cancel queued job: %v", err)
+	}
+	if err := scanService.CancelScanJob(removed.ID); !errors.Is(err, ErrJobNotQueued) {
+		t.Errorf("Expected ErrJobNotQueued, got: %v", err)
+	}
+	if err := scanService.CancelScanJob(removed.ID + 1000); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got: %v", err)
+	}
+
+	// Simulate a job interrupted by a shutdown
+	if _, err := db.ClaimNextScanJob(); err != nil {
+		t.Fatalf("Failed to claim job: %v", err)
+	}
+
+	// Starting the service requeues the interrupted job and drains the queue
+	if err := scanService.Start(); err != nil {
+		t.Fatalf("Failed to start scanner service: %v", err)
+	}
+	defer scanService.Stop()
+
+	waitForEmptyQueue(t, scanService)
+
+	for _, id := range []int64{scheduled.ID, manual.ID} {
+		job, err := db.GetScanJob(id)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		if job.Status != "completed" || job.ScanID == 0 {
+			t.Errorf("Expected job %d to complete with a scan, got %+v", id, job)
+		}
+	}
+
+	// The manual scan ran first
+	first, _ := db.GetScanJob(manual.ID)
+	second, _ := db.GetScanJob(scheduled.ID)
+	if first.ScanID >= second.ScanID {
+		t.Errorf("Expected manual scan to run before scheduled scan, got scans %d and %d", first.ScanID, second.ScanID)
+	}
+}
+
+// TestProcessScanResultsVulnerabilities tests that service CPEs are stored
+// and matched against imported CVEs, with each finding tracked across scans
+func TestProcessScanResultsVulnerabilities(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	_, _, err := db.ImportVulnerabilities([]*nvd.CVE{{
+		ID: "CVE-2023-38408", CVSS: 9.8, Severity: "CRITICAL",
+		Matches: []*nvd.Match{{CPE: "cpe:2.3:a:openbsd:openssh:*:*:*:*:*:*:*:*", VersionEndExcluding: "9.3"}},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to import vulnerabilities: %v", err)
+	}
+
+	outputPath := filepath.Join(tempDir, "ssh.xml")
+	scan := func(version string) int64 {
+		t.Helper()
+		output := `<?xml version="1.0"?>
+<nmaprun>
+<host><status state="up"/>
+<address addr="192.168.1.80" addrtype="ipv4"/>
+<ports>
+<port protocol="tcp" portid="22"><state state="open" reason="syn-ack"/>
+<service name="ssh" product="OpenSSH" version="` + version + `"><cpe>cpe:/a:openbsd:openssh:` + version + `</cpe></service>
+</port>
+</ports>
+</host>
+</nmaprun>`
+		scanID, err := db.CreateScan("default")
+		if err != nil {
+			t.Fatalf("Failed to create scan: %v", err)
+		}
+		if err := ioutil.WriteFile(outputPath, []byte(output), 0644); err != nil {
+			t.Fatalf("Failed to write scan output: %v", err)
+		}
+		if _, _, err := scanService.processScanResults(scanID, outputPath, nil); err != nil {
+			t.Fatalf("Failed to process scan results: %v", err)
+		}
+		return scanID
+	}
+
+	first := scan("7.4")
+	second := scan("7.4")
+
+	device, err := db.GetDeviceByIP("192.168.1.80")
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	details, err := db.GetDeviceDetails(device.ID)
+	if err != nil {
+		t.Fatalf("Failed to get device details: %v", err)
+	}
+	if len(details.Ports) != 1 || len(details.Ports[0].CPEs) != 1 || details.Ports[0].CPEs[0] != "cpe:/a:openbsd:openssh:7.4" {
+		t.Errorf("Expected the service CPE to be stored, got %+v", details.Ports)
+	}
+	if len(details.Vulnerabilities) != 1 {
+		t.Fatalf("Expected 1 vulnerability, got %+v", details.Vulnerabilities)
+	}
+	if v := details.Vulnerabilities[0]; v.PortNumber != 22 || v.FirstScanID != first || v.LastScanID != second {
+		t.Errorf("Expected the finding on port 22 from scan %d to %d, got %+v", first, second, v)
+	}
+
+	// An upgrade resolves the finding
+	scan("9.6")
+	details, err = db.GetDeviceDetails(device.ID)
+	if err != nil {
+		t.Fatalf("Failed to get device details: %v", err)
+	}
+	if len(details.Vulnerabilities) != 0 {
+		t.Errorf("Expected the upgrade to resolve the finding, got %+v", details.Vulnerabilities)
+	}
+}
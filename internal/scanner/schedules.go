@@ -0,0 +1,385 @@
+package scanner
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"panopticon-scanner/internal/models"
+	"panopticon-scanner/internal/scheduler"
+)
+
+// defaultScheduleName names the schedule built from Scanner.Frequency when no
+// schedules are configured
+const defaultScheduleName = "default"
+
+// scheduleRequesterPrefix identifies jobs queued by a schedule
+const scheduleRequesterPrefix = "schedule:"
+
+var (
+	// ErrScheduleNotFound is returned when a schedule does not exist
+	ErrScheduleNotFound = errors.New("schedule not found")
+
+	// ErrScheduleExists is returned when creating a schedule whose name is already taken
+	ErrScheduleExists = errors.New("schedule already exists")
+
+	// ErrScheduleReadOnly is returned when modifying a configured schedule
+	ErrScheduleReadOnly = errors.New("schedule is read-only")
+)
+
+// ScheduleValidationError describes why a schedule was rejected
+type ScheduleValidationError struct {
+	Schedule string
+	Problems []string
+}
+
+// Error implements the error interface
+func (e *ScheduleValidationError) Error() string {
+	return fmt.Sprintf("invalid schedule %q: %s", e.Schedule, strings.Join(e.Problems, "; "))
+}
+
+// StartScheduler starts running the configured and stored schedules
+func (s *ScanService) StartScheduler() {
+	schedules := s.getSchedules()
+
+	for _, schedule := range schedules {
+		s.scheduleJob(schedule)
+	}
+
+	s.logger.Info().Int("schedules", len(schedules)).Msg("Starting scan scheduler")
+
+	s.scanLock.Lock()
+	ctx := s.ctx
+	s.scanLock.Unlock()
+
+	s.scheduler.Start(ctx)
+}
+
+// configSchedules returns the schedules from the configuration file. Without
+// any, a single schedule runs the default template every Scanner.Frequency.
+func (s *ScanService) configSchedules() []*models.Schedule {
+	var schedules []*models.Schedule
+
+	for _, sc := range s.config.Scanner.Schedules {
+		schedule := &models.Schedule{
+			Name:          sc.Name,
+			Cron:          sc.Cron,
+			Template:      sc.Template,
+			TargetNetwork: sc.TargetNetwork,
+			Site:          sc.Site,
+			Jitter:        sc.Jitter,
+			Enabled:       true,
+			Source:        TemplateSourceConfig,
+		}
+		if schedule.Template == "" {
+			schedule.Template = s.config.Scanner.DefaultTemplate
+		}
+		for _, bc := range sc.Blackouts {
+			schedule.Blackouts = append(schedule.Blackouts, models.BlackoutWindow{Start: bc.Start, End: bc.End, Days: bc.Days})
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	if len(schedules) == 0 && s.config.Scanner.Frequency != "" {
+		schedules = append(schedules, &models.Schedule{
+			Name:     defaultScheduleName,
+			Cron:     "@every " + s.config.Scanner.Frequency,
+			Template: s.config.Scanner.DefaultTemplate,
+			Enabled:  true,
+			Source:   TemplateSourceConfig,
+		})
+	}
+
+	return schedules
+}
+
+// getSchedules returns all schedules by name. Schedules stored in the
+// database override configured schedules with the same name.
+func (s *ScanService) getSchedules() map[string]*models.Schedule {
+	schedules := make(map[string]*models.Schedule)
+
+	for _, schedule := range s.configSchedules() {
+		schedules[schedule.Name] = schedule
+	}
+
+	stored, err := s.db.GetSchedules()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to load schedules from database")
+		return schedules
+	}
+
+	for _, schedule := range stored {
+		schedules[schedule.Name] = schedule
+	}
+
+	return schedules
+}
+
+// compileSchedule validates a schedule and converts it to a scheduler job
+func (s *ScanService) compileSchedule(schedule *models.Schedule) (scheduler.Job, error) {
+	var problems []string
+	job := scheduler.Job{Name: schedule.Name}
+
+	if !templateNamePattern.MatchString(schedule.Name) {
+		problems = append(problems, "name must be 1-64 characters of letters, digits, '-' or '_' and start with a letter or digit")
+	}
+
+	cron, err := scheduler.Parse(schedule.Cron)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	job.Schedule = cron
+
+	if _, err := s.getScanTemplate(schedule.Template); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if schedule.Jitter != "" {
+		jitter, err := time.ParseDuration(schedule.Jitter)
+		if err != nil || jitter < 0 {
+			problems = append(problems, fmt.Sprintf("jitter %q must be a duration such as 5m", schedule.Jitter))
+		}
+		job.Jitter = jitter
+	}
+
+	for _, blackout := range schedule.Blackouts {
+		window, err := scheduler.ParseWindow(blackout.Start, blackout.End, blackout.Days)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		job.Blackouts = append(job.Blackouts, window)
+	}
+
+	if schedule.TargetNetwork != "" || schedule.Site != "" {
+		if _, err := s.checkTargets(schedule.TargetNetwork, schedule.Site); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return scheduler.Job{}, &ScheduleValidationError{Schedule: schedule.Name, Problems: problems}
+	}
+
+	// The schedule built from Frequency queues a scan at startup as it always has
+	job.RunOnStart = schedule.Name == defaultScheduleName && schedule.Source == TemplateSourceConfig &&
+		len(s.config.Scanner.Schedules) == 0
+
+	job.Run = func(ctx context.Context, scheduled time.Time) {
+		s.runSchedule(schedule, scheduled)
+	}
+	job.Skip = func(scheduled time.Time, reason string) {
+		s.recordScheduleRun(&models.ScheduleRun{
+			Schedule:    schedule.Name,
+			ScheduledAt: scheduled,
+			Status:      "skipped",
+			Message:     reason,
+		})
+	}
+
+	return job, nil
+}
+
+// scheduleJob adds a schedule to the scheduler, or removes it if it is
+// disabled or invalid
+func (s *ScanService) scheduleJob(schedule *models.Schedule) {
+	if !schedule.Enabled {
+		s.scheduler.Remove(schedule.Name)
+		return
+	}
+
+	job, err := s.compileSchedule(schedule)
+	if err != nil {
+		s.logger.Error().Err(err).Str("schedule", schedule.Name).Msg("Ignoring invalid schedule")
+		s.scheduler.Remove(schedule.Name)
+		return
+	}
+
+	s.scheduler.Set(job)
+}
+
+// runSchedule queues a scan for a schedule unless its last scan is still
+// waiting, and records the outcome in the schedule's run history
+func (s *ScanService) runSchedule(schedule *models.Schedule, scheduled time.Time) {
+	run := &models.ScheduleRun{Schedule: schedule.Name, ScheduledAt: scheduled}
+	requestedBy := scheduleRequesterPrefix + schedule.Name
+
+	jobs, err := s.db.GetPendingScanJobs()
+	if err != nil {
+		run.Status, run.Message = "error", err.Error()
+		s.recordScheduleRun(run)
+		return
+	}
+
+	for _, job := range jobs {
+		if job.RequestedBy == requestedBy && job.Status == "queued" {
+			run.Status, run.JobID = "skipped", job.ID
+			run.Message = "previous scan from this schedule is still queued"
+			s.recordScheduleRun(run)
+			return
+		}
+	}
+
+	params := models.ScanParameters{
+		Template:      schedule.Template,
+		TargetNetwork: schedule.TargetNetwork,
+		Site:          schedule.Site,
+	}
+
+	job, err := s.EnqueueScan(params, ScanPriorityScheduled, requestedBy, "")
+	if err != nil {
+		s.logger.Error().Err(err).Str("schedule", schedule.Name).Msg("Failed to queue scheduled scan")
+		run.Status, run.Message = "error", err.Error()
+	} else {
+		run.Status, run.JobID = "queued", job.ID
+	}
+
+	s.recordScheduleRun(run)
+}
+
+// recordScheduleRun adds an entry to a schedule's run history
+func (s *ScanService) recordScheduleRun(run *models.ScheduleRun) {
+	if _, err := s.db.AddScheduleRun(run); err != nil {
+		s.logger.Error().Err(err).Str("schedule", run.Schedule).Msg("Failed to record schedule run")
+	}
+}
+
+// describeSchedule fills in a schedule's next and last runs
+func (s *ScanService) describeSchedule(schedule *models.Schedule) *models.Schedule {
+	described := *schedule
+
+	if s.config.Scanner.EnableScheduler && schedule.Enabled {
+		if next, ok := s.scheduler.NextRun(schedule.Name); ok {
+			described.NextRun = &next
+		}
+	}
+
+	runs, err := s.db.GetScheduleRuns(schedule.Name, 1)
+	if err != nil {
+		s.logger.Error().Err(err).Str("schedule", schedule.Name).Msg("Failed to load schedule run history")
+	} else if len(runs) > 0 {
+		described.LastRun = runs[0]
+	}
+
+	return &described
+}
+
+// GetSchedules returns all schedules with their next and last runs
+func (s *ScanService) GetSchedules() ([]*models.Schedule, error) {
+	schedules := s.getSchedules()
+	result := make([]*models.Schedule, 0, len(schedules))
+
+	for _, schedule := range schedules {
+		result = append(result, s.describeSchedule(schedule))
+	}
+
+	// Return schedules in a stable order
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// GetSchedule returns a single schedule by name
+func (s *ScanService) GetSchedule(name string) (*models.Schedule, error) {
+	schedule, exists := s.getSchedules()[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrScheduleNotFound, name)
+	}
+
+	return s.describeSchedule(schedule), nil
+}
+
+// GetScheduleRuns returns the most recent runs of a schedule
+func (s *ScanService) GetScheduleRuns(name string, limit int) ([]*models.ScheduleRun, error) {
+	if _, exists := s.getSchedules()[name]; !exists {
+		return nil, fmt.Errorf("%w: %s", ErrScheduleNotFound, name)
+	}
+
+	return s.db.GetScheduleRuns(name, limit)
+}
+
+// CreateSchedule validates and stores a new user-defined schedule
+func (s *ScanService) CreateSchedule(schedule *models.Schedule) (*models.Schedule, error) {
+	candidate := *schedule
+	candidate.Source = TemplateSourceDatabase
+
+	if _, err := s.compileSchedule(&candidate); err != nil {
+		return nil, err
+	}
+
+	if _, exists := s.getSchedules()[candidate.Name]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrScheduleExists, candidate.Name)
+	}
+
+	if err := s.db.SaveSchedule(&candidate); err != nil {
+		return nil, err
+	}
+
+	s.scheduleJob(&candidate)
+	s.logger.Info().Str("schedule", candidate.Name).Str("cron", candidate.Cron).Msg("Schedule created")
+
+	return s.GetSchedule(candidate.Name)
+}
+
+// UpdateSchedule validates and replaces a user-defined schedule
+func (s *ScanService) UpdateSchedule(name string, schedule *models.Schedule) (*models.Schedule, error) {
+	if err := s.checkScheduleWritable(name); err != nil {
+		return nil, err
+	}
+
+	candidate := *schedule
+	candidate.Name = name
+	candidate.Source = TemplateSourceDatabase
+
+	if _, err := s.compileSchedule(&candidate); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.SaveSchedule(&candidate); err != nil {
+		return nil, err
+	}
+
+	s.scheduleJob(&candidate)
+	s.logger.Info().Str("schedule", name).Str("cron", candidate.Cron).Msg("Schedule updated")
+
+	return s.GetSchedule(name)
+}
+
+// DeleteSchedule removes a user-defined schedule
+func (s *ScanService) DeleteSchedule(name string) error {
+	if err := s.checkScheduleWritable(name); err != nil {
+		return err
+	}
+
+	if err := s.db.DeleteSchedule(name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrScheduleNotFound, name)
+		}
+		return err
+	}
+
+	s.scheduler.Remove(name)
+	s.logger.Info().Str("schedule", name).Msg("Schedule deleted")
+
+	return nil
+}
+
+// checkScheduleWritable ensures a schedule exists and is stored in the database
+func (s *ScanService) checkScheduleWritable(name string) error {
+	schedule, exists := s.getSchedules()[name]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrScheduleNotFound, name)
+	}
+
+	if schedule.Source != TemplateSourceDatabase {
+		return fmt.Errorf("%w: %s is a %s schedule", ErrScheduleReadOnly, name, schedule.Source)
+	}
+
+	return nil
+}
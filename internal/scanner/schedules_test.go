@@ -0,0 +1,153 @@
+// internal/scanner/schedules_test.go
+package scanner
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"panopticon-scanner/internal/config"
+	"panopticon-scanner/internal/models"
+)
+
+// TestConfigSchedules tests schedules from the configuration file
+func TestConfigSchedules(t *testing.T) {
+	tempDir, cfg, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	// Without configured schedules the scan frequency is used
+	schedules, err := scanService.GetSchedules()
+	if err != nil {
+		t.Fatalf("Failed to get schedules: %v", err)
+	}
+
+	if len(schedules) != 1 || schedules[0].Name != defaultScheduleName || schedules[0].Cron != "@every "+cfg.Scanner.Frequency {
+		t.Fatalf("Expected the default schedule, got %+v", schedules)
+	}
+
+	cfg.Scanner.Schedules = []config.ScheduleConfig{
+		{Name: "nightly", Cron: "0 2 * * *", Template: "thorough", Blackouts: []config.BlackoutConfig{{Start: "01:00", End: "03:00"}}},
+	}
+	defer func() { cfg.Scanner.Schedules = nil }()
+
+	schedule, err := scanService.GetSchedule("nightly")
+	if err != nil {
+		t.Fatalf("Failed to get schedule: %v", err)
+	}
+
+	if schedule.Source != TemplateSourceConfig || !schedule.Enabled || len(schedule.Blackouts) != 1 {
+		t.Errorf("Unexpected configured schedule: %+v", schedule)
+	}
+
+	if _, err := scanService.GetSchedule(defaultScheduleName); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("Expected configured schedules to replace the default schedule, got %v", err)
+	}
+
+	if err := scanService.DeleteSchedule("nightly"); !errors.Is(err, ErrScheduleReadOnly) {
+		t.Errorf("Expected ErrScheduleReadOnly, got %v", err)
+	}
+}
+
+// TestScheduleCRUD tests creating, updating and deleting schedules
+func TestScheduleCRUD(t *testing.T) {
+	tempDir, cfg, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	cfg.Scanner.EnableScheduler = true
+	defer func() { cfg.Scanner.EnableScheduler = false }()
+
+	created, err := scanService.CreateSchedule(&models.Schedule{
+		Name:     "weekday-quick",
+		Cron:     "*/30 * * * mon-fri",
+		Template: "quick",
+		Jitter:   "5m",
+		Enabled:  true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create schedule: %v", err)
+	}
+
+	if created.Source != TemplateSourceDatabase || created.NextRun == nil || !created.NextRun.After(time.Now()) {
+		t.Errorf("Expected a stored schedule with a next run, got %+v", created)
+	}
+
+	if _, err := scanService.CreateSchedule(created); !errors.Is(err, ErrScheduleExists) {
+		t.Errorf("Expected ErrScheduleExists, got %v", err)
+	}
+
+	// Invalid schedules are rejected with every problem found
+	_, err = scanService.CreateSchedule(&models.Schedule{
+		Name:          "bad",
+		Cron:          "every night",
+		Template:      "missing",
+		TargetNetwork: "8.8.8.8",
+		Jitter:        "a bit",
+		Blackouts:     []models.BlackoutWindow{{Start: "25:00", End: "01:00"}},
+	})
+	var validationErr *ScheduleValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Problems) != 5 {
+		t.Errorf("Expected 5 validation problems, got %v", err)
+	}
+
+	// Disabling a schedule removes its next run
+	created.Enabled = false
+	updated, err := scanService.UpdateSchedule("weekday-quick", created)
+	if err != nil {
+		t.Fatalf("Failed to update schedule: %v", err)
+	}
+
+	if updated.Enabled || updated.NextRun != nil {
+		t.Errorf("Expected a disabled schedule without a next run, got %+v", updated)
+	}
+
+	if err := scanService.DeleteSchedule("weekday-quick"); err != nil {
+		t.Fatalf("Failed to delete schedule: %v", err)
+	}
+
+	if _, err := scanService.GetSchedule("weekday-quick"); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("Expected ErrScheduleNotFound, got %v", err)
+	}
+}
+
+// TestRunSchedule tests that schedules queue scans and record their runs
+func TestRunSchedule(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	schedule := &models.Schedule{Name: "hourly", Cron: "@hourly", Template: "quick", Enabled: true}
+	scheduled := time.Now().Truncate(time.Hour)
+
+	// The worker is not running, so the first scan stays queued
+	scanService.runSchedule(schedule, scheduled)
+	scanService.runSchedule(schedule, scheduled.Add(time.Hour))
+
+	runs, err := scanService.db.GetScheduleRuns("hourly", 10)
+	if err != nil {
+		t.Fatalf("Failed to get schedule runs: %v", err)
+	}
+
+	if len(runs) != 2 {
+		t.Fatalf("Expected 2 runs, got %d", len(runs))
+	}
+
+	if runs[1].Status != "queued" || runs[1].JobID == 0 {
+		t.Errorf("Expected first run to queue a scan, got %+v", runs[1])
+	}
+
+	if runs[0].Status != "skipped" || runs[0].JobID != runs[1].JobID {
+		t.Errorf("Expected second run to be skipped while the first is queued, got %+v", runs[0])
+	}
+
+	jobs, err := scanService.GetScanQueue()
+	if err != nil {
+		t.Fatalf("Failed to get scan queue: %v", err)
+	}
+
+	if len(jobs) != 1 || jobs[0].RequestedBy != "schedule:hourly" || jobs[0].Priority != ScanPriorityScheduled {
+		t.Errorf("Unexpected scan queue: %+v", jobs)
+	}
+}
@@ -0,0 +1,235 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"panopticon-scanner/internal/models"
+)
+
+// Audit log actions for scan requests
+const (
+	AuditScanAuthorized = "scan_authorized"
+	AuditScanRejected   = "scan_rejected"
+)
+
+var (
+	// ErrTargetOutOfScope is returned when a target is outside the authorized scopes
+	ErrTargetOutOfScope = errors.New("target is outside the authorized scope")
+
+	// ErrTargetTooLarge is returned when a target exceeds the configured size limit
+	ErrTargetTooLarge = errors.New("target is too large")
+
+	// ErrUnknownSite is returned when a scan requests a site with no authorized scope
+	ErrUnknownSite = errors.New("unknown site")
+)
+
+// ParseTargets parses a list of targets separated by spaces or commas
+func ParseTargets(spec string) ([]*TargetRange, error) {
+	fields := strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: no target specified", ErrInvalidTarget)
+	}
+
+	targets := make([]*TargetRange, 0, len(fields))
+	for _, field := range fields {
+		target, err := ParseTarget(field)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+// authorizedScopes returns the networks scans for site may target. Without
+// configured scopes only the configured target network is authorized.
+func (s *ScanService) authorizedScopes(site string) ([]*TargetRange, error) {
+	var networks []string
+
+	if len(s.config.Scanner.AuthorizedScopes) == 0 {
+		if site != "" {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownSite, site)
+		}
+		networks = []string{s.config.Scanner.TargetNetwork}
+	} else {
+		found := false
+		for _, scope := range s.config.Scanner.AuthorizedScopes {
+			if site == "" || scope.Site == site {
+				networks = append(networks, scope.Networks...)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownSite, site)
+		}
+	}
+
+	var scopes []*TargetRange
+	for _, network := range networks {
+		targets, err := ParseTargets(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid authorized scope in configuration: %w", err)
+		}
+		scopes = append(scopes, targets...)
+	}
+
+	return scopes, nil
+}
+
+// checkTargets parses a target specification, defaulting to the configured
+// target network, and checks every target against the authorized scopes for
+// site and the target size limit
+func (s *ScanService) checkTargets(spec, site string) ([]*TargetRange, error) {
+	if strings.TrimSpace(spec) == "" {
+		spec = s.config.Scanner.TargetNetwork
+	}
+	if strings.TrimSpace(spec) == "" {
+		return nil, fmt.Errorf("%w: no target network specified", ErrInvalidTarget)
+	}
+
+	targets, err := ParseTargets(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes, err := s.authorizedScopes(site)
+	if err != nil {
+		return nil, err
+	}
+
+	// nmap scans one address family at a time
+	for _, target := range targets[1:] {
+		if target.IsIPv6() != targets[0].IsIPv6() {
+			return nil, fmt.Errorf("%w: IPv4 and IPv6 targets must be scanned separately", ErrInvalidTarget)
+		}
+	}
+
+	// The limit allows the same number of addresses in either family, so the
+	// default /16 for IPv4 is a /112 for IPv6
+	limit := s.config.Scanner.TargetSizeLimit
+	for _, target := range targets {
+		if limit > 0 && target.HostBits() > 32-limit {
+			prefix := limit
+			if target.IsIPv6() {
+				prefix += 128 - 32
+			}
+			return nil, fmt.Errorf("%w: %s is larger than a /%d", ErrTargetTooLarge, target, prefix)
+		}
+
+		inScope := false
+		for _, scope := range scopes {
+			if target.Within(scope) {
+				inScope = true
+				break
+			}
+		}
+		if !inScope {
+			return nil, fmt.Errorf("%w: %s", ErrTargetOutOfScope, target)
+		}
+	}
+
+	return targets, nil
+}
+
+// checkConfigScopes logs authorized scopes in the configuration that are not valid
+func (s *ScanService) checkConfigScopes() {
+	for _, scope := range s.config.Scanner.AuthorizedScopes {
+		for _, network := range scope.Networks {
+			if _, err := ParseTargets(network); err != nil {
+				s.logger.Error().Err(err).Str("site", scope.Site).Str("network", network).Msg("Invalid authorized scope in configuration; scans will be refused until it is fixed")
+			}
+		}
+	}
+}
+
+// authorizeScan checks a scan request against the authorized scopes and
+// records the decision in the audit log. On success the request's targets
+// are replaced with their normalized form.
+func (s *ScanService) authorizeScan(params *models.ScanParameters, requestedBy string) error {
+	targets, err := s.checkTargets(params.TargetNetwork, params.Site)
+
+	entry := &models.AuditEntry{
+		Action: AuditScanAuthorized,
+		Actor:  requestedBy,
+		Target: params.TargetNetwork,
+		Site:   params.Site,
+	}
+	if entry.Target == "" {
+		entry.Target = s.config.Scanner.TargetNetwork
+	}
+
+	if err != nil {
+		entry.Action = AuditScanRejected
+		entry.Reason = err.Error()
+
+		s.logger.Warn().
+			Err(err).
+			Str("target", entry.Target).
+			Str("site", params.Site).
+			Str("requestedBy", requestedBy).
+			Msg("Scan request rejected")
+	} else if params.TargetNetwork != "" {
+		normalized := make([]string, 0, len(targets))
+		for _, target := range targets {
+			normalized = append(normalized, target.String())
+		}
+		params.TargetNetwork = strings.Join(normalized, " ")
+	}
+
+	if _, auditErr := s.db.AddAuditEntry(entry); auditErr != nil {
+		s.logger.Error().Err(auditErr).Str("action", entry.Action).Msg("Failed to write audit log")
+	}
+
+	return err
+}
+
+// GetAuditLog returns the most recent audit log entries
+func (s *ScanService) GetAuditLog(limit int) ([]*models.AuditEntry, error) {
+	return s.db.GetAuditEntries(limit)
+}
+
+// targetArgs returns the nmap target arguments for targets, preceded by -6
+// for IPv6 targets unless the template already selects IPv6
+func targetArgs(template *ScanTemplate, targets []*TargetRange) ([]string, error) {
+	ipv6 := len(targets) > 0 && targets[0].IsIPv6()
+
+	templateIPv6 := false
+	for _, arg := range template.NmapArgs {
+		if arg == "-6" {
+			templateIPv6 = true
+		}
+	}
+
+	var args []string
+	switch {
+	case templateIPv6 && !ipv6:
+		return nil, fmt.Errorf("%w: template %s scans IPv6 only", ErrInvalidTarget, template.Name)
+	case ipv6 && !templateIPv6:
+		args = append(args, "-6")
+	}
+
+	for _, target := range targets {
+		args = append(args, target.NmapSpecs()...)
+	}
+	return args, nil
+}
+
+// isIPv6Scan reports whether a scan of spec, or of the configured target
+// network if spec is empty, is an IPv6 scan. Invalid targets are reported
+// when the scan command is prepared.
+func (s *ScanService) isIPv6Scan(spec string) bool {
+	if strings.TrimSpace(spec) == "" {
+		spec = s.config.Scanner.TargetNetwork
+	}
+
+	targets, err := ParseTargets(spec)
+	if err != nil {
+		return false
+	}
+	return targets[0].IsIPv6()
+}
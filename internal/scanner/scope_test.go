@@ -0,0 +1,140 @@
+// internal/scanner/scope_test.go
+package scanner
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"panopticon-scanner/internal/config"
+	"panopticon-scanner/internal/models"
+)
+
+// TestCheckTargets tests checking targets against the authorized scopes
+func TestCheckTargets(t *testing.T) {
+	tempDir, cfg, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	// Without configured scopes only the target network may be scanned
+	if _, err := scanService.checkTargets("192.168.1.5, 192.168.1.128/25", ""); err != nil {
+		t.Errorf("Expected targets inside the target network to be allowed, got %v", err)
+	}
+
+	if _, err := scanService.checkTargets("192.168.2.1", ""); !errors.Is(err, ErrTargetOutOfScope) {
+		t.Errorf("Expected ErrTargetOutOfScope, got %v", err)
+	}
+
+	cfg.Scanner.AuthorizedScopes = []config.ScopeConfig{{Site: "lab", Networks: []string{"10.0.0.0/8"}}}
+	cfg.Scanner.TargetSizeLimit = 20
+	defer func() {
+		cfg.Scanner.AuthorizedScopes = nil
+		cfg.Scanner.TargetSizeLimit = 16
+	}()
+
+	if _, err := scanService.checkTargets("10.1.0.0/20", "lab"); err != nil {
+		t.Errorf("Expected target within size limit to be allowed, got %v", err)
+	}
+
+	if _, err := scanService.checkTargets("10.1.0.0/19", "lab"); !errors.Is(err, ErrTargetTooLarge) {
+		t.Errorf("Expected ErrTargetTooLarge, got %v", err)
+	}
+
+	if _, err := scanService.checkTargets("10.1.0.1", "office"); !errors.Is(err, ErrUnknownSite) {
+		t.Errorf("Expected ErrUnknownSite, got %v", err)
+	}
+
+	// Scheduled scans of a target network outside the scopes are refused too
+	template, err := scanService.getScanTemplate("default")
+	if err != nil {
+		t.Fatalf("Failed to get template: %v", err)
+	}
+
+	if _, err := scanService.prepareScanCommand(template, "out.xml", ""); !errors.Is(err, ErrTargetOutOfScope) {
+		t.Errorf("Expected ErrTargetOutOfScope for configured target network, got %v", err)
+	}
+
+	// Ranges are passed to nmap as CIDR blocks
+	cmd, err := scanService.prepareManualScanCommand(template, "out.xml", "", models.ScanParameters{TargetNetwork: "10.0.0.1-10.0.0.6"})
+	if err != nil {
+		t.Fatalf("Failed to prepare command: %v", err)
+	}
+
+	if args := strings.Join(cmd.Args, " "); !strings.HasSuffix(args, " 10.0.0.1/32 10.0.0.2/31 10.0.0.4/31 10.0.0.6/32") {
+		t.Errorf("Unexpected nmap targets: %s", args)
+	}
+}
+
+// TestEnqueueScanAudit tests that queued and rejected scans are audited
+func TestEnqueueScanAudit(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	job, err := scanService.EnqueueScan(models.ScanParameters{Template: "default", TargetNetwork: "192.168.1.0-255"}, ScanPriorityManual, "tester", "")
+	if err != nil {
+		t.Fatalf("Failed to queue scan: %v", err)
+	}
+
+	if job.Parameters.TargetNetwork != "192.168.1.0/24" {
+		t.Errorf("Expected normalized target network, got %s", job.Parameters.TargetNetwork)
+	}
+
+	if _, err := scanService.EnqueueScan(models.ScanParameters{Template: "default", TargetNetwork: "1.1.1.1"}, ScanPriorityManual, "tester", ""); !errors.Is(err, ErrTargetOutOfScope) {
+		t.Errorf("Expected ErrTargetOutOfScope, got %v", err)
+	}
+
+	entries, err := scanService.GetAuditLog(10)
+	if err != nil {
+		t.Fatalf("Failed to get audit log: %v", err)
+	}
+
+	if len(entries) != 2 || entries[0].Action != AuditScanRejected || entries[0].Target != "1.1.1.1" || entries[1].Action != AuditScanAuthorized {
+		t.Errorf("Unexpected audit log: %+v", entries)
+	}
+}
+
+// TestCheckTargetsIPv6 tests IPv6 targets in scopes and nmap commands
+func TestCheckTargetsIPv6(t *testing.T) {
+	tempDir, cfg, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	cfg.Scanner.AuthorizedScopes = []config.ScopeConfig{{Site: "hq", Networks: []string{"192.168.1.0/24", "2001:db8::/64"}}}
+	defer func() { cfg.Scanner.AuthorizedScopes = nil }()
+
+	if _, err := scanService.checkTargets("2001:db8::/120", "hq"); err != nil {
+		t.Errorf("Expected IPv6 target within scope to be allowed, got %v", err)
+	}
+
+	// The default size limit allows as many IPv6 addresses as IPv4 ones
+	_, err := scanService.checkTargets("2001:db8::/111", "hq")
+	if !errors.Is(err, ErrTargetTooLarge) || !strings.Contains(err.Error(), "/112") {
+		t.Errorf("Expected ErrTargetTooLarge mentioning /112, got %v", err)
+	}
+
+	if _, err := scanService.checkTargets("192.168.1.1 2001:db8::1", "hq"); !errors.Is(err, ErrInvalidTarget) {
+		t.Errorf("Expected ErrInvalidTarget for mixed address families, got %v", err)
+	}
+
+	template, err := scanService.getScanTemplate("default")
+	if err != nil {
+		t.Fatalf("Failed to get template: %v", err)
+	}
+
+	cmd, err := scanService.prepareManualScanCommand(template, "out.xml", "", models.ScanParameters{TargetNetwork: "2001:0db8::0010", Site: "hq"})
+	if err != nil {
+		t.Fatalf("Failed to prepare command: %v", err)
+	}
+
+	if args := strings.Join(cmd.Args, " "); !strings.HasSuffix(args, " -6 2001:db8::10") {
+		t.Errorf("Expected IPv6 scan of normalized target, got %s", args)
+	}
+
+	// Templates that select IPv6 cannot scan IPv4 targets
+	template.NmapArgs = append(template.NmapArgs, "-6")
+	if _, err := scanService.prepareManualScanCommand(template, "out.xml", "", models.ScanParameters{TargetNetwork: "192.168.1.1", Site: "hq"}); !errors.Is(err, ErrInvalidTarget) {
+		t.Errorf("Expected ErrInvalidTarget for IPv4 target with IPv6 template, got %v", err)
+	}
+}
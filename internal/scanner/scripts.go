@@ -0,0 +1,108 @@
+package scanner
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"panopticon-scanner/internal/models"
+)
+
+// Script represents the output of an NSE script in nmap's XML output
+type Script struct {
+	ID     string        `xml:"id,attr"`
+	Output string        `xml:"output,attr"`
+	Elems  []ScriptElem  `xml:"elem"`
+	Tables []ScriptTable `xml:"table"`
+}
+
+// ScriptElem represents a single value in a script's structured output
+type ScriptElem struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// ScriptTable represents a list or map in a script's structured output
+type ScriptTable struct {
+	Key    string        `xml:"key,attr"`
+	Elems  []ScriptElem  `xml:"elem"`
+	Tables []ScriptTable `xml:"table"`
+}
+
+// scriptResult converts a script from nmap's XML output into a result for
+// storage, encoding its structured output as JSON
+func scriptResult(script Script) *models.ScriptResult {
+	result := &models.ScriptResult{
+		ScriptID: script.ID,
+		Output:   strings.TrimSpace(script.Output),
+	}
+
+	if len(script.Elems) > 0 || len(script.Tables) > 0 {
+		if data, err := json.Marshal(scriptValue(script.Elems, script.Tables)); err == nil {
+			result.Data = data
+		}
+	}
+
+	return result
+}
+
+// scriptValue converts structured script output. Children with keys become
+// an object and children without become an array; in an object, children
+// without a key are keyed by their position.
+func scriptValue(elems []ScriptElem, tables []ScriptTable) interface{} {
+	keyed := false
+	for _, elem := range elems {
+		keyed = keyed || elem.Key != ""
+	}
+	for _, table := range tables {
+		keyed = keyed || table.Key != ""
+	}
+
+	if !keyed {
+		values := make([]interface{}, 0, len(elems)+len(tables))
+		for _, elem := range elems {
+			values = append(values, elem.Value)
+		}
+		for _, table := range tables {
+			values = append(values, scriptValue(table.Elems, table.Tables))
+		}
+		return values
+	}
+
+	object := make(map[string]interface{}, len(elems)+len(tables))
+	position := 0
+	key := func(k string) string {
+		position++
+		if k == "" {
+			return strconv.Itoa(position)
+		}
+		return k
+	}
+	for _, elem := range elems {
+		object[key(elem.Key)] = elem.Value
+	}
+	for _, table := range tables {
+		object[key(table.Key)] = scriptValue(table.Elems, table.Tables)
+	}
+	return object
+}
+
+// saveScriptResults stores the script output for a host or, when port is
+// non-zero, one of its ports
+func (s *ScanService) saveScriptResults(scanID, deviceID int64, port int, protocol string, results []*models.ScriptResult) {
+	for _, r := range results {
+		result := *r
+		result.DeviceID = deviceID
+		result.ScanID = scanID
+		result.PortNumber = port
+		result.Protocol = protocol
+
+		if err := s.db.SaveScriptResult(&result); err != nil {
+			s.logger.Error().Err(err).
+				Int64("deviceID", deviceID).
+				Int("port", port).
+				Str("script", result.ScriptID).
+				Msg("Failed to save script result")
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// internal/scanner/scripts_test.go
+package scanner
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// scriptScanOutput is nmap output with host and port script results
+const scriptScanOutput = `<?xml version="1.0"?>
+<nmaprun>
+<host><status state="up"/>
+<address addr="192.168.1.30" addrtype="ipv4"/>
+<ports>
+<port protocol="tcp" portid="443"><state state="open"/><service name="https"/>
+<script id="ssl-cert" output="Subject: commonName=nas.example.com&#xa;Not valid after: 2030-01-01T00:00:00">
+<table key="subject"><elem key="commonName">nas.example.com</elem></table>
+<table key="extensions">
+<table><elem key="name">X509v3 Subject Alternative Name</elem><elem key="value">DNS:nas.example.com</elem></table>
+</table>
+<elem key="sig_algo">sha256WithRSAEncryption</elem>
+</script>
+</port>
+<port protocol="tcp" portid="8080"><state state="closed"/>
+<script id="http-title" output="Closed ports are not stored"/>
+</port>
+</ports>
+<hostscript>
+<script id="smb-os-discovery" output="OS: Windows Server 2019">
+<elem key="os">Windows Server 2019</elem>
+<elem key="fqdn">nas.example.com</elem>
+</script>
+</hostscript>
+</host>
+</nmaprun>`
+
+// TestScriptValue tests converting structured script output to JSON values
+func TestScriptValue(t *testing.T) {
+	var run NmapRun
+	if err := xml.Unmarshal([]byte(scriptScanOutput), &run); err != nil {
+		t.Fatalf("Failed to parse output: %v", err)
+	}
+
+	result := scriptResult(run.Hosts[0].Ports.Port[0].Scripts[0])
+
+	want := `{"extensions":[{"name":"X509v3 Subject Alternative Name","value":"DNS:nas.example.com"}],"sig_algo":"sha256WithRSAEncryption","subject":{"commonName":"nas.example.com"}}`
+	if string(result.Data) != want {
+		t.Errorf("Unexpected structured output:\n%s\nwant:\n%s", result.Data, want)
+	}
+
+	if result.Output != "Subject: commonName=nas.example.com\nNot valid after: 2030-01-01T00:00:00" {
+		t.Errorf("Unexpected output: %q", result.Output)
+	}
+
+	// Scripts without structured output store only their text
+	if result := scriptResult(Script{ID: "banner", Output: "SSH-2.0-OpenSSH_8.9"}); result.Data != nil {
+		t.Errorf("Expected no structured output, got %s", result.Data)
+	}
+}
+
+// TestProcessScriptResults tests that script output is stored with the host and port
+func TestProcessScriptResults(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	scanID, err := db.CreateScan("scripts")
+	if err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+
+	outputPath := filepath.Join(tempDir, "scripts.xml")
+	if err := ioutil.WriteFile(outputPath, []byte(scriptScanOutput), 0644); err != nil {
+		t.Fatalf("Failed to write scan output: %v", err)
+	}
+
+	// Processing the same output twice keeps one result per script
+	for i := 0; i < 2; i++ {
+		if _, _, err := scanService.processScanResults(scanID, outputPath, nil); err != nil {
+			t.Fatalf("Failed to process scan results: %v", err)
+		}
+	}
+
+	device, err := db.GetDeviceByIP("192.168.1.30")
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+
+	details, err := db.GetDeviceDetails(device.ID)
+	if err != nil {
+		t.Fatalf("Failed to get device details: %v", err)
+	}
+
+	if len(details.Scripts) != 1 || details.Scripts[0].ScriptID != "smb-os-discovery" || details.Scripts[0].ScanID != scanID {
+		t.Errorf("Unexpected host scripts: %+v", details.Scripts)
+	}
+
+	if len(details.Ports) != 1 || len(details.Ports[0].Scripts) != 1 || details.Ports[0].Scripts[0].ScriptID != "ssl-cert" {
+		t.Fatalf("Expected the ssl-cert result on port 443, got %+v", details.Ports)
+	}
+
+	if details.Ports[0].Scripts[0].PortNumber != 443 || details.Ports[0].Scripts[0].Protocol != "tcp" {
+		t.Errorf("Unexpected port script: %+v", details.Ports[0].Scripts[0])
+	}
+}
@@ -0,0 +1,194 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidTarget is returned when a target is not an IP address, CIDR block or range
+var ErrInvalidTarget = errors.New("invalid target")
+
+// TargetRange is a contiguous block of IP addresses given as a single IP,
+// a CIDR block ("192.168.1.0/24") or a range ("192.168.1.10-20" or
+// "192.168.1.10-192.168.1.20")
+type TargetRange struct {
+	Start net.IP
+	End   net.IP
+}
+
+// ParseTarget parses and validates a target specification
+func ParseTarget(spec string) (*TargetRange, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("%w: empty target", ErrInvalidTarget)
+	}
+
+	switch {
+	case strings.Contains(spec, "/"):
+		ip, network, err := net.ParseCIDR(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s is not a valid CIDR block", ErrInvalidTarget, spec)
+		}
+		if ip.To4() != nil {
+			network.IP = network.IP.To4()
+		}
+		return &TargetRange{Start: network.IP, End: lastIP(network)}, nil
+
+	case strings.Contains(spec, "-"):
+		return parseRange(spec)
+
+	default:
+		ip := parseIP(spec)
+		if ip == nil {
+			return nil, fmt.Errorf("%w: %s is not an IP address, CIDR block or range", ErrInvalidTarget, spec)
+		}
+		return &TargetRange{Start: ip, End: ip}, nil
+	}
+}
+
+// parseRange parses "a.b.c.d-e" and "a.b.c.d-e.f.g.h" ranges
+func parseRange(spec string) (*TargetRange, error) {
+	parts := strings.SplitN(spec, "-", 2)
+	start := parseIP(parts[0])
+	if start == nil {
+		return nil, fmt.Errorf("%w: %s does not start with an IP address", ErrInvalidTarget, spec)
+	}
+	if start.To4() == nil {
+		return nil, fmt.Errorf("%w: IPv6 ranges are not supported, use CIDR notation", ErrInvalidTarget)
+	}
+
+	end := parseIP(parts[1])
+	if end == nil {
+		// Short form: the range replaces the last octet
+		last, err := strconv.Atoi(parts[1])
+		if err != nil || last < 0 || last > 255 {
+			return nil, fmt.Errorf("%w: %s has an invalid range end", ErrInvalidTarget, spec)
+		}
+		end = make(net.IP, 4)
+		copy(end, start)
+		end[3] = byte(last)
+	}
+
+	if end.To4() == nil {
+		return nil, fmt.Errorf("%w: %s mixes IPv4 and IPv6 addresses", ErrInvalidTarget, spec)
+	}
+	if bytes.Compare(start, end) > 0 {
+		return nil, fmt.Errorf("%w: %s ends before it starts", ErrInvalidTarget, spec)
+	}
+
+	return &TargetRange{Start: start, End: end}, nil
+}
+
+// parseIP parses an IP address, using the 4-byte form for IPv4
+func parseIP(s string) net.IP {
+	ip := net.ParseIP(strings.TrimSpace(s))
+	if ip == nil {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
+
+// IsIPv6 reports whether the range holds IPv6 addresses
+func (t *TargetRange) IsIPv6() bool {
+	return t.Start.To4() == nil
+}
+
+// Contains reports whether ip is within the range
+func (t *TargetRange) Contains(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	if len(ip) != len(t.Start) {
+		return false
+	}
+	return bytes.Compare(ip, t.Start) >= 0 && bytes.Compare(ip, t.End) <= 0
+}
+
+// Within reports whether the whole range lies inside scope
+func (t *TargetRange) Within(scope *TargetRange) bool {
+	return scope.Contains(t.Start) && scope.Contains(t.End)
+}
+
+// HostBits returns the number of address bits the range spans, so that a /24
+// network or any range of up to 256 addresses spans 8 bits
+func (t *TargetRange) HostBits() int {
+	span := new(big.Int).Sub(new(big.Int).SetBytes(t.End), new(big.Int).SetBytes(t.Start))
+	return span.BitLen()
+}
+
+// String returns the normalized form of the range
+func (t *TargetRange) String() string {
+	if t.Start.Equal(t.End) {
+		return t.Start.String()
+	}
+	if cidrs := t.cidrs(); len(cidrs) == 1 {
+		return cidrs[0]
+	}
+	return t.Start.String() + "-" + t.End.String()
+}
+
+// NmapSpecs returns the range in target formats nmap accepts
+func (t *TargetRange) NmapSpecs() []string {
+	if t.Start.Equal(t.End) {
+		return []string{t.Start.String()}
+	}
+	return t.cidrs()
+}
+
+// cidrs splits the range into the smallest list of CIDR blocks that cover it
+func (t *TargetRange) cidrs() []string {
+	if t.IsIPv6() {
+		// IPv6 ranges are only ever parsed from a single CIDR block
+		for ones := 0; ones <= 128; ones++ {
+			mask := net.CIDRMask(ones, 128)
+			network := &net.IPNet{IP: t.Start.Mask(mask), Mask: mask}
+			if network.IP.Equal(t.Start) && lastIP(network).Equal(t.End) {
+				return []string{network.String()}
+			}
+		}
+		return []string{t.Start.String() + "-" + t.End.String()}
+	}
+
+	start := uint64(binary.BigEndian.Uint32(t.Start))
+	end := uint64(binary.BigEndian.Uint32(t.End))
+
+	var cidrs []string
+	for start <= end {
+		// Largest block aligned at start that does not pass end
+		size := uint64(1)
+		for start%(size*2) == 0 && start+size*2-1 <= end && size < 1<<32 {
+			size *= 2
+		}
+
+		ones := 32
+		for s := size; s > 1; s /= 2 {
+			ones--
+		}
+
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, uint32(start))
+		cidrs = append(cidrs, fmt.Sprintf("%s/%d", ip, ones))
+
+		start += size
+	}
+
+	return cidrs
+}
+
+// lastIP returns the last address in a network
+func lastIP(network *net.IPNet) net.IP {
+	ip := make(net.IP, len(network.IP))
+	for i := range network.IP {
+		ip[i] = network.IP[i] | ^network.Mask[i]
+	}
+	return ip
+}
@@ -0,0 +1,102 @@
+// internal/scanner/targets_test.go
+package scanner
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// TestParseTarget tests parsing and normalizing target specifications
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		spec      string
+		want      string
+		nmapSpecs []string
+	}{
+		{"192.168.1.10", "192.168.1.10", []string{"192.168.1.10"}},
+		{"192.168.1.77/24", "192.168.1.0/24", []string{"192.168.1.0/24"}},
+		{"192.168.1.0-255", "192.168.1.0/24", []string{"192.168.1.0/24"}},
+		{"192.168.1.10-20", "192.168.1.10-192.168.1.20", []string{"192.168.1.10/31", "192.168.1.12/30", "192.168.1.16/30", "192.168.1.20/32"}},
+		{"10.0.0.0-10.0.1.255", "10.0.0.0/23", []string{"10.0.0.0/23"}},
+		{"fe80::1", "fe80::1", []string{"fe80::1"}},
+		{"2001:db8::/64", "2001:db8::/64", []string{"2001:db8::/64"}},
+	}
+
+	for _, tt := range tests {
+		target, err := ParseTarget(tt.spec)
+		if err != nil {
+			t.Errorf("ParseTarget(%q) returned error: %v", tt.spec, err)
+			continue
+		}
+		if got := target.String(); got != tt.want {
+			t.Errorf("ParseTarget(%q) = %s, want %s", tt.spec, got, tt.want)
+		}
+		if got := target.NmapSpecs(); !reflect.DeepEqual(got, tt.nmapSpecs) {
+			t.Errorf("ParseTarget(%q).NmapSpecs() = %v, want %v", tt.spec, got, tt.nmapSpecs)
+		}
+	}
+
+	invalid := []string{"", "plc.local", "192.168.1.300", "192.168.1.20-10", "192.168.1.0/33", "fe80::1-fe80::9", "192.168.1.1-fe80::1"}
+	for _, spec := range invalid {
+		if _, err := ParseTarget(spec); !errors.Is(err, ErrInvalidTarget) {
+			t.Errorf("ParseTarget(%q): expected ErrInvalidTarget, got %v", spec, err)
+		}
+	}
+}
+
+// TestTargetContains tests address membership
+func TestTargetContains(t *testing.T) {
+	target, err := ParseTarget("192.168.1.10-20")
+	if err != nil {
+		t.Fatalf("Failed to parse target: %v", err)
+	}
+
+	for ip, want := range map[string]bool{
+		"192.168.1.10": true,
+		"192.168.1.20": true,
+		"192.168.1.21": false,
+		"10.0.0.15":    false,
+		"fe80::1":      false,
+	} {
+		if got := target.Contains(net.ParseIP(ip)); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+// TestTargetWithin tests range containment and size
+func TestTargetWithin(t *testing.T) {
+	scope, err := ParseTarget("192.168.0.0/16")
+	if err != nil {
+		t.Fatalf("Failed to parse scope: %v", err)
+	}
+
+	tests := []struct {
+		spec     string
+		within   bool
+		hostBits int
+	}{
+		{"192.168.1.1", true, 0},
+		{"192.168.1.0/24", true, 8},
+		{"192.168.1.10-20", true, 4},
+		{"192.168.0.0/16", true, 16},
+		{"192.168.255.0-192.169.0.10", false, 9},
+		{"10.0.0.0/8", false, 24},
+		{"fe80::/64", false, 64},
+	}
+
+	for _, tt := range tests {
+		target, err := ParseTarget(tt.spec)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", tt.spec, err)
+		}
+		if got := target.Within(scope); got != tt.within {
+			t.Errorf("%s.Within(%s) = %v, want %v", tt.spec, scope, got, tt.within)
+		}
+		if got := target.HostBits(); got != tt.hostBits {
+			t.Errorf("%s.HostBits() = %d, want %d", tt.spec, got, tt.hostBits)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package scanner
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"panopticon-scanner/internal/config"
+	"panopticon-scanner/internal/models"
+)
+
+// Template sources, in increasing order of precedence
+const (
+	TemplateSourceBuiltin  = "builtin"
+	TemplateSourceConfig   = "config"
+	TemplateSourceDatabase = "database"
+)
+
+var (
+	// ErrTemplateNotFound is returned when a scan template does not exist
+	ErrTemplateNotFound = errors.New("scan template not found")
+
+	// ErrTemplateExists is returned when creating a template whose name is already taken
+	ErrTemplateExists = errors.New("scan template already exists")
+
+	// ErrTemplateReadOnly is returned when modifying a built-in or configured template
+	ErrTemplateReadOnly = errors.New("scan template is read-only")
+)
+
+// templateNamePattern restricts template names to URL- and filename-safe identifiers
+var templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// ScanTemplate defines a scan configuration template
+type ScanTemplate struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	NmapArgs    []string `yaml:"nmapArgs"`
+	RateLimit   int      `yaml:"rateLimit"`
+	Source      string   `yaml:"-"`
+}
+
+// TemplateValidationError describes why a scan template was rejected
+type TemplateValidationError struct {
+	Template   string
+	Problems   []string
+	Violations []ArgViolation
+}
+
+// Error implements the error interface
+func (e *TemplateValidationError) Error() string {
+	return fmt.Sprintf("invalid scan template %q: %s", e.Template, strings.Join(e.Problems, "; "))
+}
+
+// builtinTemplates returns the templates that ship with the scanner
+func builtinTemplates() map[string]*ScanTemplate {
+	return map[string]*ScanTemplate{
+		"default": {
+			Name:        "default",
+			Description: "Standard network scan, with Windows NetBIOS, SMB and TLS certificate discovery",
+			NmapArgs:    []string{"-sS", "-sV", "-O", "--osscan-limit", "--script", "nbstat,smb-os-discovery,ssl-cert"},
+			RateLimit:   1000,
+			Source:      TemplateSourceBuiltin,
+		},
+		"quick": {
+			Name:        "quick",
+			Description: "Fast scan of common ports",
+			NmapArgs:    []string{"-sS", "-F"},
+			RateLimit:   2000,
+			Source:      TemplateSourceBuiltin,
+		},
+		"thorough": {
+			Name:        "thorough",
+			Description: "Detailed scan of all ports",
+			NmapArgs:    []string{"-sS", "-sV", "-p-", "-O", "--osscan-guess", "--script", "ssl-cert"},
+			RateLimit:   500,
+			Source:      TemplateSourceBuiltin,
+		},
+		"stealth": {
+			Name:        "stealth",
+			Description: "Low-impact scan for sensitive networks",
+			NmapArgs:    []string{"-sS", "-T2", "--max-retries", "1"},
+			RateLimit:   100,
+			Source:      TemplateSourceBuiltin,
+		},
+		"udp": {
+			Name:        "udp",
+			Description: "UDP scan of the most common ports",
+			NmapArgs:    []string{"-sU", "--top-ports", "100", "-sV", "--version-intensity", "0", "--reason"},
+			RateLimit:   500,
+			Source:      TemplateSourceBuiltin,
+		},
+		"sctp": {
+			Name:        "sctp",
+			Description: "SCTP INIT scan of common ports",
+			NmapArgs:    []string{"-sY", "-F", "--reason"},
+			RateLimit:   500,
+			Source:      TemplateSourceBuiltin,
+		},
+	}
+}
+
+// ValidateTemplate checks that a scan template is safe to store and run
+func ValidateTemplate(template *ScanTemplate) error {
+	var problems []string
+
+	if !templateNamePattern.MatchString(template.Name) {
+		problems = append(problems, "name must be 1-64 characters of letters, digits, '-' or '_' and start with a letter or digit")
+	}
+
+	if template.RateLimit < 0 {
+		problems = append(problems, fmt.Sprintf("rate limit must not be negative (got %d)", template.RateLimit))
+	}
+
+	violations := ValidateNmapArgs(template.NmapArgs)
+	for _, violation := range violations {
+		problems = append(problems, violation.String())
+	}
+
+	if len(problems) > 0 {
+		return &TemplateValidationError{Template: template.Name, Problems: problems, Violations: violations}
+	}
+
+	return nil
+}
+
+// loadConfigTemplates validates the templates in the configuration once,
+// when the service is built. It returns the valid templates by name and the
+// validation errors of the others.
+func loadConfigTemplates(cfg *config.Config) (map[string]*ScanTemplate, []*TemplateValidationError) {
+	templates := make(map[string]*ScanTemplate)
+	var invalid []*TemplateValidationError
+
+	for _, tc := range cfg.Scanner.Templates {
+		template := &ScanTemplate{
+			Name:        tc.Name,
+			Description: tc.Description,
+			NmapArgs:    tc.NmapArgs,
+			RateLimit:   tc.RateLimit,
+			Source:      TemplateSourceConfig,
+		}
+
+		var validationErr *TemplateValidationError
+		if err := ValidateTemplate(template); errors.As(err, &validationErr) {
+			invalid = append(invalid, validationErr)
+			continue
+		}
+		templates[tc.Name] = template
+	}
+
+	return templates, invalid
+}
+
+// checkConfigTemplates reports configured templates that violate the
+// template policy. Each is logged with its violations, and an error naming
+// them is returned so the service does not start with templates silently
+// missing.
+func (s *ScanService) checkConfigTemplates() error {
+	if len(s.invalidTemplates) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(s.invalidTemplates))
+	for _, invalid := range s.invalidTemplates {
+		s.logger.Error().
+			Str("template", invalid.Template).
+			Strs("problems", invalid.Problems).
+			Interface("violations", invalid.Violations).
+			Msg("Rejected invalid scan template from configuration")
+		names = append(names, invalid.Template)
+	}
+
+	return fmt.Errorf("invalid scan templates in configuration: %s", strings.Join(names, ", "))
+}
+
+// getScanTemplate retrieves the specified scan template
+func (s *ScanService) getScanTemplate(name string) (*ScanTemplate, error) {
+	templates := s.getTemplates()
+
+	// Find the requested template
+	template, exists := templates[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	// Fall back to the configured rate limit when the template has none
+	if template.RateLimit <= 0 {
+		template.RateLimit = s.config.Scanner.RateLimit
+	}
+
+	return template, nil
+}
+
+// getTemplates returns all available scan templates. Built-in templates are
+// overridden by templates from the configuration file, which are in turn
+// overridden by templates stored in the database.
+func (s *ScanService) getTemplates() map[string]*ScanTemplate {
+	templates := builtinTemplates()
+
+	// Configured templates were validated when the service was built; copy
+	// them so callers can adjust the result
+	for name, configured := range s.configTemplates {
+		template := *configured
+		templates[name] = &template
+	}
+
+	stored, err := s.db.GetScanTemplates()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to load scan templates from database")
+		return templates
+	}
+
+	for _, st := range stored {
+		template := fromModelTemplate(st)
+		if err := ValidateTemplate(template); err != nil {
+			s.logger.Warn().Err(err).Str("template", st.Name).Msg("Ignoring invalid scan template from database")
+			continue
+		}
+		templates[st.Name] = template
+	}
+
+	return templates
+}
+
+// GetScanTemplates returns all available scan templates
+func (s *ScanService) GetScanTemplates() ([]models.ScanTemplate, error) {
+	templates := s.getTemplates()
+	result := make([]models.ScanTemplate, 0, len(templates))
+
+	for id, template := range templates {
+		result = append(result, *toModelTemplate(id, template))
+	}
+
+	// Return templates in a stable order
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result, nil
+}
+
+// GetScanTemplate returns a single scan template by name
+func (s *ScanService) GetScanTemplate(name string) (*models.ScanTemplate, error) {
+	template, exists := s.getTemplates()[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	return toModelTemplate(name, template), nil
+}
+
+// CreateScanTemplate validates and stores a new user-defined scan template
+func (s *ScanService) CreateScanTemplate(template *models.ScanTemplate) (*models.ScanTemplate, error) {
+	candidate := fromModelTemplate(template)
+	if err := ValidateTemplate(candidate); err != nil {
+		return nil, err
+	}
+
+	if _, exists := s.getTemplates()[candidate.Name]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateExists, candidate.Name)
+	}
+
+	if err := s.db.SaveScanTemplate(toModelTemplate(candidate.Name, candidate)); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().Str("template", candidate.Name).Msg("Scan template created")
+
+	return s.GetScanTemplate(candidate.Name)
+}
+
+// UpdateScanTemplate validates and replaces an existing user-defined scan template
+func (s *ScanService) UpdateScanTemplate(name string, template *models.ScanTemplate) (*models.ScanTemplate, error) {
+	if err := s.checkTemplateWritable(name); err != nil {
+		return nil, err
+	}
+
+	candidate := fromModelTemplate(template)
+	candidate.Name = name
+	if err := ValidateTemplate(candidate); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.SaveScanTemplate(toModelTemplate(name, candidate)); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().Str("template", name).Msg("Scan template updated")
+
+	return s.GetScanTemplate(name)
+}
+
+// DeleteScanTemplate removes a user-defined scan template
+func (s *ScanService) DeleteScanTemplate(name string) error {
+	if err := s.checkTemplateWritable(name); err != nil {
+		return err
+	}
+
+	if err := s.db.DeleteScanTemplate(name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+		}
+		return err
+	}
+
+	s.logger.Info().Str("template", name).Msg("Scan template deleted")
+
+	return nil
+}
+
+// checkTemplateWritable ensures a template exists and is stored in the database
+func (s *ScanService) checkTemplateWritable(name string) error {
+	template, exists := s.getTemplates()[name]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	if template.Source != TemplateSourceDatabase {
+		return fmt.Errorf("%w: %s is a %s template", ErrTemplateReadOnly, name, template.Source)
+	}
+
+	return nil
+}
+
+// toModelTemplate converts a scan template to its API representation
+func toModelTemplate(id string, template *ScanTemplate) *models.ScanTemplate {
+	return &models.ScanTemplate{
+		ID:          id,
+		Name:        template.Name,
+		Description: template.Description,
+		NmapArgs:    template.NmapArgs,
+		RateLimit:   template.RateLimit,
+		Source:      template.Source,
+	}
+}
+
+// fromModelTemplate converts a user-defined scan template to the scanner representation
+func fromModelTemplate(template *models.ScanTemplate) *ScanTemplate {
+	return &ScanTemplate{
+		Name:        template.Name,
+		Description: template.Description,
+		NmapArgs:    template.NmapArgs,
+		RateLimit:   template.RateLimit,
+		Source:      TemplateSourceDatabase,
+	}
+}
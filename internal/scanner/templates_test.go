@@ -0,0 +1,173 @@
+// internal/scanner/templates_test.go
+package scanner
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"panopticon-scanner/internal/config"
+	"panopticon-scanner/internal/models"
+)
+
+// TestGetScanTemplateUnknown tests that unknown templates are reported instead of falling back
+func TestGetScanTemplateUnknown(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	_, err := scanService.getScanTemplate("does-not-exist")
+	if !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("Expected ErrTemplateNotFound, got %v", err)
+	}
+}
+
+// TestConfigTemplates tests that templates from the configuration are merged with built-ins
+func TestConfigTemplates(t *testing.T) {
+	tempDir, cfg, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	cfg.Scanner.Templates = []config.ScanTemplateConfig{
+		{Name: "iot-safe", Description: "Gentle scan for IoT", NmapArgs: []string{"-sT", "-T2"}},
+		{Name: "broken", NmapArgs: []string{"-oN", "/tmp/out"}},
+	}
+	defer func() { cfg.Scanner.Templates = nil }()
+
+	// Configured templates are validated when the service is built
+	scanService = New(cfg, db)
+
+	template, err := scanService.getScanTemplate("iot-safe")
+	if err != nil {
+		t.Fatalf("Failed to get configured template: %v", err)
+	}
+
+	if template.Source != TemplateSourceConfig {
+		t.Errorf("Expected source %q, got %q", TemplateSourceConfig, template.Source)
+	}
+
+	// Templates without a rate limit use the configured default
+	if template.RateLimit != cfg.Scanner.RateLimit {
+		t.Errorf("Expected rate limit %d, got %d", cfg.Scanner.RateLimit, template.RateLimit)
+	}
+
+	// Invalid templates are rejected, with their violations, and stop the
+	// service from starting
+	if _, err := scanService.getScanTemplate("broken"); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("Expected invalid configured template to be rejected, got %v", err)
+	}
+	if len(scanService.invalidTemplates) != 1 || scanService.invalidTemplates[0].Template != "broken" ||
+		len(scanService.invalidTemplates[0].Violations) == 0 {
+		t.Errorf("Expected the violations of the broken template, got %+v", scanService.invalidTemplates)
+	}
+	if err := scanService.Start(); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Expected the service to refuse to start, got %v", err)
+	}
+
+	// Changing the configuration afterwards does not change the templates
+	cfg.Scanner.Templates = nil
+	if _, err := scanService.getScanTemplate("iot-safe"); err != nil {
+		t.Errorf("Expected configured templates to be loaded once, got %v", err)
+	}
+
+	// Built-ins are still available
+	if _, err := scanService.getScanTemplate("quick"); err != nil {
+		t.Errorf("Expected built-in template to be available: %v", err)
+	}
+}
+
+// TestScanTemplateCRUD tests creating, updating and deleting user-defined templates
+func TestScanTemplateCRUD(t *testing.T) {
+	tempDir, _, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	created, err := scanService.CreateScanTemplate(&models.ScanTemplate{
+		Name:        "dmz-web",
+		Description: "Web ports in the DMZ",
+		NmapArgs:    []string{"-sS", "-p", "80,443,8080"},
+		RateLimit:   300,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+
+	if created.Source != TemplateSourceDatabase {
+		t.Errorf("Expected source %q, got %q", TemplateSourceDatabase, created.Source)
+	}
+
+	// Creating the same template twice should fail
+	_, err = scanService.CreateScanTemplate(&models.ScanTemplate{Name: "dmz-web", NmapArgs: []string{"-sS"}})
+	if !errors.Is(err, ErrTemplateExists) {
+		t.Errorf("Expected ErrTemplateExists, got %v", err)
+	}
+
+	// Built-in names are taken as well
+	_, err = scanService.CreateScanTemplate(&models.ScanTemplate{Name: "default", NmapArgs: []string{"-sS"}})
+	if !errors.Is(err, ErrTemplateExists) {
+		t.Errorf("Expected ErrTemplateExists for built-in name, got %v", err)
+	}
+
+	// Update the template
+	updated, err := scanService.UpdateScanTemplate("dmz-web", &models.ScanTemplate{
+		Description: "Updated",
+		NmapArgs:    []string{"-sS", "-p", "443"},
+		RateLimit:   200,
+	})
+	if err != nil {
+		t.Fatalf("Failed to update template: %v", err)
+	}
+
+	if updated.RateLimit != 200 || updated.Description != "Updated" {
+		t.Errorf("Template was not updated: %+v", updated)
+	}
+
+	// Built-in templates are read-only
+	if _, err := scanService.UpdateScanTemplate("default", &models.ScanTemplate{NmapArgs: []string{"-sS"}}); !errors.Is(err, ErrTemplateReadOnly) {
+		t.Errorf("Expected ErrTemplateReadOnly, got %v", err)
+	}
+
+	if err := scanService.DeleteScanTemplate("quick"); !errors.Is(err, ErrTemplateReadOnly) {
+		t.Errorf("Expected ErrTemplateReadOnly, got %v", err)
+	}
+
+	// Delete the template
+	if err := scanService.DeleteScanTemplate("dmz-web"); err != nil {
+		t.Fatalf("Failed to delete template: %v", err)
+	}
+
+	if err := scanService.DeleteScanTemplate("dmz-web"); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("Expected ErrTemplateNotFound after delete, got %v", err)
+	}
+}
+
+// TestValidateTemplate tests scan template validation
+func TestValidateTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template ScanTemplate
+		valid    bool
+	}{
+		{"valid", ScanTemplate{Name: "iot-safe", NmapArgs: []string{"-sT"}}, true},
+		{"bad name", ScanTemplate{Name: "../etc", NmapArgs: []string{"-sT"}}, false},
+		{"empty name", ScanTemplate{Name: "", NmapArgs: []string{"-sT"}}, false},
+		{"negative rate", ScanTemplate{Name: "x", RateLimit: -1}, false},
+		{"output file", ScanTemplate{Name: "x", NmapArgs: []string{"-oN", "/tmp/x"}}, false},
+		{"input list", ScanTemplate{Name: "x", NmapArgs: []string{"-iL", "/etc/shadow"}}, false},
+		{"max rate", ScanTemplate{Name: "x", NmapArgs: []string{"--max-rate", "10"}}, false},
+		{"exclude file", ScanTemplate{Name: "x", NmapArgs: []string{"--excludefile", "/tmp/x"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTemplate(&tt.template)
+			if tt.valid && err != nil {
+				t.Errorf("Expected template to be valid, got %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("Expected template to be invalid")
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package scanner
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"panopticon-scanner/internal/oui"
+)
+
+// vendorCache holds the OUI registry loaded from the configured file, so that
+// it is only read again once the file changes
+type vendorCache struct {
+	sync.Mutex
+	registry *oui.Registry
+	path     string
+	modTime  time.Time
+	size     int64
+}
+
+// vendorRegistry returns the registry MAC address vendors are looked up in:
+// the configured OUI database, reloaded if it has changed since it was last
+// read, or the built-in registry if none is configured or it cannot be read
+func (s *ScanService) vendorRegistry() *oui.Registry {
+	path := s.config.Scanner.OUIDatabase
+	if path == "" {
+		return oui.Builtin()
+	}
+
+	s.vendors.Lock()
+	defer s.vendors.Unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		s.logger.Error().Err(err).Str("path", path).Msg("Failed to read OUI database")
+		return s.cachedVendors()
+	}
+	if s.vendors.registry != nil && s.vendors.path == path &&
+		info.ModTime().Equal(s.vendors.modTime) && info.Size() == s.vendors.size {
+		return s.vendors.registry
+	}
+
+	registry, err := oui.Load(path)
+	if err != nil {
+		s.logger.Error().Err(err).Str("path", path).Msg("Failed to load OUI database")
+		return s.cachedVendors()
+	}
+
+	s.vendors.registry = registry
+	s.vendors.path = path
+	s.vendors.modTime = info.ModTime()
+	s.vendors.size = info.Size()
+	s.logger.Info().Str("path", path).Int("assignments", registry.Len()).Msg("Loaded OUI database")
+
+	return registry
+}
+
+// cachedVendors returns the last registry loaded from the configured file, or
+// the built-in registry if none was. The caller holds s.vendors.
+func (s *ScanService) cachedVendors() *oui.Registry {
+	if s.vendors.registry != nil && s.vendors.path == s.config.Scanner.OUIDatabase {
+		return s.vendors.registry
+	}
+	return oui.Builtin()
+}
@@ -0,0 +1,102 @@
+// internal/scanner/vendors_test.go
+package scanner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestProcessScanResultsVendors tests that devices are given the vendor of
+// their MAC address from the OUI database, falling back to nmap's, and that
+// randomized MAC addresses are flagged
+func TestProcessScanResultsVendors(t *testing.T) {
+	tempDir, cfg, db, scanService := setupTestEnvironment(t)
+	defer os.RemoveAll(tempDir)
+	defer db.Close()
+
+	output := `<?xml version="1.0"?>
+<nmaprun>
+<host><status state="up"/>
+<address addr="192.168.1.50" addrtype="ipv4"/>
+<address addr="00:11:22:33:44:50" addrtype="mac" vendor="Nmap Vendor"/>
+</host>
+<host><status state="up"/>
+<address addr="192.168.1.51" addrtype="ipv4"/>
+<address addr="DA:A1:19:0B:2C:3D" addrtype="mac"/>
+</host>
+</nmaprun>`
+
+	scanID, err := db.CreateScan("default")
+	if err != nil {
+		t.Fatalf("Failed to create scan: %v", err)
+	}
+
+	outputPath := filepath.Join(tempDir, "vendors.xml")
+	if err := ioutil.WriteFile(outputPath, []byte(output), 0644); err != nil {
+		t.Fatalf("Failed to write scan output: %v", err)
+	}
+
+	vendor := func(ip string) string {
+		t.Helper()
+		device, err := db.GetDeviceByIP(ip)
+		if err != nil {
+			t.Fatalf("Failed to get device: %v", err)
+		}
+		return device.Vendor
+	}
+
+	// The built-in registry does not know the prefix, so nmap's vendor is kept
+	if _, _, err := scanService.processScanResults(scanID, outputPath, nil); err != nil {
+		t.Fatalf("Failed to process scan results: %v", err)
+	}
+	if got := vendor("192.168.1.50"); got != "Nmap Vendor" {
+		t.Errorf("Expected nmap's vendor, got %q", got)
+	}
+
+	device, err := db.GetDeviceByIP("192.168.1.51")
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if device.Vendor != "" || !device.RandomizedMAC {
+		t.Errorf("Expected a randomized MAC address without a vendor, got %+v", device)
+	}
+
+	// The configured OUI database takes precedence
+	registryPath := filepath.Join(tempDir, "nmap-mac-prefixes")
+	if err := ioutil.WriteFile(registryPath, []byte("001122 Example Corp\n"), 0644); err != nil {
+		t.Fatalf("Failed to write OUI database: %v", err)
+	}
+	cfg.Scanner.OUIDatabase = registryPath
+
+	if _, _, err := scanService.processScanResults(scanID, outputPath, nil); err != nil {
+		t.Fatalf("Failed to process scan results: %v", err)
+	}
+	if got := vendor("192.168.1.50"); got != "Example Corp" {
+		t.Errorf("Expected the OUI database's vendor, got %q", got)
+	}
+
+	// An updated OUI database is reloaded
+	if err := ioutil.WriteFile(registryPath, []byte("001122 Example Corporation\n"), 0644); err != nil {
+		t.Fatalf("Failed to write OUI database: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(registryPath, later, later); err != nil {
+		t.Fatalf("Failed to touch OUI database: %v", err)
+	}
+
+	if _, _, err := scanService.processScanResults(scanID, outputPath, nil); err != nil {
+		t.Fatalf("Failed to process scan results: %v", err)
+	}
+	if got := vendor("192.168.1.50"); got != "Example Corporation" {
+		t.Errorf("Expected the reloaded OUI database's vendor, got %q", got)
+	}
+
+	// A missing OUI database falls back to the built-in registry
+	cfg.Scanner.OUIDatabase = filepath.Join(tempDir, "missing")
+	if registry := scanService.vendorRegistry(); registry.Lookup("00:11:22:33:44:50") != "" {
+		t.Errorf("Expected the built-in registry when the OUI database is missing")
+	}
+}
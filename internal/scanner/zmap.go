@@ -0,0 +1,149 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// zmapImporter reads ZMap's output: either the default list of responding
+// addresses or CSV with a header naming its fields (-O csv)
+type zmapImporter struct{}
+
+// Format implements Importer
+func (zmapImporter) Format() string {
+	return FormatZMap
+}
+
+// Detect implements Importer
+func (zmapImporter) Detect(data []byte) bool {
+	first := firstLine(data)
+	if strings.Contains(first, ",") {
+		for _, field := range strings.Split(first, ",") {
+			if strings.TrimSpace(field) == "saddr" {
+				return true
+			}
+		}
+		return false
+	}
+	return net.ParseIP(first) != nil
+}
+
+// Parse implements Importer
+func (i zmapImporter) Parse(data []byte) (*ScanResults, error) {
+	if strings.Contains(firstLine(data), ",") {
+		return i.parseCSV(data)
+	}
+	return i.parseList(data)
+}
+
+// parseList reads a list of addresses that responded. The list does not say
+// which port was probed, so only the hosts are recorded.
+func (zmapImporter) parseList(data []byte) (*ScanResults, error) {
+	index := newHostIndex()
+
+	err := eachLine(data, func(line string) error {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return nil
+		}
+		if net.ParseIP(line) == nil {
+			return fmt.Errorf("%w: %q is not an IP address", ErrInvalidImport, line)
+		}
+		index.host(line)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ScanResults{Format: FormatZMap, Hosts: index.hosts}, nil
+}
+
+// parseCSV reads CSV output. Rows whose success field is not 1 are skipped;
+// the responding port (sport) is recorded as open when the probe was
+// answered with a SYN-ACK or a UDP reply.
+func (zmapImporter) parseCSV(data []byte) (*ScanResults, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	column := make(map[string]int, len(header))
+	for i, name := range header {
+		column[strings.TrimSpace(name)] = i
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := column[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	index := newHostIndex()
+	var times timeRange
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+
+		if success := field(record, "success"); success != "" && success != "1" && success != "true" {
+			continue
+		}
+
+		ip := field(record, "saddr")
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("%w: invalid address %q", ErrInvalidImport, ip)
+		}
+
+		if ts := field(record, "timestamp_ts"); ts != "" {
+			seen, err := parseUnixTime(ts)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid timestamp %q", ErrInvalidImport, ts)
+			}
+			times.add(seen)
+		}
+
+		index.host(ip)
+
+		sport := field(record, "sport")
+		if sport == "" {
+			continue
+		}
+		number, err := strconv.Atoi(sport)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid port %q", ErrInvalidImport, sport)
+		}
+
+		switch field(record, "classification") {
+		case "synack", "":
+			index.port(ip, number, "tcp").Reason = "syn-ack"
+		case "udp":
+			index.port(ip, number, "udp").Reason = "udp-response"
+		}
+	}
+
+	return &ScanResults{Format: FormatZMap, Start: times.start, End: times.end, Hosts: index.hosts}, nil
+}
+
+// firstLine returns the first non-blank line of data
+func firstLine(data []byte) string {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if trimmed := strings.TrimSpace(string(line)); trimmed != "" {
+			return trimmed
+		}
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+// internal/scheduler/cron_test.go
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestParse tests parsing cron expressions
+func TestParse(t *testing.T) {
+	valid := []string{
+		"0 2 * * *",
+		"*/15 * * * *",
+		"0 9-17 * * mon-fri",
+		"30 1 1,15 * *",
+		"0 0 * jan,jul sun",
+		"0 0 * * 7",
+		"5/10 * * * *",
+		"@daily",
+		"@hourly",
+		"@every 90m",
+	}
+	for _, expr := range valid {
+		if _, err := Parse(expr); err != nil {
+			t.Errorf("Parse(%q) returned error: %v", expr, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@every 10s",
+		"@every soon",
+	}
+	for _, expr := range invalid {
+		if _, err := Parse(expr); !errors.Is(err, ErrInvalidSchedule) {
+			t.Errorf("Parse(%q) expected ErrInvalidSchedule, got %v", expr, err)
+		}
+	}
+}
+
+// TestNext tests finding the next run of a schedule
+func TestNext(t *testing.T) {
+	// Wednesday 10 January 2024, 10:30
+	base := time.Date(2024, 1, 10, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 2 * * *", time.Date(2024, 1, 11, 2, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 10, 10, 45, 0, 0, time.UTC)},
+		{"31 10 * * *", time.Date(2024, 1, 10, 10, 31, 0, 0, time.UTC)},
+		{"0 9 * * mon", time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either one matches
+		{"0 0 13 * fri", time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
+		{"@every 2h", time.Date(2024, 1, 10, 12, 30, 15, 0, time.UTC)},
+		// Never matches
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		schedule, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) returned error: %v", tt.expr, err)
+		}
+		if got := schedule.Next(base); !got.Equal(tt.want) {
+			t.Errorf("Next(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
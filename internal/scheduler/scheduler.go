@@ -0,0 +1,239 @@
+package scheduler
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Reasons passed to Job.Skip when a scheduled run does not happen
+const (
+	SkipBlackout = "blackout window"
+	SkipRunning  = "previous run still in progress"
+)
+
+// idleWait is how long the scheduler sleeps when no job has a next run
+const idleWait = time.Hour
+
+// Job is a named task run on a schedule
+type Job struct {
+	Name      string
+	Schedule  *Schedule
+	Jitter    time.Duration
+	Blackouts []Window
+
+	// RunOnStart runs the job as soon as it is added, then on its schedule
+	RunOnStart bool
+
+	// Run is called in its own goroutine with the time the run was due
+	Run func(ctx context.Context, scheduled time.Time)
+
+	// Skip, if set, is called when a due run is skipped
+	Skip func(scheduled time.Time, reason string)
+}
+
+// entry is a job and the time of its next run
+type entry struct {
+	job  Job
+	next time.Time
+}
+
+// Scheduler runs jobs on their schedules until stopped
+type Scheduler struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	running map[string]bool
+	wake    chan struct{}
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	now     func() time.Time
+	rand    *rand.Rand
+	logger  zerolog.Logger
+}
+
+// New creates a scheduler with no jobs
+func New() *Scheduler {
+	return &Scheduler{
+		entries: make(map[string]*entry),
+		running: make(map[string]bool),
+		wake:    make(chan struct{}, 1),
+		now:     time.Now,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		logger:  log.With().Str("component", "scheduler").Logger(),
+	}
+}
+
+// Set adds a job, replacing any job with the same name
+func (s *Scheduler) Set(job Job) {
+	s.mu.Lock()
+	now := s.now()
+	e := &entry{job: job}
+	if job.RunOnStart {
+		e.next = now
+	} else {
+		e.next = s.nextRun(job, now)
+	}
+	s.entries[job.Name] = e
+	s.mu.Unlock()
+
+	s.signal()
+}
+
+// Remove removes a job. A run already in progress is not interrupted.
+func (s *Scheduler) Remove(name string) {
+	s.mu.Lock()
+	delete(s.entries, name)
+	s.mu.Unlock()
+
+	s.signal()
+}
+
+// NextRun returns when a job will next run
+func (s *Scheduler) NextRun(name string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok || e.next.IsZero() {
+		return time.Time{}, false
+	}
+	return e.next, true
+}
+
+// Start runs jobs as they become due until ctx is cancelled or Stop is called
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.mu.Unlock()
+		return
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.loop(ctx)
+}
+
+// Stop stops the scheduler and waits for running jobs to return
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+}
+
+// loop waits for the next due job, runs it and repeats
+func (s *Scheduler) loop(ctx context.Context) {
+	defer s.wg.Done()
+
+	for {
+		wait := idleWait
+		if next := s.runDue(ctx); !next.IsZero() {
+			wait = next.Sub(s.now())
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// runDue starts every job that is due and returns the earliest next run
+func (s *Scheduler) runDue(ctx context.Context) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var earliest time.Time
+
+	for _, e := range s.entries {
+		if !e.next.IsZero() && !e.next.After(now) {
+			s.fire(ctx, e, now)
+		}
+		if !e.next.IsZero() && (earliest.IsZero() || e.next.Before(earliest)) {
+			earliest = e.next
+		}
+	}
+
+	return earliest
+}
+
+// fire runs a due job unless it is blacked out or still running, and
+// schedules its next run. The caller must hold s.mu.
+func (s *Scheduler) fire(ctx context.Context, e *entry, now time.Time) {
+	scheduled := e.next
+	e.next = s.nextRun(e.job, now)
+
+	reason := ""
+	switch {
+	case inWindow(e.job.Blackouts, now):
+		reason = SkipBlackout
+	case s.running[e.job.Name]:
+		reason = SkipRunning
+	}
+
+	if reason != "" {
+		s.logger.Info().Str("job", e.job.Name).Str("reason", reason).Msg("Skipping scheduled run")
+		if e.job.Skip != nil {
+			go e.job.Skip(scheduled, reason)
+		}
+		return
+	}
+
+	job := e.job
+	s.running[job.Name] = true
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, job.Name)
+			s.mu.Unlock()
+		}()
+
+		s.logger.Info().Str("job", job.Name).Time("scheduled", scheduled).Msg("Running scheduled job")
+		job.Run(ctx, scheduled)
+	}()
+}
+
+// nextRun returns the next run of a job after t, including jitter
+func (s *Scheduler) nextRun(job Job, t time.Time) time.Time {
+	next := job.Schedule.Next(t)
+	if next.IsZero() || job.Jitter <= 0 {
+		return next
+	}
+	return next.Add(time.Duration(s.rand.Int63n(int64(job.Jitter))))
+}
+
+// signal wakes the scheduler loop without blocking
+func (s *Scheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// inWindow reports whether t falls inside any of the windows
+func inWindow(windows []Window, t time.Time) bool {
+	for _, w := range windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+// internal/scheduler/scheduler_test.go
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRunDue tests running due jobs, jitter and blackout windows
+func TestRunDue(t *testing.T) {
+	now := time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC)
+
+	s := New()
+	s.now = func() time.Time { return now }
+
+	hourly, _ := Parse("0 * * * *")
+	blackout, _ := ParseWindow("11:00", "13:00", nil)
+
+	var mu sync.Mutex
+	var runs []string
+	var skips []string
+	done := make(chan struct{}, 10)
+
+	run := func(name string) func(context.Context, time.Time) {
+		return func(ctx context.Context, scheduled time.Time) {
+			mu.Lock()
+			runs = append(runs, name)
+			mu.Unlock()
+			done <- struct{}{}
+		}
+	}
+	skip := func(scheduled time.Time, reason string) {
+		mu.Lock()
+		skips = append(skips, reason)
+		mu.Unlock()
+		done <- struct{}{}
+	}
+
+	s.Set(Job{Name: "immediate", Schedule: hourly, RunOnStart: true, Run: run("immediate")})
+	s.Set(Job{Name: "blacked-out", Schedule: hourly, RunOnStart: true, Blackouts: []Window{blackout}, Run: run("blacked-out"), Skip: skip})
+	s.Set(Job{Name: "later", Schedule: hourly, Jitter: 10 * time.Minute, Run: run("later")})
+
+	next, ok := s.NextRun("later")
+	if !ok || next.Before(now.Add(time.Hour)) || !next.Before(now.Add(70*time.Minute)) {
+		t.Errorf("Expected next run between 13:00 and 13:10, got %v", next)
+	}
+
+	earliest := s.runDue(context.Background())
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for scheduled runs")
+		}
+	}
+	s.wg.Wait()
+
+	mu.Lock()
+	if len(runs) != 1 || runs[0] != "immediate" {
+		t.Errorf("Expected only the immediate job to run, got %v", runs)
+	}
+	if len(skips) != 1 || skips[0] != SkipBlackout {
+		t.Errorf("Expected the blacked-out job to be skipped, got %v", skips)
+	}
+	mu.Unlock()
+
+	if want := now.Add(time.Hour); !earliest.Equal(want) {
+		t.Errorf("Expected earliest next run %v, got %v", want, earliest)
+	}
+
+	if next, _ := s.NextRun("immediate"); !next.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected immediate job to be rescheduled for 13:00, got %v", next)
+	}
+
+	s.Remove("later")
+	if _, ok := s.NextRun("later"); ok {
+		t.Errorf("Expected removed job to have no next run")
+	}
+}
+
+// TestStartStop tests that the scheduler loop runs jobs and stops cleanly
+func TestStartStop(t *testing.T) {
+	s := New()
+	schedule, _ := Parse("@every 1h")
+
+	ran := make(chan struct{}, 1)
+	s.Set(Job{Name: "job", Schedule: schedule, RunOnStart: true, Run: func(ctx context.Context, scheduled time.Time) {
+		ran <- struct{}{}
+	}})
+
+	s.Start(context.Background())
+
+	select {
+	case <-ran:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected job to run on start")
+	}
+
+	s.Stop()
+}
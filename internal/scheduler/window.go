@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a recurring period of the day during which jobs must not run,
+// such as "22:00" to "06:00". Windows that end before they start continue
+// past midnight. If Days is set, the window only starts on those weekdays.
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+	Days  map[time.Weekday]bool
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseWindow parses a blackout window from "HH:MM" start and end times and
+// optional weekday names
+func ParseWindow(start, end string, days []string) (Window, error) {
+	var window Window
+	var err error
+
+	if window.Start, err = parseClock(start); err != nil {
+		return Window{}, err
+	}
+	if window.End, err = parseClock(end); err != nil {
+		return Window{}, err
+	}
+	if window.Start == window.End {
+		return Window{}, fmt.Errorf("%w: blackout window %s-%s is empty", ErrInvalidSchedule, start, end)
+	}
+
+	for _, day := range days {
+		key := strings.ToLower(strings.TrimSpace(day))
+		if len(key) > 3 {
+			key = key[:3]
+		}
+		weekday, ok := weekdays[key]
+		if !ok {
+			return Window{}, fmt.Errorf("%w: %q is not a day of the week", ErrInvalidSchedule, day)
+		}
+		if window.Days == nil {
+			window.Days = make(map[time.Weekday]bool)
+		}
+		window.Days[weekday] = true
+	}
+
+	return window, nil
+}
+
+// parseClock parses a time of day in 24-hour "HH:MM" form
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is not a time of day (HH:MM)", ErrInvalidSchedule, s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t falls inside the window
+func (w Window) Contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End && w.startsOn(t.Weekday())
+	}
+
+	// The window wraps past midnight: it is either in today's window, or
+	// still in the one that started yesterday
+	if offset >= w.Start {
+		return w.startsOn(t.Weekday())
+	}
+	if offset < w.End {
+		return w.startsOn((t.Weekday() + 6) % 7)
+	}
+	return false
+}
+
+// startsOn reports whether the window applies when starting on day
+func (w Window) startsOn(day time.Weekday) bool {
+	return len(w.Days) == 0 || w.Days[day]
+}
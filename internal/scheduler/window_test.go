@@ -0,0 +1,64 @@
+// internal/scheduler/window_test.go
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+// TestWindowContains tests blackout windows, including ones past midnight
+func TestWindowContains(t *testing.T) {
+	overnight, err := ParseWindow("22:00", "06:00", nil)
+	if err != nil {
+		t.Fatalf("Failed to parse window: %v", err)
+	}
+
+	business, err := ParseWindow("09:00", "17:00", []string{"Mon", "tuesday"})
+	if err != nil {
+		t.Fatalf("Failed to parse window: %v", err)
+	}
+
+	fridayNight, err := ParseWindow("22:00", "02:00", []string{"fri"})
+	if err != nil {
+		t.Fatalf("Failed to parse window: %v", err)
+	}
+
+	// Monday 8 January 2024
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		window Window
+		t      time.Time
+		want   bool
+	}{
+		{"overnight late", overnight, at(8, 23, 0), true},
+		{"overnight early", overnight, at(8, 5, 59), true},
+		{"overnight end", overnight, at(8, 6, 0), false},
+		{"overnight day", overnight, at(8, 12, 0), false},
+		{"business monday", business, at(8, 10, 0), true},
+		{"business tuesday", business, at(9, 16, 59), true},
+		{"business wednesday", business, at(10, 10, 0), false},
+		{"friday night", fridayNight, at(12, 23, 0), true},
+		{"friday night into saturday", fridayNight, at(13, 1, 0), true},
+		{"saturday night", fridayNight, at(13, 23, 0), false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.window.Contains(tt.t); got != tt.want {
+			t.Errorf("%s: Contains(%v) = %v, want %v", tt.name, tt.t, got, tt.want)
+		}
+	}
+
+	for _, bad := range [][2]string{{"25:00", "06:00"}, {"22:00", "noon"}, {"10:00", "10:00"}} {
+		if _, err := ParseWindow(bad[0], bad[1], nil); err == nil {
+			t.Errorf("Expected error for window %s-%s", bad[0], bad[1])
+		}
+	}
+
+	if _, err := ParseWindow("10:00", "11:00", []string{"someday"}); err == nil {
+		t.Errorf("Expected error for invalid weekday")
+	}
+}
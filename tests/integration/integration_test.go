@@ -407,8 +407,8 @@ func TestScanWorkflow(t *testing.T) {
 		}
 
 		// Verify response fields
-		if message, ok := response["message"]; !ok || message != "Scan started" {
-			t.Errorf("Expected message 'Scan started', got %v", message)
+		if message, ok := response["message"]; !ok || message != "Scan queued" {
+			t.Errorf("Expected message 'Scan queued', got %v", message)
 		}
 	})
 